@@ -0,0 +1,67 @@
+// mydb 是数据库的命令行工具。
+//
+// 用法：
+//
+//	mydb [-shadow] [-checksums] [-compress] [数据库文件]
+//
+// 不指定文件时使用 data.db，文件名为 :memory: 时使用退出后就丢弃的内存数据库。设置了环境变量 MYDB_PASSPHRASE 时用它作为口令打开加密的数据库，
+// 新建的数据库也会加密。标准输入是终端时进入交互模式，否则把标准输入当作脚本执行，
+// 有语句出错时退出码为 1。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"mySQLite/db"
+	"mySQLite/store"
+)
+
+func main() {
+	shadow := flag.Bool("shadow", false, "create new databases in shadow paging mode")
+	checksums := flag.Bool("checksums", false, "create new databases with page checksums")
+	compress := flag.Bool("compress", false, "create new databases with page compression (requires -shadow)")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: mydb [-shadow] [-checksums] [-compress] [database]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	path := "data.db"
+	if flag.NArg() > 0 {
+		path = flag.Arg(0)
+	}
+
+	opts := store.Options{Shadow: *shadow, Checksums: *checksums, Compress: *compress, Passphrase: os.Getenv("MYDB_PASSPHRASE")}
+	pager, err := store.OpenPagerWithOptions(path, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: cannot open database:", err)
+		os.Exit(1)
+	}
+	d := db.NewDatabase(pager)
+	defer d.Close()
+
+	sh := newShell(d, os.Stdout, os.Stderr)
+	interactive := isTerminal(os.Stdin)
+	if interactive {
+		if home, err := os.UserHomeDir(); err == nil {
+			sh.historyFile = filepath.Join(home, ".mydb_history")
+			sh.loadHistory()
+		}
+		fmt.Printf("mydb shell, database %s\nEnter \".help\" for usage hints.\n", path)
+	}
+	if err := sh.run(os.Stdin, interactive); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	if sh.failed && !interactive {
+		d.Close()
+		os.Exit(1)
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"mySQLite/db"
+)
+
+func (sh *shell) printResult(rs *db.ResultSet) {
+	switch sh.mode {
+	case "csv":
+		printCSV(sh.out, rs)
+	case "json":
+		printJSON(sh.out, rs)
+	default:
+		printTable(sh.out, rs)
+	}
+}
+
+/*
+table 模式把结果画成对齐的表格，数字右对齐：
+
+	+----+-------+
+	| id | name  |
+	+----+-------+
+	|  1 | Alice |
+	+----+-------+
+*/
+func printTable(w io.Writer, rs *db.ResultSet) {
+	widths := make([]int, len(rs.Columns))
+	for i, c := range rs.Columns {
+		widths[i] = utf8.RuneCountInString(c)
+	}
+	cells := make([][]string, len(rs.Rows))
+	for r, row := range rs.Rows {
+		cells[r] = make([]string, len(row))
+		for i, v := range row {
+			cells[r][i] = displayText(v)
+			widths[i] = max(widths[i], utf8.RuneCountInString(cells[r][i]))
+		}
+	}
+
+	var sep strings.Builder
+	sep.WriteString("+")
+	for _, n := range widths {
+		sep.WriteString(strings.Repeat("-", n+2) + "+")
+	}
+	line := func(fields []string, right func(int) bool) {
+		var b strings.Builder
+		b.WriteString("|")
+		for i, f := range fields {
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(f))
+			if right(i) {
+				b.WriteString(" " + pad + f + " |")
+			} else {
+				b.WriteString(" " + f + pad + " |")
+			}
+		}
+		fmt.Fprintln(w, b.String())
+	}
+
+	fmt.Fprintln(w, sep.String())
+	line(rs.Columns, func(int) bool { return false })
+	fmt.Fprintln(w, sep.String())
+	for r, row := range rs.Rows {
+		line(cells[r], func(i int) bool { return row[i].Kind == db.KindInt || row[i].Kind == db.KindFloat })
+	}
+	if len(rs.Rows) > 0 {
+		fmt.Fprintln(w, sep.String())
+	}
+}
+
+// displayText 是值在表格中的写法，BLOB 显示为十六进制字面量，控制字符换成空格
+func displayText(v db.Value) string {
+	if v.Kind == db.KindBlob {
+		return "X'" + hex.EncodeToString([]byte(v.S)) + "'"
+	}
+	return strings.Map(func(r rune) rune {
+		if r < ' ' {
+			return ' '
+		}
+		return r
+	}, v.String())
+}
+
+// csv 模式第一行是列名，NULL 输出为空字段
+func printCSV(w io.Writer, rs *db.ResultSet) {
+	cw := csv.NewWriter(w)
+	cw.Write(rs.Columns)
+	for _, row := range rs.Rows {
+		fields := make([]string, len(row))
+		for i, v := range row {
+			if !v.IsNull() {
+				fields[i] = v.String()
+			}
+		}
+		cw.Write(fields)
+	}
+	cw.Flush()
+}
+
+// json 模式输出一个对象数组，每行一个对象，列按查询中的顺序排列
+func printJSON(w io.Writer, rs *db.ResultSet) {
+	if len(rs.Rows) == 0 {
+		fmt.Fprintln(w, "[]")
+		return
+	}
+	for r, row := range rs.Rows {
+		var b strings.Builder
+		if r == 0 {
+			b.WriteString("[")
+		}
+		b.WriteString("{")
+		for i, v := range row {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(jsonString(rs.Columns[i]) + ":" + jsonValue(v))
+		}
+		b.WriteString("}")
+		if r == len(rs.Rows)-1 {
+			b.WriteString("]")
+		} else {
+			b.WriteString(",")
+		}
+		fmt.Fprintln(w, b.String())
+	}
+}
+
+func jsonValue(v db.Value) string {
+	switch v.Kind {
+	case db.KindNull:
+		return "null"
+	case db.KindInt:
+		return strconv.FormatInt(v.I, 10)
+	case db.KindFloat:
+		if math.IsNaN(v.F) || math.IsInf(v.F, 0) {
+			return "null"
+		}
+		return strconv.FormatFloat(v.F, 'g', -1, 64)
+	case db.KindBlob:
+		return jsonString(hex.EncodeToString([]byte(v.S)))
+	}
+	return jsonString(v.S)
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
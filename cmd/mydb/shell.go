@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"mySQLite/db"
+)
+
+// 历史文件中最多保留的条数
+const maxHistory = 1000
+
+// shell 逐行读取输入，拼成以分号结尾的语句执行；缓冲区为空时以 "." 开头的行是 shell 命令
+type shell struct {
+	db          *db.Database
+	out         io.Writer
+	errOut      io.Writer // 错误信息单独输出，不混进 csv、json 的数据中
+	mode        string    // table、csv 或 json
+	timer       bool
+	history     []string
+	historyFile string // 为空时不保存历史
+	reading     int    // 正在执行的 .read 层数，其中的语句不记入历史
+	failed      bool   // 有语句或命令出错，脚本模式下据此设置退出码
+	quit        bool
+}
+
+func newShell(d *db.Database, out, errOut io.Writer) *shell {
+	return &shell{db: d, out: out, errOut: errOut, mode: "table"}
+}
+
+// run 执行 in 中的全部语句，interactive 为 true 时输出提示符
+func (sh *shell) run(in io.Reader, interactive bool) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var pending strings.Builder
+	prompt := func() {
+		if !interactive {
+			return
+		}
+		if pending.Len() == 0 {
+			fmt.Fprint(sh.out, "mydb> ")
+		} else {
+			fmt.Fprint(sh.out, "   ...> ")
+		}
+	}
+
+	prompt()
+	for !sh.quit && scanner.Scan() {
+		line := scanner.Text()
+		if pending.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ".") {
+			sh.addHistory(strings.TrimSpace(line))
+			sh.command(strings.TrimSpace(line))
+			prompt()
+			continue
+		}
+		pending.WriteString(line)
+		pending.WriteString("\n")
+		stmts, rest := db.SplitStatements(pending.String())
+		for _, stmt := range stmts {
+			sh.addHistory(stmt)
+			sh.execute(stmt)
+		}
+		pending.Reset()
+		if strings.TrimSpace(rest) != "" {
+			pending.WriteString(rest)
+		}
+		prompt()
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if !sh.quit && pending.Len() > 0 {
+		sh.errorf("incomplete statement: %s", strings.TrimSpace(pending.String()))
+	}
+	if interactive && !sh.quit {
+		fmt.Fprintln(sh.out)
+	}
+	return nil
+}
+
+// execute 执行一条 SQL 语句，查询结果按当前输出模式打印
+func (sh *shell) execute(stmt string) {
+	start := time.Now()
+	keyword := strings.ToUpper(strings.Fields(stmt)[0])
+	if keyword == "SELECT" || keyword == "EXPLAIN" || keyword == "PRAGMA" {
+		rs, err := sh.db.Query(stmt)
+		if err != nil {
+			sh.errorf("%v", err)
+		} else {
+			sh.printResult(rs)
+		}
+	} else if err := sh.db.Exec(stmt); err != nil {
+		sh.errorf("%v", err)
+	}
+	if sh.timer {
+		fmt.Fprintf(sh.out, "Run Time: %.6fs\n", time.Since(start).Seconds())
+	}
+}
+
+func (sh *shell) errorf(format string, args ...any) {
+	sh.failed = true
+	fmt.Fprintf(sh.errOut, "Error: "+format+"\n", args...)
+}
+
+const helpText = `.help                  Show this message
+.tables                List tables
+.schema [TABLE]        Show CREATE statements
+.dump [TABLE...]       Write the database (or some tables) as SQL statements
+.indexes [TABLE]       List indexes
+.import FILE TABLE     Import CSV data from FILE into TABLE
+.export TABLE FILE     Export TABLE to FILE as CSV
+.backup FILE           Copy the database to FILE while it stays in use
+.mode [MODE]           Set output mode: table, csv or json
+.timer on|off          Show the run time of each statement
+.read FILE             Execute statements from FILE
+.history               Show previous statements
+.quit                  Exit this program
+`
+
+// command 执行一条 shell 命令
+func (sh *shell) command(line string) {
+	args := strings.Fields(line)
+	switch args[0] {
+	case ".help":
+		fmt.Fprint(sh.out, helpText)
+	case ".quit", ".exit":
+		sh.quit = true
+	case ".tables":
+		sh.listNames("table", args[1:])
+	case ".indexes", ".indices":
+		sh.listNames("index", args[1:])
+	case ".schema":
+		sql := "SELECT sql FROM mydb_master"
+		if len(args) > 1 {
+			sql += " WHERE tbl_name = " + quote(args[1])
+		}
+		rs, err := sh.db.Query(sql + " ORDER BY type DESC, name;")
+		if err != nil {
+			sh.errorf("%v", err)
+			return
+		}
+		for _, row := range rs.Rows {
+			fmt.Fprintln(sh.out, row[0].String()+";")
+		}
+	case ".dump":
+		if err := sh.db.Dump(sh.out, args[1:]...); err != nil {
+			sh.errorf("%v", err)
+		}
+	case ".import":
+		if len(args) != 3 {
+			sh.errorf("usage: .import FILE TABLE")
+			return
+		}
+		f, err := os.Open(args[1])
+		if err != nil {
+			sh.errorf("%v", err)
+			return
+		}
+		defer f.Close()
+		if _, err := sh.db.ImportCSV(f, args[2]); err != nil {
+			sh.errorf("%s: %v", args[1], err)
+		}
+	case ".export":
+		if len(args) != 3 {
+			sh.errorf("usage: .export TABLE FILE")
+			return
+		}
+		f, err := os.Create(args[2])
+		if err != nil {
+			sh.errorf("%v", err)
+			return
+		}
+		_, err = sh.db.ExportCSV(f, args[1])
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			sh.errorf("%v", err)
+		}
+	case ".backup":
+		if len(args) != 2 {
+			sh.errorf("usage: .backup FILE")
+			return
+		}
+		if err := sh.db.Backup(args[1]); err != nil {
+			sh.errorf("%v", err)
+		}
+	case ".mode":
+		if len(args) == 1 {
+			fmt.Fprintln(sh.out, "current output mode:", sh.mode)
+			return
+		}
+		switch args[1] {
+		case "table", "csv", "json":
+			sh.mode = args[1]
+		default:
+			sh.errorf("unknown mode %q, use table, csv or json", args[1])
+		}
+	case ".timer":
+		if len(args) != 2 || (args[1] != "on" && args[1] != "off") {
+			sh.errorf("usage: .timer on|off")
+			return
+		}
+		sh.timer = args[1] == "on"
+	case ".read":
+		if len(args) != 2 {
+			sh.errorf("usage: .read FILE")
+			return
+		}
+		f, err := os.Open(args[1])
+		if err != nil {
+			sh.errorf("%v", err)
+			return
+		}
+		defer f.Close()
+		sh.reading++
+		defer func() { sh.reading-- }()
+		if err := sh.run(f, false); err != nil {
+			sh.errorf("%v", err)
+		}
+		// 文件中的 .quit 只结束这个文件
+		sh.quit = false
+	case ".history":
+		for i, h := range sh.history {
+			fmt.Fprintf(sh.out, "%5d  %s\n", i+1, h)
+		}
+	default:
+		sh.errorf("unknown command %s, enter \".help\" for usage hints", args[0])
+	}
+}
+
+// listNames 列出某一类对象的名字，可以只列出属于某个表的
+func (sh *shell) listNames(typ string, args []string) {
+	sql := "SELECT name FROM mydb_master WHERE type = " + quote(typ)
+	if len(args) > 0 {
+		sql += " AND tbl_name = " + quote(args[0])
+	}
+	rs, err := sh.db.Query(sql + " ORDER BY name;")
+	if err != nil {
+		sh.errorf("%v", err)
+		return
+	}
+	var names []string
+	for _, row := range rs.Rows {
+		names = append(names, row[0].String())
+	}
+	if len(names) > 0 {
+		fmt.Fprintln(sh.out, strings.Join(names, "  "))
+	}
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// addHistory 记录一条输入，多行语句合成一行，交互模式下同时追加到历史文件
+func (sh *shell) addHistory(entry string) {
+	if sh.reading > 0 {
+		return
+	}
+	entry = strings.Join(strings.Fields(entry), " ")
+	if n := len(sh.history); n > 0 && sh.history[n-1] == entry {
+		return
+	}
+	sh.history = append(sh.history, entry)
+	if len(sh.history) > maxHistory {
+		sh.history = sh.history[len(sh.history)-maxHistory:]
+	}
+	if sh.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(sh.historyFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(f, entry)
+	f.Close()
+}
+
+// loadHistory 读入上次保存的历史，文件过长时只保留最后 maxHistory 条
+func (sh *shell) loadHistory() {
+	data, err := os.ReadFile(sh.historyFile)
+	if err != nil {
+		return
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+		os.WriteFile(sh.historyFile, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	}
+	for _, l := range lines {
+		if l != "" {
+			sh.history = append(sh.history, l)
+		}
+	}
+}
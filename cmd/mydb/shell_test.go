@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mySQLite/db"
+	"mySQLite/store"
+)
+
+// 在临时目录中的数据库上运行一段脚本，返回 shell 的输出和错误输出
+func runScript(t *testing.T, script string) (string, string, *shell) {
+	t.Helper()
+	pager, err := store.OpenPager(filepath.Join(t.TempDir(), "shell.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pager.Close() })
+	var out, errOut bytes.Buffer
+	sh := newShell(db.NewDatabase(pager), &out, &errOut)
+	if err := sh.run(strings.NewReader(script), false); err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), errOut.String(), sh
+}
+
+const usersScript = `CREATE TABLE users(id INT, name TEXT, score REAL);
+INSERT INTO users VALUES (1, 'Ali;ce', 1.5),
+  (2, 'Bob', NULL); INSERT INTO users VALUES (3, 'Carol', 10);
+CREATE INDEX users_name ON users(name);
+`
+
+func TestShellOutputModes(t *testing.T) {
+	out, errs, sh := runScript(t, usersScript+`SELECT id, name, score
+FROM users
+WHERE id < 3;
+.mode csv
+SELECT * FROM users ORDER BY id;
+.mode json
+SELECT id, name, score FROM users WHERE id <> 3;
+`)
+	if sh.failed {
+		t.Fatalf("script failed:\n%s", errs)
+	}
+	want := `+----+--------+-------+
+| id | name   | score |
++----+--------+-------+
+|  1 | Ali;ce |   1.5 |
+|  2 | Bob    | NULL  |
++----+--------+-------+
+id,name,score
+1,Ali;ce,1.5
+2,Bob,
+3,Carol,10.0
+[{"id":1,"name":"Ali;ce","score":1.5},
+{"id":2,"name":"Bob","score":null}]
+`
+	if out != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestShellCommands(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "more.sql")
+	os.WriteFile(script, []byte("CREATE TABLE tags(name TEXT);\nINSERT INTO tags VALUES ('x');\n"), 0644)
+
+	out, errs, sh := runScript(t, usersScript+`.read `+script+`
+.tables
+.indexes users
+.schema users
+.dump tags
+.mode csv
+SELECT COUNT(*) FROM tags;
+.quit
+SELECT * FROM users;
+`)
+	if sh.failed {
+		t.Fatalf("script failed:\n%s", errs)
+	}
+	want := `tags  users
+users_name
+CREATE TABLE users(id INT, name TEXT, score REAL);
+CREATE INDEX users_name ON users(name);
+BEGIN TRANSACTION;
+CREATE TABLE tags(name TEXT);
+INSERT INTO tags VALUES ('x');
+COMMIT;
+COUNT(*)
+1
+`
+	if out != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+	if n := len(sh.history); n != 12 || sh.history[1] != "INSERT INTO users VALUES (1, 'Ali;ce', 1.5), (2, 'Bob', NULL);" {
+		t.Errorf("history = %q", sh.history)
+	}
+}
+
+func TestShellReadQuit(t *testing.T) {
+	// .read 的文件中的 .quit 只结束这个文件，后面的输入照常执行
+	script := filepath.Join(t.TempDir(), "quit.sql")
+	os.WriteFile(script, []byte("INSERT INTO t VALUES (1);\n.quit\nINSERT INTO t VALUES (2);\n"), 0644)
+	out, errs, sh := runScript(t, "CREATE TABLE t(id INT);\n.read "+script+"\n.mode csv\nSELECT id FROM t;\n.quit\nSELECT 1;\n")
+	if sh.failed || out != "id\n1\n" {
+		t.Errorf("output = %q, errors = %q", out, errs)
+	}
+}
+
+func TestShellErrors(t *testing.T) {
+	out, errs, sh := runScript(t, ".mode xml\nSELECT * FROM missing;\nSELECT 1")
+	if !sh.failed {
+		t.Errorf("errors should mark the script as failed")
+	}
+	for _, msg := range []string{`unknown mode "xml"`, "no such table: missing", "incomplete statement: SELECT 1"} {
+		if !strings.Contains(errs, msg) {
+			t.Errorf("error output %q should contain %q", errs, msg)
+		}
+	}
+	if out != "" {
+		t.Errorf("errors written to the output: %q", out)
+	}
+}
+
+func TestShellWriteErrors(t *testing.T) {
+	// 写语句出错时脚本失败，出错的语句整条回滚；错误不混进 csv 输出
+	out, errs, sh := runScript(t, "CREATE TABLE t(id INT, v TEXT);\n.mode csv\nINSERT INTO t VALUES (1, 'a'), (2);\nSELECT COUNT(*) FROM t;\n")
+	if !sh.failed {
+		t.Errorf("a failed INSERT should mark the script as failed")
+	}
+	if !strings.Contains(errs, "Error: row 2: table t has 2 columns but 1 values") || out != "COUNT(*)\n0\n" {
+		t.Errorf("output = %q, errors = %q", out, errs)
+	}
+}
+
+func TestShellOnlyWritesToOut(t *testing.T) {
+	// 数据库的状态信息不能混进标准输出，否则 .mode csv/json 的输出被破坏
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	out, _, sh := runScript(t, usersScript+".mode csv\nDELETE FROM users WHERE id = 2;\nSELECT id FROM users;\n")
+	os.Stdout = stdout
+	w.Close()
+	leaked, _ := io.ReadAll(r)
+	if sh.failed || out != "id\n1\n3\n" || len(leaked) > 0 {
+		t.Errorf("output %q, written to stdout %q", out, leaked)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	stmts, rest := db.SplitStatements("SELECT ';'; -- a; comment\nSELECT \"a;b\" FROM t;;\nSELECT")
+	if len(stmts) != 2 || stmts[0] != "SELECT ';';" || !strings.HasSuffix(stmts[1], "FROM t;") {
+		t.Errorf("statements = %q", stmts)
+	}
+	if rest != "SELECT" {
+		t.Errorf("rest = %q", rest)
+	}
+}
+
+func TestShellImportExport(t *testing.T) {
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "in.csv"), filepath.Join(dir, "out.csv")
+	os.WriteFile(in, []byte("id,name\n1,a\n2,b\n"), 0644)
+
+	_, errs, sh := runScript(t, ".import "+in+" t\n.export t "+out+"\n.import missing.csv t\n")
+	if !strings.Contains(errs, "Error: open missing.csv") || strings.Count(errs, "Error") != 1 {
+		t.Errorf("error output = %q", errs)
+	}
+	if !sh.failed {
+		t.Errorf("a failed import should mark the script as failed")
+	}
+	data, err := os.ReadFile(out)
+	if err != nil || string(data) != "id,name\n1,a\n2,b\n" {
+		t.Errorf("exported %q, %v", data, err)
+	}
+}
@@ -0,0 +1,438 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// isAggregateCall 判断函数调用是否为聚合函数（单参数的 MIN/MAX 才是聚合）
+func isAggregateCall(fc *FuncCall) bool {
+	switch fc.Name {
+	case "COUNT", "SUM", "AVG", "GROUP_CONCAT":
+		return true
+	case "MIN", "MAX":
+		return len(fc.Args) == 1
+	}
+	return false
+}
+
+// collectAggregates 按出现顺序收集表达式中的聚合调用
+func collectAggregates(e Expr, out []*FuncCall) ([]*FuncCall, error) {
+	switch e := e.(type) {
+	case nil, *Literal, *ColumnRef:
+	case *UnaryExpr:
+		return collectAggregates(e.X, out)
+	case *BinaryExpr:
+		out, err := collectAggregates(e.Left, out)
+		if err != nil {
+			return nil, err
+		}
+		return collectAggregates(e.Right, out)
+	case *IsNullExpr:
+		return collectAggregates(e.X, out)
+	case *InExpr:
+		out, err := collectAggregates(e.X, out)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range e.List {
+			if out, err = collectAggregates(item, out); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case *BetweenExpr:
+		for _, x := range []Expr{e.X, e.Low, e.High} {
+			var err error
+			if out, err = collectAggregates(x, out); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case *FuncCall:
+		if !isAggregateCall(e) {
+			for _, a := range e.Args {
+				var err error
+				if out, err = collectAggregates(a, out); err != nil {
+					return nil, err
+				}
+			}
+			return out, nil
+		}
+		for _, a := range e.Args {
+			nested, err := collectAggregates(a, nil)
+			if err != nil {
+				return nil, err
+			}
+			if len(nested) > 0 {
+				return nil, fmt.Errorf("misuse of aggregate function %s()", nested[0].Name)
+			}
+		}
+		if err := checkAggregateArgs(e); err != nil {
+			return nil, err
+		}
+		return append(out, e), nil
+	}
+	return out, nil
+}
+
+func checkAggregateArgs(fc *FuncCall) error {
+	n := len(fc.Args)
+	ok := true
+	switch fc.Name {
+	case "COUNT":
+		ok = fc.Star && !fc.Distinct || n == 1
+	case "GROUP_CONCAT":
+		ok = n == 1 || n == 2 && !fc.Distinct
+	default:
+		ok = n == 1
+	}
+	if !ok {
+		return fmt.Errorf("wrong number of arguments to function %s()", fc.Name)
+	}
+	return nil
+}
+
+// accumulator 累积一组行上某个聚合函数的状态
+type accumulator interface {
+	add(args []Value)
+	result() Value
+}
+
+func newAccumulator(fc *FuncCall) accumulator {
+	var acc accumulator
+	switch fc.Name {
+	case "COUNT":
+		acc = &countAcc{star: fc.Star}
+	case "SUM":
+		acc = &sumAcc{}
+	case "AVG":
+		acc = &avgAcc{}
+	case "MIN":
+		acc = &minMaxAcc{max: false}
+	case "MAX":
+		acc = &minMaxAcc{max: true}
+	case "GROUP_CONCAT":
+		acc = &groupConcatAcc{}
+	}
+	if fc.Distinct {
+		acc = &distinctAcc{inner: acc, seen: map[string]bool{}}
+	}
+	return acc
+}
+
+type countAcc struct {
+	star bool
+	n    int64
+}
+
+func (a *countAcc) add(args []Value) {
+	if a.star || !args[0].IsNull() {
+		a.n++
+	}
+}
+
+func (a *countAcc) result() Value { return IntValue(a.n) }
+
+// sumAcc 全为整数时结果为整数（溢出后转为浮点），没有非 NULL 值时结果为 NULL
+type sumAcc struct {
+	seen    bool
+	isFloat bool
+	i       int64
+	f       float64
+}
+
+func (a *sumAcc) add(args []Value) {
+	v := args[0]
+	if v.IsNull() {
+		return
+	}
+	a.seen = true
+	n := toNumeric(v)
+	// 非数值文本按 0.0 计入，结果随之变为浮点
+	_, numericText := parseNumber(v.S)
+	asFloat := !v.isNumeric() && !numericText
+	if !a.isFloat && !asFloat && n.Kind == KindInt {
+		sum := a.i + n.I
+		// 有符号溢出检测
+		if (n.I > 0 && sum < a.i) || (n.I < 0 && sum > a.i) {
+			a.isFloat = true
+			a.f = float64(a.i) + float64(n.I)
+			return
+		}
+		a.i = sum
+		return
+	}
+	if !a.isFloat {
+		a.isFloat = true
+		a.f = float64(a.i)
+	}
+	a.f += n.toFloat()
+}
+
+func (a *sumAcc) result() Value {
+	if !a.seen {
+		return Null
+	}
+	if a.isFloat {
+		return FloatValue(a.f)
+	}
+	return IntValue(a.i)
+}
+
+type avgAcc struct {
+	n   int64
+	sum float64
+}
+
+func (a *avgAcc) add(args []Value) {
+	if args[0].IsNull() {
+		return
+	}
+	a.n++
+	a.sum += toNumeric(args[0]).toFloat()
+}
+
+func (a *avgAcc) result() Value {
+	if a.n == 0 {
+		return Null
+	}
+	return FloatValue(a.sum / float64(a.n))
+}
+
+type minMaxAcc struct {
+	max  bool
+	seen bool
+	best Value
+}
+
+func (a *minMaxAcc) add(args []Value) {
+	v := args[0]
+	if v.IsNull() {
+		return
+	}
+	c := compareValues(v, a.best)
+	if !a.seen || (a.max && c > 0) || (!a.max && c < 0) {
+		a.best = v
+		a.seen = true
+	}
+}
+
+func (a *minMaxAcc) result() Value {
+	if !a.seen {
+		return Null
+	}
+	return a.best
+}
+
+type groupConcatAcc struct {
+	seen bool
+	sb   strings.Builder
+}
+
+func (a *groupConcatAcc) add(args []Value) {
+	if args[0].IsNull() {
+		return
+	}
+	if a.seen {
+		sep := ","
+		if len(args) > 1 {
+			sep = args[1].storageString()
+		}
+		a.sb.WriteString(sep)
+	}
+	a.seen = true
+	a.sb.WriteString(args[0].String())
+}
+
+func (a *groupConcatAcc) result() Value {
+	if !a.seen {
+		return Null
+	}
+	return TextValue(a.sb.String())
+}
+
+// distinctAcc 只把第一次出现的值交给内部累加器
+type distinctAcc struct {
+	inner accumulator
+	seen  map[string]bool
+}
+
+func (a *distinctAcc) add(args []Value) {
+	if args[0].IsNull() {
+		return
+	}
+	k := args[0].groupKey()
+	if a.seen[k] {
+		return
+	}
+	a.seen[k] = true
+	a.inner.add(args)
+}
+
+func (a *distinctAcc) result() Value { return a.inner.result() }
+
+// aggGroup 是一个分组：分组键、组内第一行（用于求值非聚合列）以及各聚合累加器
+type aggGroup struct {
+	key     []Value
+	hashKey string // 流式聚合中区分存储形式相同的组，见 streamAggregate
+	first   []Value
+	accs    []accumulator
+}
+
+type aggPlan struct {
+	cols      []colInfo
+	groupBy   []Expr
+	calls     []*FuncCall
+	streaming bool
+}
+
+func (plan *aggPlan) newGroup(key, row []Value) *aggGroup {
+	g := &aggGroup{key: key, first: row, accs: make([]accumulator, len(plan.calls))}
+	for i, fc := range plan.calls {
+		g.accs[i] = newAccumulator(fc)
+	}
+	return g
+}
+
+func (plan *aggPlan) accumulate(g *aggGroup, ctx *evalContext) error {
+	for i, fc := range plan.calls {
+		args := make([]Value, len(fc.Args))
+		for j, a := range fc.Args {
+			v, err := evalExpr(a, ctx)
+			if err != nil {
+				return err
+			}
+			args[j] = v
+		}
+		if fc.Star {
+			args = []Value{Null}
+		}
+		g.accs[i].add(args)
+	}
+	return nil
+}
+
+func (plan *aggPlan) groupKey(ctx *evalContext) ([]Value, string, error) {
+	key := make([]Value, len(plan.groupBy))
+	var sb strings.Builder
+	for i, e := range plan.groupBy {
+		v, err := evalExpr(e, ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		key[i] = v
+		sb.WriteString(v.groupKey())
+		sb.WriteByte(0)
+	}
+	return key, sb.String(), nil
+}
+
+// aggregate 消费 source 中的行并按组回调 emit。
+// 输入已按分组键有序时使用流式聚合（只保留当前存储形式的组），否则使用哈希聚合。
+func (plan *aggPlan) aggregate(source rowSource, emit func(g *aggGroup) error) error {
+	if plan.streaming {
+		return plan.streamAggregate(source, emit)
+	}
+	return plan.hashAggregate(source, emit)
+}
+
+func (plan *aggPlan) hashAggregate(source rowSource, emit func(g *aggGroup) error) error {
+	groups := map[string]*aggGroup{}
+	var order []*aggGroup
+	err := source(func(row []Value) error {
+		ctx := &evalContext{cols: plan.cols, row: row}
+		key, hk, err := plan.groupKey(ctx)
+		if err != nil {
+			return err
+		}
+		g, ok := groups[hk]
+		if !ok {
+			g = plan.newGroup(key, row)
+			groups[hk] = g
+			order = append(order, g)
+		}
+		return plan.accumulate(g, ctx)
+	})
+	if err != nil {
+		return err
+	}
+	// 没有 GROUP BY 时，即使没有输入行也输出一组（例如 COUNT(*) = 0）
+	if len(order) == 0 && len(plan.groupBy) == 0 {
+		order = append(order, plan.newGroup(nil, make([]Value, len(plan.cols))))
+	}
+	for _, g := range order {
+		if err := emit(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamAggregate 的输入按表的 key 有序，相同存储形式的行相邻。NULL 与 ” 的存储形式相同，
+// 在输入中交错出现，所以只保留当前存储形式的几个组，存储形式变化时依次输出
+func (plan *aggPlan) streamAggregate(source rowSource, emit func(g *aggGroup) error) error {
+	var run []*aggGroup // 当前存储形式的组，按第一次出现的先后
+	var runKey string
+	flush := func() error {
+		for _, g := range run {
+			if err := emit(g); err != nil {
+				return err
+			}
+		}
+		run = run[:0]
+		return nil
+	}
+	err := source(func(row []Value) error {
+		ctx := &evalContext{cols: plan.cols, row: row}
+		key, hk, err := plan.groupKey(ctx)
+		if err != nil {
+			return err
+		}
+		stored := storedGroupKey(key)
+		if len(run) > 0 && stored != runKey {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		runKey = stored
+		var cur *aggGroup
+		for _, g := range run {
+			if g.hashKey == hk {
+				cur = g
+				break
+			}
+		}
+		if cur == nil {
+			cur = plan.newGroup(key, row)
+			cur.hashKey = hk
+			run = append(run, cur)
+		}
+		return plan.accumulate(cur, ctx)
+	})
+	if err != nil {
+		return err
+	}
+	if len(run) == 0 && len(plan.groupBy) == 0 {
+		run = append(run, plan.newGroup(nil, make([]Value, len(plan.cols))))
+	}
+	return flush()
+}
+
+// storedGroupKey 返回分组键在表中的存储形式，输入按它有序
+func storedGroupKey(key []Value) string {
+	var sb strings.Builder
+	for _, v := range key {
+		sb.WriteString(v.storageString())
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
+
+func (g *aggGroup) results(plan *aggPlan) map[*FuncCall]Value {
+	m := make(map[*FuncCall]Value, len(plan.calls))
+	for i, fc := range plan.calls {
+		m[fc] = g.accs[i].result()
+	}
+	return m
+}
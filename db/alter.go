@@ -0,0 +1,98 @@
+package db
+
+import (
+	"fmt"
+	"mySQLite/store"
+	"strings"
+)
+
+// ALTER TABLE tab ADD COLUMN / RENAME TO / RENAME COLUMN
+// 已有记录不需要改写：ADD COLUMN 之前的记录字段较少，读取时缺少的列取默认值。
+func (db *Database) alterTable(sql string) error {
+	stmt, err := parseAlterTable(sql)
+	if err != nil {
+		return fmt.Errorf("invalid ALTER TABLE syntax: %w", err)
+	}
+	table, ok := db.Tables[stmt.Table]
+	if !ok {
+		return fmt.Errorf("no such table: %s", stmt.Table)
+	}
+
+	// 在副本上修改，元数据写入成功后才替换内存中的表
+	updated := table.clone()
+	switch stmt.Action {
+	case "ADD COLUMN":
+		err = updated.addColumn(stmt.Column)
+	case "RENAME TO":
+		if isReservedName(stmt.NewName) {
+			err = fmt.Errorf("object name reserved for internal use: %s", stmt.NewName)
+		} else if _, exists := db.Tables[stmt.NewName]; exists && !strings.EqualFold(stmt.NewName, table.Name) {
+			err = fmt.Errorf("there is already another table named %s", stmt.NewName)
+		} else if _, exists := db.Indexes[stmt.NewName]; exists {
+			err = fmt.Errorf("there is already an index named %s", stmt.NewName)
+		}
+		updated.Name = stmt.NewName
+	case "RENAME COLUMN":
+		err = updated.renameColumn(stmt.OldColumn, stmt.NewName)
+	}
+	if err != nil {
+		return fmt.Errorf("alter table %s: %w", table.Name, err)
+	}
+	for _, idx := range updated.Indexes {
+		idx.Table = updated.Name
+	}
+
+	err = db.inTransaction(func() error {
+		if err := db.replaceMeta(table.Name, updated.metaRow()); err != nil {
+			return fmt.Errorf("update table metadata: %w", err)
+		}
+		for _, idx := range updated.Indexes {
+			if err := db.saveIndexMeta(idx); err != nil {
+				return fmt.Errorf("update index metadata %s: %w", idx.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("alter table %s: %w", table.Name, err)
+	}
+
+	delete(db.Tables, table.Name)
+	db.Tables[updated.Name] = updated
+	for _, idx := range updated.Indexes {
+		db.Indexes[idx.Name] = idx
+	}
+	store.Logger.Println("Table altered:", updated.createSQL())
+	return nil
+}
+
+// clone 复制表结构（包括索引），页和数据共用
+func (t *Table) clone() *Table {
+	c := *t
+	c.Columns = append([]string(nil), t.Columns...)
+	c.Types = append([]string(nil), t.Types...)
+	c.Defaults = append([]Value(nil), t.Defaults...)
+	c.Indexes = make([]*Index, len(t.Indexes))
+	for i, idx := range t.Indexes {
+		copied := *idx
+		c.Indexes[i] = &copied
+	}
+	return &c
+}
+
+func (t *Table) renameColumn(oldName, newName string) error {
+	col := indexOfName(t.Columns, oldName)
+	if col < 0 {
+		return fmt.Errorf("no such column: %s", oldName)
+	}
+	if other := indexOfName(t.Columns, newName); other >= 0 && other != col {
+		return fmt.Errorf("duplicate column name: %s", newName)
+	}
+	for _, idx := range t.Indexes {
+		if strings.EqualFold(idx.Column, oldName) {
+			idx.Column = newName
+		}
+	}
+	t.Columns[col] = newName
+	return nil
+}
@@ -0,0 +1,154 @@
+package db
+
+type Expr interface{ exprNode() }
+
+type Literal struct{ Val Value }
+
+type ColumnRef struct {
+	Table string // 可选的表名或别名限定
+	Name  string
+}
+
+type BinaryExpr struct {
+	Op          string // 大写关键字或符号，如 AND、=、||
+	Left, Right Expr
+}
+
+type UnaryExpr struct {
+	Op string // - + NOT
+	X  Expr
+}
+
+type IsNullExpr struct {
+	X   Expr
+	Not bool
+}
+
+type InExpr struct {
+	X    Expr
+	List []Expr
+	Not  bool
+}
+
+type BetweenExpr struct {
+	X, Low, High Expr
+	Not          bool
+}
+
+type FuncCall struct {
+	Name     string // 大写
+	Args     []Expr
+	Star     bool // COUNT(*)
+	Distinct bool
+}
+
+func (*Literal) exprNode()     {}
+func (*ColumnRef) exprNode()   {}
+func (*BinaryExpr) exprNode()  {}
+func (*UnaryExpr) exprNode()   {}
+func (*IsNullExpr) exprNode()  {}
+func (*InExpr) exprNode()      {}
+func (*BetweenExpr) exprNode() {}
+func (*FuncCall) exprNode()    {}
+
+type SelectColumn struct {
+	Expr      Expr
+	Alias     string
+	Text      string // 原始 SQL 文本，用作默认列名
+	Star      bool
+	StarTable string // t.*
+}
+
+type OrderItem struct {
+	Expr Expr
+	Desc bool
+}
+
+type TableRef struct {
+	Schema string // schema.table 中的 schema，见 attach.go
+	Name   string
+	Alias  string
+}
+
+// JoinClause 是 FROM 中第一个表之后的每一个连接
+type JoinClause struct {
+	Kind  string // INNER、LEFT 或 CROSS（逗号连接也是 CROSS）
+	Table *TableRef
+	On    Expr
+}
+
+type SelectStmt struct {
+	Distinct bool
+	Columns  []SelectColumn
+	From     *TableRef
+	Joins    []JoinClause
+	Where    Expr
+	GroupBy  []Expr
+	Having   Expr
+	OrderBy  []OrderItem
+	Limit    Expr
+	Offset   Expr
+}
+
+type ColumnDef struct {
+	Name    string
+	Type    string
+	Default Expr // DEFAULT 子句，没有时为 nil
+}
+
+type CreateTableStmt struct {
+	Schema      string
+	Name        string
+	Columns     []ColumnDef
+	IfNotExists bool
+	Temp        bool // CREATE TEMP TABLE，见 temp.go
+}
+
+type CreateIndexStmt struct {
+	Schema      string // 可以写在索引名或表名前面
+	Name        string
+	Table       string
+	Column      string
+	IfNotExists bool
+}
+
+type DropTableStmt struct {
+	Schema   string
+	Name     string
+	IfExists bool
+}
+
+// AlterTableStmt 的 Action 为 ADD COLUMN、RENAME TO 或 RENAME COLUMN
+type AlterTableStmt struct {
+	Schema    string
+	Table     string
+	Action    string
+	Column    ColumnDef // ADD COLUMN
+	NewName   string    // RENAME TO 的新表名，或 RENAME COLUMN 的新列名
+	OldColumn string    // RENAME COLUMN
+}
+
+type InsertStmt struct {
+	Schema  string
+	Table   string
+	Columns []string
+	Rows    [][]Expr
+}
+
+// VacuumStmt 是 VACUUM 或 VACUUM INTO 'path'
+// AttachStmt 是 ATTACH [DATABASE] 'file' AS name
+type AttachStmt struct {
+	File string
+	Name string
+}
+
+type VacuumStmt struct {
+	Schema string
+	Into   string // 为空表示整理数据库本身
+}
+
+// PragmaStmt 是 PRAGMA name、PRAGMA name = value 或 PRAGMA name(value)
+type PragmaStmt struct {
+	Name  string
+	Value Expr // 没有参数时为 nil
+}
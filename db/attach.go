@@ -0,0 +1,245 @@
+package db
+
+import (
+	"fmt"
+	"mySQLite/store"
+	"strings"
+)
+
+/*
+ATTACH 'file' AS name 把另一个数据库文件附加到这个连接上，DETACH name 分离。
+每个附加的数据库是一个完整的 Database（自己的 Pager 和元数据表），与主数据库在同一个 VFS 中打开，
+文件已有的格式（影子分页、校验和、压缩）自动识别，加密的文件不能附加。
+
+表名可以写成 schema.table，schema 是 main（主数据库）、temp（临时表，见 temp.go）
+或附加时的名字。没有 schema 的表名依次在 temp、main 和附加的数据库（按附加的顺序）中查找，
+CREATE TABLE 建在 main 中；mydb_master 指 main 的元数据表。
+
+  - 写语句整条交给表所在的数据库执行，只锁那一个文件；
+  - 快照同时包括所有数据库，同一条 SELECT 可以连接不同文件中的表；
+  - BEGIN ... COMMIT 中的语句可以修改多个文件，COMMIT 通过主日志一起提交，见 transaction.go。
+*/
+
+// attachment 是一个附加的数据库
+type attachment struct {
+	name string
+	db   *Database
+}
+
+// ATTACH [DATABASE] 'file' AS name
+func (db *Database) attach(sql string) error {
+	stmt, err := parseAttach(sql)
+	if err != nil {
+		return fmt.Errorf("invalid ATTACH syntax: %w", err)
+	}
+	if err := db.Attach(stmt.File, stmt.Name); err != nil {
+		return fmt.Errorf("attach database: %w", err)
+	}
+	store.Logger.Printf("Database attached: %s as %s", stmt.File, stmt.Name)
+	return nil
+}
+
+// DETACH [DATABASE] name
+func (db *Database) detach(sql string) error {
+	name, err := parseDetach(sql)
+	if err != nil {
+		return fmt.Errorf("invalid DETACH syntax: %w", err)
+	}
+	if err := db.Detach(name); err != nil {
+		return fmt.Errorf("detach database: %w", err)
+	}
+	store.Logger.Println("Database detached:", name)
+	return nil
+}
+
+// Attach 打开 file 并以 name 附加到这个连接上
+func (db *Database) Attach(file, name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.explicit {
+		return fmt.Errorf("cannot ATTACH database within transaction")
+	}
+	if _, ok := db.schemaLocked(name); ok || strings.EqualFold(name, "temp") {
+		return fmt.Errorf("database %s is already in use", name)
+	}
+	// :memory: 总是新的内存数据库；主数据库在内存中时附加的文件在磁盘上
+	var opts store.Options
+	if file != store.MemoryDB && db.Pager.Filename() != store.MemoryDB {
+		opts.VFS = db.Pager.VFS()
+	}
+	pager, err := store.OpenPagerWithOptions(file, opts)
+	if err != nil {
+		return err
+	}
+	db.attached = append(db.attached, attachment{name: name, db: NewDatabase(pager)})
+	return nil
+}
+
+// Detach 分离并关闭附加的数据库
+func (db *Database) Detach(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.explicit {
+		return fmt.Errorf("cannot DETACH database within transaction")
+	}
+	for i, a := range db.attached {
+		if strings.EqualFold(a.name, name) {
+			db.attached = append(db.attached[:i], db.attached[i+1:]...)
+			return a.db.Close()
+		}
+	}
+	return fmt.Errorf("no such database: %s", name)
+}
+
+// schemaLocked 按 schema 名查找数据库，temp 在还没有临时表时找不到。调用时持有 db.mu
+func (db *Database) schemaLocked(schema string) (*Database, bool) {
+	switch {
+	case strings.EqualFold(schema, "main"):
+		return db, true
+	case strings.EqualFold(schema, "temp"):
+		return db.temp, db.temp != nil
+	}
+	for _, a := range db.attached {
+		if strings.EqualFold(a.name, schema) {
+			return a.db, true
+		}
+	}
+	return nil, false
+}
+
+// searchOrder 返回没有 schema 的表名的查找顺序：temp、main、附加的数据库
+func (db *Database) searchOrder() []*Database {
+	var order []*Database
+	if db.temp != nil {
+		order = append(order, db.temp)
+	}
+	order = append(order, db)
+	for _, a := range db.attached {
+		order = append(order, a.db)
+	}
+	return order
+}
+
+// lookupTable 按 [schema.]name 查找表，包括只读的元数据表。
+// 在快照上调用，或者调用时持有 db.mu
+func (db *Database) lookupTable(schema, name string) (*Table, bool) {
+	d := db
+	if schema != "" {
+		var ok bool
+		if d, ok = db.schemaLocked(schema); !ok {
+			return nil, false
+		}
+	}
+	if strings.EqualFold(name, MasterTableName) {
+		return d.Master, true
+	}
+	if schema != "" {
+		t, ok := d.Tables[name]
+		return t, ok
+	}
+	for _, d := range db.searchOrder() {
+		if t, ok := d.Tables[name]; ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// splitQualified 把 "schema.table" 拆成两部分，没有 schema 时第一部分为空
+func splitQualified(name string) (string, string) {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+// qualifiedName 返回用于错误信息的 [schema.]name
+func qualifiedName(schema, name string) string {
+	if schema == "" {
+		return name
+	}
+	return schema + "." + name
+}
+
+// writeTarget 是写语句要修改的对象
+type writeTarget struct {
+	schema string
+	table  string
+	create bool // CREATE TABLE，表还不存在
+	temp   bool // CREATE TEMP TABLE
+}
+
+// statementTarget 解析写语句要修改的表，解析失败时返回零值，由原来的执行路径报告错误
+func statementTarget(sql string) writeTarget {
+	tokens := strings.Fields(sql)
+	if len(tokens) == 0 {
+		return writeTarget{}
+	}
+	switch strings.ToUpper(tokens[0]) {
+	case "INSERT":
+		if stmt, err := parseInsert(sql); err == nil {
+			return writeTarget{schema: stmt.Schema, table: stmt.Table}
+		}
+	case "DELETE":
+		if len(tokens) > 2 {
+			schema, table := splitQualified(tokens[2])
+			return writeTarget{schema: schema, table: table}
+		}
+	case "DROP":
+		if stmt, err := parseDropTable(sql); err == nil {
+			return writeTarget{schema: stmt.Schema, table: stmt.Name}
+		}
+	case "ALTER":
+		if stmt, err := parseAlterTable(sql); err == nil {
+			return writeTarget{schema: stmt.Schema, table: stmt.Table}
+		}
+	case "CREATE":
+		if stmt, err := parseCreateIndex(sql); err == nil {
+			return writeTarget{schema: stmt.Schema, table: stmt.Table}
+		}
+		if stmt, err := parseCreateTable(sql); err == nil {
+			return writeTarget{schema: stmt.Schema, table: stmt.Name, create: true, temp: stmt.Temp}
+		}
+	}
+	return writeTarget{}
+}
+
+// target 返回执行写语句的数据库
+func (db *Database) target(sql string) (*Database, error) {
+	w := statementTarget(sql)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if w.temp || strings.EqualFold(w.schema, "temp") {
+		if w.schema != "" && !strings.EqualFold(w.schema, "temp") {
+			return nil, fmt.Errorf("temporary table name must be unqualified")
+		}
+		return db.tempLocked()
+	}
+	if w.schema != "" {
+		d, ok := db.schemaLocked(w.schema)
+		if !ok {
+			return nil, fmt.Errorf("unknown database %s", w.schema)
+		}
+		return d, nil
+	}
+	if w.table == "" || w.create {
+		return db, nil
+	}
+	for _, d := range db.searchOrder() {
+		if d == db {
+			if _, ok := db.Tables[w.table]; ok {
+				return db, nil
+			}
+		} else if d.hasTable(w.table) {
+			return d, nil
+		}
+	}
+	return db, nil
+}
+
+func (db *Database) hasTable(name string) bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	_, ok := db.Tables[name]
+	return ok
+}
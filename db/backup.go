@@ -0,0 +1,40 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"mySQLite/store"
+)
+
+// 在线备份每一步复制的页数，两步之间写者可以提交
+const backupStepPages = 100
+
+// Backup 把主数据库在线备份到 path，已有的文件被替换。
+// 备份在同一个 VFS 中（内存数据库备份到磁盘上），格式与原文件相同；每一步只短暂持有读锁，不阻塞写者，见 store/backup.go。
+func (db *Database) Backup(path string) error {
+	if path == db.Pager.Filename() {
+		return fmt.Errorf("cannot back up a database to itself")
+	}
+	opts := db.Pager.FormatOptions()
+	if db.Pager.Filename() == store.MemoryDB {
+		// 内存数据库备份到磁盘上
+		opts.VFS = nil
+	}
+	dst, err := store.OpenPagerWithOptions(path, opts)
+	if err != nil {
+		return err
+	}
+	b, err := store.NewBackup(dst, db.Pager)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	for done := false; !done && err == nil; {
+		done, err = b.Step(backupStepPages)
+	}
+	err = errors.Join(err, b.Close(), dst.Close())
+	if err != nil {
+		return fmt.Errorf("backup to %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"fmt"
+	"mySQLite/store"
+	"strings"
+)
+
+/*
+元数据表 mydb_master（与 sqlite_master 相同）是一棵普通的 B+ 树，
+根页号记录在文件头中，创建后不再改变。对外的列为：
+
+| 列       | 内容                     |
+| -------- | ------------------------ |
+| type     | "table" 或 "index"       |
+| name     | 名称                     |
+| tbl_name | 所属表名                 |
+| rootpage | 根页号                   |
+| sql      | CREATE 语句              |
+
+B+ 树按记录第一个字段排序，而 type 有大量重复，所以记录中把 name 放在最前面：
+[name, type, tbl_name, rootpage, sql]，name 在表和索引之间唯一。
+
+旧版本的元数据是页 1 中的记录（[type, name, tbl_name, rootpage, sql]，
+更早的是 [name, "col1|col2", root] 三字段），打开时迁移到 B+ 树。
+*/
+
+const MasterTableName = "mydb_master"
+
+// 元数据表的列在记录中的位置
+var masterFieldOrder = []int{1, 0, 2, 3, 4}
+
+func newMasterTable(pager *store.Pager, root int) *Table {
+	return &Table{
+		Name:       MasterTableName,
+		Columns:    []string{"type", "name", "tbl_name", "rootpage", "sql"},
+		Types:      []string{"TEXT", "TEXT", "TEXT", "INT", "TEXT"},
+		Pager:      pager,
+		RootPage:   root,
+		fieldOrder: masterFieldOrder,
+	}
+}
+
+// isReservedName 判断名称是否保留给内部对象
+func isReservedName(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), "mydb_")
+}
+
+// openCatalog 返回元数据 B+ 树的根页，旧格式的文件先迁移
+func openCatalog(pager *store.Pager) (int, error) {
+	fh, err := pager.ReadFileHeader()
+	if err != nil {
+		return 0, err
+	}
+	if fh.CatalogRoot != 0 {
+		return int(fh.CatalogRoot), nil
+	}
+
+	var root int
+	err = inTransaction(pager, func() error {
+		rows, err := pager.ReadAllRows(1)
+		if err != nil {
+			return err
+		}
+		if root, err = pager.AllocatePage(); err != nil {
+			return err
+		}
+		data, _ := store.NewLeafPage().ToBytes()
+		if err := pager.WritePage(root, data); err != nil {
+			return err
+		}
+		for _, r := range rows {
+			fields, err := store.DecodeRow(r)
+			if err != nil {
+				return err
+			}
+			switch len(fields) {
+			case 3:
+				// 最早的三字段格式没有类型，转换成 CREATE TABLE 语句
+				t, err := tableFromMeta(fields)
+				if err != nil {
+					return err
+				}
+				fields = t.metaRow()
+			case len(masterFieldOrder):
+			default:
+				return fmt.Errorf("invalid metadata record with %d fields in page 1", len(fields))
+			}
+			if err := catalogInsert(pager, root, fields); err != nil {
+				return err
+			}
+		}
+		if err := pager.ClearRows(1); err != nil {
+			return err
+		}
+		return pager.SetCatalogRoot(root)
+	})
+	return root, err
+}
+
+// catalogEntries 按 [type, name, tbl_name, rootpage, sql] 的顺序返回所有元数据
+func catalogEntries(pager *store.Pager, root int) ([][]string, error) {
+	var entries [][]string
+	err := store.ScanRows(pager, root, func(rec []byte) error {
+		fields, err := store.DecodeRow(rec)
+		if err != nil {
+			return err
+		}
+		if len(fields) != len(masterFieldOrder) {
+			return fmt.Errorf("invalid catalog record with %d fields", len(fields))
+		}
+		entry := make([]string, len(fields))
+		for col, field := range masterFieldOrder {
+			entry[col] = fields[field]
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+func catalogInsert(pager *store.Pager, root int, entry []string) error {
+	fields := make([]string, len(entry))
+	for col, field := range masterFieldOrder {
+		fields[field] = entry[col]
+	}
+	data, err := store.EncodeRow(fields)
+	if err != nil {
+		return fmt.Errorf("encode catalog record: %w", err)
+	}
+	return store.InsertRowFixedRoot(pager, root, data)
+}
+
+// insertMeta 在元数据表中加入一条记录
+func (db *Database) insertMeta(entry []string) error {
+	return catalogInsert(db.Pager, db.Master.RootPage, entry)
+}
+
+// removeMeta 删除某个表或索引的元数据
+func (db *Database) removeMeta(name string) error {
+	_, err := store.DeleteRow(db.Pager, db.Master.RootPage, name)
+	return err
+}
+
+// replaceMeta 用新的元数据替换名为 name 的记录（名称可以改变）
+func (db *Database) replaceMeta(name string, entry []string) error {
+	if err := db.removeMeta(name); err != nil {
+		return fmt.Errorf("remove metadata %s: %w", name, err)
+	}
+	return db.insertMeta(entry)
+}
+
+// saveTableMeta 根页变化后更新元数据
+func (db *Database) saveTableMeta(t *Table) error {
+	return db.replaceMeta(t.Name, t.metaRow())
+}
+
+func (db *Database) saveIndexMeta(idx *Index) error {
+	return db.replaceMeta(idx.Name, idx.metaRow())
+}
@@ -0,0 +1,282 @@
+package db
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mySQLite/store"
+	"strings"
+)
+
+/*
+CSV 导入导出，第一行是列名。
+
+导入时表不存在就按列名建表，列的类型由前 csvSampleRows 行推断：全是整数为 INTEGER，
+有小数为 REAL，其他为 TEXT（有前导 0 的数字如 "007" 也按 TEXT，避免丢掉 0）。
+表已存在时按列名对应到表的列，值按列类型转换，文件中没有的列取默认值。
+数值列中的空字段为 NULL，文本列中为空串。
+
+导入边读边插入，不会把整个文件读入内存。新建的表先批量加载（见 store/btree_bulk.go）：
+只要行按 key（第一列）有序，就直接自底向上建成页面填满的 B+ 树，这一段是一个事务，
+出错时整段回滚。之后的行（以及追加到已有的表时的所有行）走普通的插入，
+每 csvBatchSize 行一个事务，批之间释放写锁，其他连接可以读写；
+某一批出错时这一批回滚，之前的批已经提交。
+*/
+
+const (
+	csvBatchSize  = 1000
+	csvSampleRows = 1000
+)
+
+// ImportCSV 把 CSV 中的行插入表，返回插入的行数
+func (db *Database) ImportCSV(r io.Reader, table string) (int, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return 0, fmt.Errorf("CSV has no header row")
+	}
+	if err != nil {
+		return 0, err
+	}
+	header = append([]string(nil), header...)
+
+	// 先读入用于推断类型的行，它们也是第一批要插入的行
+	var batch [][]string
+	for len(batch) < csvSampleRows {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		batch = append(batch, rec)
+	}
+
+	var positions []int
+	created := false
+	err = db.write(func() error {
+		t, ok := db.Tables[table]
+		if !ok {
+			created = true
+			sql, err := csvCreateSQL(table, header, batch)
+			if err != nil {
+				return err
+			}
+			if err := db.createTable(sql); err != nil {
+				return err
+			}
+			t = db.Tables[table]
+		}
+		positions = make([]int, len(header))
+		for i, name := range header {
+			if positions[i] = indexOfName(t.Columns, name); positions[i] < 0 {
+				return fmt.Errorf("table %s has no column named %s", t.Name, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	imported := 0
+	if created {
+		if imported, err = db.csvBulkLoad(table, positions, &batch, cr); err != nil {
+			return 0, fmt.Errorf("import into %s: %w", table, err)
+		}
+	}
+
+	flush := func() error {
+		err := db.write(func() error {
+			t, ok := db.Tables[table]
+			if !ok {
+				return fmt.Errorf("no such table: %s", table)
+			}
+			affs := t.affinities()
+			for _, rec := range batch {
+				if err := db.insertRow(t, t.csvRow(positions, rec, affs)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("import into %s after %d rows: %w", table, imported, err)
+		}
+		imported += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		if len(batch) >= csvBatchSize {
+			if err := flush(); err != nil {
+				return imported, err
+			}
+		}
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return imported, err
+		}
+		batch = append(batch, rec)
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return imported, err
+		}
+	}
+	return imported, nil
+}
+
+// csvBulkLoad 把刚建的空表按 key 有序的前几行（可能是全部）批量加载成紧凑的 B+ 树，
+// 整个加载是一个事务。遇到 key 比前一行小的行时停下，这一行和之后的行放回 batch，
+// 由调用方逐行插入。返回加载的行数。
+func (db *Database) csvBulkLoad(table string, positions []int, batch *[][]string, cr *csv.Reader) (int, error) {
+	loaded := 0
+	err := db.write(func() error {
+		t, ok := db.Tables[table]
+		if !ok {
+			return fmt.Errorf("no such table: %s", table)
+		}
+		loader, err := store.NewBulkLoader(t.Pager, store.DefaultFillFactor)
+		if err != nil {
+			return err
+		}
+		affs := t.affinities()
+		pending := *batch
+		var rest [][]string
+		for {
+			var rec []string
+			if len(pending) > 0 {
+				rec, pending = pending[0], pending[1:]
+			} else if rec, err = cr.Read(); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return err
+			}
+			data, err := encodeValues(t.csvRow(positions, rec, affs))
+			if err != nil {
+				return err
+			}
+			if err := loader.Add(data); errors.Is(err, store.ErrNotSorted) {
+				rest = append([][]string{rec}, pending...)
+				break
+			} else if err != nil {
+				return err
+			}
+		}
+		root, err := loader.Finish()
+		if err != nil {
+			return err
+		}
+		oldRoot := t.RootPage
+		t.RootPage = root
+		if err := db.saveTableMeta(t); err != nil {
+			t.RootPage = oldRoot
+			return err
+		}
+		*batch = rest
+		loaded = loader.Count()
+		return db.Pager.FreePage(oldRoot)
+	})
+	return loaded, err
+}
+
+// csvRow 把一条 CSV 记录转换成表中的一行
+func (t *Table) csvRow(positions []int, rec []string, affs []affinity) []Value {
+	row := make([]Value, len(t.Columns))
+	for i := range row {
+		row[i] = t.defaultValue(i)
+	}
+	for i, field := range rec {
+		row[positions[i]] = csvValue(field, affs[positions[i]])
+	}
+	return row
+}
+
+// csvCreateSQL 根据列名和样本行生成建表语句
+func csvCreateSQL(table string, header []string, sample [][]string) (string, error) {
+	t := &Table{Name: table}
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			name = fmt.Sprintf("c%d", i+1)
+		}
+		if err := t.addColumn(ColumnDef{Name: name, Type: inferColumnType(sample, i)}); err != nil {
+			return "", err
+		}
+	}
+	return t.createSQL(), nil
+}
+
+func inferColumnType(sample [][]string, col int) string {
+	typ := ""
+	for _, rec := range sample {
+		s := strings.TrimSpace(rec[col])
+		if s == "" {
+			continue
+		}
+		v, ok := parseNumber(s)
+		if !ok || hasLeadingZero(s) {
+			return "TEXT"
+		}
+		if v.Kind == KindFloat {
+			typ = "REAL"
+		} else if typ == "" {
+			typ = "INTEGER"
+		}
+	}
+	if typ == "" {
+		return "TEXT"
+	}
+	return typ
+}
+
+func hasLeadingZero(s string) bool {
+	s = strings.TrimLeft(s, "+-")
+	return len(s) > 1 && s[0] == '0' && s[1] >= '0' && s[1] <= '9'
+}
+
+// csvValue 把 CSV 字段按列亲和性转换
+func csvValue(field string, aff affinity) Value {
+	if field == "" && aff != affinityText {
+		return Null
+	}
+	return applyAffinity(TextValue(field), aff)
+}
+
+// ExportCSV 把表写成 CSV，第一行是列名，NULL 写成空字段，返回导出的行数。
+// 导出在快照上进行，不阻塞写者。
+func (db *Database) ExportCSV(w io.Writer, table string) (int, error) {
+	s, err := db.Snapshot()
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+	t, ok := s.db.lookupTable(splitQualified(table))
+	if !ok {
+		return 0, fmt.Errorf("no such table: %s", table)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(t.Columns)
+	n := 0
+	err = t.scan(func(row []Value) error {
+		rec := make([]string, len(row))
+		for i, v := range row {
+			rec[i] = v.storageString()
+		}
+		n++
+		return cw.Write(rec)
+	})
+	if err != nil {
+		return n, err
+	}
+	cw.Flush()
+	return n, cw.Error()
+}
@@ -5,44 +5,349 @@ import (
 	"mySQLite/store"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type Row []string
 
 type Table struct {
 	Columns  []string
+	Types    []string // 列声明的类型，未声明为空串
+	Defaults []Value  // 列的默认值，没有 DEFAULT 时为 NULL
 	Name     string
 	Pager    *store.Pager
 	RootPage int
+	Indexes  []*Index
+
+	fieldOrder []int // 列在记录中的位置，nil 表示与列顺序相同
 }
 
+/*
+并发模型：一个 Database 可以被多个 goroutine 同时使用，同一时间只有一个写者。
+
+  - Exec 中的写语句（CREATE、INSERT、DELETE、ALTER、DROP）执行期间持有 mu，彼此串行；
+  - Query 以及 Exec 中的 SELECT / EXPLAIN / SEARCH 只在建立快照时短暂持有 mu，
+    之后在快照上执行（见 snapshot.go），看到的是开始时已提交的版本，
+    写者可以同时插入，长查询不会阻塞写者；
+  - Tables、Indexes 和 Table 的字段只在持有 mu 时修改和复制。
+
+Pager 自己的锁只保证单个页操作的原子性，见 store/pager.go。
+直接使用 Pager 或 store 包函数的代码需要自己遵守同样的规则。
+
+多个进程（或同一进程中的多个 Database）可以打开同一个文件：写语句执行期间持有
+文件写锁，快照持有文件读锁，拿不到锁时等待 busy timeout 后返回 store.ErrBusy。
+加锁时发现文件被其他连接改过，就重新加载元数据，见 store/lock.go。
+*/
+
 type Database struct {
-	Tables map[string]*Table
-	Pager  *store.Pager
+	Tables  map[string]*Table
+	Indexes map[string]*Index
+	Pager   *store.Pager
+	Master  *Table // 元数据表 mydb_master，见 catalog.go
+
+	temp     *Database    // 临时表所在的内存数据库，nil 表示还没有临时表，见 temp.go
+	attached []attachment // ATTACH 的数据库，按附加的顺序，见 attach.go
+	explicit bool         // 在 BEGIN 开始的事务中，见 transaction.go
+
+	mu          sync.Mutex
+	dataVersion uint64 // 加载元数据时 Pager 的 DataVersion
 }
 
 func NewDatabase(pager *store.Pager) *Database {
+	db := &Database{Pager: pager}
+	if err := db.withReadLock(db.loadSchema); err != nil {
+		store.Logger.Println("Error loading schema:", err)
+	}
+	store.Logger.Println("Recovered tables:")
+	for name, t := range db.Tables {
+		store.Logger.Printf("  - %s at root page %d, columns: %v", name, t.RootPage, t.Columns)
+	}
+	return db
+}
+
+// loadSchema 从元数据表重新加载所有表和索引，调用时需要持有文件锁
+func (db *Database) loadSchema() error {
+	pager := db.Pager
 	tables := make(map[string]*Table)
-	rows, _ := pager.ReadAllRows(1)
-	for _, r := range rows {
-		fields, _ := store.DecodeRow(r)
-		if len(fields) != 3 {
+	indexes := make(map[string]*Index)
+	db.Tables, db.Indexes = tables, indexes
+	root, err := openCatalog(pager)
+	if err != nil {
+		return fmt.Errorf("open catalog: %w", err)
+	}
+	db.Master = newMasterTable(pager, root)
+	db.dataVersion = pager.DataVersion()
+	entries, err := catalogEntries(pager, root)
+	if err != nil {
+		return fmt.Errorf("read catalog: %w", err)
+	}
+	var indexRows [][]string
+	for _, fields := range entries {
+		if fields[0] == "index" {
+			indexRows = append(indexRows, fields)
+			continue
+		}
+		t, err := tableFromMeta(fields)
+		if err != nil {
+			store.Logger.Println("Skip invalid table metadata:", err)
 			continue
 		}
-		name := fields[0]
+		if t == nil {
+			continue
+		}
+		t.Pager = pager
+		tables[t.Name] = t
+	}
+	// 索引在所有表加载之后再挂到对应的表上
+	for _, fields := range indexRows {
+		idx, err := indexFromMeta(fields)
+		if err != nil {
+			store.Logger.Println("Skip invalid index metadata:", err)
+			continue
+		}
+		t, ok := tables[idx.Table]
+		if !ok {
+			store.Logger.Println("Skip index on missing table:", idx.Name)
+			continue
+		}
+		idx.Pager = pager
+		indexes[idx.Name] = idx
+		t.Indexes = append(t.Indexes, idx)
+	}
+	return nil
+}
+
+// withReadLock 持有文件读锁执行 fn，文件被其他连接改过时先重新加载元数据
+func (db *Database) withReadLock(fn func() error) error {
+	if err := db.Pager.BeginRead(); err != nil {
+		return err
+	}
+	defer db.Pager.EndRead()
+	if err := db.reloadIfChanged(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// withWriteLock 持有文件写锁执行 fn
+func (db *Database) withWriteLock(fn func() error) error {
+	if err := db.Pager.BeginWrite(); err != nil {
+		return err
+	}
+	defer db.Pager.EndWrite()
+	if err := db.reloadIfChanged(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// write 执行一组写操作：写者同一时间只有一个，执行期间持有文件写锁，整组操作是一个事务。
+// fn 出错时事务回滚，返回 fn 的错误
+func (db *Database) write(fn func() error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	err := db.withWriteLock(func() error {
+		return db.inTransaction(fn)
+	})
+	if err != nil {
+		// 内存中的表可能已经改过，与回滚之后的文件不一致，下次加锁时重新加载
+		db.Master = nil
+	}
+	return err
+}
+
+func (db *Database) reloadIfChanged() error {
+	if db.Master != nil && db.Pager.DataVersion() == db.dataVersion {
+		return nil
+	}
+	return db.loadSchema()
+}
+
+func tableFromMeta(fields []string) (*Table, error) {
+	switch {
+	case len(fields) == 3:
+		root, err := metaRootPage(fields[0], fields[2])
+		if err != nil {
+			return nil, err
+		}
 		cols := strings.Split(fields[1], "|")
-		root, _ := strconv.Atoi(fields[2])
-		tables[name] = &Table{
-			Name:     name,
+		return &Table{
+			Name:     fields[0],
 			Columns:  cols,
+			Types:    make([]string, len(cols)),
 			RootPage: root,
-			Pager:    pager,
+		}, nil
+	case len(fields) == 5 && fields[0] == "table":
+		stmt, err := parseCreateTable(fields[4])
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", fields[1], err)
+		}
+		root, err := metaRootPage(fields[1], fields[3])
+		if err != nil {
+			return nil, err
 		}
+		t := &Table{Name: fields[1], RootPage: root}
+		for _, c := range stmt.Columns {
+			if err := t.addColumn(c); err != nil {
+				return nil, fmt.Errorf("table %s: %w", fields[1], err)
+			}
+		}
+		return t, nil
 	}
-	fmt.Println("Recovered tables:")
-	for name, t := range tables {
-		fmt.Printf("  - %s at root page %d, columns: %v\n", name, t.RootPage, t.Columns)
+	return nil, nil
+}
+
+// metaRootPage 解析元数据中的根页号，页 1 是文件头所在的页，不会是表或索引的根
+func metaRootPage(name, s string) (int, error) {
+	root, err := strconv.Atoi(s)
+	if err != nil || root < 2 {
+		return 0, fmt.Errorf("%s: invalid root page %q", name, s)
 	}
+	return root, nil
+}
 
-	return &Database{Tables: tables, Pager: pager}
+// createSQL 根据列定义生成规范化的 CREATE TABLE 语句
+func (t *Table) createSQL() string {
+	defs := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		defs[i] = quoteIdent(c)
+		if i < len(t.Types) && t.Types[i] != "" {
+			defs[i] += " " + t.Types[i]
+		}
+		if d := t.defaultValue(i); !d.IsNull() {
+			defs[i] += " DEFAULT " + d.sqlLiteral()
+		}
+	}
+	return fmt.Sprintf("CREATE TABLE %s(%s)", quoteIdent(t.Name), strings.Join(defs, ", "))
+}
+
+// metaRow 返回元数据表中的记录
+func (t *Table) metaRow() []string {
+	return []string{"table", t.Name, t.Name, fmt.Sprint(t.RootPage), t.createSQL()}
+}
+
+// keyColumn 返回作为 B+ 树 key 的列（记录的第一个字段）
+func (t *Table) keyColumn() int {
+	for col, field := range t.fieldOrder {
+		if field == 0 {
+			return col
+		}
+	}
+	return 0
+}
+
+// addColumn 追加一列，DEFAULT 表达式在这里求值并按列类型转换
+func (t *Table) addColumn(def ColumnDef) error {
+	if indexOfName(t.Columns, def.Name) >= 0 {
+		return fmt.Errorf("duplicate column name: %s", def.Name)
+	}
+	d := Null
+	if def.Default != nil {
+		v, err := evalExpr(def.Default, &evalContext{})
+		if err != nil {
+			return fmt.Errorf("default value of column %s: %w", def.Name, err)
+		}
+		d = applyAffinity(v, typeAffinity(def.Type))
+	}
+	// 旧格式的表没有 Types/Defaults，先补齐
+	for len(t.Types) < len(t.Columns) {
+		t.Types = append(t.Types, "")
+	}
+	for len(t.Defaults) < len(t.Columns) {
+		t.Defaults = append(t.Defaults, Null)
+	}
+	t.Columns = append(t.Columns, def.Name)
+	t.Types = append(t.Types, def.Type)
+	t.Defaults = append(t.Defaults, d)
+	return nil
+}
+
+func (t *Table) defaultValue(col int) Value {
+	if col < len(t.Defaults) {
+		return t.Defaults[col]
+	}
+	return Null
+}
+
+func (t *Table) affinities() []affinity {
+	affs := make([]affinity, len(t.Columns))
+	for i := range t.Columns {
+		if i < len(t.Types) {
+			affs[i] = typeAffinity(t.Types[i])
+		}
+	}
+	return affs
+}
+
+// scan 按 key 顺序遍历表中所有行，字段按列类型还原为带类型的值
+func (t *Table) scan(fn func(row []Value) error) error {
+	affs := t.affinities()
+	return store.ScanRows(t.Pager, t.RootPage, func(rec []byte) error {
+		row, err := t.decodeRow(rec, affs)
+		if err != nil {
+			return err
+		}
+		return fn(row)
+	})
+}
+
+// decodeRow 解码一条记录；ADD COLUMN 之前写入的记录字段较少，缺少的列取默认值
+func (t *Table) decodeRow(rec []byte, affs []affinity) ([]Value, error) {
+	fields, nulls, err := store.DecodeRowWithNulls(rec)
+	if err != nil {
+		return nil, err
+	}
+	row := make([]Value, len(affs))
+	for i := range affs {
+		field := i
+		if t.fieldOrder != nil {
+			field = t.fieldOrder[i]
+		}
+		if field < len(fields) {
+			row[i] = valueFromStorage(fields[field], nulls[field], affs[i])
+		} else {
+			row[i] = t.defaultValue(i)
+		}
+	}
+	return row, nil
+}
+
+// inTransaction 在一个事务中执行 fn，出错时回滚；已经在事务中时 fn 是一个语句保存点，
+// 出错时只撤销 fn 的修改
+func (db *Database) inTransaction(fn func() error) error {
+	return inTransaction(db.Pager, fn)
+}
+
+func inTransaction(pager *store.Pager, fn func() error) error {
+	if pager.InTransaction() {
+		return inStatement(pager, fn)
+	}
+	if err := pager.Begin(); err != nil {
+		return err
+	}
+	err := fn()
+	if err == nil {
+		err = pager.Commit()
+	}
+	// 提交失败时事务可能还没有结束，也要回滚，否则之后的语句都留在这个事务中
+	if err != nil && pager.InTransaction() {
+		if rbErr := pager.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+	}
+	return err
+}
+
+// inStatement 在事务中以语句保存点执行 fn，出错时回到保存点，事务中之前的修改保留
+func inStatement(pager *store.Pager, fn func() error) error {
+	if err := pager.BeginStatement(); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		if rbErr := pager.RollbackStatement(); rbErr != nil {
+			return fmt.Errorf("%w (statement rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	return pager.ReleaseStatement()
 }
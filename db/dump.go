@@ -0,0 +1,166 @@
+package db
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+导出为 SQL 文本：每个表一条 CREATE TABLE 加上每行一条 INSERT，按表名排序，
+最后是 CREATE INDEX（先插入数据再建索引比较快）。整个输出包在 BEGIN TRANSACTION; ... COMMIT; 中，
+重放是一个事务，中途出错或者文件不完整时不会留下导入了一半的数据库。
+输出可以用 ExecScript 或 shell 的 .read 重放，得到内容相同的数据库。
+*/
+
+// Dump 把数据库写成 SQL 语句，指定表名时只导出这些表和它们的索引。
+// 导出在快照上进行，不阻塞写者。
+func (db *Database) Dump(w io.Writer, tables ...string) error {
+	s, err := db.Snapshot()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.db.dump(w, tables)
+}
+
+func (db *Database) dump(w io.Writer, tables []string) error {
+	if len(tables) == 0 {
+		for name := range db.Tables {
+			tables = append(tables, name)
+		}
+		sort.Strings(tables)
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString("BEGIN TRANSACTION;\n")
+	var indexes []*Index
+	for _, name := range tables {
+		t, ok := db.Tables[name]
+		if !ok {
+			return fmt.Errorf("no such table: %s", name)
+		}
+		fmt.Fprintf(bw, "%s;\n", t.createSQL())
+		prefix := "INSERT INTO " + quoteIdent(t.Name) + " VALUES ("
+		err := t.scan(func(row []Value) error {
+			bw.WriteString(prefix)
+			for i, v := range row {
+				if i > 0 {
+					bw.WriteString(", ")
+				}
+				bw.WriteString(dumpLiteral(v))
+			}
+			_, err := bw.WriteString(");\n")
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("dump table %s: %w", name, err)
+		}
+		indexes = append(indexes, t.Indexes...)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].Name < indexes[j].Name })
+	for _, idx := range indexes {
+		fmt.Fprintf(bw, "%s;\n", idx.createSQL())
+	}
+	bw.WriteString("COMMIT;\n")
+	return bw.Flush()
+}
+
+// dumpLiteral 与 sqlLiteral 相同，只是不是合法 UTF-8 的文本写成 BLOB 字面量，
+// 使导出的文件是文本文件；重放时 BLOB 按原样存储，存储内容不变
+func dumpLiteral(v Value) string {
+	if v.Kind == KindText && !utf8.ValidString(v.S) {
+		return BlobValue(v.S).sqlLiteral()
+	}
+	return v.sqlLiteral()
+}
+
+// ExecScript 依次执行 r 中以分号结尾的语句，用于重放 Dump 的输出。
+// 遇到出错的语句时停止并返回错误；读取失败、结尾有不完整的语句或者脚本中的事务没有提交时也返回错误，
+// 这些情况下脚本自己开始的事务被回滚。
+func (db *Database) ExecScript(r io.Reader) (err error) {
+	explicit := db.inExplicit()
+	defer func() {
+		// 脚本开始的事务没有结束，说明脚本中途出错或者不完整
+		if !explicit && db.inExplicit() {
+			if err == nil {
+				err = fmt.Errorf("script ended inside a transaction")
+			}
+			if rbErr := db.Rollback(); rbErr != nil {
+				err = fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+			}
+		}
+	}()
+	br := bufio.NewReader(r)
+	var pending string
+	for {
+		line, readErr := br.ReadString('\n')
+		pending += line
+		if strings.Contains(line, ";") {
+			stmts, rest := SplitStatements(pending)
+			for _, stmt := range stmts {
+				if err := db.Exec(stmt); err != nil {
+					return fmt.Errorf("%s: %w", stmt, err)
+				}
+			}
+			pending = rest
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+	if rest := strings.TrimSpace(pending); rest != "" {
+		return fmt.Errorf("incomplete statement: %s", rest)
+	}
+	return nil
+}
+
+// SplitStatements 取出 buf 中所有以分号结尾的完整语句，引号中的分号不算。
+// 语句之前的注释和空白去掉，rest 是剩下的不完整部分（同样去掉开头的注释）。
+func SplitStatements(buf string) (stmts []string, rest string) {
+	var quote byte
+	start := 0
+	for i := 0; i < len(buf); i++ {
+		c := buf[i]
+		switch {
+		case quote != 0:
+			// 引号内两个连续的引号是转义，逐个切换状态结果相同
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '-' && i+1 < len(buf) && buf[i+1] == '-':
+			// 注释到行尾
+			for i < len(buf) && buf[i] != '\n' {
+				i++
+			}
+		case c == ';':
+			if stmt := strings.TrimSpace(stripComments(buf[start : i+1])); stmt != ";" {
+				stmts = append(stmts, stmt)
+			}
+			start = i + 1
+		}
+	}
+	return stmts, stripComments(buf[start:])
+}
+
+// stripComments 去掉语句开头的注释行
+func stripComments(s string) string {
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if !strings.HasPrefix(s, "--") {
+			return s
+		}
+		end := strings.IndexByte(s, '\n')
+		if end < 0 {
+			return ""
+		}
+		s = s[end+1:]
+	}
+}
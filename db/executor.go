@@ -5,22 +5,59 @@ import (
 	"strings"
 )
 
-func (db *Database) Exec(sql string) {
+// Exec 执行一条 SQL 语句，返回语句的错误。写语句是原子的：不在显式事务中时是一个事务，
+// 在显式事务中时是一个语句保存点，出错时整条语句回滚，见 transaction.go
+func (db *Database) Exec(sql string) error {
 	tokens := strings.Fields(sql)
 	if len(tokens) == 0 {
-		fmt.Println("Empty SQL")
-		return
+		return fmt.Errorf("empty SQL")
 	}
-	switch strings.ToUpper(tokens[0]) {
+	var exec func(*Database, string) error
+	// "VACUUM;" 这样只有一个词的语句，分号紧跟在关键字后面
+	switch strings.ToUpper(strings.TrimSuffix(tokens[0], ";")) {
 	case "CREATE":
-		db.createTable(sql)
+		if len(tokens) > 1 && (strings.EqualFold(tokens[1], "INDEX") || strings.EqualFold(tokens[1], "UNIQUE")) {
+			exec = (*Database).createIndex
+		} else {
+			exec = (*Database).createTable
+		}
 	case "INSERT":
-		db.insertInto(sql)
+		exec = (*Database).insertInto
+	case "SELECT", "EXPLAIN", "PRAGMA":
+		// 在快照上执行，不阻塞写者
+		return db.selectRows(sql)
 	case "SEARCH":
-		db.searchKey(sql)
+		s, err := db.Snapshot()
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		return s.db.searchKey(sql)
+	case "VACUUM":
+		// VACUUM 自己加锁，见 vacuum.go
+		return db.vacuum(sql)
+	case "ATTACH":
+		return db.attach(sql)
+	case "DETACH":
+		return db.detach(sql)
+	case "BEGIN", "COMMIT", "END", "ROLLBACK":
+		return db.transaction(sql)
+	case "ALTER":
+		exec = (*Database).alterTable
+	case "DROP":
+		exec = (*Database).dropTable
 	case "DELETE":
-		db.deleteFrom(sql)
+		exec = (*Database).deleteFrom
 	default:
-		fmt.Println("Unsupported SQL:", sql)
+		return fmt.Errorf("unsupported SQL: %s", sql)
 	}
+
+	// 语句修改的表可能在临时数据库或附加的数据库中，整条语句交给那个数据库执行，见 attach.go
+	target, err := db.target(sql)
+	if err != nil {
+		return err
+	}
+	return db.writeTo(target, func() error {
+		return exec(target, sql)
+	})
 }
@@ -0,0 +1,398 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// colInfo 描述结果行中的一列
+type colInfo struct {
+	Table string // 所属表名或别名
+	Name  string
+}
+
+// evalContext 是表达式求值时的行环境
+type evalContext struct {
+	cols    []colInfo
+	row     []Value
+	aggs    map[*FuncCall]Value // 聚合查询中各聚合调用的结果
+	aliases map[string]Expr     // SELECT 列别名，可在 HAVING/ORDER BY 中引用
+}
+
+func (ctx *evalContext) lookup(ref *ColumnRef) (Value, error) {
+	idx, err := resolveColumn(ctx.cols, ref)
+	if err == nil {
+		return ctx.row[idx], nil
+	}
+	if ref.Table == "" && ctx.aliases != nil {
+		for name, e := range ctx.aliases {
+			if strings.EqualFold(name, ref.Name) {
+				return evalExpr(e, ctx)
+			}
+		}
+	}
+	return Null, err
+}
+
+func resolveColumn(cols []colInfo, ref *ColumnRef) (int, error) {
+	found := -1
+	for i, c := range cols {
+		if !strings.EqualFold(c.Name, ref.Name) {
+			continue
+		}
+		if ref.Table != "" && !strings.EqualFold(c.Table, ref.Table) {
+			continue
+		}
+		if found >= 0 {
+			return -1, fmt.Errorf("ambiguous column name: %s", ref.Name)
+		}
+		found = i
+	}
+	if found < 0 {
+		if ref.Table != "" {
+			return -1, fmt.Errorf("no such column: %s.%s", ref.Table, ref.Name)
+		}
+		return -1, fmt.Errorf("no such column: %s", ref.Name)
+	}
+	return found, nil
+}
+
+func evalExpr(e Expr, ctx *evalContext) (Value, error) {
+	switch e := e.(type) {
+	case *Literal:
+		return e.Val, nil
+	case *ColumnRef:
+		return ctx.lookup(e)
+	case *UnaryExpr:
+		x, err := evalExpr(e.X, ctx)
+		if err != nil {
+			return Null, err
+		}
+		return evalUnary(e.Op, x)
+	case *BinaryExpr:
+		return evalBinary(e, ctx)
+	case *IsNullExpr:
+		x, err := evalExpr(e.X, ctx)
+		if err != nil {
+			return Null, err
+		}
+		return boolValue(x.IsNull() != e.Not), nil
+	case *InExpr:
+		return evalIn(e, ctx)
+	case *BetweenExpr:
+		x, err := evalExpr(e.X, ctx)
+		if err != nil {
+			return Null, err
+		}
+		low, err := evalExpr(e.Low, ctx)
+		if err != nil {
+			return Null, err
+		}
+		high, err := evalExpr(e.High, ctx)
+		if err != nil {
+			return Null, err
+		}
+		if x.IsNull() || low.IsNull() || high.IsNull() {
+			return Null, nil
+		}
+		in := compareValues(x, low) >= 0 && compareValues(x, high) <= 0
+		return boolValue(in != e.Not), nil
+	case *FuncCall:
+		if v, ok := ctx.aggs[e]; ok {
+			return v, nil
+		}
+		if isAggregateCall(e) {
+			return Null, fmt.Errorf("misuse of aggregate function %s()", e.Name)
+		}
+		return evalScalarFunc(e, ctx)
+	}
+	return Null, fmt.Errorf("unsupported expression %T", e)
+}
+
+func boolValue(b bool) Value {
+	if b {
+		return IntValue(1)
+	}
+	return IntValue(0)
+}
+
+func evalUnary(op string, x Value) (Value, error) {
+	switch op {
+	case "NOT":
+		if x.IsNull() {
+			return Null, nil
+		}
+		return boolValue(!x.truthy()), nil
+	case "+":
+		return x, nil
+	case "-":
+		if x.IsNull() {
+			return Null, nil
+		}
+		n := toNumeric(x)
+		if n.Kind == KindInt {
+			return IntValue(-n.I), nil
+		}
+		return FloatValue(-n.F), nil
+	}
+	return Null, fmt.Errorf("unsupported unary operator %s", op)
+}
+
+func evalBinary(e *BinaryExpr, ctx *evalContext) (Value, error) {
+	left, err := evalExpr(e.Left, ctx)
+	if err != nil {
+		return Null, err
+	}
+
+	// AND/OR 使用三值逻辑并短路
+	switch e.Op {
+	case "AND":
+		if !left.IsNull() && !left.truthy() {
+			return boolValue(false), nil
+		}
+		right, err := evalExpr(e.Right, ctx)
+		if err != nil {
+			return Null, err
+		}
+		if !right.IsNull() && !right.truthy() {
+			return boolValue(false), nil
+		}
+		if left.IsNull() || right.IsNull() {
+			return Null, nil
+		}
+		return boolValue(true), nil
+	case "OR":
+		if left.truthy() {
+			return boolValue(true), nil
+		}
+		right, err := evalExpr(e.Right, ctx)
+		if err != nil {
+			return Null, err
+		}
+		if right.truthy() {
+			return boolValue(true), nil
+		}
+		if left.IsNull() || right.IsNull() {
+			return Null, nil
+		}
+		return boolValue(false), nil
+	}
+
+	right, err := evalExpr(e.Right, ctx)
+	if err != nil {
+		return Null, err
+	}
+	if left.IsNull() || right.IsNull() {
+		return Null, nil
+	}
+
+	switch e.Op {
+	case "=":
+		return boolValue(compareValues(left, right) == 0), nil
+	case "!=":
+		return boolValue(compareValues(left, right) != 0), nil
+	case "<":
+		return boolValue(compareValues(left, right) < 0), nil
+	case "<=":
+		return boolValue(compareValues(left, right) <= 0), nil
+	case ">":
+		return boolValue(compareValues(left, right) > 0), nil
+	case ">=":
+		return boolValue(compareValues(left, right) >= 0), nil
+	case "||":
+		return TextValue(left.String() + right.String()), nil
+	case "LIKE":
+		return boolValue(likeMatch(strings.ToLower(right.String()), strings.ToLower(left.String()))), nil
+	case "+", "-", "*", "/", "%":
+		return arith(e.Op, toNumeric(left), toNumeric(right))
+	}
+	return Null, fmt.Errorf("unsupported operator %s", e.Op)
+}
+
+func toNumeric(v Value) Value {
+	if v.isNumeric() {
+		return v
+	}
+	if n, ok := parseNumber(v.S); ok {
+		return n
+	}
+	return IntValue(0)
+}
+
+func arith(op string, a, b Value) (Value, error) {
+	if a.Kind == KindInt && b.Kind == KindInt {
+		switch op {
+		case "+":
+			return IntValue(a.I + b.I), nil
+		case "-":
+			return IntValue(a.I - b.I), nil
+		case "*":
+			return IntValue(a.I * b.I), nil
+		case "/":
+			if b.I == 0 {
+				return Null, nil
+			}
+			return IntValue(a.I / b.I), nil
+		case "%":
+			if b.I == 0 {
+				return Null, nil
+			}
+			return IntValue(a.I % b.I), nil
+		}
+	}
+	fa, fb := a.toFloat(), b.toFloat()
+	switch op {
+	case "+":
+		return FloatValue(fa + fb), nil
+	case "-":
+		return FloatValue(fa - fb), nil
+	case "*":
+		return FloatValue(fa * fb), nil
+	case "/":
+		if fb == 0 {
+			return Null, nil
+		}
+		return FloatValue(fa / fb), nil
+	case "%":
+		if fb == 0 {
+			return Null, nil
+		}
+		return FloatValue(math.Mod(fa, fb)), nil
+	}
+	return Null, fmt.Errorf("unsupported operator %s", op)
+}
+
+func evalIn(e *InExpr, ctx *evalContext) (Value, error) {
+	x, err := evalExpr(e.X, ctx)
+	if err != nil {
+		return Null, err
+	}
+	if x.IsNull() {
+		return Null, nil
+	}
+	sawNull := false
+	for _, item := range e.List {
+		v, err := evalExpr(item, ctx)
+		if err != nil {
+			return Null, err
+		}
+		if v.IsNull() {
+			sawNull = true
+			continue
+		}
+		if compareValues(x, v) == 0 {
+			return boolValue(!e.Not), nil
+		}
+	}
+	if sawNull {
+		return Null, nil
+	}
+	return boolValue(e.Not), nil
+}
+
+// likeMatch 实现 LIKE 的 % 与 _ 通配
+func likeMatch(pattern, s string) bool {
+	if pattern == "" {
+		return s == ""
+	}
+	switch pattern[0] {
+	case '%':
+		for i := 0; i <= len(s); i++ {
+			if likeMatch(pattern[1:], s[i:]) {
+				return true
+			}
+		}
+		return false
+	case '_':
+		return s != "" && likeMatch(pattern[1:], s[1:])
+	}
+	return s != "" && s[0] == pattern[0] && likeMatch(pattern[1:], s[1:])
+}
+
+func evalScalarFunc(fc *FuncCall, ctx *evalContext) (Value, error) {
+	args := make([]Value, len(fc.Args))
+	for i, a := range fc.Args {
+		v, err := evalExpr(a, ctx)
+		if err != nil {
+			return Null, err
+		}
+		args[i] = v
+	}
+	argc := func(n int) error {
+		if len(args) != n {
+			return fmt.Errorf("wrong number of arguments to function %s()", fc.Name)
+		}
+		return nil
+	}
+
+	switch fc.Name {
+	case "COALESCE", "IFNULL":
+		if len(args) < 2 {
+			return Null, fmt.Errorf("wrong number of arguments to function %s()", fc.Name)
+		}
+		for _, v := range args {
+			if !v.IsNull() {
+				return v, nil
+			}
+		}
+		return Null, nil
+	case "TYPEOF":
+		if err := argc(1); err != nil {
+			return Null, err
+		}
+		return TextValue(strings.ToLower(args[0].Kind.String())), nil
+	case "LENGTH":
+		if err := argc(1); err != nil {
+			return Null, err
+		}
+		if args[0].IsNull() {
+			return Null, nil
+		}
+		if args[0].Kind == KindBlob {
+			return IntValue(int64(len(args[0].S))), nil
+		}
+		return IntValue(int64(len([]rune(args[0].String())))), nil
+	case "UPPER", "LOWER":
+		if err := argc(1); err != nil {
+			return Null, err
+		}
+		if args[0].IsNull() {
+			return Null, nil
+		}
+		if fc.Name == "UPPER" {
+			return TextValue(strings.ToUpper(args[0].String())), nil
+		}
+		return TextValue(strings.ToLower(args[0].String())), nil
+	case "ABS":
+		if err := argc(1); err != nil {
+			return Null, err
+		}
+		v := args[0]
+		if v.IsNull() {
+			return Null, nil
+		}
+		v = toNumeric(v)
+		if v.Kind == KindInt {
+			if v.I < 0 {
+				return IntValue(-v.I), nil
+			}
+			return v, nil
+		}
+		return FloatValue(math.Abs(v.F)), nil
+	case "MIN", "MAX":
+		// 多参数形式是标量函数
+		var best Value
+		for i, v := range args {
+			if v.IsNull() {
+				return Null, nil
+			}
+			c := compareValues(v, best)
+			if i == 0 || (fc.Name == "MIN" && c < 0) || (fc.Name == "MAX" && c > 0) {
+				best = v
+			}
+		}
+		return best, nil
+	}
+	return Null, fmt.Errorf("no such function: %s", fc.Name)
+}
@@ -0,0 +1,262 @@
+package db
+
+import (
+	"fmt"
+	"mySQLite/store"
+	"sort"
+	"strings"
+)
+
+/*
+二级索引也是一棵 B+ 树，每条索引记录有两个字段：
+
+| 字段 | 内容                          |
+| ---- | ----------------------------- |
+| 0    | 列值 + "\x01" + 表的 key（排序用） |
+| 1    | 表的 key                      |
+
+内部页的 cell 用 "\x00" 结束 key，所以分隔符用 "\x01"。NULL 值不进入索引。索引的元数据以 ["index", name, table, root, sql] 的形式记录在 mydb_master。
+*/
+
+type Index struct {
+	Name     string
+	Table    string
+	Column   string
+	RootPage int
+	Pager    *store.Pager
+}
+
+func (idx *Index) createSQL() string {
+	return fmt.Sprintf("CREATE INDEX %s ON %s(%s)", quoteIdent(idx.Name), quoteIdent(idx.Table), quoteIdent(idx.Column))
+}
+
+func (idx *Index) metaRow() []string {
+	return []string{"index", idx.Name, idx.Table, fmt.Sprint(idx.RootPage), idx.createSQL()}
+}
+
+func indexFromMeta(fields []string) (*Index, error) {
+	stmt, err := parseCreateIndex(fields[4])
+	if err != nil {
+		return nil, fmt.Errorf("index %s: %w", fields[1], err)
+	}
+	root, err := metaRootPage(fields[1], fields[3])
+	if err != nil {
+		return nil, err
+	}
+	return &Index{Name: fields[1], Table: stmt.Table, Column: stmt.Column, RootPage: root}, nil
+}
+
+// indexPrefix 返回某个值在索引中的 key 前缀
+func indexPrefix(v Value) string {
+	return v.storageString() + "\x01"
+}
+
+// indexEntry 由表中的一行生成索引记录，列值为 NULL 时返回 nil
+func (t *Table) indexEntry(idx *Index, row []Value) ([]byte, string, error) {
+	col := indexOfName(t.Columns, idx.Column)
+	if col < 0 || row[col].IsNull() {
+		return nil, "", nil
+	}
+	pk := row[t.keyColumn()].storageString()
+	key := indexPrefix(row[col]) + pk
+	data, err := store.EncodeRow([]string{key, pk})
+	return data, key, err
+}
+
+// columnIndex 返回建立在某列上的索引
+func (t *Table) columnIndex(col int) *Index {
+	for _, idx := range t.Indexes {
+		if strings.EqualFold(idx.Column, t.Columns[col]) {
+			return idx
+		}
+	}
+	return nil
+}
+
+func (db *Database) createIndex(sql string) error {
+	stmt, err := parseCreateIndex(sql)
+	if err != nil {
+		return fmt.Errorf("invalid CREATE INDEX syntax: %w", err)
+	}
+	if isReservedName(stmt.Name) {
+		return fmt.Errorf("object name reserved for internal use: %s", stmt.Name)
+	}
+	if _, exists := db.Indexes[stmt.Name]; exists {
+		if stmt.IfNotExists {
+			store.Logger.Println("Index already exists, skip CREATE.")
+			return nil
+		}
+		return fmt.Errorf("index %s already exists", stmt.Name)
+	}
+	if _, exists := db.Tables[stmt.Name]; exists {
+		return fmt.Errorf("there is already a table named %s", stmt.Name)
+	}
+	table, ok := db.Tables[stmt.Table]
+	if !ok {
+		return fmt.Errorf("no such table: %s", stmt.Table)
+	}
+	col := indexOfName(table.Columns, stmt.Column)
+	if col < 0 {
+		return fmt.Errorf("table %s has no column named %s", table.Name, stmt.Column)
+	}
+
+	idx := &Index{Name: stmt.Name, Table: table.Name, Column: table.Columns[col], Pager: db.Pager}
+	if idx.RootPage, err = table.buildIndex(idx); err != nil {
+		return fmt.Errorf("build index: %w", err)
+	}
+
+	if err := db.insertMeta(idx.metaRow()); err != nil {
+		return fmt.Errorf("write index metadata: %w", err)
+	}
+	db.Indexes[idx.Name] = idx
+	table.Indexes = append(table.Indexes, idx)
+	store.Logger.Printf("Index created: %s on %s(%s) at root page %d", idx.Name, table.Name, idx.Column, idx.RootPage)
+	return nil
+}
+
+// buildIndex 扫描表中已有的行，按 key 排序后批量加载成索引的 B+ 树，返回根页号
+func (t *Table) buildIndex(idx *Index) (int, error) {
+	type entry struct {
+		key  string
+		data []byte
+	}
+	var entries []entry
+	err := t.scan(func(row []Value) error {
+		data, key, err := t.indexEntry(idx, row)
+		if err != nil || data == nil {
+			return err
+		}
+		entries = append(entries, entry{key, data})
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	loader, err := store.NewBulkLoader(idx.Pager, store.DefaultFillFactor)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		if err := loader.Add(e.data); err != nil {
+			return 0, err
+		}
+	}
+	return loader.Finish()
+}
+
+// insert 把一行加入索引，根页变化只更新内存中的 RootPage，由调用方保存元数据
+func (idx *Index) insert(t *Table, row []Value) error {
+	data, _, err := t.indexEntry(idx, row)
+	if err != nil || data == nil {
+		return err
+	}
+	newRoot, err := store.InsertRow(idx.Pager, idx.RootPage, data)
+	if err != nil {
+		return err
+	}
+	idx.RootPage = newRoot
+	return nil
+}
+
+// updateIndexes 在表中插入一行后维护该表的所有索引
+func (db *Database) updateIndexes(t *Table, row []Value) error {
+	for _, idx := range t.Indexes {
+		oldRoot := idx.RootPage
+		if err := idx.insert(t, row); err != nil {
+			return fmt.Errorf("index %s: %w", idx.Name, err)
+		}
+		if idx.RootPage != oldRoot {
+			if err := db.saveIndexMeta(idx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeFromIndexes 为从表中删掉的每一行删除它在各个索引中的一条记录。
+// 相同的行生成相同的索引记录，每行只删一条，不多删也不少删
+func (db *Database) removeFromIndexes(t *Table, removed [][]byte) error {
+	if len(t.Indexes) == 0 {
+		return nil
+	}
+	affs := t.affinities()
+	for _, rec := range removed {
+		row, err := t.decodeRow(rec, affs)
+		if err != nil {
+			return err
+		}
+		for _, idx := range t.Indexes {
+			_, entryKey, err := t.indexEntry(idx, row)
+			if err != nil {
+				return err
+			}
+			if entryKey == "" {
+				continue
+			}
+			if _, err := store.DeleteRow(idx.Pager, idx.RootPage, entryKey); err != nil {
+				return fmt.Errorf("index %s: %w", idx.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// seek 遍历 key（第一列）等于给定值的所有行
+func (t *Table) seek(key string, fn func(row []Value) error) error {
+	affs := t.affinities()
+	return store.SeekRows(t.Pager, t.RootPage, key, func(rec []byte) error {
+		k, err := store.ExtractKey(rec)
+		if err != nil {
+			return err
+		}
+		if k != key {
+			return store.ErrStopScan
+		}
+		row, err := t.decodeRow(rec, affs)
+		if err != nil {
+			return err
+		}
+		return fn(row)
+	})
+}
+
+// indexLookup 通过索引找出某列等于 v 的所有行
+func (t *Table) indexLookup(idx *Index, v Value, fn func(row []Value) error) error {
+	prefix := indexPrefix(v)
+	var keys []string
+	seen := map[string]bool{}
+	err := store.SeekRows(idx.Pager, idx.RootPage, prefix, func(rec []byte) error {
+		fields, err := store.DecodeRow(rec)
+		if err != nil {
+			return err
+		}
+		if len(fields) != 2 || !strings.HasPrefix(fields[0], prefix) {
+			return store.ErrStopScan
+		}
+		// 表中 key 重复时，同一个 key 只回表一次
+		if !seen[fields[1]] {
+			seen[fields[1]] = true
+			keys = append(keys, fields[1])
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	col := indexOfName(t.Columns, idx.Column)
+	for _, k := range keys {
+		err := t.seek(k, func(row []Value) error {
+			if compareValues(row[col], v) != 0 {
+				return nil
+			}
+			return fn(row)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
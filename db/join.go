@@ -0,0 +1,415 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 连接策略
+const (
+	joinScan  = iota // 第一个表：全表扫描
+	joinLoop         // 嵌套循环：内表整表读入后逐行比较
+	joinKey          // 内表按 key（第一列）查找，以下三种按优先级排列
+	joinIndex        // 内表通过二级索引查找
+	joinHash         // 等值连接但内表没有可用的 key/索引：对内表建哈希表
+)
+
+// fromTable 是 FROM 中的一个表及其连接方式
+type fromTable struct {
+	table  *Table
+	name   string // 别名或表名
+	offset int    // 该表的列在结果行中的起始位置
+	kind   string // 第一个表为空，否则为 INNER、LEFT 或 CROSS
+	conds  []Expr // ON 条件以及下推到这里的 WHERE 条件
+
+	strategy int
+	column   int    // 查找使用的内表列
+	probe    Expr   // 等值条件中外表一侧的表达式
+	index    *Index // joinIndex 使用的索引
+}
+
+// queryPlan 是 FROM/WHERE 部分的执行计划
+type queryPlan struct {
+	cols     []colInfo
+	tables   []*fromTable
+	filters  []Expr // 只涉及第一个表的 WHERE 条件，扫描时过滤
+	residual Expr   // 无法下推的 WHERE 条件，在连接之后求值
+}
+
+// planFrom 为 FROM 和 WHERE 生成执行计划：把 WHERE 拆成 AND 连接的条件尽量下推，
+// 并为每个连接选择查找方式
+func (db *Database) planFrom(stmt *SelectStmt) (*queryPlan, error) {
+	plan := &queryPlan{}
+	if stmt.From == nil {
+		plan.residual = stmt.Where
+		return plan, nil
+	}
+
+	refs := []*TableRef{stmt.From}
+	kinds := []string{""}
+	ons := []Expr{nil}
+	for _, j := range stmt.Joins {
+		refs = append(refs, j.Table)
+		kinds = append(kinds, j.Kind)
+		ons = append(ons, j.On)
+	}
+	for i, ref := range refs {
+		table, ok := db.lookupTable(ref.Schema, ref.Name)
+		if !ok {
+			return nil, fmt.Errorf("no such table: %s", qualifiedName(ref.Schema, ref.Name))
+		}
+		ft := &fromTable{table: table, name: table.Name, offset: len(plan.cols), kind: kinds[i]}
+		if ref.Alias != "" {
+			ft.name = ref.Alias
+		}
+		for _, t := range plan.tables {
+			if strings.EqualFold(t.name, ft.name) {
+				return nil, fmt.Errorf("ambiguous table name: %s", ft.name)
+			}
+		}
+		for _, c := range table.Columns {
+			plan.cols = append(plan.cols, colInfo{Table: ft.name, Name: c})
+		}
+		ft.conds = splitAnd(ons[i], nil)
+		plan.tables = append(plan.tables, ft)
+	}
+
+	// LEFT JOIN 的内表可能补 NULL，涉及它的 WHERE 条件只能在连接之后求值
+	var residual []Expr
+	for _, c := range splitAnd(stmt.Where, nil) {
+		last, ok := plan.lastTable(c)
+		switch {
+		case !ok:
+			residual = append(residual, c)
+		case last <= 0:
+			plan.filters = append(plan.filters, c)
+		case plan.tables[last].kind != "LEFT":
+			plan.tables[last].conds = append(plan.tables[last].conds, c)
+		default:
+			residual = append(residual, c)
+		}
+	}
+	plan.residual = joinAnd(residual)
+
+	for i, ft := range plan.tables {
+		if i > 0 {
+			plan.chooseStrategy(i, ft)
+		}
+	}
+	return plan, nil
+}
+
+// chooseStrategy 在等值条件中优先选择 key 查找，其次索引查找，最后哈希连接
+func (plan *queryPlan) chooseStrategy(i int, ft *fromTable) {
+	ft.strategy = joinLoop
+	for _, c := range ft.conds {
+		be, ok := c.(*BinaryExpr)
+		if !ok || be.Op != "=" {
+			continue
+		}
+		for _, side := range [][2]Expr{{be.Left, be.Right}, {be.Right, be.Left}} {
+			col, ok := plan.innerColumn(i, side[0])
+			if !ok {
+				continue
+			}
+			if last, ok := plan.lastTable(side[1]); !ok || last >= i {
+				continue
+			}
+			strategy := joinHash
+			var idx *Index
+			if col == ft.table.keyColumn() {
+				strategy = joinKey
+			} else if idx = ft.table.columnIndex(col); idx != nil {
+				strategy = joinIndex
+			}
+			if ft.strategy == joinLoop || strategy < ft.strategy {
+				ft.strategy, ft.column, ft.probe, ft.index = strategy, col, side[1], idx
+			}
+		}
+	}
+}
+
+// innerColumn 判断表达式是否为第 i 个表的列，返回列在表中的位置
+func (plan *queryPlan) innerColumn(i int, e Expr) (int, bool) {
+	ref, ok := e.(*ColumnRef)
+	if !ok {
+		return 0, false
+	}
+	idx, err := resolveColumn(plan.cols, ref)
+	if err != nil || plan.tableOf(idx) != i {
+		return 0, false
+	}
+	return idx - plan.tables[i].offset, true
+}
+
+func (plan *queryPlan) tableOf(col int) int {
+	for i := len(plan.tables) - 1; i >= 0; i-- {
+		if col >= plan.tables[i].offset {
+			return i
+		}
+	}
+	return -1
+}
+
+// lastTable 返回表达式引用的最后一个表的序号（不引用任何列时为 -1），
+// 列名无法解析时 ok 为 false
+func (plan *queryPlan) lastTable(e Expr) (last int, ok bool) {
+	last, ok = -1, true
+	walkExpr(e, func(x Expr) {
+		ref, isRef := x.(*ColumnRef)
+		if !isRef {
+			return
+		}
+		idx, err := resolveColumn(plan.cols, ref)
+		if err != nil {
+			ok = false
+			return
+		}
+		if t := plan.tableOf(idx); t > last {
+			last = t
+		}
+	})
+	return last, ok
+}
+
+// walkExpr 先序遍历表达式树
+func walkExpr(e Expr, fn func(Expr)) {
+	if e == nil {
+		return
+	}
+	fn(e)
+	switch e := e.(type) {
+	case *UnaryExpr:
+		walkExpr(e.X, fn)
+	case *BinaryExpr:
+		walkExpr(e.Left, fn)
+		walkExpr(e.Right, fn)
+	case *IsNullExpr:
+		walkExpr(e.X, fn)
+	case *InExpr:
+		walkExpr(e.X, fn)
+		for _, item := range e.List {
+			walkExpr(item, fn)
+		}
+	case *BetweenExpr:
+		walkExpr(e.X, fn)
+		walkExpr(e.Low, fn)
+		walkExpr(e.High, fn)
+	case *FuncCall:
+		for _, a := range e.Args {
+			walkExpr(a, fn)
+		}
+	}
+}
+
+func splitAnd(e Expr, out []Expr) []Expr {
+	if e == nil {
+		return out
+	}
+	if be, ok := e.(*BinaryExpr); ok && be.Op == "AND" {
+		return splitAnd(be.Right, splitAnd(be.Left, out))
+	}
+	return append(out, e)
+}
+
+func joinAnd(list []Expr) Expr {
+	var e Expr
+	for _, c := range list {
+		if e == nil {
+			e = c
+		} else {
+			e = &BinaryExpr{Op: "AND", Left: e, Right: c}
+		}
+	}
+	return e
+}
+
+// orderedBy 返回结果行按哪一列有序：连接保持外表顺序，所以与第一个表的扫描顺序相同
+func (plan *queryPlan) orderedBy() int {
+	if len(plan.tables) == 0 {
+		return -1
+	}
+	return plan.tables[0].table.keyColumn()
+}
+
+// explain 返回每个表的访问方式
+func (plan *queryPlan) explain() []string {
+	var details []string
+	for _, ft := range plan.tables {
+		name := ft.table.Name
+		if ft.name != ft.table.Name {
+			name += " AS " + ft.name
+		}
+		col := ""
+		if ft.strategy != joinScan && ft.strategy != joinLoop {
+			col = ft.table.Columns[ft.column]
+		}
+		switch ft.strategy {
+		case joinScan, joinLoop:
+			details = append(details, "SCAN "+name)
+		case joinKey:
+			details = append(details, fmt.Sprintf("SEARCH %s USING KEY (%s=?)", name, col))
+		case joinIndex:
+			details = append(details, fmt.Sprintf("SEARCH %s USING INDEX %s (%s=?)", name, ft.index.Name, col))
+		case joinHash:
+			details = append(details, fmt.Sprintf("HASH JOIN %s (%s=?)", name, col))
+		}
+	}
+	return details
+}
+
+// source 返回 FROM/WHERE 产生的行，每行包含所有表的列
+func (plan *queryPlan) source() rowSource {
+	if len(plan.tables) == 0 {
+		// 没有 FROM 时只产生一行空行
+		return func(fn func(row []Value) error) error { return fn(nil) }
+	}
+	width := len(plan.cols)
+	first := plan.tables[0]
+	var src rowSource = func(fn func(row []Value) error) error {
+		return first.table.scan(func(values []Value) error {
+			row := make([]Value, width)
+			for i := range row {
+				row[i] = Null
+			}
+			copy(row[first.offset:], values)
+			ok, err := allTrue(plan.filters, plan.cols, row)
+			if err != nil || !ok {
+				return err
+			}
+			return fn(row)
+		})
+	}
+	for _, ft := range plan.tables[1:] {
+		src = plan.joinSource(src, ft)
+	}
+	if plan.residual != nil {
+		src = filterSource(src, plan.cols, plan.residual)
+	}
+	return src
+}
+
+// joinSource 对外表的每一行找出内表中满足连接条件的行。
+// LEFT JOIN 没有匹配时输出内表列全为 NULL 的一行。
+func (plan *queryPlan) joinSource(outer rowSource, ft *fromTable) rowSource {
+	return func(fn func(row []Value) error) error {
+		candidates := plan.candidates(ft)
+		return outer(func(outerRow []Value) error {
+			matched := false
+			err := candidates(outerRow, func(inner []Value) error {
+				row := append([]Value(nil), outerRow...)
+				copy(row[ft.offset:], inner)
+				ok, err := allTrue(ft.conds, plan.cols, row)
+				if err != nil || !ok {
+					return err
+				}
+				matched = true
+				return fn(row)
+			})
+			if err != nil {
+				return err
+			}
+			if !matched && ft.kind == "LEFT" {
+				return fn(append([]Value(nil), outerRow...))
+			}
+			return nil
+		})
+	}
+}
+
+// candidates 按连接策略返回给定外表行对应的内表候选行，连接条件由调用方再次检查
+func (plan *queryPlan) candidates(ft *fromTable) func(outer []Value, fn func(inner []Value) error) error {
+	t := ft.table
+	aff := affinityNumeric
+	if ft.strategy != joinLoop {
+		aff = t.affinities()[ft.column]
+	}
+	// probeValue 计算外表一侧的值，并按内表列的亲和性转换，使其与存储形式一致
+	probeValue := func(outer []Value) (Value, error) {
+		v, err := evalExpr(ft.probe, &evalContext{cols: plan.cols, row: outer})
+		if err != nil {
+			return Null, err
+		}
+		return applyAffinity(v, aff), nil
+	}
+
+	switch ft.strategy {
+	case joinKey:
+		return func(outer []Value, fn func(inner []Value) error) error {
+			v, err := probeValue(outer)
+			if err != nil || v.IsNull() {
+				return err
+			}
+			return t.seek(v.storageString(), fn)
+		}
+	case joinIndex:
+		return func(outer []Value, fn func(inner []Value) error) error {
+			v, err := probeValue(outer)
+			if err != nil || v.IsNull() {
+				return err
+			}
+			return t.indexLookup(ft.index, v, fn)
+		}
+	case joinHash:
+		var buckets map[string][][]Value
+		return func(outer []Value, fn func(inner []Value) error) error {
+			if buckets == nil {
+				buckets = map[string][][]Value{}
+				err := t.scan(func(row []Value) error {
+					if v := row[ft.column]; !v.IsNull() {
+						buckets[v.groupKey()] = append(buckets[v.groupKey()], row)
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			v, err := probeValue(outer)
+			if err != nil || v.IsNull() {
+				return err
+			}
+			for _, row := range buckets[v.groupKey()] {
+				if err := fn(row); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	var rows [][]Value
+	loaded := false
+	return func(outer []Value, fn func(inner []Value) error) error {
+		if !loaded {
+			err := t.scan(func(row []Value) error {
+				rows = append(rows, row)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			loaded = true
+		}
+		for _, row := range rows {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func allTrue(conds []Expr, cols []colInfo, row []Value) (bool, error) {
+	ctx := &evalContext{cols: cols, row: row}
+	for _, c := range conds {
+		v, err := evalExpr(c, ctx)
+		if err != nil {
+			return false, err
+		}
+		if !v.truthy() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
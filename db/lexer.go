@@ -0,0 +1,150 @@
+package db
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokKeyword
+	tokNumber
+	tokString
+	tokBlob
+	tokSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string // 关键字统一为大写，字符串为去掉引号后的内容
+	pos  int
+}
+
+var keywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "BY": true,
+	"HAVING": true, "ORDER": true, "ASC": true, "DESC": true, "LIMIT": true,
+	"OFFSET": true, "AS": true, "AND": true, "OR": true, "NOT": true,
+	"NULL": true, "IS": true, "DISTINCT": true, "ALL": true, "CREATE": true,
+	"TABLE": true, "INSERT": true, "INTO": true, "VALUES": true, "LIKE": true,
+	"IN": true, "BETWEEN": true, "JOIN": true, "INNER": true, "LEFT": true,
+	"OUTER": true, "CROSS": true, "ON": true, "INDEX": true, "EXPLAIN": true,
+}
+
+func tokenize(sql string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(sql) {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			// 行注释
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case (c == 'x' || c == 'X') && i+1 < len(sql) && sql[i+1] == '\'':
+			s, n, err := readQuoted(sql, i+1, '\'')
+			if err != nil {
+				return nil, err
+			}
+			b, err := hex.DecodeString(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid blob literal at %d", i)
+			}
+			toks = append(toks, token{kind: tokBlob, text: string(b), pos: i})
+			i = n
+		case isIdentStart(c):
+			start := i
+			for i < len(sql) && isIdentPart(sql[i]) {
+				i++
+			}
+			word := sql[start:i]
+			if keywords[strings.ToUpper(word)] {
+				toks = append(toks, token{kind: tokKeyword, text: strings.ToUpper(word), pos: start})
+			} else {
+				toks = append(toks, token{kind: tokIdent, text: word, pos: start})
+			}
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(sql) && sql[i+1] >= '0' && sql[i+1] <= '9':
+			start := i
+			for i < len(sql) && (sql[i] >= '0' && sql[i] <= '9' || sql[i] == '.') {
+				i++
+			}
+			if i < len(sql) && (sql[i] == 'e' || sql[i] == 'E') {
+				j := i + 1
+				if j < len(sql) && (sql[j] == '+' || sql[j] == '-') {
+					j++
+				}
+				if j < len(sql) && sql[j] >= '0' && sql[j] <= '9' {
+					i = j
+					for i < len(sql) && sql[i] >= '0' && sql[i] <= '9' {
+						i++
+					}
+				}
+			}
+			toks = append(toks, token{kind: tokNumber, text: sql[start:i], pos: start})
+		case c == '\'':
+			s, n, err := readQuoted(sql, i, '\'')
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, token{kind: tokString, text: s, pos: i})
+			i = n
+		case c == '"' || c == '`':
+			s, n, err := readQuoted(sql, i, c)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, token{kind: tokIdent, text: s, pos: i})
+			i = n
+		default:
+			if i+1 < len(sql) {
+				two := sql[i : i+2]
+				switch two {
+				case "<=", ">=", "<>", "!=", "==", "||":
+					toks = append(toks, token{kind: tokSymbol, text: two, pos: i})
+					i += 2
+					continue
+				}
+			}
+			if strings.IndexByte("(),;*+-/%=<>.", c) < 0 {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+			toks = append(toks, token{kind: tokSymbol, text: string(c), pos: i})
+			i++
+		}
+	}
+	toks = append(toks, token{kind: tokEOF, pos: len(sql)})
+	return toks, nil
+}
+
+// readQuoted 读取从 start 开始的引号串，两个连续引号表示转义
+func readQuoted(sql string, start int, quote byte) (string, int, error) {
+	var sb strings.Builder
+	i := start + 1
+	for i < len(sql) {
+		if sql[i] == quote {
+			if i+1 < len(sql) && sql[i+1] == quote {
+				sb.WriteByte(quote)
+				i += 2
+				continue
+			}
+			return sb.String(), i + 1, nil
+		}
+		sb.WriteByte(sql[i])
+		i++
+	}
+	return "", 0, fmt.Errorf("unterminated quoted string at %d", start)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
@@ -0,0 +1,1057 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type parser struct {
+	sql  string
+	toks []token
+	pos  int
+}
+
+func newParser(sql string) (*parser, error) {
+	toks, err := tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{sql: sql, toks: toks}, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) peekAt(n int) token {
+	if p.pos+n >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+	return p.toks[p.pos+n]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isWord 判断 token 是否为给定关键字（不区分大小写，也匹配同名标识符）
+func isWord(t token, word string) bool {
+	return (t.kind == tokKeyword || t.kind == tokIdent) && strings.EqualFold(t.text, word)
+}
+
+func (p *parser) acceptWord(word string) bool {
+	if isWord(p.peek(), word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectWord(word string) error {
+	if !p.acceptWord(word) {
+		return p.errorf("expected %s", word)
+	}
+	return nil
+}
+
+func (p *parser) acceptSymbol(sym string) bool {
+	t := p.peek()
+	if t.kind == tokSymbol && t.text == sym {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectSymbol(sym string) error {
+	if !p.acceptSymbol(sym) {
+		return p.errorf("expected %q", sym)
+	}
+	return nil
+}
+
+func (p *parser) expectIdent() (string, error) {
+	t := p.peek()
+	if t.kind != tokIdent {
+		return "", p.errorf("expected identifier")
+	}
+	p.pos++
+	return t.text, nil
+}
+
+// expectEnd 允许语句末尾有分号，之后不应再有内容
+func (p *parser) expectEnd() error {
+	p.acceptSymbol(";")
+	if p.peek().kind != tokEOF {
+		return p.errorf("unexpected trailing input")
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	t := p.peek()
+	near := "end of input"
+	if t.kind != tokEOF {
+		near = fmt.Sprintf("%q", t.text)
+	}
+	return fmt.Errorf("syntax error near %s: %s", near, fmt.Sprintf(format, args...))
+}
+
+// textFrom 返回从 token start 到当前位置之间的原始 SQL 文本
+func (p *parser) textFrom(start int) string {
+	end := p.peek().pos
+	return strings.TrimSpace(p.sql[p.toks[start].pos:end])
+}
+
+// parseQuery 解析 SELECT，允许前面带 EXPLAIN QUERY PLAN
+func parseQuery(sql string) (*SelectStmt, bool, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return nil, false, err
+	}
+	explain := false
+	if p.acceptWord("EXPLAIN") {
+		if err := p.expectWord("QUERY"); err != nil {
+			return nil, false, err
+		}
+		if err := p.expectWord("PLAN"); err != nil {
+			return nil, false, err
+		}
+		explain = true
+	}
+	stmt, err := p.parseSelect()
+	if err != nil {
+		return nil, false, err
+	}
+	return stmt, explain, p.expectEnd()
+}
+
+func (p *parser) parseSelect() (*SelectStmt, error) {
+	if err := p.expectWord("SELECT"); err != nil {
+		return nil, err
+	}
+	stmt := &SelectStmt{}
+	if p.acceptWord("DISTINCT") {
+		stmt.Distinct = true
+	} else {
+		p.acceptWord("ALL")
+	}
+
+	for {
+		col, err := p.parseSelectColumn()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Columns = append(stmt.Columns, col)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+
+	if p.acceptWord("FROM") {
+		ref, err := p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+		stmt.From = ref
+		if stmt.Joins, err = p.parseJoins(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptWord("WHERE") {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Where = e
+	}
+
+	if p.acceptWord("GROUP") {
+		if err := p.expectWord("BY"); err != nil {
+			return nil, err
+		}
+		list, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		stmt.GroupBy = list
+	}
+
+	if p.acceptWord("HAVING") {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Having = e
+	}
+
+	if p.acceptWord("ORDER") {
+		if err := p.expectWord("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			item := OrderItem{Expr: e}
+			if p.acceptWord("DESC") {
+				item.Desc = true
+			} else {
+				p.acceptWord("ASC")
+			}
+			stmt.OrderBy = append(stmt.OrderBy, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptWord("LIMIT") {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Limit = e
+		if p.acceptWord("OFFSET") {
+			if stmt.Offset, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		} else if p.acceptSymbol(",") {
+			// LIMIT offset, count
+			count, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Offset, stmt.Limit = stmt.Limit, count
+		}
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseSelectColumn() (SelectColumn, error) {
+	if p.acceptSymbol("*") {
+		return SelectColumn{Star: true, Text: "*"}, nil
+	}
+	// t.*
+	if p.peek().kind == tokIdent && p.peekAt(1).text == "." && p.peekAt(2).text == "*" {
+		table := p.next().text
+		p.next()
+		p.next()
+		return SelectColumn{Star: true, StarTable: table, Text: table + ".*"}, nil
+	}
+
+	start := p.pos
+	e, err := p.parseExpr()
+	if err != nil {
+		return SelectColumn{}, err
+	}
+	col := SelectColumn{Expr: e, Text: p.textFrom(start)}
+	if p.acceptWord("AS") {
+		t := p.next()
+		if t.kind != tokIdent && t.kind != tokString {
+			return SelectColumn{}, p.errorf("expected alias")
+		}
+		col.Alias = t.text
+	} else if p.peek().kind == tokIdent {
+		col.Alias = p.next().text
+	}
+	return col, nil
+}
+
+// parseQualifiedName 解析 [schema.]name
+func (p *parser) parseQualifiedName() (schema, name string, err error) {
+	if name, err = p.expectIdent(); err != nil {
+		return "", "", err
+	}
+	if p.acceptSymbol(".") {
+		schema = name
+		if name, err = p.expectIdent(); err != nil {
+			return "", "", err
+		}
+	}
+	return schema, name, nil
+}
+
+func (p *parser) parseTableRef() (*TableRef, error) {
+	schema, name, err := p.parseQualifiedName()
+	if err != nil {
+		return nil, err
+	}
+	ref := &TableRef{Schema: schema, Name: name}
+	if p.acceptWord("AS") {
+		if ref.Alias, err = p.expectIdent(); err != nil {
+			return nil, err
+		}
+	} else if p.peek().kind == tokIdent {
+		ref.Alias = p.next().text
+	}
+	return ref, nil
+}
+
+// parseJoins 解析 FROM 第一个表之后的逗号连接和 [INNER|LEFT [OUTER]|CROSS] JOIN
+func (p *parser) parseJoins() ([]JoinClause, error) {
+	var joins []JoinClause
+	for {
+		kind := "INNER"
+		if p.acceptSymbol(",") {
+			kind = "CROSS"
+		} else {
+			switch {
+			case p.acceptWord("CROSS"):
+				kind = "CROSS"
+			case p.acceptWord("INNER"):
+			case p.acceptWord("LEFT"):
+				kind = "LEFT"
+				p.acceptWord("OUTER")
+			case isWord(p.peek(), "JOIN"):
+			default:
+				return joins, nil
+			}
+			if err := p.expectWord("JOIN"); err != nil {
+				return nil, err
+			}
+		}
+		ref, err := p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+		join := JoinClause{Kind: kind, Table: ref}
+		if kind != "CROSS" && p.acceptWord("ON") {
+			if join.On, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		}
+		joins = append(joins, join)
+	}
+}
+
+func (p *parser) parseExprList() ([]Expr, error) {
+	var list []Expr
+	for {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+		if !p.acceptSymbol(",") {
+			return list, nil
+		}
+	}
+}
+
+// 表达式优先级（低到高）：OR, AND, NOT, 比较, + -, * / %, ||, 一元运算
+func (p *parser) parseExpr() (Expr, error) { return p.parseOr() }
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptWord("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptWord("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.acceptWord("NOT") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: "NOT", X: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokSymbol && isComparisonOp(t.text):
+			p.next()
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			op := t.text
+			switch op {
+			case "==":
+				op = "="
+			case "<>":
+				op = "!="
+			}
+			left = &BinaryExpr{Op: op, Left: left, Right: right}
+		case isWord(t, "IS"):
+			p.next()
+			not := p.acceptWord("NOT")
+			if err := p.expectWord("NULL"); err != nil {
+				return nil, err
+			}
+			left = &IsNullExpr{X: left, Not: not}
+		case isWord(t, "NOT") && (isWord(p.peekAt(1), "IN") || isWord(p.peekAt(1), "LIKE") || isWord(p.peekAt(1), "BETWEEN")):
+			p.next()
+			e, err := p.parsePostfixPredicate(left, true)
+			if err != nil {
+				return nil, err
+			}
+			left = e
+		case isWord(t, "IN") || isWord(t, "LIKE") || isWord(t, "BETWEEN"):
+			e, err := p.parsePostfixPredicate(left, false)
+			if err != nil {
+				return nil, err
+			}
+			left = e
+		default:
+			return left, nil
+		}
+	}
+}
+
+func (p *parser) parsePostfixPredicate(left Expr, not bool) (Expr, error) {
+	switch {
+	case p.acceptWord("IN"):
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		list, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return &InExpr{X: left, List: list, Not: not}, nil
+	case p.acceptWord("LIKE"):
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		var e Expr = &BinaryExpr{Op: "LIKE", Left: left, Right: right}
+		if not {
+			e = &UnaryExpr{Op: "NOT", X: e}
+		}
+		return e, nil
+	case p.acceptWord("BETWEEN"):
+		low, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectWord("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &BetweenExpr{X: left, Low: low, High: high, Not: not}, nil
+	}
+	return nil, p.errorf("expected IN, LIKE or BETWEEN")
+}
+
+func isComparisonOp(s string) bool {
+	switch s {
+	case "=", "==", "!=", "<>", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseAdditive() (Expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokSymbol || (t.text != "+" && t.text != "-") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: t.text, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (Expr, error) {
+	left, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokSymbol || (t.text != "*" && t.text != "/" && t.text != "%") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: t.text, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseConcat() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptSymbol("||") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "||", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	t := p.peek()
+	if t.kind == tokSymbol && (t.text == "-" || t.text == "+") {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		// 负数字面量直接折叠
+		if lit, ok := x.(*Literal); ok && t.text == "-" {
+			switch lit.Val.Kind {
+			case KindInt:
+				return &Literal{Val: IntValue(-lit.Val.I)}, nil
+			case KindFloat:
+				return &Literal{Val: FloatValue(-lit.Val.F)}, nil
+			}
+		}
+		return &UnaryExpr{Op: t.text, X: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokNumber:
+		p.next()
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &Literal{Val: IntValue(i)}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.text)
+		}
+		return &Literal{Val: FloatValue(f)}, nil
+	case tokString:
+		p.next()
+		return &Literal{Val: TextValue(t.text)}, nil
+	case tokBlob:
+		p.next()
+		return &Literal{Val: BlobValue(t.text)}, nil
+	case tokKeyword:
+		if t.text == "NULL" {
+			p.next()
+			return &Literal{Val: Null}, nil
+		}
+	case tokSymbol:
+		if t.text == "(" {
+			p.next()
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expectSymbol(")")
+		}
+	case tokIdent:
+		p.next()
+		if p.peek().kind == tokSymbol && p.peek().text == "(" {
+			return p.parseFuncCall(t.text)
+		}
+		if p.acceptSymbol(".") {
+			name, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			return &ColumnRef{Table: t.text, Name: name}, nil
+		}
+		return &ColumnRef{Name: t.text}, nil
+	}
+	return nil, p.errorf("expected expression")
+}
+
+func (p *parser) parseFuncCall(name string) (Expr, error) {
+	p.next() // (
+	fc := &FuncCall{Name: strings.ToUpper(name)}
+	if p.acceptSymbol("*") {
+		fc.Star = true
+		return fc, p.expectSymbol(")")
+	}
+	if p.acceptSymbol(")") {
+		return fc, nil
+	}
+	if p.acceptWord("DISTINCT") {
+		fc.Distinct = true
+	}
+	args, err := p.parseExprList()
+	if err != nil {
+		return nil, err
+	}
+	fc.Args = args
+	return fc, p.expectSymbol(")")
+}
+
+func parseCreateTable(sql string) (*CreateTableStmt, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectWord("CREATE"); err != nil {
+		return nil, err
+	}
+	stmt := &CreateTableStmt{}
+	stmt.Temp = p.acceptWord("TEMP") || p.acceptWord("TEMPORARY")
+	if err := p.expectWord("TABLE"); err != nil {
+		return nil, err
+	}
+	if p.acceptWord("IF") {
+		if err := p.expectWord("NOT"); err != nil {
+			return nil, err
+		}
+		if err := p.expectWord("EXISTS"); err != nil {
+			return nil, err
+		}
+		stmt.IfNotExists = true
+	}
+	if stmt.Schema, stmt.Name, err = p.parseQualifiedName(); err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	for {
+		col, err := p.parseColumnDef()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Columns = append(stmt.Columns, col)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return stmt, p.expectEnd()
+}
+
+// 列约束关键字，出现后类型名结束
+var columnConstraintWords = []string{"PRIMARY", "NOT", "NULL", "UNIQUE", "CHECK", "DEFAULT", "REFERENCES", "COLLATE", "CONSTRAINT"}
+
+func isConstraintStart(t token) bool {
+	for _, w := range columnConstraintWords {
+		if isWord(t, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseColumnDef() (ColumnDef, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return ColumnDef{}, err
+	}
+	col := ColumnDef{Name: name}
+
+	// 类型名：若干标识符，后面可跟 (n) 或 (n, m)
+	var typeParts []string
+	for p.peek().kind == tokIdent && !isConstraintStart(p.peek()) {
+		typeParts = append(typeParts, p.next().text)
+	}
+	if len(typeParts) > 0 && p.peek().kind == tokSymbol && p.peek().text == "(" {
+		start := p.pos
+		for !p.acceptSymbol(")") {
+			if p.next().kind == tokEOF {
+				return ColumnDef{}, p.errorf("unterminated type size")
+			}
+		}
+		typeParts[len(typeParts)-1] += p.sql[p.toks[start].pos:p.toks[p.pos-1].pos] + ")"
+	}
+	col.Type = strings.Join(typeParts, " ")
+
+	// 除 DEFAULT 外的约束暂不处理，跳到本列结束
+	depth := 0
+	for {
+		t := p.peek()
+		if depth == 0 && isWord(t, "DEFAULT") {
+			p.next()
+			e, err := p.parseDefault()
+			if err != nil {
+				return ColumnDef{}, err
+			}
+			col.Default = e
+			continue
+		}
+		if t.kind == tokEOF {
+			return col, nil
+		}
+		if t.kind == tokSymbol {
+			if (t.text == "," || t.text == ")") && depth == 0 {
+				return col, nil
+			}
+			if t.text == "(" {
+				depth++
+			} else if t.text == ")" {
+				depth--
+			}
+		}
+		p.next()
+	}
+}
+
+// parseDefault 解析 DEFAULT 后面的值：字面量、带符号的数字或括号中的表达式
+func (p *parser) parseDefault() (Expr, error) {
+	if p.acceptSymbol("(") {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expectSymbol(")")
+	}
+	switch t := p.peek(); {
+	case t.kind == tokNumber || t.kind == tokString || t.kind == tokBlob || isWord(t, "NULL"):
+		return p.parsePrimary()
+	case t.kind == tokSymbol && (t.text == "-" || t.text == "+"):
+		return p.parseUnary()
+	}
+	return nil, p.errorf("default value must be a constant")
+}
+
+func parseInsert(sql string) (*InsertStmt, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectWord("INSERT"); err != nil {
+		return nil, err
+	}
+	if err := p.expectWord("INTO"); err != nil {
+		return nil, err
+	}
+	stmt := &InsertStmt{}
+	if stmt.Schema, stmt.Table, err = p.parseQualifiedName(); err != nil {
+		return nil, err
+	}
+	if p.acceptSymbol("(") {
+		for {
+			col, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Columns = append(stmt.Columns, col)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectWord("VALUES"); err != nil {
+		return nil, err
+	}
+	for {
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		row, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		stmt.Rows = append(stmt.Rows, row)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	return stmt, p.expectEnd()
+}
+
+// CREATE INDEX [IF NOT EXISTS] [schema.]name ON [schema.]table(column)，目前只支持单列索引
+func parseCreateIndex(sql string) (*CreateIndexStmt, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectWord("CREATE"); err != nil {
+		return nil, err
+	}
+	if isWord(p.peek(), "UNIQUE") {
+		return nil, p.errorf("UNIQUE indexes are not supported")
+	}
+	if err := p.expectWord("INDEX"); err != nil {
+		return nil, err
+	}
+	stmt := &CreateIndexStmt{}
+	if p.acceptWord("IF") {
+		if err := p.expectWord("NOT"); err != nil {
+			return nil, err
+		}
+		if err := p.expectWord("EXISTS"); err != nil {
+			return nil, err
+		}
+		stmt.IfNotExists = true
+	}
+	if stmt.Schema, stmt.Name, err = p.parseQualifiedName(); err != nil {
+		return nil, err
+	}
+	if err := p.expectWord("ON"); err != nil {
+		return nil, err
+	}
+	var schema string
+	if schema, stmt.Table, err = p.parseQualifiedName(); err != nil {
+		return nil, err
+	}
+	if schema != "" {
+		if stmt.Schema != "" && !strings.EqualFold(schema, stmt.Schema) {
+			return nil, p.errorf("index and table must be in the same database")
+		}
+		stmt.Schema = schema
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	if stmt.Column, err = p.expectIdent(); err != nil {
+		return nil, err
+	}
+	p.acceptWord("ASC")
+	if p.peek().text == "," {
+		return nil, p.errorf("multi-column indexes are not supported")
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return stmt, p.expectEnd()
+}
+
+// DROP TABLE [IF EXISTS] [schema.]name
+func parseDropTable(sql string) (*DropTableStmt, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectWord("DROP"); err != nil {
+		return nil, err
+	}
+	if err := p.expectWord("TABLE"); err != nil {
+		return nil, err
+	}
+	stmt := &DropTableStmt{}
+	if p.acceptWord("IF") {
+		if err := p.expectWord("EXISTS"); err != nil {
+			return nil, err
+		}
+		stmt.IfExists = true
+	}
+	if stmt.Schema, stmt.Name, err = p.parseQualifiedName(); err != nil {
+		return nil, err
+	}
+	return stmt, p.expectEnd()
+}
+
+// ALTER TABLE [schema.]name ADD [COLUMN] def | RENAME TO new | RENAME [COLUMN] old TO new
+func parseAlterTable(sql string) (*AlterTableStmt, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectWord("ALTER"); err != nil {
+		return nil, err
+	}
+	if err := p.expectWord("TABLE"); err != nil {
+		return nil, err
+	}
+	stmt := &AlterTableStmt{}
+	if stmt.Schema, stmt.Table, err = p.parseQualifiedName(); err != nil {
+		return nil, err
+	}
+	switch {
+	case p.acceptWord("ADD"):
+		p.acceptWord("COLUMN")
+		stmt.Action = "ADD COLUMN"
+		if stmt.Column, err = p.parseColumnDef(); err != nil {
+			return nil, err
+		}
+	case p.acceptWord("RENAME"):
+		if p.acceptWord("TO") {
+			stmt.Action = "RENAME TO"
+		} else {
+			p.acceptWord("COLUMN")
+			stmt.Action = "RENAME COLUMN"
+			if stmt.OldColumn, err = p.expectIdent(); err != nil {
+				return nil, err
+			}
+			if err := p.expectWord("TO"); err != nil {
+				return nil, err
+			}
+		}
+		if stmt.NewName, err = p.expectIdent(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, p.errorf("expected ADD or RENAME")
+	}
+	return stmt, p.expectEnd()
+}
+
+// PRAGMA name [= value | (value)]
+func parsePragma(sql string) (*PragmaStmt, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectWord("PRAGMA"); err != nil {
+		return nil, err
+	}
+	stmt := &PragmaStmt{}
+	if stmt.Name, err = p.expectIdent(); err != nil {
+		return nil, err
+	}
+	switch {
+	case p.acceptSymbol("="):
+		if stmt.Value, err = p.parsePragmaValue(); err != nil {
+			return nil, err
+		}
+	case p.acceptSymbol("("):
+		if stmt.Value, err = p.parsePragmaValue(); err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, p.expectEnd()
+}
+
+// BEGIN | COMMIT | END | ROLLBACK [TRANSACTION]，返回 BEGIN、COMMIT 或 ROLLBACK
+func parseTransaction(sql string) (string, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return "", err
+	}
+	word := strings.ToUpper(p.next().text)
+	switch word {
+	case "END":
+		word = "COMMIT"
+	case "BEGIN", "COMMIT", "ROLLBACK":
+	default:
+		return "", fmt.Errorf("expected BEGIN, COMMIT or ROLLBACK")
+	}
+	p.acceptWord("TRANSACTION")
+	return word, p.expectEnd()
+}
+
+// ATTACH [DATABASE] 'file' AS name
+func parseAttach(sql string) (*AttachStmt, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectWord("ATTACH"); err != nil {
+		return nil, err
+	}
+	p.acceptWord("DATABASE")
+	stmt := &AttachStmt{}
+	if t := p.peek(); t.kind != tokString || t.text == "" {
+		return nil, p.errorf("expected file name")
+	}
+	stmt.File = p.next().text
+	if err := p.expectWord("AS"); err != nil {
+		return nil, err
+	}
+	if stmt.Name, err = p.expectIdent(); err != nil {
+		return nil, err
+	}
+	return stmt, p.expectEnd()
+}
+
+// DETACH [DATABASE] name
+func parseDetach(sql string) (string, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return "", err
+	}
+	if err := p.expectWord("DETACH"); err != nil {
+		return "", err
+	}
+	p.acceptWord("DATABASE")
+	name, err := p.expectIdent()
+	if err != nil {
+		return "", err
+	}
+	return name, p.expectEnd()
+}
+
+// VACUUM [schema] [INTO 'file']
+func parseVacuum(sql string) (*VacuumStmt, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectWord("VACUUM"); err != nil {
+		return nil, err
+	}
+	stmt := &VacuumStmt{}
+	if p.peek().kind == tokIdent {
+		stmt.Schema = p.next().text
+	}
+	if p.acceptWord("INTO") {
+		if t := p.peek(); t.kind != tokString || t.text == "" {
+			return nil, p.errorf("expected file name")
+		}
+		stmt.Into = p.next().text
+	}
+	return stmt, p.expectEnd()
+}
+
+// parsePragmaValue 解析 PRAGMA 的参数，ON、FULL 这样的单词当作文本
+func (p *parser) parsePragmaValue() (Expr, error) {
+	if t := p.peek(); t.kind == tokIdent || t.kind == tokKeyword {
+		p.next()
+		return &Literal{Val: TextValue(t.text)}, nil
+	}
+	return p.parseUnary()
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"fmt"
+	"mySQLite/store"
+	"sort"
+	"strings"
+)
+
+/*
+PRAGMA 语句：
+
+| 语句                        | 结果                                     |
+| --------------------------- | ---------------------------------------- |
+| PRAGMA integrity_check      | 每个问题一行，没有问题时为一行 "ok"      |
+| PRAGMA integrity_check(N)   | 最多列出 N 个问题                        |
+| PRAGMA checksums            | 每页是否带校验和（1 或 0），只能在新建文件时选择 |
+| PRAGMA compression          | 是否压缩、打开以来的压缩比和压缩解压的耗时（微秒） |
+| PRAGMA database_list        | main、temp 和附加的数据库及其文件名，见 attach.go |
+*/
+
+// pragma 执行一条 PRAGMA，返回结果集
+func (db *Database) pragma(sql string) (*ResultSet, error) {
+	stmt, err := parsePragma(sql)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(stmt.Name) {
+	case "integrity_check":
+		limit, err := pragmaInt(stmt, 100)
+		if err != nil {
+			return nil, err
+		}
+		problems, err := db.integrityCheck()
+		if err != nil {
+			return nil, err
+		}
+		rs := &ResultSet{Columns: []string{"integrity_check"}}
+		for i, p := range problems {
+			if i == int(limit) {
+				break
+			}
+			rs.Rows = append(rs.Rows, []Value{TextValue(p.String())})
+		}
+		if len(problems) == 0 {
+			rs.Rows = append(rs.Rows, []Value{TextValue("ok")})
+		}
+		return rs, nil
+	case "checksums":
+		if stmt.Value != nil {
+			return nil, fmt.Errorf("PRAGMA checksums cannot be changed, it is chosen when the database is created")
+		}
+		on := int64(0)
+		if db.Pager.Checksums() {
+			on = 1
+		}
+		return &ResultSet{Columns: []string{"checksums"}, Rows: [][]Value{{IntValue(on)}}}, nil
+	case "compression":
+		if stmt.Value != nil {
+			return nil, fmt.Errorf("PRAGMA compression cannot be changed, it is chosen when the database is created")
+		}
+		on := int64(0)
+		if db.Pager.Compressed() {
+			on = 1
+		}
+		st := db.Pager.CompressionStats()
+		return &ResultSet{
+			Columns: []string{"compression", "pages_written", "ratio", "compress_us", "pages_read", "decompress_us", "cache_hits"},
+			Rows: [][]Value{{IntValue(on), IntValue(st.PagesWritten), FloatValue(st.Ratio()), IntValue(st.CompressTime.Microseconds()),
+				IntValue(st.PagesRead), IntValue(st.DecompressTime.Microseconds()), IntValue(st.CacheHits)}},
+		}, nil
+	case "database_list":
+		rs := &ResultSet{Columns: []string{"seq", "name", "file"}}
+		// 与 SQLite 相同，temp 的序号总是 1，附加的数据库从 2 开始
+		add := func(seq int, name string, d *Database) {
+			rs.Rows = append(rs.Rows, []Value{IntValue(int64(seq)), TextValue(name), TextValue(d.Pager.Filename())})
+		}
+		add(0, "main", db)
+		if db.temp != nil {
+			add(1, "temp", db.temp)
+		}
+		for i, a := range db.attached {
+			add(i+2, a.name, a.db)
+		}
+		return rs, nil
+	}
+	return nil, fmt.Errorf("unknown pragma: %s", stmt.Name)
+}
+
+// pragmaInt 返回 PRAGMA 的整数参数，没有参数时返回 def
+func pragmaInt(stmt *PragmaStmt, def int64) (int64, error) {
+	if stmt.Value == nil {
+		return def, nil
+	}
+	v, err := evalInt(stmt.Value, "PRAGMA "+stmt.Name)
+	if err != nil {
+		return 0, err
+	}
+	if v <= 0 {
+		return 0, fmt.Errorf("PRAGMA %s: argument must be positive", stmt.Name)
+	}
+	return v, nil
+}
+
+// IntegrityCheck 检查元数据表、所有表和索引的 B+ 树以及空闲链表（见 store/integrity.go），
+// 并核对每个索引的记录数与表中对应列不为 NULL 的行数。在快照上进行，不阻塞写者。
+func (db *Database) IntegrityCheck() ([]store.Problem, error) {
+	s, err := db.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	return s.db.integrityCheck()
+}
+
+func (db *Database) integrityCheck() ([]store.Problem, error) {
+	trees := []store.TreeRoot{{Name: MasterTableName, Root: db.Master.RootPage}}
+	var names []string
+	for name := range db.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := db.Tables[name]
+		trees = append(trees, store.TreeRoot{Name: t.Name, Root: t.RootPage})
+		for _, idx := range t.Indexes {
+			trees = append(trees, store.TreeRoot{Name: idx.Name, Root: idx.RootPage})
+		}
+	}
+	problems, err := store.CheckIntegrity(db.Pager, trees)
+	if err != nil {
+		return nil, err
+	}
+
+	// 树的结构没有问题时才能放心遍历，核对索引
+	broken := map[string]bool{}
+	for _, p := range problems {
+		broken[p.Tree] = true
+	}
+	for _, name := range names {
+		t := db.Tables[name]
+		if broken[t.Name] {
+			continue
+		}
+		for _, idx := range t.Indexes {
+			if broken[idx.Name] {
+				continue
+			}
+			if p, err := t.checkIndex(idx); err != nil {
+				return nil, err
+			} else if p != nil {
+				problems = append(problems, *p)
+			}
+		}
+	}
+	return problems, nil
+}
+
+// checkIndex 比较索引的记录数和表中该列不为 NULL 的行数
+func (t *Table) checkIndex(idx *Index) (*store.Problem, error) {
+	col := indexOfName(t.Columns, idx.Column)
+	if col < 0 {
+		return &store.Problem{Tree: idx.Name, Msg: fmt.Sprintf("table %s has no column %s", t.Name, idx.Column)}, nil
+	}
+	rows := 0
+	if err := t.scan(func(row []Value) error {
+		if !row[col].IsNull() {
+			rows++
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	entries := 0
+	if err := store.ScanRows(idx.Pager, idx.RootPage, func([]byte) error {
+		entries++
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if rows != entries {
+		return &store.Problem{Tree: idx.Name, Msg: fmt.Sprintf("index has %d entries, table %s has %d rows with %s not NULL", entries, t.Name, rows, idx.Column)}, nil
+	}
+	return nil, nil
+}
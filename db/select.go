@@ -0,0 +1,375 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ResultSet 是 SELECT 的查询结果
+type ResultSet struct {
+	Columns []string
+	Rows    [][]Value
+}
+
+// rowSource 依次把每一行交给回调
+type rowSource func(fn func(row []Value) error) error
+
+// Query 在当前已提交版本的快照上执行一条 SELECT（或 EXPLAIN、PRAGMA），不会阻塞写者
+func (db *Database) Query(sql string) (*ResultSet, error) {
+	if db.inExplicit() {
+		return db.queryInTransaction(sql)
+	}
+	s, err := db.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	return s.Query(sql)
+}
+
+func (db *Database) query(sql string) (*ResultSet, error) {
+	if fields := strings.Fields(sql); len(fields) > 0 && strings.EqualFold(fields[0], "PRAGMA") {
+		return db.pragma(sql)
+	}
+	stmt, explain, err := parseQuery(sql)
+	if err != nil {
+		return nil, err
+	}
+	if explain {
+		return db.explainSelect(stmt)
+	}
+	return db.execSelect(stmt)
+}
+
+// selectRows 执行 SELECT 并打印结果
+func (db *Database) selectRows(sql string) error {
+	rs, err := db.Query(sql)
+	if err != nil {
+		return err
+	}
+	fmt.Println(rs.Columns)
+	for _, row := range rs.Rows {
+		fmt.Println(row)
+	}
+	return nil
+}
+
+// outputRow 是一行投影结果及其 ORDER BY 排序键
+type outputRow struct {
+	values []Value
+	keys   []Value
+}
+
+// explainSelect 实现 EXPLAIN QUERY PLAN，每个表一行说明其访问方式
+func (db *Database) explainSelect(stmt *SelectStmt) (*ResultSet, error) {
+	plan, err := db.planFrom(stmt)
+	if err != nil {
+		return nil, err
+	}
+	rs := &ResultSet{Columns: []string{"detail"}}
+	for _, d := range plan.explain() {
+		rs.Rows = append(rs.Rows, []Value{TextValue(d)})
+	}
+	return rs, nil
+}
+
+func (db *Database) execSelect(stmt *SelectStmt) (*ResultSet, error) {
+	for _, e := range append([]Expr{stmt.Where}, joinConditions(stmt)...) {
+		if calls, err := collectAggregates(e, nil); err != nil {
+			return nil, err
+		} else if len(calls) > 0 {
+			return nil, fmt.Errorf("misuse of aggregate function %s()", calls[0].Name)
+		}
+	}
+	plan, err := db.planFrom(stmt)
+	if err != nil {
+		return nil, err
+	}
+	cols, source, orderedBy := plan.cols, plan.source(), plan.orderedBy()
+
+	names, exprs, err := expandColumns(stmt.Columns, cols)
+	if err != nil {
+		return nil, err
+	}
+	aliases := map[string]Expr{}
+	for _, c := range stmt.Columns {
+		if c.Alias != "" {
+			aliases[c.Alias] = c.Expr
+		}
+	}
+
+	var calls []*FuncCall
+	for _, e := range exprs {
+		if calls, err = collectAggregates(e, calls); err != nil {
+			return nil, err
+		}
+	}
+	if calls, err = collectAggregates(stmt.Having, calls); err != nil {
+		return nil, err
+	}
+	for _, item := range stmt.OrderBy {
+		if calls, err = collectAggregates(item.Expr, calls); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range stmt.GroupBy {
+		if nested, err := collectAggregates(e, nil); err != nil {
+			return nil, err
+		} else if len(nested) > 0 {
+			return nil, fmt.Errorf("aggregate functions are not allowed in the GROUP BY clause")
+		}
+	}
+
+	var out []outputRow
+	project := func(ctx *evalContext) error {
+		row := outputRow{values: make([]Value, len(exprs))}
+		for i, e := range exprs {
+			v, err := evalExpr(e, ctx)
+			if err != nil {
+				return err
+			}
+			row.values[i] = v
+		}
+		keys, err := orderKeys(stmt.OrderBy, names, row.values, ctx)
+		if err != nil {
+			return err
+		}
+		row.keys = keys
+		out = append(out, row)
+		return nil
+	}
+
+	if len(calls) > 0 || len(stmt.GroupBy) > 0 {
+		plan := &aggPlan{cols: cols, groupBy: stmt.GroupBy, calls: calls}
+		plan.streaming = groupedByOrder(stmt.GroupBy, cols, orderedBy)
+		err = plan.aggregate(source, func(g *aggGroup) error {
+			ctx := &evalContext{cols: cols, row: g.first, aggs: g.results(plan), aliases: aliases}
+			if stmt.Having != nil {
+				v, err := evalExpr(stmt.Having, ctx)
+				if err != nil {
+					return err
+				}
+				if !v.truthy() {
+					return nil
+				}
+			}
+			return project(ctx)
+		})
+	} else {
+		if stmt.Having != nil {
+			return nil, fmt.Errorf("a GROUP BY clause is required before HAVING")
+		}
+		err = source(func(row []Value) error {
+			return project(&evalContext{cols: cols, row: row, aliases: aliases})
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if stmt.Distinct {
+		out = distinctRows(out)
+	}
+	if len(stmt.OrderBy) > 0 {
+		sort.SliceStable(out, func(i, j int) bool {
+			for k, item := range stmt.OrderBy {
+				c := compareValues(out[i].keys[k], out[j].keys[k])
+				if c == 0 {
+					continue
+				}
+				if item.Desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+	if out, err = applyLimit(stmt, out); err != nil {
+		return nil, err
+	}
+
+	rs := &ResultSet{Columns: names, Rows: make([][]Value, len(out))}
+	for i, r := range out {
+		rs.Rows[i] = r.values
+	}
+	return rs, nil
+}
+
+func joinConditions(stmt *SelectStmt) []Expr {
+	var conds []Expr
+	for _, j := range stmt.Joins {
+		if j.On != nil {
+			conds = append(conds, j.On)
+		}
+	}
+	return conds
+}
+
+func filterSource(source rowSource, cols []colInfo, where Expr) rowSource {
+	return func(fn func(row []Value) error) error {
+		return source(func(row []Value) error {
+			v, err := evalExpr(where, &evalContext{cols: cols, row: row})
+			if err != nil {
+				return err
+			}
+			if !v.truthy() {
+				return nil
+			}
+			return fn(row)
+		})
+	}
+}
+
+// groupedByOrder 判断输入是否已按分组键有序，可以使用流式聚合
+func groupedByOrder(groupBy []Expr, cols []colInfo, orderedBy int) bool {
+	if orderedBy < 0 || len(groupBy) != 1 {
+		return false
+	}
+	ref, ok := groupBy[0].(*ColumnRef)
+	if !ok {
+		return false
+	}
+	idx, err := resolveColumn(cols, ref)
+	return err == nil && idx == orderedBy
+}
+
+// expandColumns 展开 * 并返回输出列名与对应表达式
+func expandColumns(selCols []SelectColumn, cols []colInfo) ([]string, []Expr, error) {
+	var names []string
+	var exprs []Expr
+	for _, c := range selCols {
+		if !c.Star {
+			exprs = append(exprs, c.Expr)
+			switch {
+			case c.Alias != "":
+				names = append(names, c.Alias)
+			case isColumnRef(c.Expr):
+				names = append(names, c.Expr.(*ColumnRef).Name)
+			default:
+				names = append(names, c.Text)
+			}
+			continue
+		}
+		matched := false
+		for _, col := range cols {
+			if c.StarTable != "" && !strings.EqualFold(col.Table, c.StarTable) {
+				continue
+			}
+			matched = true
+			names = append(names, col.Name)
+			exprs = append(exprs, &ColumnRef{Table: col.Table, Name: col.Name})
+		}
+		if !matched {
+			if c.StarTable != "" {
+				return nil, nil, fmt.Errorf("no such table: %s", c.StarTable)
+			}
+			return nil, nil, fmt.Errorf("no tables specified")
+		}
+	}
+	return names, exprs, nil
+}
+
+func isColumnRef(e Expr) bool {
+	_, ok := e.(*ColumnRef)
+	return ok
+}
+
+// orderKeys 计算 ORDER BY 排序键：整数表示输出列序号，裸名优先匹配输出列别名
+func orderKeys(items []OrderItem, names []string, values []Value, ctx *evalContext) ([]Value, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	keys := make([]Value, len(items))
+	for i, item := range items {
+		if lit, ok := item.Expr.(*Literal); ok && lit.Val.Kind == KindInt {
+			n := int(lit.Val.I)
+			if n < 1 || n > len(values) {
+				return nil, fmt.Errorf("ORDER BY term out of range - should be between 1 and %d", len(values))
+			}
+			keys[i] = values[n-1]
+			continue
+		}
+		if ref, ok := item.Expr.(*ColumnRef); ok && ref.Table == "" {
+			if _, err := resolveColumn(ctx.cols, ref); err != nil {
+				if idx := indexOfName(names, ref.Name); idx >= 0 {
+					keys[i] = values[idx]
+					continue
+				}
+			}
+		}
+		v, err := evalExpr(item.Expr, ctx)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = v
+	}
+	return keys, nil
+}
+
+func indexOfName(names []string, name string) int {
+	for i, n := range names {
+		if strings.EqualFold(n, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func distinctRows(rows []outputRow) []outputRow {
+	seen := map[string]bool{}
+	out := rows[:0]
+	for _, r := range rows {
+		var sb strings.Builder
+		for _, v := range r.values {
+			sb.WriteString(v.groupKey())
+			sb.WriteByte(0)
+		}
+		k := sb.String()
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		out = append(out, r)
+	}
+	return out
+}
+
+func applyLimit(stmt *SelectStmt, rows []outputRow) ([]outputRow, error) {
+	if stmt.Limit == nil {
+		return rows, nil
+	}
+	limit, err := evalInt(stmt.Limit, "LIMIT")
+	if err != nil {
+		return nil, err
+	}
+	offset := int64(0)
+	if stmt.Offset != nil {
+		if offset, err = evalInt(stmt.Offset, "OFFSET"); err != nil {
+			return nil, err
+		}
+	}
+	if offset > 0 {
+		if offset >= int64(len(rows)) {
+			return nil, nil
+		}
+		rows = rows[offset:]
+	}
+	if limit >= 0 && limit < int64(len(rows)) {
+		rows = rows[:limit]
+	}
+	return rows, nil
+}
+
+func evalInt(e Expr, clause string) (int64, error) {
+	v, err := evalExpr(e, &evalContext{})
+	if err != nil {
+		return 0, err
+	}
+	v = toNumeric(v)
+	if v.Kind != KindInt {
+		return 0, fmt.Errorf("datatype mismatch in %s", clause)
+	}
+	return v.I, nil
+}
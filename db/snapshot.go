@@ -0,0 +1,74 @@
+package db
+
+// Snapshot 是数据库某个已提交版本的只读视图。
+// 快照上的查询不持有数据库的锁，写者可以同时插入和提交，查询结果不受影响。
+type Snapshot struct {
+	db *Database
+}
+
+// Snapshot 返回当前已提交版本的快照，用完之后调用 Close。
+// 快照持有文件读锁，其他进程正在写时等待，超时返回 store.ErrBusy。
+func (db *Database) Snapshot() (*Snapshot, error) {
+	// 文件被其他连接改过时要重新加载元数据，所以这里用写锁
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	pager, err := db.Pager.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.reloadIfChanged(); err != nil {
+		pager.Close()
+		return nil, err
+	}
+	view := &Database{
+		Tables:  make(map[string]*Table, len(db.Tables)),
+		Indexes: make(map[string]*Index, len(db.Indexes)),
+		Pager:   pager,
+		Master:  db.Master.clone(),
+	}
+	view.Master.Pager = pager
+	for name, t := range db.Tables {
+		c := t.clone()
+		c.Pager = pager
+		for _, idx := range c.Indexes {
+			idx.Pager = pager
+			view.Indexes[idx.Name] = idx
+		}
+		view.Tables[name] = c
+	}
+	// 临时表和附加的数据库在各自的文件中，也各取一个快照
+	s := &Snapshot{db: view}
+	if db.temp != nil {
+		temp, err := db.temp.Snapshot()
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		view.temp = temp.db
+	}
+	for _, a := range db.attached {
+		snap, err := a.db.Snapshot()
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		view.attached = append(view.attached, attachment{name: a.name, db: snap.db})
+	}
+	return s, nil
+}
+
+// Query 在快照上执行一条 SELECT
+func (s *Snapshot) Query(sql string) (*ResultSet, error) {
+	return s.db.query(sql)
+}
+
+// Close 释放快照，之后写者可以回收它占用的旧页
+func (s *Snapshot) Close() error {
+	if s.db.temp != nil {
+		s.db.temp.Pager.Close()
+	}
+	for _, a := range s.db.attached {
+		a.db.Pager.Close()
+	}
+	return s.db.Pager.Close()
+}
@@ -6,173 +6,260 @@ import (
 	"strings"
 )
 
-func (db *Database) createTable(sql string) {
-	sql = strings.TrimSuffix(sql, ";")
-	parts := strings.SplitN(sql, "(", 2)
-	head := strings.Fields(parts[0])
-	if len(head) < 3 {
-		fmt.Println("Invalid CREATE TABLE syntax")
-		return
+func (db *Database) createTable(sql string) error {
+	stmt, err := parseCreateTable(sql)
+	if err != nil {
+		return fmt.Errorf("invalid CREATE TABLE syntax: %w", err)
 	}
-	tableName := head[2]
-	cols := strings.TrimSuffix(parts[1], ")")
-	colNames := []string{}
-	for _, field := range strings.Split(cols, ",") {
-		col := strings.Fields(strings.TrimSpace(field))[0]
-		colNames = append(colNames, col)
+	tableName := stmt.Name
+	if isReservedName(tableName) {
+		return fmt.Errorf("object name reserved for internal use: %s", tableName)
 	}
 
 	// 替代错误逻辑：在 CREATE 开始前判断是否已存在
 	if _, exists := db.Tables[tableName]; exists {
-		fmt.Println("Table already exists, skip CREATE.")
-		return
+		if stmt.IfNotExists {
+			store.Logger.Println("Table already exists, skip CREATE.")
+			return nil
+		}
+		return fmt.Errorf("table %s already exists", tableName)
 	}
-
-	root := db.Pager.AllocatePage()
-	leaf := store.NewLeafPage()
-	data, _ := leaf.ToBytes()
-	if err := db.Pager.WritePage(root, data); err != nil {
-		fmt.Println("Failed to write initial leaf page:", err)
-		return
+	if _, exists := db.Indexes[tableName]; exists {
+		return fmt.Errorf("there is already an index named %s", tableName)
 	}
 
-	db.Tables[tableName] = &Table{
-		Name:     tableName,
-		Columns:  colNames,
-		RootPage: root,
-		Pager:    db.Pager,
+	table := &Table{
+		Name:  tableName,
+		Pager: db.Pager,
+	}
+	for _, c := range stmt.Columns {
+		if err := table.addColumn(c); err != nil {
+			return fmt.Errorf("invalid CREATE TABLE syntax: %w", err)
+		}
 	}
 
-	fmt.Printf("Table created: %s at root page %d\n", tableName, root)
-
-	metaRow := []string{tableName, strings.Join(colNames, "|"), fmt.Sprint(root)}
-	data, _ = store.EncodeRow(metaRow)
-	err := db.Pager.AppendRow(1, data)
+	root, err := db.Pager.AllocatePage()
 	if err != nil {
-		fmt.Println("Error writing table metadata:", err)
+		return fmt.Errorf("allocate root page: %w", err)
+	}
+	leaf := store.NewLeafPage()
+	data, _ := leaf.ToBytes()
+	if err := db.Pager.WritePage(root, data); err != nil {
+		return fmt.Errorf("write initial leaf page: %w", err)
 	}
+	table.RootPage = root
+	if err := db.insertMeta(table.metaRow()); err != nil {
+		return fmt.Errorf("write table metadata: %w", err)
+	}
+	db.Tables[tableName] = table
 
+	store.Logger.Printf("Table created: %s at root page %d", tableName, root)
+	return nil
 }
 
-func (db *Database) insertInto(sql string) {
-	sql = strings.TrimSuffix(sql, ";")
-	parts := strings.Split(sql, "VALUES")
-	if len(parts) != 2 {
-		fmt.Println("Invalid INSERT syntax")
-		return
-	}
-	head := strings.Fields(parts[0])
-	tableName := head[2]
-	values := strings.Trim(strings.TrimSpace(parts[1]), "()")
-	valList := strings.Split(values, ",")
-	for i := range valList {
-		valList[i] = strings.Trim(strings.TrimSpace(valList[i]), "'")
+func (db *Database) insertInto(sql string) error {
+	stmt, err := parseInsert(sql)
+	if err != nil {
+		return fmt.Errorf("invalid INSERT syntax: %w", err)
 	}
-	table, ok := db.Tables[tableName]
+	table, ok := db.Tables[stmt.Table]
 	if !ok {
-		fmt.Println("Table not found:", tableName)
-		return
+		return fmt.Errorf("no such table: %s", stmt.Table)
+	}
+
+	for i, values := range stmt.Rows {
+		row, err := table.buildRecord(stmt.Columns, values)
+		if err != nil {
+			return fmt.Errorf("row %d: %w", i+1, err)
+		}
+		if err := db.insertRow(table, row); err != nil {
+			return fmt.Errorf("insert row %d: %w", i+1, err)
+		}
 	}
 
-	encoded, err := store.EncodeRow(valList)
+	store.Logger.Println("Row inserted successfully.")
+	return nil
+}
+
+// insertRow 把一行插入表和它的索引，根页变化时更新元数据
+func (db *Database) insertRow(table *Table, row []Value) error {
+	encoded, err := encodeValues(row)
 	if err != nil {
-		fmt.Println("Error encoding row:", err)
-		return
+		return fmt.Errorf("encode row: %w", err)
 	}
 
-	newRoot, err := store.InsertRow(table.Pager, table.RootPage, encoded) // ✅ 改这里
+	newRoot, err := store.InsertRow(table.Pager, table.RootPage, encoded)
 	if err != nil {
-		fmt.Println("Error inserting row:", err)
-		return
+		return err
 	}
 
 	if newRoot != table.RootPage {
 		oldRoot := table.RootPage
 		table.RootPage = newRoot
-		fmt.Printf("New root page: %d, old root page: %d\n", newRoot, oldRoot)
+		store.Logger.Printf("New root page: %d, old root page: %d", newRoot, oldRoot)
 
-		newMeta := []string{table.Name, strings.Join(table.Columns, "|"), fmt.Sprint(newRoot)}
-		data, err := store.EncodeRow(newMeta)
-		if err != nil {
-			fmt.Println("Error encoding table metadata:", err)
-			return
+		if err := db.saveTableMeta(table); err != nil {
+			return fmt.Errorf("update table metadata: %w", err)
 		}
-		err = db.Pager.UpdateRowInPage(1, table.Name, data)
+		store.Logger.Println("Table metadata updated successfully.")
+	}
+	return db.updateIndexes(table, row)
+}
+
+// buildRecord 求值 VALUES 中的表达式，按列类型转换后返回要存储的行
+func (t *Table) buildRecord(columns []string, values []Expr) ([]Value, error) {
+	positions := make([]int, len(values))
+	if len(columns) == 0 {
+		if len(values) != len(t.Columns) {
+			return nil, fmt.Errorf("table %s has %d columns but %d values were supplied", t.Name, len(t.Columns), len(values))
+		}
+		for i := range values {
+			positions[i] = i
+		}
+	} else {
+		if len(values) != len(columns) {
+			return nil, fmt.Errorf("%d values for %d columns", len(values), len(columns))
+		}
+		for i, c := range columns {
+			idx := indexOfName(t.Columns, c)
+			if idx < 0 {
+				return nil, fmt.Errorf("table %s has no column named %s", t.Name, c)
+			}
+			positions[i] = idx
+		}
+	}
+
+	row := make([]Value, len(t.Columns))
+	for i := range row {
+		row[i] = t.defaultValue(i)
+	}
+	affs := t.affinities()
+	for i, e := range values {
+		v, err := evalExpr(e, &evalContext{})
 		if err != nil {
-			fmt.Println("Error updating table metadata:", err)
-			return
+			return nil, err
 		}
-		fmt.Println("Table metadata updated successfully.")
+		row[positions[i]] = applyAffinity(v, affs[positions[i]])
 	}
+	return row, nil
+}
 
-	fmt.Println("Row inserted successfully.")
+// encodeValues 把一行编码为记录，NULL 单独标记
+func encodeValues(row []Value) ([]byte, error) {
+	fields := make([]string, len(row))
+	nulls := make([]bool, len(row))
+	for i, v := range row {
+		fields[i] = v.storageString()
+		nulls[i] = v.IsNull()
+	}
+	return store.EncodeRowWithNulls(fields, nulls)
 }
 
 // SEARCH FROM tab WHERE key = '123'
-func (db *Database) searchKey(sql string) {
+func (db *Database) searchKey(sql string) error {
 	sql = strings.TrimSuffix(sql, ";")
 	tokens := strings.Fields(sql)
 	if len(tokens) < 6 || strings.ToUpper(tokens[1]) != "FROM" || strings.ToUpper(tokens[3]) != "WHERE" {
-		fmt.Println("Invalid SELECT syntax")
-		return
+		return fmt.Errorf("invalid SEARCH syntax")
 	}
-	tableName := tokens[2]
+	schema, tableName := splitQualified(tokens[2])
 	whereKey := strings.Trim(tokens[6], "'\"")
 
-	fmt.Printf("[DEBUG] Searching key = [%s]\n", whereKey)
+	store.Logger.Printf("[DEBUG] Searching key = [%s]", whereKey)
 
-	table, ok := db.Tables[tableName]
+	table, ok := db.lookupTable(schema, tableName)
 	if !ok {
-		fmt.Println("Table not found:", tableName)
-		return
+		return fmt.Errorf("no such table: %s", tokens[2])
 	}
 
 	rowData, err := store.SearchRow(table.Pager, table.RootPage, whereKey)
 	if err != nil {
-		fmt.Println("Error searching row:", err)
-		return
+		return fmt.Errorf("search row: %w", err)
 	}
 	row, err := store.DecodeRow(rowData)
 	if err != nil {
-		fmt.Println("Error decoding row:", err)
-		return
+		return fmt.Errorf("decode row: %w", err)
 	}
 	fmt.Println(table.Columns)
 	fmt.Println(row)
+	return nil
 }
 
 // DELETE FROM tab WHERE key = '123'
-func (db *Database) deleteFrom(sql string) {
+func (db *Database) deleteFrom(sql string) error {
 	sql = strings.TrimSuffix(sql, ";")
 	tokens := strings.Fields(sql)
 	if len(tokens) < 6 || strings.ToUpper(tokens[0]) != "DELETE" || strings.ToUpper(tokens[1]) != "FROM" || strings.ToUpper(tokens[3]) != "WHERE" {
-		fmt.Println("Invalid DELETE syntax")
-		return
+		return fmt.Errorf("invalid DELETE syntax")
 	}
-	tableName := tokens[2]
+	// schema 已经在 Exec 中选好了数据库，见 attach.go
+	_, tableName := splitQualified(tokens[2])
 	whereKey := strings.Trim(tokens[6], "'\"")
 
-	fmt.Printf("[DEBUG] Searching key = [%s]\n", whereKey)
+	store.Logger.Printf("[DEBUG] Searching key = [%s]", whereKey)
 
 	table, ok := db.Tables[tableName]
 	if !ok {
-		fmt.Println("Table not found:", tableName)
-		return
+		return fmt.Errorf("no such table: %s", tableName)
 	}
-	newRoot, err := store.DeleteRow(table.Pager, table.RootPage, whereKey)
+	// 先删表中的行：重复的 key 可能跨过叶子的边界，全部删掉之后按删掉的行逐条删除索引记录。
+	// 中途失败时整条语句由 Exec 的事务回滚
+	newRoot, removed, err := store.DeleteRows(table.Pager, table.RootPage, whereKey)
 	if err != nil {
-		fmt.Println("Error deleting row:", err)
-		return
+		return fmt.Errorf("delete row: %w", err)
+	}
+	if err := db.removeFromIndexes(table, removed); err != nil {
+		return fmt.Errorf("update index: %w", err)
 	}
 
 	if newRoot != table.RootPage {
 		table.RootPage = newRoot
-		meta := []string{table.Name, strings.Join(table.Columns, "|"), fmt.Sprint(newRoot)}
-		data, _ := store.EncodeRow(meta)
-		db.Pager.UpdateRowInPage(1, table.Name, data)
-		fmt.Println("Updated root after delete")
+		if err := db.saveTableMeta(table); err != nil {
+			return fmt.Errorf("update table metadata: %w", err)
+		}
+		store.Logger.Println("Updated root after delete")
 	}
 
-	fmt.Println("Row deleted successfully.")
+	store.Logger.Println("Row deleted successfully.")
+	return nil
+}
 
+// DROP TABLE [IF EXISTS] tab
+func (db *Database) dropTable(sql string) error {
+	stmt, err := parseDropTable(sql)
+	if err != nil {
+		return fmt.Errorf("invalid DROP TABLE syntax: %w", err)
+	}
+	table, ok := db.Tables[stmt.Name]
+	if !ok {
+		if stmt.IfExists {
+			store.Logger.Println("Table does not exist, skip DROP.")
+			return nil
+		}
+		return fmt.Errorf("no such table: %s", stmt.Name)
+	}
+
+	// 索引和表的页都放回空闲链表，元数据一起删除。整条语句在 Exec 的事务里，
+	// 出错时返回错误让事务回滚，不会提交已经释放、元数据还指向的页
+	for _, idx := range table.Indexes {
+		if err := store.FreeTree(db.Pager, idx.RootPage); err != nil {
+			return fmt.Errorf("free index %s: %w", idx.Name, err)
+		}
+		if err := db.removeMeta(idx.Name); err != nil {
+			return fmt.Errorf("remove index metadata %s: %w", idx.Name, err)
+		}
+	}
+	if err := store.FreeTree(db.Pager, table.RootPage); err != nil {
+		return fmt.Errorf("free table pages: %w", err)
+	}
+	if err := db.removeMeta(table.Name); err != nil {
+		return fmt.Errorf("remove table metadata: %w", err)
+	}
+
+	for _, idx := range table.Indexes {
+		delete(db.Indexes, idx.Name)
+	}
+	delete(db.Tables, table.Name)
+	store.Logger.Println("Table dropped:", table.Name)
+	return nil
 }
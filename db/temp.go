@@ -0,0 +1,44 @@
+package db
+
+import (
+	"fmt"
+	"mySQLite/store"
+)
+
+/*
+临时表（CREATE TEMP TABLE）保存在这个连接自己的 :memory: 数据库（Database.temp）中，
+第一次创建临时表时打开，Close 时丢弃，其他连接和重新打开之后都看不到，
+主文件的元数据表里也没有它们。
+
+  - 临时表与普通表同名时优先使用临时表，也可以写成 temp.name；
+  - 写临时表的语句（INSERT、DELETE、DROP、ALTER、CREATE INDEX）整条交给临时数据库执行，
+    不加主文件的锁，见 attach.go 中的 target；
+  - 快照同时包括两个数据库，同一条 SELECT 可以连接临时表和普通表。
+*/
+
+// tempLocked 返回临时数据库，还没有时打开。调用时持有 db.mu
+func (db *Database) tempLocked() (*Database, error) {
+	if db.temp == nil {
+		pager, err := store.OpenPager(store.MemoryDB)
+		if err != nil {
+			return nil, fmt.Errorf("open temporary database: %w", err)
+		}
+		db.temp = NewDatabase(pager)
+	}
+	return db.temp, nil
+}
+
+// Close 丢弃临时表，关闭附加的数据库和数据库文件
+func (db *Database) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.temp != nil {
+		db.temp.Pager.Close()
+		db.temp = nil
+	}
+	for _, a := range db.attached {
+		a.db.Close()
+	}
+	db.attached = nil
+	return db.Pager.Close()
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"mySQLite/store"
+)
+
+/*
+BEGIN [TRANSACTION] 开始一个显式事务，COMMIT（或 END）提交，ROLLBACK 回滚。
+
+BEGIN 本身不加锁。每个数据库（main、temp、附加的数据库）在事务中第一次被写时才开始
+自己的 Pager 事务，从那时起持有这个文件的写锁，直到 COMMIT 或 ROLLBACK。
+COMMIT 用 store.CommitAll 一起提交：修改了多个回滚日志模式的文件时通过主日志原子地提交，
+崩溃之后要么全部生效，要么全部回滚，见 store/master.go。
+
+事务中的查询不在快照上执行，而是加读锁直接读当前的页，能看到本事务还没有提交的修改。
+每条写语句在一个语句保存点中执行（见 store/statement.go）：语句出错时只撤销这条语句
+写过的页，事务中之前的语句不受影响，事务仍然可以提交或回滚。
+*/
+
+var errNoTransaction = errors.New("no transaction is active")
+
+// transaction 执行 BEGIN、COMMIT 和 ROLLBACK 语句
+func (db *Database) transaction(sql string) error {
+	word, err := parseTransaction(sql)
+	if err != nil {
+		return fmt.Errorf("invalid transaction statement: %w", err)
+	}
+	var done string
+	switch word {
+	case "BEGIN":
+		err, done = db.Begin(), "started"
+	case "COMMIT":
+		err, done = db.Commit(), "committed"
+	case "ROLLBACK":
+		err, done = db.Rollback(), "rolled back"
+	}
+	if err != nil {
+		return err
+	}
+	store.Logger.Println("Transaction", done)
+	return nil
+}
+
+// Begin 开始显式事务，之后 Exec 执行的写语句在 Commit 时一起提交
+func (db *Database) Begin() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.explicit {
+		return fmt.Errorf("cannot start a transaction within a transaction")
+	}
+	db.explicit = true
+	return nil
+}
+
+// Commit 提交显式事务修改过的所有数据库
+func (db *Database) Commit() error {
+	return db.endTransaction(true)
+}
+
+// Rollback 放弃显式事务中对所有数据库的修改
+func (db *Database) Rollback() error {
+	return db.endTransaction(false)
+}
+
+func (db *Database) endTransaction(commit bool) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if !db.explicit {
+		return errNoTransaction
+	}
+	db.explicit = false
+	schemas := db.searchOrder()
+	var pagers []*store.Pager
+	for _, d := range schemas {
+		if d != db {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+		}
+		pagers = append(pagers, d.Pager)
+	}
+	var err error
+	if commit {
+		err = store.CommitAll(pagers...)
+	} else {
+		for _, p := range pagers {
+			if p.InTransaction() {
+				err = errors.Join(err, p.Rollback())
+			}
+		}
+	}
+	// 回滚之后已经加载的元数据可能包括回滚掉的表，下次加锁时重新加载
+	if !commit || err != nil {
+		for _, d := range schemas {
+			d.Master = nil
+		}
+	}
+	return err
+}
+
+// inExplicit 返回是否在 BEGIN 开始的事务中
+func (db *Database) inExplicit() bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.explicit
+}
+
+// writeTo 在 target 上执行一组写操作。不在显式事务中时整组操作是一个事务，
+// 否则开始 target 的事务，留到 COMMIT 时提交，这组操作出错时回到它开始之前的状态
+func (db *Database) writeTo(target *Database, fn func() error) error {
+	if !db.inExplicit() {
+		return target.write(fn)
+	}
+	target.mu.Lock()
+	defer target.mu.Unlock()
+	err := target.withWriteLock(func() error {
+		if !target.Pager.InTransaction() {
+			if err := target.Pager.Begin(); err != nil {
+				return err
+			}
+		}
+		return inStatement(target.Pager, fn)
+	})
+	if err != nil {
+		// 出错的语句可能改过内存中的表，按回到保存点之后的页重新加载
+		target.Master = nil
+	}
+	return err
+}
+
+// queryInTransaction 在显式事务中执行查询：读当前的页，看得到本事务的修改
+func (db *Database) queryInTransaction(sql string) (*ResultSet, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, d := range db.searchOrder() {
+		if d != db {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+		}
+		if err := d.Pager.BeginRead(); err != nil {
+			return nil, err
+		}
+		defer d.Pager.EndRead()
+		if err := d.reloadIfChanged(); err != nil {
+			return nil, err
+		}
+	}
+	return db.query(sql)
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"fmt"
 	"mySQLite/store"
+	"strings"
 )
 
 func padToPage(data []byte) []byte {
@@ -76,3 +77,15 @@ func collectRecursive(pager *store.Pager, pageNo int, visited map[int]bool) ([][
 	}
 	return rows, nil
 }
+
+// quoteIdent 在标识符含有特殊字符或是关键字时加上双引号
+func quoteIdent(name string) string {
+	plain := name != "" && !keywords[strings.ToUpper(name)] && isIdentStart(name[0])
+	for i := 0; plain && i < len(name); i++ {
+		plain = isIdentPart(name[i])
+	}
+	if plain {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,233 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mySQLite/store"
+	"strconv"
+)
+
+/*
+VACUUM 把所有表和索引重新写成紧凑的 B+ 树，去掉空闲页和没有写满的页：
+
+  - VACUUM INTO 'path' 在快照上把每棵树按 key 顺序批量加载到新文件（见 store/btree_bulk.go），
+    原来的数据库不受影响，写者可以同时提交；
+  - VACUUM 先用同样的方法在 "<文件名>-vacuum" 中建立紧凑的副本，检查副本完整之后在一个事务中
+    把副本的每一页写回原文件，截掉多余的页。回滚日志或影子分页保证这一步是原子的，
+    崩溃之后看到的要么是原来的数据库，要么是整理之后的数据库。
+    临时文件的删除、建立、读取和清理都在原文件的写锁中，与回滚日志一样，
+    同一时间只有持有写锁的连接使用这个文件名。
+
+元数据表中的记录原样复制，只有根页号换成新的。新文件的树依次排列，最后是元数据表。
+*/
+
+// VacuumInto 把数据库的紧凑副本写到 path，path 不能是已有的非空文件。
+// 副本在同一个 VFS 中，格式（影子分页、页校验和、加密）与原文件相同。在快照上进行，不阻塞写者。
+func (db *Database) VacuumInto(path string) error {
+	if size, err := db.Pager.VFS().Stat(path); err == nil && size > 0 {
+		return fmt.Errorf("output file already exists: %s", path)
+	}
+	s, err := db.Snapshot()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.db.vacuumInto(path, db.Pager.FormatOptions())
+}
+
+// Vacuum 整理数据库文件：在临时文件中建立紧凑的副本，再在一个事务中替换原来的内容
+func (db *Database) Vacuum() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.withWriteLock(func() error {
+		vfs := db.Pager.VFS()
+		tmp := db.Pager.Filename() + "-vacuum"
+		// 上次中断留下的临时文件没有用处。持有写锁时没有别的连接在用这个文件
+		vfs.Remove(tmp)
+		defer vfs.Remove(tmp)
+
+		// 临时文件与原文件的格式相同，加密的数据库不会留下明文的副本
+		opts := db.Pager.FormatOptions()
+		err := db.inTransaction(func() error {
+			if err := db.vacuumInto(tmp, opts); err != nil {
+				return err
+			}
+			src, err := store.OpenPagerWithOptions(tmp, opts)
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+			if err := checkCompactCopy(src); err != nil {
+				return fmt.Errorf("vacuumed copy %s: %w", tmp, err)
+			}
+			return db.replacePages(src)
+		})
+		// 无论成功还是回滚，都按文件中的内容重新加载元数据
+		if loadErr := db.loadSchema(); err == nil {
+			err = loadErr
+		}
+		return err
+	})
+}
+
+// vacuumInto 把每棵树复制到新文件 path，出错时删除写了一半的文件
+func (db *Database) vacuumInto(path string, opts store.Options) error {
+	dst, err := store.OpenPagerWithOptions(path, opts)
+	if err != nil {
+		return err
+	}
+	err = inTransaction(dst, func() error {
+		return db.copyCompact(dst)
+	})
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		opts.VFS.Remove(path)
+		return fmt.Errorf("vacuum into %s: %w", path, err)
+	}
+	return nil
+}
+
+// copyCompact 把元数据表中的每个对象复制到空的 dst，最后批量加载元数据表
+func (db *Database) copyCompact(dst *store.Pager) error {
+	entries, err := catalogEntries(db.Pager, db.Master.RootPage)
+	if err != nil {
+		return fmt.Errorf("read catalog: %w", err)
+	}
+	catalog, err := store.NewBulkLoader(dst, store.DefaultFillFactor)
+	if err != nil {
+		return err
+	}
+	// 元数据表按 name 排序，替换根页号之后顺序不变
+	for _, entry := range entries {
+		root, err := strconv.Atoi(entry[3])
+		if err != nil {
+			return fmt.Errorf("%s %s: invalid root page %q", entry[0], entry[1], entry[3])
+		}
+		newRoot, err := copyTree(db.Pager, root, dst)
+		if err != nil {
+			return fmt.Errorf("copy %s %s: %w", entry[0], entry[1], err)
+		}
+		entry[3] = strconv.Itoa(newRoot)
+		fields := make([]string, len(entry))
+		for col, field := range masterFieldOrder {
+			fields[field] = entry[col]
+		}
+		rec, err := store.EncodeRow(fields)
+		if err != nil {
+			return fmt.Errorf("encode catalog record: %w", err)
+		}
+		if err := catalog.Add(rec); err != nil {
+			return err
+		}
+	}
+	root, err := catalog.Finish()
+	if err != nil {
+		return err
+	}
+	return dst.SetCatalogRoot(root)
+}
+
+// copyTree 把 src 中以 root 为根的树按 key 顺序批量加载到 dst，返回新的根页
+func copyTree(src *store.Pager, root int, dst *store.Pager) (int, error) {
+	loader, err := store.NewBulkLoader(dst, store.DefaultFillFactor)
+	if err != nil {
+		return 0, err
+	}
+	if err := store.ScanRows(src, root, loader.Add); err != nil {
+		return 0, err
+	}
+	return loader.Finish()
+}
+
+// checkCompactCopy 检查副本中元数据表和它记录的每棵树都完整，不完整的副本
+// （例如被截断的文件）写回原文件会丢掉数据
+func checkCompactCopy(src *store.Pager) error {
+	fh, err := src.ReadFileHeader()
+	if err != nil {
+		return err
+	}
+	root := int(fh.CatalogRoot)
+	if root < 2 || root > src.PageCount() {
+		return fmt.Errorf("catalog root %d is outside the %d pages of the file", root, src.PageCount())
+	}
+	entries, err := catalogEntries(src, root)
+	if err != nil {
+		return fmt.Errorf("read catalog: %w", err)
+	}
+	trees := []store.TreeRoot{{Name: MasterTableName, Root: root}}
+	for _, entry := range entries {
+		r, err := metaRootPage(entry[1], entry[3])
+		if err != nil {
+			return err
+		}
+		trees = append(trees, store.TreeRoot{Name: entry[1], Root: r})
+	}
+	problems, err := store.CheckIntegrity(src, trees)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("copy is incomplete: %v", problems[0])
+	}
+	return nil
+}
+
+// replacePages 在当前事务中用 src 的内容替换整个数据库，内容相同的页不重写
+func (db *Database) replacePages(src *store.Pager) error {
+	n := src.PageCount()
+	for pageNo := 1; pageNo <= n; pageNo++ {
+		data, err := src.ReadPage(pageNo)
+		if err != nil {
+			return fmt.Errorf("read page %d of the vacuumed copy: %w", pageNo, err)
+		}
+		old, err := db.Pager.ReadPage(pageNo)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if err == nil && bytes.Equal(old, data) {
+			continue
+		}
+		if err := db.Pager.WritePage(pageNo, data); err != nil {
+			return err
+		}
+	}
+	return db.Pager.Truncate(n)
+}
+
+// vacuum 执行 VACUUM 语句
+func (db *Database) vacuum(sql string) error {
+	stmt, err := parseVacuum(sql)
+	if err != nil {
+		return fmt.Errorf("invalid VACUUM syntax: %w", err)
+	}
+	if db.inExplicit() {
+		return fmt.Errorf("cannot VACUUM from within a transaction")
+	}
+	target := db
+	if stmt.Schema != "" {
+		db.mu.Lock()
+		d, ok := db.schemaLocked(stmt.Schema)
+		db.mu.Unlock()
+		if !ok {
+			return fmt.Errorf("no such database: %s", stmt.Schema)
+		}
+		target = d
+	}
+	if stmt.Into != "" {
+		if err := target.VacuumInto(stmt.Into); err != nil {
+			return err
+		}
+		store.Logger.Printf("Database copied to %s", stmt.Into)
+		return nil
+	}
+	before := target.Pager.PageCount()
+	if err := target.Vacuum(); err != nil {
+		return err
+	}
+	store.Logger.Printf("Database vacuumed: %d pages -> %d pages", before, target.Pager.PageCount())
+	return nil
+}
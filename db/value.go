@@ -0,0 +1,282 @@
+package db
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type Kind int
+
+const (
+	KindNull Kind = iota
+	KindInt
+	KindFloat
+	KindText
+	KindBlob
+)
+
+// Value 是查询执行中使用的带类型值
+type Value struct {
+	Kind Kind
+	I    int64
+	F    float64
+	S    string // TEXT 与 BLOB 的内容
+}
+
+var Null = Value{Kind: KindNull}
+
+func IntValue(i int64) Value     { return Value{Kind: KindInt, I: i} }
+func FloatValue(f float64) Value { return Value{Kind: KindFloat, F: f} }
+func TextValue(s string) Value   { return Value{Kind: KindText, S: s} }
+func BlobValue(b string) Value   { return Value{Kind: KindBlob, S: b} }
+
+func (v Value) IsNull() bool { return v.Kind == KindNull }
+
+func (v Value) isNumeric() bool { return v.Kind == KindInt || v.Kind == KindFloat }
+
+// String 返回值的文本形式，NULL 返回 "NULL"
+func (v Value) String() string {
+	switch v.Kind {
+	case KindNull:
+		return "NULL"
+	case KindInt:
+		return strconv.FormatInt(v.I, 10)
+	case KindFloat:
+		return formatFloat(v.F)
+	default:
+		return v.S
+	}
+}
+
+// 存储到记录中的文本形式
+func (v Value) storageString() string {
+	if v.Kind == KindNull {
+		return ""
+	}
+	return v.String()
+}
+
+// sqlLiteral 返回值在 SQL 语句中的字面量写法
+func (v Value) sqlLiteral() string {
+	switch v.Kind {
+	case KindNull:
+		return "NULL"
+	case KindInt, KindFloat:
+		return v.String()
+	case KindBlob:
+		return "X'" + hex.EncodeToString([]byte(v.S)) + "'"
+	}
+	return "'" + strings.ReplaceAll(v.S, "'", "''") + "'"
+}
+
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEnN") {
+		s += ".0"
+	}
+	return s
+}
+
+func (v Value) toFloat() float64 {
+	switch v.Kind {
+	case KindInt:
+		return float64(v.I)
+	case KindFloat:
+		return v.F
+	case KindText, KindBlob:
+		if n, ok := parseNumber(v.S); ok {
+			return n.toFloat()
+		}
+	}
+	return 0
+}
+
+// truthy 按 SQL 规则判断条件是否成立，NULL 视为不成立
+func (v Value) truthy() bool {
+	switch v.Kind {
+	case KindNull:
+		return false
+	case KindInt:
+		return v.I != 0
+	default:
+		return v.toFloat() != 0
+	}
+}
+
+// parseNumber 把看起来像数字的文本转换成 INT 或 FLOAT
+func parseNumber(s string) (Value, bool) {
+	t := strings.TrimSpace(s)
+	if t == "" {
+		return Null, false
+	}
+	if i, err := strconv.ParseInt(t, 10, 64); err == nil {
+		return IntValue(i), true
+	}
+	if f, err := strconv.ParseFloat(t, 64); err == nil && !math.IsNaN(f) {
+		return FloatValue(f), true
+	}
+	return Null, false
+}
+
+// 列的类型亲和性，规则与 SQLite 相同（未声明类型时按数值推断）
+type affinity int
+
+const (
+	affinityNumeric affinity = iota
+	affinityInteger
+	affinityReal
+	affinityText
+	affinityBlob
+)
+
+func typeAffinity(declType string) affinity {
+	t := strings.ToUpper(declType)
+	switch {
+	case strings.Contains(t, "INT"):
+		return affinityInteger
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		return affinityText
+	case strings.Contains(t, "BLOB"):
+		return affinityBlob
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"):
+		return affinityReal
+	}
+	return affinityNumeric
+}
+
+// valueFromStorage 把记录中的字段按列亲和性还原为带类型的值
+func valueFromStorage(s string, isNull bool, aff affinity) Value {
+	if isNull {
+		return Null
+	}
+	switch aff {
+	case affinityText:
+		return TextValue(s)
+	case affinityBlob:
+		return BlobValue(s)
+	}
+	n, ok := parseNumber(s)
+	if !ok {
+		return TextValue(s)
+	}
+	if aff == affinityReal {
+		return FloatValue(n.toFloat())
+	}
+	if n.Kind == KindFloat && n.F == math.Trunc(n.F) && math.Abs(n.F) < 1<<63 {
+		return IntValue(int64(n.F))
+	}
+	return n
+}
+
+// applyAffinity 插入时按列亲和性转换值，使相等的值有相同的存储形式
+func applyAffinity(v Value, aff affinity) Value {
+	switch v.Kind {
+	case KindNull, KindBlob:
+		return v
+	}
+	switch aff {
+	case affinityText:
+		return TextValue(v.String())
+	case affinityBlob:
+		return v
+	}
+	n := v
+	if v.Kind == KindText {
+		parsed, ok := parseNumber(v.S)
+		if !ok {
+			return v
+		}
+		n = parsed
+	}
+	if aff == affinityReal {
+		return FloatValue(n.toFloat())
+	}
+	if n.Kind == KindFloat && n.F == math.Trunc(n.F) && math.Abs(n.F) < 1<<63 {
+		return IntValue(int64(n.F))
+	}
+	return n
+}
+
+// 排序时各类型的先后：NULL < 数值 < TEXT < BLOB
+func kindRank(k Kind) int {
+	switch k {
+	case KindNull:
+		return 0
+	case KindInt, KindFloat:
+		return 1
+	case KindText:
+		return 2
+	}
+	return 3
+}
+
+// compareValues 比较两个值，返回 -1/0/1
+func compareValues(a, b Value) int {
+	ra, rb := kindRank(a.Kind), kindRank(b.Kind)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+	switch ra {
+	case 0:
+		return 0
+	case 1:
+		if a.Kind == KindInt && b.Kind == KindInt {
+			switch {
+			case a.I < b.I:
+				return -1
+			case a.I > b.I:
+				return 1
+			}
+			return 0
+		}
+		fa, fb := a.toFloat(), b.toFloat()
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a.S, b.S)
+}
+
+// groupKey 生成用于哈希分组的键，数值相等的 INT 与 FLOAT 归为同一组
+func (v Value) groupKey() string {
+	switch v.Kind {
+	case KindNull:
+		return "n"
+	case KindInt:
+		return "i" + strconv.FormatInt(v.I, 10)
+	case KindFloat:
+		if v.F == math.Trunc(v.F) && math.Abs(v.F) < 1<<63 {
+			return "i" + strconv.FormatInt(int64(v.F), 10)
+		}
+		return "f" + strconv.FormatFloat(v.F, 'g', -1, 64)
+	case KindText:
+		return "t" + v.S
+	}
+	return "b" + v.S
+}
+
+func (k Kind) String() string {
+	switch k {
+	case KindNull:
+		return "NULL"
+	case KindInt:
+		return "INTEGER"
+	case KindFloat:
+		return "REAL"
+	case KindText:
+		return "TEXT"
+	case KindBlob:
+		return "BLOB"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
@@ -0,0 +1,183 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+/*
+在线备份把一个正在使用的数据库逐页复制到另一个 Pager，与 SQLite 的 backup API 相同，
+每次 Step 复制若干页，两次 Step 之间源数据库照常读写。
+
+  - 每次 Step 在源数据库的一个快照上进行，只在这一步期间持有读锁；
+  - 同一个 Pager（包括它的快照所属的文件）写的页由 writePage 记在 dirty 中，
+    已经复制过的页下一步从新的快照重新复制，追上源数据库；
+  - 其他连接修改了文件（DataVersion 变化）时不知道改了哪些页，从第 1 页重新开始；
+  - 目标的所有写入在一个事务中，复制完最后一页时截掉多余的页并提交，
+    目标数据库要么是原来的内容，要么是源数据库在最后一步的快照版本。
+
+源数据库的事务中写的页在提交之前可能还会变，它们的 dirty 标记保留到事务结束之后的一步。
+逻辑页的内容与文件格式无关，目标可以使用不同的格式（影子分页、校验和、压缩、加密）。
+*/
+
+// Backup 是一个进行中的在线备份，由 NewBackup 创建，Step 直到完成，最后调用 Close
+type Backup struct {
+	src, dst    *Pager
+	next        int          // 下一个按顺序复制的页
+	pages       int          // 最近一步时源数据库的页数
+	dataVersion uint64       // 开始或重新开始时源数据库的 DataVersion
+	dirty       map[int]bool // 复制之后被改写的页，由源数据库的 mu 保护
+	restarts    int
+	done        bool // 已经提交
+	closed      bool
+}
+
+// NewBackup 开始把 src 备份到 dst，dst 原有的内容在完成时被替换。
+// 在 Close 之前 dst 一直在事务中，持有它的写锁。
+func NewBackup(dst, src *Pager) (*Backup, error) {
+	if src.snap != nil || dst.snap != nil {
+		return nil, ErrReadOnly
+	}
+	if src.pagerFile == dst.pagerFile || (src.vfs == dst.vfs && src.filename == dst.filename) {
+		return nil, fmt.Errorf("source and destination are the same database")
+	}
+	if err := dst.Begin(); err != nil {
+		return nil, fmt.Errorf("begin backup destination: %w", err)
+	}
+	b := &Backup{src: src, dst: dst, next: 1, dirty: map[int]bool{}}
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	b.dataVersion = src.dataVersion
+	if src.backups == nil {
+		src.backups = map[*Backup]bool{}
+	}
+	src.backups[b] = true
+	return b, nil
+}
+
+// Step 最多按顺序复制 n 页，n <= 0 时复制剩下的所有页；之前复制过又被改写的页总是重新复制。
+// 返回 true 时备份已经完成并提交。源数据库被其他连接锁住时返回 ErrBusy，可以稍后重试。
+func (b *Backup) Step(n int) (bool, error) {
+	if b.closed {
+		return b.done, fmt.Errorf("backup is closed")
+	}
+	if b.done {
+		return true, nil
+	}
+	var dirty map[int]bool
+	var inTx bool
+	var dataVersion uint64
+	snap, err := b.src.snapshotWith(func() {
+		dirty, b.dirty = b.dirty, map[int]bool{}
+		inTx, dataVersion = b.src.inTx(), b.src.dataVersion
+	})
+	if err != nil {
+		return false, err
+	}
+	defer snap.Close()
+
+	if dataVersion != b.dataVersion {
+		// 其他连接改过文件，已经复制的页都不可信
+		if b.next > 1 {
+			Logger.Printf("[Backup] Source changed by another connection, restarting from page 1")
+			b.restarts++
+		}
+		b.dataVersion, b.next, dirty = dataVersion, 1, nil
+	}
+	b.pages = snap.PageCount()
+
+	var recopy []int
+	for pageNum := range dirty {
+		// 还没有复制到的页在下面按顺序复制
+		if pageNum < b.next && pageNum <= b.pages {
+			recopy = append(recopy, pageNum)
+		}
+	}
+	sort.Ints(recopy)
+	for _, pageNum := range recopy {
+		if err := b.copyPage(snap, pageNum); err != nil {
+			return false, err
+		}
+	}
+	for copied := 0; b.next <= b.pages && (n <= 0 || copied < n); copied++ {
+		if err := b.copyPage(snap, b.next); err != nil {
+			return false, err
+		}
+		b.next++
+	}
+	if inTx {
+		// 事务提交之前这些页还可能变，下一步再复制一次
+		b.src.mu.Lock()
+		for pageNum := range dirty {
+			b.dirty[pageNum] = true
+		}
+		b.src.mu.Unlock()
+	}
+	if b.next <= b.pages {
+		return false, nil
+	}
+
+	// 目标现在与快照版本相同
+	if err := b.dst.Truncate(b.pages); err != nil {
+		return false, err
+	}
+	if err := b.dst.Commit(); err != nil {
+		return false, err
+	}
+	b.done = true
+	b.unregister()
+	Logger.Printf("[Backup] Copied %d pages", b.pages)
+	return true, nil
+}
+
+// copyPage 把快照中的一页写到目标，分配之后还没有写过的页写为全 0
+func (b *Backup) copyPage(snap *Pager, pageNum int) error {
+	data, err := snap.ReadPage(pageNum)
+	if errors.Is(err, io.EOF) {
+		data, err = make([]byte, PageSize), nil
+	}
+	if err != nil {
+		return fmt.Errorf("read page %d of the backup source: %w", pageNum, err)
+	}
+	if err := b.dst.WritePage(pageNum, data); err != nil {
+		return fmt.Errorf("write page %d of the backup destination: %w", pageNum, err)
+	}
+	return nil
+}
+
+// Remaining 返回最近一步之后还没有按顺序复制的页数
+func (b *Backup) Remaining() int {
+	return max(b.pages-b.next+1, 0)
+}
+
+// PageCount 返回最近一步时源数据库的页数
+func (b *Backup) PageCount() int {
+	return b.pages
+}
+
+// Restarts 返回因为其他连接修改了源数据库而从头开始的次数
+func (b *Backup) Restarts() int {
+	return b.restarts
+}
+
+// Close 结束备份，没有完成时回滚目标的事务，目标保持原来的内容
+func (b *Backup) Close() error {
+	if b.closed || b.done {
+		b.closed = true
+		return nil
+	}
+	b.closed = true
+	b.unregister()
+	if !b.dst.InTransaction() {
+		return nil
+	}
+	return b.dst.Rollback()
+}
+
+func (b *Backup) unregister() {
+	b.src.mu.Lock()
+	defer b.src.mu.Unlock()
+	delete(b.src.backups, b)
+}
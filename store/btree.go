@@ -3,7 +3,6 @@ package store
 import (
 	"bytes"
 	"encoding/binary"
-	"errors"
 	"fmt"
 )
 
@@ -82,10 +81,11 @@ func EncodeInternalCell(key string, childPage uint32) []byte {
 	return buf.Bytes()
 }
 
+// DecodeInternalCell 解码内部页的 cell，格式不对时返回的错误满足 errors.Is(err, ErrCorrupt)
 func DecodeInternalCell(data []byte) (string, uint32, error) {
 	nullIndex := bytes.IndexByte(data, 0)
-	if nullIndex == -1 || nullIndex+5 > len(data) {
-		return "", 0, fmt.Errorf("invalid internal cell: nullIndex=%d, len=%d", nullIndex, len(data))
+	if nullIndex == -1 || nullIndex+5 != len(data) {
+		return "", 0, fmt.Errorf("%w: invalid internal cell: nullIndex=%d, len=%d", ErrCorrupt, nullIndex, len(data))
 	}
 	key := string(data[:nullIndex])
 	child := binary.LittleEndian.Uint32(data[nullIndex+1 : nullIndex+5])
@@ -133,10 +133,11 @@ func (p *Page) ToBytes() ([]byte, error) {
 	return buf, nil
 }
 
-// FromBytes bytes to page
+// PageFromBytes 解析 B+ 树页。先检查类型、cell 数和 cell 偏移，
+// 损坏的页返回的错误满足 errors.Is(err, ErrCorrupt)，cell 都在页内。
 func PageFromBytes(data []byte) (*Page, error) {
-	if len(data) != PageSize {
-		return nil, errors.New("invalid page size")
+	if msg := checkPageLayout(data); msg != "" {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupt, msg)
 	}
 	typ := data[0]
 	cellCount := binary.LittleEndian.Uint16(data[1:])
@@ -162,8 +163,35 @@ func PageFromBytes(data []byte) (*Page, error) {
 	}
 	if typ == PageLeaf {
 		page.NextLeaf = binary.LittleEndian.Uint32(data[5:])
-	} else if typ == PageInternal {
+	} else {
 		page.LeftChild = binary.LittleEndian.Uint32(data[5:])
 	}
 	return page, nil
 }
+
+// checkPageLayout 检查 B+ 树页的类型和 cell 偏移，返回问题描述，没有问题时为空串
+func checkPageLayout(data []byte) string {
+	if len(data) != PageSize {
+		return fmt.Sprintf("page has %d bytes", len(data))
+	}
+	if data[0] != PageLeaf && data[0] != PageInternal {
+		return fmt.Sprintf("invalid page type 0x%02x", data[0])
+	}
+	n := int(binary.LittleEndian.Uint16(data[1:]))
+	tableEnd := pageHeaderSize + 2*n
+	if tableEnd > PageSize {
+		return fmt.Sprintf("cell count %d does not fit in a page", n)
+	}
+	end := PageSize
+	for i := 0; i < n; i++ {
+		off := int(binary.LittleEndian.Uint16(data[pageHeaderSize+2*i:]))
+		if off < tableEnd || off >= end {
+			return fmt.Sprintf("cell %d offset %d out of bounds [%d, %d)", i, off, tableEnd, end)
+		}
+		end = off
+	}
+	if start := int(binary.LittleEndian.Uint16(data[3:])); start != end {
+		return fmt.Sprintf("cell content starts at %d, header says %d", end, start)
+	}
+	return ""
+}
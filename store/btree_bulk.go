@@ -0,0 +1,204 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+批量加载：从按 key 有序的记录流自底向上建一棵新的 B+ 树。
+
+记录依次放进当前叶子页，页中的字节数超过 fillFactor 时开始新的一页，
+并用 NextLeaf 把两页连起来。每写完一页就把（第一个 key，页号）交给上一层：
+每层第一个子页作为 LeftChild，之后的作为 cell，同样按 fillFactor 分页，
+页满时再交给更上一层。结束时从下往上写完每层的最后一页，最上面一层只有一页，就是根。
+
+分隔 key 取右边子页的第一个 key，与 InsertRow 分裂时相同。
+fillFactor 小于 1 时页中留有空间，之后的插入不会马上分裂。
+每层最后一页可能不满，内部层的最后一页可能只有 LeftChild。
+*/
+
+const DefaultFillFactor = 0.9
+
+// ErrNotSorted 表示加入的记录 key 比前一条小
+var ErrNotSorted = errors.New("records are not sorted by key")
+
+// 页头 9 字节，每个 cell 另外占 2 字节的指针
+const pageHeaderSize = 9
+
+type BulkLoader struct {
+	pager   *Pager
+	limit   int // 每页最多使用的字节数
+	levels  []*bulkLevel
+	lastKey string
+	count   int
+	done    bool
+}
+
+// bulkLevel 是某一层正在填充的页
+type bulkLevel struct {
+	page     *Page
+	pageNo   int    // 已经分配的页号，叶子层开始新页时就分配，以便写 NextLeaf
+	firstKey string // 页中第一个 key（内部页是 LeftChild 的 key）
+	size     int
+	children int
+}
+
+// NewBulkLoader 创建批量加载器，fillFactor 取 (0, 1]
+func NewBulkLoader(pager *Pager, fillFactor float64) (*BulkLoader, error) {
+	if fillFactor <= 0 || fillFactor > 1 {
+		return nil, fmt.Errorf("fill factor %v out of range (0, 1]", fillFactor)
+	}
+	return &BulkLoader{
+		pager: pager,
+		limit: pageHeaderSize + int(float64(PageSize-pageHeaderSize)*fillFactor),
+	}, nil
+}
+
+// Count 返回已经加入的记录数
+func (b *BulkLoader) Count() int {
+	return b.count
+}
+
+// Add 加入一条记录，key 不能比前一条小，相同的 key 按加入顺序排列。
+// 返回 ErrNotSorted 时记录没有加入，之前的记录仍然可以用 Finish 建成树。
+func (b *BulkLoader) Add(record []byte) error {
+	if b.done {
+		return fmt.Errorf("bulk loader already finished")
+	}
+	key, err := ExtractKey(record)
+	if err != nil {
+		return err
+	}
+	if b.count > 0 && key < b.lastKey {
+		return fmt.Errorf("%w: %q after %q", ErrNotSorted, key, b.lastKey)
+	}
+	if len(record)+2 > PageSize-pageHeaderSize {
+		return fmt.Errorf("record of %d bytes does not fit in a page", len(record))
+	}
+	if err := b.addToLevel(0, key, record, 0); err != nil {
+		return err
+	}
+	b.lastKey = key
+	b.count++
+	return nil
+}
+
+// addToLevel 把一条记录（level 0）或一个子页（level > 0）加入某层的当前页
+func (b *BulkLoader) addToLevel(level int, key string, cell []byte, child int) error {
+	if level == len(b.levels) {
+		b.levels = append(b.levels, &bulkLevel{})
+	}
+	l := b.levels[level]
+	need := len(cell) + 2
+	if level > 0 {
+		cell, need = nil, 0
+		if l.page != nil {
+			cell = EncodeInternalCell(key, uint32(child))
+			need = len(cell) + 2
+		}
+	}
+
+	// 当前页满了，写出去并开始新页。内部页至少要有两个子页，否则层数不会减少
+	if l.page != nil && l.size+need > b.limit && (level == 0 || l.children > 1) {
+		next := 0
+		if level == 0 {
+			var err error
+			if next, err = b.pager.AllocatePage(); err != nil {
+				return err
+			}
+		}
+		if err := b.flush(level, next); err != nil {
+			return err
+		}
+		l.pageNo = next
+		if level > 0 {
+			cell, need = nil, 0
+		}
+	}
+	if l.page == nil {
+		if level == 0 {
+			l.page = NewLeafPage()
+			if l.pageNo == 0 {
+				var err error
+				if l.pageNo, err = b.pager.AllocatePage(); err != nil {
+					return err
+				}
+			}
+		} else {
+			l.page = NewInternalPage()
+		}
+		l.firstKey, l.size, l.children = key, pageHeaderSize, 0
+	}
+	if level > 0 && l.children == 0 {
+		l.page.LeftChild = uint32(child)
+	} else {
+		l.page.Cells = append(l.page.Cells, cell)
+		l.size += need
+	}
+	l.children++
+	return nil
+}
+
+// flush 写出某层的当前页并交给上一层，next 是叶子层下一页的页号
+func (b *BulkLoader) flush(level int, next int) error {
+	l := b.levels[level]
+	if level == 0 {
+		l.page.NextLeaf = uint32(next)
+	} else {
+		var err error
+		if l.pageNo, err = b.pager.AllocatePage(); err != nil {
+			return err
+		}
+	}
+	data, err := l.page.ToBytes()
+	if err != nil {
+		return err
+	}
+	if err := b.pager.WritePage(l.pageNo, data); err != nil {
+		return err
+	}
+	pageNo, firstKey := l.pageNo, l.firstKey
+	l.page = nil
+	return b.addToLevel(level+1, firstKey, nil, pageNo)
+}
+
+// Finish 写出剩下的页，返回新树的根页号。没有加入记录时根是一个空的叶子页。
+func (b *BulkLoader) Finish() (int, error) {
+	if b.done {
+		return 0, fmt.Errorf("bulk loader already finished")
+	}
+	b.done = true
+	if len(b.levels) == 0 {
+		root, err := b.pager.AllocatePage()
+		if err != nil {
+			return 0, err
+		}
+		data, _ := NewLeafPage().ToBytes()
+		return root, b.pager.WritePage(root, data)
+	}
+	for level := 0; ; level++ {
+		l := b.levels[level]
+		if level == len(b.levels)-1 && (level == 0 || l.children > 1) {
+			// 最上面一层只剩这一页，它就是根
+			if level > 0 {
+				var err error
+				if l.pageNo, err = b.pager.AllocatePage(); err != nil {
+					return 0, err
+				}
+			}
+			data, err := l.page.ToBytes()
+			if err != nil {
+				return 0, err
+			}
+			return l.pageNo, b.pager.WritePage(l.pageNo, data)
+		}
+		if level == len(b.levels)-1 {
+			// 只有一个子页的内部页不需要，子页就是根
+			return int(l.page.LeftChild), nil
+		}
+		if err := b.flush(level, 0); err != nil {
+			return 0, err
+		}
+	}
+}
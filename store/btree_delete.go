@@ -2,53 +2,79 @@ package store
 
 import "fmt"
 
+// DeleteRow 删除 key 对应的第一条记录（重复的 key 按插入的先后），没有这个 key 时返回错误
 func DeleteRow(pager *Pager, rootPage int, key string) (int, error) {
-	raw, err := pager.ReadPage(rootPage)
-	if err != nil {
-		return 0, fmt.Errorf("read rootPage %d: %w", rootPage, err)
-	}
-	page, err := PageFromBytes(raw)
+	_, err := deleteRows(pager, rootPage, key, 1)
+	return rootPage, err
+}
+
+// DeleteRows 删除 key 对应的所有记录，返回删除的记录。
+// 重复的 key 可能分布在相邻的多个叶子中，从可能包含 key 的第一个叶子开始沿叶子链删除
+func DeleteRows(pager *Pager, rootPage int, key string) (int, [][]byte, error) {
+	removed, err := deleteRows(pager, rootPage, key, -1)
+	return rootPage, removed, err
+}
+
+// deleteRows 最多删除 limit 条 key 相同的记录，limit < 0 时不限制。
+// 删除之后不合并叶子，根页不变；空的叶子留在叶子链中，遍历时跳过
+func deleteRows(pager *Pager, rootPage int, key string, limit int) ([][]byte, error) {
+	pageNo, err := seekLeaf(pager, rootPage, key)
 	if err != nil {
-		return 0, fmt.Errorf("parse rootPage: %w", err)
+		return nil, err
 	}
+	var removed [][]byte
+	visited := map[int]bool{}
+	for pageNo != 0 && limit != 0 {
+		if visited[pageNo] {
+			return nil, fmt.Errorf("detected loop: page %d already visited", pageNo)
+		}
+		visited[pageNo] = true
+		raw, err := pager.ReadPage(pageNo)
+		if err != nil {
+			return nil, fmt.Errorf("read page %d: %w", pageNo, err)
+		}
+		page, err := PageFromBytes(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse page %d: %w", pageNo, err)
+		}
+		if page.Type != PageLeaf {
+			return nil, fmt.Errorf("page %d in leaf chain is not a leaf", pageNo)
+		}
 
-	if page.Type == PageLeaf {
-		found := false
-		newCells := [][]byte{}
+		kept := make([][]byte, 0, len(page.Cells))
+		past := false // 已经遇到比 key 大的记录，后面的叶子不用再看
 		for _, cell := range page.Cells {
 			cellKey, err := ExtractKey(cell)
 			if err != nil {
-				continue
+				return nil, fmt.Errorf("page %d: %w", pageNo, err)
 			}
-			if cellKey == key {
-				found = true
+			if cellKey == key && limit != 0 {
+				removed = append(removed, cell)
+				limit--
 				continue
 			}
-			newCells = append(newCells, cell)
-		}
-		if !found {
-			return 0, fmt.Errorf("not found")
+			if cellKey > key {
+				past = true
+			}
+			kept = append(kept, cell)
 		}
-		page.Cells = newCells
-		data, _ := page.ToBytes()
-		err := pager.WritePage(rootPage, data)
-		return rootPage, err
-	}
-
-	// Internal page
-	childPage := int(page.LeftChild)
-	for _, cell := range page.Cells {
-		k, child, err := DecodeInternalCell(cell)
-		if err != nil {
-			continue
+		if len(kept) != len(page.Cells) {
+			page.Cells = kept
+			data, err := page.ToBytes()
+			if err != nil {
+				return nil, err
+			}
+			if err := pager.WritePage(pageNo, data); err != nil {
+				return nil, err
+			}
 		}
-		if key < k {
+		if past {
 			break
 		}
-		childPage = int(child)
+		pageNo = int(page.NextLeaf)
 	}
-
-	_, err = DeleteRow(pager, childPage, key)
-	return rootPage, err
-
+	if len(removed) == 0 {
+		return nil, fmt.Errorf("not found")
+	}
+	return removed, nil
 }
@@ -0,0 +1,61 @@
+package store
+
+import "fmt"
+
+// TreePages 返回一棵 B+ 树用到的所有页（先序），重复引用视为损坏。
+// 记录总是完整地放在叶子页中，没有溢出页，所以这些就是树的全部页。
+func TreePages(pager *Pager, rootPage int) ([]int, error) {
+	var pages []int
+	visited := map[int]bool{}
+	var walk func(pageNo int) error
+	walk = func(pageNo int) error {
+		if visited[pageNo] {
+			return fmt.Errorf("detected loop: page %d already visited", pageNo)
+		}
+		visited[pageNo] = true
+		pages = append(pages, pageNo)
+
+		raw, err := pager.ReadPage(pageNo)
+		if err != nil {
+			return fmt.Errorf("read page %d: %w", pageNo, err)
+		}
+		page, err := PageFromBytes(raw)
+		if err != nil {
+			return fmt.Errorf("parse page %d: %w", pageNo, err)
+		}
+		if page.Type != PageInternal {
+			return nil
+		}
+		if err := walk(int(page.LeftChild)); err != nil {
+			return err
+		}
+		for _, cell := range page.Cells {
+			_, child, err := DecodeInternalCell(cell)
+			if err != nil {
+				return err
+			}
+			if err := walk(int(child)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(rootPage); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// FreeTree 把一棵 B+ 树的所有页放回空闲链表
+func FreeTree(pager *Pager, rootPage int) error {
+	pages, err := TreePages(pager, rootPage)
+	if err != nil {
+		return err
+	}
+	for _, pageNo := range pages {
+		if err := pager.FreePage(pageNo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -14,36 +14,68 @@ func InsertIntoLeafPage(pager *Pager, pageNo int, row []byte) (InsertResult, err
 	if page.Type != PageLeaf {
 		return InsertResult{}, fmt.Errorf("InsertIntoLeafPage: not a leaf page")
 	}
+	rowKey, err := ExtractKey(row)
+	if err != nil {
+		return InsertResult{}, fmt.Errorf("extract key from row: %w", err)
+	}
+
+	// 按 key 有序插入（相同 key 排在已有记录之后），保证叶子内部有序
+	pos := len(page.Cells)
+	for i, cell := range page.Cells {
+		cellKey, err := ExtractKey(cell)
+		if err != nil {
+			continue
+		}
+		if rowKey < cellKey {
+			pos = i
+			break
+		}
+	}
+	page.Cells = append(page.Cells, nil)
+	copy(page.Cells[pos+1:], page.Cells[pos:])
+	page.Cells[pos] = row
 
 	// 试图添加新记录后模拟 ToBytes，看是否仍能容纳
-	test := *page // 浅拷贝
-	test.Cells = append(test.Cells, row)
-	test.Offsets = nil // 让 ToBytes 重新计算
-	if _, err := test.ToBytes(); err == nil {
+	if data, err := page.ToBytes(); err == nil {
 		// 容纳得下
-		page.Cells = append(page.Cells, row)
-		data, _ := page.ToBytes()
-		pager.WritePage(pageNo, data)
+		if err := pager.WritePage(pageNo, data); err != nil {
+			return InsertResult{}, err
+		}
 		return InsertResult{SelfChanged: true, Split: false}, nil
 	}
 
 	// 页满，执行分裂
-	page.Cells = append(page.Cells, row) // 加回来再分裂
-
-	mid := len(page.Cells) / 2
+	mid, err := splitPoint(page.Cells, false)
+	if err != nil {
+		return InsertResult{}, fmt.Errorf("split leaf page %d: %w", pageNo, err)
+	}
 	left := NewLeafPage()
 	right := NewLeafPage()
 
 	left.Cells = append(left.Cells, page.Cells[:mid]...)
 	right.Cells = append(right.Cells, page.Cells[mid:]...)
 
-	rightPage := pager.AllocatePage()
+	rightPage, err := pager.AllocatePage()
+	if err != nil {
+		return InsertResult{}, err
+	}
+	right.NextLeaf = page.NextLeaf // 右页接上原来的叶子链
 	left.NextLeaf = uint32(rightPage)
 
-	dataL, _ := left.ToBytes()
-	dataR, _ := right.ToBytes()
-	pager.WritePage(pageNo, dataL)
-	pager.WritePage(rightPage, dataR)
+	dataL, err := left.ToBytes()
+	if err != nil {
+		return InsertResult{}, err
+	}
+	dataR, err := right.ToBytes()
+	if err != nil {
+		return InsertResult{}, err
+	}
+	if err := pager.WritePage(pageNo, dataL); err != nil {
+		return InsertResult{}, err
+	}
+	if err := pager.WritePage(rightPage, dataR); err != nil {
+		return InsertResult{}, err
+	}
 
 	return InsertResult{
 		SelfChanged: true,
@@ -52,163 +84,211 @@ func InsertIntoLeafPage(pager *Pager, pageNo int, row []byte) (InsertResult, err
 		NewPageNo:   rightPage,
 	}, nil
 }
+
+// InsertRow 插入一行，返回插入后的根页号（根分裂时会变化）
 func InsertRow(pager *Pager, rootPage int, row []byte) (int, error) {
 	if rootPage <= 0 {
 		return 0, fmt.Errorf("invalid rootPage: %d", rootPage)
 	}
 
-	raw, err := pager.ReadPage(rootPage)
+	promoteKey, res, err := insertRecursive(pager, rootPage, row)
 	if err != nil {
-		return 0, fmt.Errorf("read rootPage %d: %w", rootPage, err)
+		return 0, err
 	}
-	root, err := PageFromBytes(raw)
-	if err != nil {
-		return 0, fmt.Errorf("parse rootPage: %w", err)
+	if !res.Split {
+		return rootPage, nil
 	}
 
-	// ✅ CASE 1: 叶子页插入
-	if root.Type == PageLeaf {
-		res, err := InsertIntoLeafPage(pager, rootPage, row)
-		if err != nil {
-			return 0, err
-		}
-		if !res.Split {
-			return rootPage, nil
-		}
-
-		// ⚠️ promote key 和 childPage = res.NewPageNo
-		key, err := ExtractKey(res.NewPage.Cells[0])
-		if err != nil {
-			return 0, fmt.Errorf("ExtractKey on right split leaf failed: %w", err)
-		}
-
-		newRoot := NewInternalPage()
-		newRoot.LeftChild = uint32(rootPage)
-		newRoot.Cells = append(newRoot.Cells, EncodeInternalCell(key, uint32(res.NewPageNo)))
-		sortInternalCells(newRoot)
+	// ✅ 根分裂：新建根，左边是原根页，右边是分裂出的新页
+	newRoot := NewInternalPage()
+	newRoot.LeftChild = uint32(rootPage)
+	newRoot.Cells = append(newRoot.Cells, EncodeInternalCell(promoteKey, uint32(res.NewPageNo)))
 
-		newRootPage := pager.AllocatePage()
-		pager.WritePage(newRootPage, newRoot.ToBytesMust())
-		return newRootPage, nil
+	newRootPage, err := pager.AllocatePage()
+	if err != nil {
+		return 0, err
+	}
+	if err := pager.WritePage(newRootPage, newRoot.ToBytesMust()); err != nil {
+		return 0, err
 	}
+	return newRootPage, nil
+}
 
-	// ✅ CASE 2: Internal Page → 向下递归插入
-	insertPage := int(root.LeftChild)
-	rowKey, err := ExtractKey(row)
+// InsertRowFixedRoot 插入一行并保持根页号不变：根分裂时把原根的内容搬到新页，
+// 再把新根的内容写回原根页。用于根页号记录在固定位置的树（例如元数据表）。
+func InsertRowFixedRoot(pager *Pager, rootPage int, row []byte) error {
+	newRoot, err := InsertRow(pager, rootPage, row)
+	if err != nil || newRoot == rootPage {
+		return err
+	}
+	oldRoot, err := pager.ReadPage(rootPage)
 	if err != nil {
-		return 0, fmt.Errorf("extract key from row: %w", err)
+		return err
 	}
-	for i := 0; i < len(root.Cells); i++ {
-		key, child, err := DecodeInternalCell(root.Cells[i])
-		if err != nil {
-			return 0, fmt.Errorf("DecodeInternalCell at i=%d: %w", i, err)
-		}
-		if rowKey < key {
-			break
-		}
-		insertPage = int(child)
+	raw, err := pager.ReadPage(newRoot)
+	if err != nil {
+		return err
+	}
+	page, err := PageFromBytes(raw)
+	if err != nil {
+		return err
 	}
 
-	newChildPage, err := InsertRow(pager, insertPage, row)
+	// 原根是最左边的页，除了新根之外没有别的页指向它
+	moved, err := pager.AllocatePage()
 	if err != nil {
-		return 0, err
+		return err
 	}
-	if newChildPage == insertPage {
-		return rootPage, nil
+	if err := pager.WritePage(moved, oldRoot); err != nil {
+		return err
+	}
+	page.LeftChild = uint32(moved)
+	data, err := page.ToBytes()
+	if err != nil {
+		return err
+	}
+	if err := pager.WritePage(rootPage, data); err != nil {
+		return err
 	}
+	return pager.FreePage(newRoot)
+}
 
-	// ✅ promoteKey: 从 newChild 的第一个 key 抽取
-	newChildRaw, err := pager.ReadPage(newChildPage)
+// insertRecursive 把 row 插入以 pageNo 为根的子树。
+// 子树分裂时返回需要提升到父节点的 key，res.NewPageNo 为分裂出的右页。
+func insertRecursive(pager *Pager, pageNo int, row []byte) (string, InsertResult, error) {
+	raw, err := pager.ReadPage(pageNo)
 	if err != nil {
-		return 0, err
+		return "", InsertResult{}, fmt.Errorf("read page %d: %w", pageNo, err)
 	}
-	newChild, err := PageFromBytes(newChildRaw)
+	page, err := PageFromBytes(raw)
 	if err != nil {
-		return 0, err
+		return "", InsertResult{}, fmt.Errorf("parse page %d: %w", pageNo, err)
 	}
-	// ✅ promoteKey, promoteChild 来自 newChild 的第一个 InternalCell
-	var promoteKey string
-	var promoteChild uint32
 
-	if newChild.Type == PageLeaf {
-		promoteKey, err = ExtractKey(newChild.Cells[0])
-		if err != nil {
-			return 0, fmt.Errorf("extract key from leaf: %w", err)
+	// ✅ CASE 1: 叶子页插入
+	if page.Type == PageLeaf {
+		res, err := InsertIntoLeafPage(pager, pageNo, row)
+		if err != nil || !res.Split {
+			return "", res, err
 		}
-		promoteChild = uint32(newChildPage) // ✅ child 是新分裂出来的 leaf 页页号
-	} else {
-		promoteKey, promoteChild, err = DecodeInternalCell(newChild.Cells[0]) // ✅ child 是 LeftChild
+		// ⚠️ promote key 取右页第一条记录的 key
+		key, err := ExtractKey(res.NewPage.Cells[0])
 		if err != nil {
-			return 0, fmt.Errorf("extract key from internal: %w", err)
+			return "", InsertResult{}, fmt.Errorf("ExtractKey on right split leaf failed: %w", err)
 		}
+		return key, res, nil
+	}
+	if page.Type != PageInternal {
+		return "", InsertResult{}, fmt.Errorf("invalid page type: %d", page.Type)
 	}
 
-	newCell := EncodeInternalCell(promoteKey, promoteChild)
-
-	// 插入 promote cell 到 root
-	insertPos := 0
-	for i := range root.Cells {
-		keyI, _, _ := DecodeInternalCell(root.Cells[i])
-		if promoteKey < keyI {
+	// ✅ CASE 2: Internal Page → 向下递归插入
+	insertPage := int(page.LeftChild)
+	insertPos := 0 // 子页分裂时新 cell 的位置，紧跟在 insertPage 的 cell 后面
+	rowKey, err := ExtractKey(row)
+	if err != nil {
+		return "", InsertResult{}, fmt.Errorf("extract key from row: %w", err)
+	}
+	for i := 0; i < len(page.Cells); i++ {
+		key, child, err := DecodeInternalCell(page.Cells[i])
+		if err != nil {
+			return "", InsertResult{}, fmt.Errorf("DecodeInternalCell at i=%d: %w", i, err)
+		}
+		if rowKey < key {
 			break
 		}
-		insertPos++
+		insertPage = int(child)
+		insertPos = i + 1
 	}
-	root.Cells = append(root.Cells, nil)
-	copy(root.Cells[insertPos+1:], root.Cells[insertPos:])
-	root.Cells[insertPos] = newCell
-	if insertPos == 0 {
-		root.LeftChild = promoteChild // ✅ promote 的左边是 promoteChild，不是 newChildPage
+
+	promoteKey, childRes, err := insertRecursive(pager, insertPage, row)
+	if err != nil || !childRes.Split {
+		return "", InsertResult{}, err
 	}
 
-	data, err := root.ToBytes()
-	if err == nil {
-		pager.WritePage(rootPage, data)
-		return rootPage, nil
+	// 插入 promote cell，LeftChild 保持不变。位置按子页而不是按 key 找：
+	// 分隔键可以重复，按 key 找可能把新页放到另一个相同分隔键的后面
+	newCell := EncodeInternalCell(promoteKey, uint32(childRes.NewPageNo))
+	page.Cells = append(page.Cells, nil)
+	copy(page.Cells[insertPos+1:], page.Cells[insertPos:])
+	page.Cells[insertPos] = newCell
+
+	if data, err := page.ToBytes(); err == nil {
+		if err := pager.WritePage(pageNo, data); err != nil {
+			return "", InsertResult{}, err
+		}
+		return "", InsertResult{SelfChanged: true}, nil
 	}
 
-	// ✅ root 自身也满了 → 分裂
-	mid := len(root.Cells) / 2
-	promoteCell := root.Cells[mid]
-	promoteKey, _, err = DecodeInternalCell(promoteCell)
+	// ✅ 内部页也满了 → 分裂，中间 cell 提升到父节点
+	mid, err := splitPoint(page.Cells, true)
 	if err != nil {
-		return 0, fmt.Errorf("decode promote key during split: %w", err)
+		return "", InsertResult{}, fmt.Errorf("split internal page %d: %w", pageNo, err)
+	}
+	midKey, midChild, err := DecodeInternalCell(page.Cells[mid])
+	if err != nil {
+		return "", InsertResult{}, fmt.Errorf("decode promote key during split: %w", err)
 	}
-
-	root.Cells = append(root.Cells[:mid], root.Cells[mid+1:]...)
 
 	left := NewInternalPage()
 	right := NewInternalPage()
 
-	left.LeftChild = root.LeftChild
-	left.Cells = append(left.Cells, root.Cells[:mid]...)
-
-	right.Cells = append(right.Cells, root.Cells[mid:]...)
-	rightPage := pager.AllocatePage()
-	right.LeftChild = extractChildFromFirstCell(right)
-
-	pager.WritePage(rootPage, left.ToBytesMust())
-	pager.WritePage(rightPage, right.ToBytesMust())
-
-	// ✅ promote key → rightPage（真正 promote 上去）
-	newRoot := NewInternalPage()
-	newRoot.LeftChild = uint32(rootPage)
-	newRoot.Cells = append(newRoot.Cells, EncodeInternalCell(promoteKey, uint32(rightPage)))
+	left.LeftChild = page.LeftChild
+	left.Cells = append(left.Cells, page.Cells[:mid]...)
 
-	newRootPage := pager.AllocatePage()
-	pager.WritePage(newRootPage, newRoot.ToBytesMust())
-	return newRootPage, nil
+	// 提升 cell 的子页成为右页的 LeftChild
+	right.LeftChild = midChild
+	right.Cells = append(right.Cells, page.Cells[mid+1:]...)
+	rightPage, err := pager.AllocatePage()
+	if err != nil {
+		return "", InsertResult{}, err
+	}
+	if err := pager.WritePage(pageNo, left.ToBytesMust()); err != nil {
+		return "", InsertResult{}, err
+	}
+	if err := pager.WritePage(rightPage, right.ToBytesMust()); err != nil {
+		return "", InsertResult{}, err
+	}
+	return midKey, InsertResult{
+		SelfChanged: true,
+		Split:       true,
+		NewPage:     right,
+		NewPageNo:   rightPage,
+	}, nil
 }
 
-func extractChildFromFirstCell(p *Page) uint32 {
-	if len(p.Cells) == 0 {
-		return 0
+// splitPoint 返回分裂的位置 i：左页是 cells[:i]，右页是 cells[i:]，两边都放得下，
+// 字节数尽量接近。按 cell 个数对半分时，大小悬殊的记录会让一边放不下。
+// promote 为 true 时（内部页）cells[i] 提升到父页，右页是 cells[i+1:]
+func splitPoint(cells [][]byte, promote bool) (int, error) {
+	const space = PageSize - pageHeaderSize
+	total := 0
+	for _, cell := range cells {
+		total += len(cell) + 2
 	}
-	_, child, err := DecodeInternalCell(p.Cells[0])
-	if err != nil {
-		return 0
+	best, bestDiff := -1, 0
+	left := 0
+	for i := 1; i < len(cells); i++ {
+		left += len(cells[i-1]) + 2
+		right := total - left
+		if promote {
+			if i == len(cells)-1 {
+				break
+			}
+			right -= len(cells[i]) + 2
+		}
+		if left > space || right > space {
+			continue
+		}
+		diff := max(left-right, right-left)
+		if best < 0 || diff < bestDiff {
+			best, bestDiff = i, diff
+		}
+	}
+	if best < 0 {
+		return 0, fmt.Errorf("%d cells of %d bytes do not fit in two pages", len(cells), total)
 	}
-	return child
+	return best, nil
 }
 
 func (p *Page) ToBytesMust() []byte {
@@ -221,7 +301,7 @@ func (p *Page) ToBytesMust() []byte {
 
 func ExtractPromoteKeyAndChild(pager *Pager, pageNo int) (string, uint32, error) {
 
-	fmt.Println("Use ExtractPromoteKeyAndChild")
+	Logger.Println("Use ExtractPromoteKeyAndChild")
 
 	raw, err := pager.ReadPage(pageNo)
 	if err != nil {
@@ -0,0 +1,367 @@
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 差分测试：同一串随机操作（插入、删除、查找、从某个 key 开始遍历）
+// 同时作用于 B+ 树和一个按 key 排序的多重映射，每一步之后比较结果、整棵树的内容和完整性检查。
+// 与表和索引一样 key 可以重复，相同 key 的记录按插入的先后排列，常常跨过叶子的边界。
+// 失败时把操作序列缩小到仍然失败的最短序列再报告。
+//
+//	go test ./store -run TestBTreeModel
+//	go test ./store -fuzz FuzzBTreeModel
+
+type modelOpKind byte
+
+const (
+	opInsert    modelOpKind = 'i'
+	opDelete    modelOpKind = 'd' // DeleteRow，删除最早插入的一条
+	opDeleteAll modelOpKind = 'D' // DeleteRows，删除所有重复的记录
+	opSearch    modelOpKind = 's'
+	opSeek      modelOpKind = 'k'
+)
+
+type modelOp struct {
+	kind modelOpKind
+	key  int // 见 modelKey
+	size int // 插入的值的长度
+}
+
+func (op modelOp) String() string {
+	if op.kind == opInsert {
+		return fmt.Sprintf("%c %q (%d bytes)", op.kind, modelKey(op.key), op.size)
+	}
+	return fmt.Sprintf("%c %q", op.kind, modelKey(op.key))
+}
+
+// modelKey 把编号变成 key：长度不同的数字（按字符串排序 "10" < "9"），
+// 后面补上长度不一的填充，让内部页也很快分裂
+func modelKey(n int) string {
+	return strconv.Itoa(n) + strings.Repeat("_", n*37%400)
+}
+
+func genModelOps(r *rand.Rand, n int) []modelOp {
+	ops := make([]modelOp, n)
+	for i := range ops {
+		op := modelOp{key: r.Intn(500)}
+		if r.Intn(4) == 0 {
+			// 少数几个 key 反复插入，重复的记录占满几个叶子
+			op.key = r.Intn(5)
+		}
+		switch k := r.Intn(10); {
+		case k < 6:
+			op.kind, op.size = opInsert, r.Intn(900)
+			if r.Intn(20) == 0 {
+				// 偶尔插入大的记录，分裂时两边的字节数相差很多
+				op.size = 1000 + r.Intn(500)
+			}
+		case k < 7:
+			op.kind = opDelete
+		case k < 8:
+			op.kind = opDeleteAll
+		case k < 9:
+			op.kind = opSearch
+		default:
+			op.kind = opSeek
+		}
+		ops[i] = op
+	}
+	return ops
+}
+
+// runModel 在空树和空模型上依次执行 ops，返回第一个不一致
+func runModel(ops []modelOp) error {
+	pager, err := OpenPagerWithOptions("model.db", Options{VFS: NewMemVFS()})
+	if err != nil {
+		return err
+	}
+	defer pager.Close()
+	root, err := pager.AllocatePage()
+	if err != nil {
+		return err
+	}
+	if err := pager.WritePage(root, NewLeafPage().ToBytesMust()); err != nil {
+		return err
+	}
+	model := modelMap{}
+	for i, op := range ops {
+		if err := stepModel(pager, &root, model, op, i); err != nil {
+			return fmt.Errorf("step %d (%v): %w", i, op, err)
+		}
+		if err := compareModel(pager, root, model); err != nil {
+			return fmt.Errorf("after step %d (%v): %w", i, op, err)
+		}
+	}
+	return nil
+}
+
+// modelMap 是模型：每个 key 的值按插入的先后排列
+type modelMap map[string][]string
+
+func stepModel(pager *Pager, root *int, model modelMap, op modelOp, step int) error {
+	key := modelKey(op.key)
+	want := model[key]
+	switch op.kind {
+	case opInsert:
+		value := fmt.Sprintf("%d:%s", step, strings.Repeat("v", op.size))
+		rec, err := EncodeRow([]string{key, value})
+		if err != nil {
+			return err
+		}
+		newRoot, err := InsertRow(pager, *root, rec)
+		if err != nil {
+			return err
+		}
+		*root = newRoot
+		model[key] = append(want, value)
+	case opDelete:
+		newRoot, err := DeleteRow(pager, *root, key)
+		if (len(want) > 0) != (err == nil) {
+			return fmt.Errorf("key has %d records, DeleteRow returned %v", len(want), err)
+		}
+		if err == nil {
+			*root = newRoot
+			model.remove(key, 1)
+		}
+	case opDeleteAll:
+		newRoot, removed, err := DeleteRows(pager, *root, key)
+		if (len(want) > 0) != (err == nil) {
+			return fmt.Errorf("key has %d records, DeleteRows returned %v", len(want), err)
+		}
+		if err != nil {
+			return nil
+		}
+		got, err := modelValues(removed)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("DeleteRows removed %q, want %q", got, want)
+		}
+		*root = newRoot
+		model.remove(key, len(want))
+	case opSearch:
+		rec, err := SearchRow(pager, *root, key)
+		if (len(want) > 0) != (err == nil) {
+			return fmt.Errorf("key has %d records, SearchRow returned %v", len(want), err)
+		}
+		if err == nil {
+			row, err := DecodeRow(rec)
+			if err != nil {
+				return err
+			}
+			// 重复的 key 返回最早插入的一条
+			if !reflect.DeepEqual(row, []string{key, want[0]}) {
+				return fmt.Errorf("SearchRow found %q, want %q", row, want[0])
+			}
+		}
+	case opSeek:
+		var got [][]string
+		err := SeekRows(pager, *root, key, func(rec []byte) error {
+			row, err := DecodeRow(rec)
+			got = append(got, row)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		var rows [][]string
+		for _, row := range model.rows() {
+			if row[0] >= key {
+				rows = append(rows, row)
+			}
+		}
+		if !reflect.DeepEqual(got, rows) {
+			return fmt.Errorf("SeekRows returned %q, want %q", modelRowKeys(got), modelRowKeys(rows))
+		}
+	}
+	return nil
+}
+
+// remove 删除 key 最早插入的 n 个值
+func (m modelMap) remove(key string, n int) {
+	if rest := m[key][n:]; len(rest) > 0 {
+		m[key] = rest
+	} else {
+		delete(m, key)
+	}
+}
+
+// rows 按 key 排序返回所有记录，相同 key 的按插入的先后
+func (m modelMap) rows() [][]string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var rows [][]string
+	for _, k := range keys {
+		for _, v := range m[k] {
+			rows = append(rows, []string{k, v})
+		}
+	}
+	return rows
+}
+
+// modelValues 取出记录的值
+func modelValues(recs [][]byte) ([]string, error) {
+	var values []string
+	for _, rec := range recs {
+		row, err := DecodeRow(rec)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, row[1])
+	}
+	return values, nil
+}
+
+// compareModel 比较整棵树的内容，并检查树的结构
+func compareModel(pager *Pager, root int, model modelMap) error {
+	var got [][]string
+	err := ScanRows(pager, root, func(rec []byte) error {
+		row, err := DecodeRow(rec)
+		got = append(got, row)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	want := model.rows()
+	if !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("tree has %d rows %q, model has %d rows %q", len(got), modelRowKeys(got), len(want), modelRowKeys(want))
+	}
+	problems, err := CheckIntegrity(pager, []TreeRoot{{Name: "tree", Root: root}})
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity check: %v", problems)
+	}
+	return nil
+}
+
+func modelRowKeys(rows [][]string) []string {
+	keys := make([]string, len(rows))
+	for i, row := range rows {
+		keys[i] = row[0]
+	}
+	return keys
+}
+
+// shrinkModel 缩小让 fails 返回 true 的操作序列：先删掉整段、再删掉单个操作，
+// 最后减小插入的值，直到任何一步缩小都不再失败
+func shrinkModel(ops []modelOp, fails func([]modelOp) bool) []modelOp {
+	for chunk := len(ops) / 2; chunk >= 1; chunk /= 2 {
+		for i := 0; i+chunk <= len(ops); {
+			candidate := append(append([]modelOp(nil), ops[:i]...), ops[i+chunk:]...)
+			if fails(candidate) {
+				ops = candidate
+			} else {
+				i += chunk
+			}
+		}
+	}
+	for i := range ops {
+		for ops[i].size > 0 {
+			candidate := append([]modelOp(nil), ops...)
+			candidate[i].size /= 2
+			if !fails(candidate) {
+				break
+			}
+			ops = candidate
+		}
+	}
+	return ops
+}
+
+// checkModel 执行 ops，失败时缩小之后报告最短的序列
+func checkModel(t *testing.T, ops []modelOp) {
+	t.Helper()
+	if runModel(ops) == nil {
+		return
+	}
+	ops = shrinkModel(ops, func(ops []modelOp) bool { return runModel(ops) != nil })
+	var lines []string
+	for _, op := range ops {
+		lines = append(lines, "  "+op.String())
+	}
+	t.Fatalf("%v\nminimal sequence (%d operations):\n%s", runModel(ops), len(ops), strings.Join(lines, "\n"))
+}
+
+func TestBTreeModel(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			checkModel(t, genModelOps(rand.New(rand.NewSource(seed)), 400))
+		})
+	}
+}
+
+func TestSplitOversizedRecord(t *testing.T) {
+	// 很多小记录之后插入一条接近一页的记录：按 cell 个数对半分时右页放不下
+	var ops []modelOp
+	for k := 394; k < 400; k++ {
+		ops = append(ops, modelOp{kind: opInsert, key: k})
+	}
+	ops = append(ops, modelOp{kind: opInsert, key: 99, size: 3000})
+	checkModel(t, ops)
+
+	if _, err := splitPoint([][]byte{make([]byte, 3000), make([]byte, 3000), make([]byte, 3000)}, false); err == nil {
+		t.Errorf("splitPoint accepted cells that do not fit in two pages")
+	}
+}
+
+func TestShrinkModel(t *testing.T) {
+	// 只有先插入 7 再删除 7 才失败，缩小之后只剩这两个操作
+	fails := func(ops []modelOp) bool {
+		inserted := false
+		for _, op := range ops {
+			if op.key == 7 && op.kind == opInsert {
+				inserted = true
+			}
+			if op.key == 7 && op.kind == opDelete && inserted {
+				return true
+			}
+		}
+		return false
+	}
+	ops := genModelOps(rand.New(rand.NewSource(1)), 200)
+	ops = append(ops, modelOp{kind: opInsert, key: 7, size: 500}, modelOp{kind: opDelete, key: 7})
+	got := shrinkModel(ops, fails)
+	want := []modelOp{{kind: opInsert, key: 7}, {kind: opDelete, key: 7}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("shrunk to %v, want %v", got, want)
+	}
+}
+
+// FuzzBTreeModel 把输入的每 3 个字节解释为一个操作
+func FuzzBTreeModel(f *testing.F) {
+	f.Add([]byte{0, 1, 255, 0, 2, 255, 0, 3, 255, 1, 2, 0, 2, 1, 0, 3, 0, 0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var ops []modelOp
+		for i := 0; i+3 <= len(data) && len(ops) < 500; i += 3 {
+			op := modelOp{key: int(data[i+1]), size: int(data[i+2]) * 4}
+			switch data[i] % 5 {
+			case 0:
+				op.kind = opInsert
+			case 1:
+				op.kind = opDelete
+			case 2:
+				op.kind = opDeleteAll
+			case 3:
+				op.kind = opSearch
+			default:
+				op.kind = opSeek
+			}
+			ops = append(ops, op)
+		}
+		checkModel(t, ops)
+	})
+}
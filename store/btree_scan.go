@@ -0,0 +1,136 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrStopScan 由回调返回，用于提前结束遍历（不视为错误）
+var ErrStopScan = errors.New("stop scan")
+
+// ScanRows 从最左叶子开始沿 NextLeaf 链按 key 顺序遍历所有记录
+func ScanRows(pager *Pager, rootPage int, fn func(row []byte) error) error {
+	leaf, err := leftmostLeaf(pager, rootPage)
+	if err != nil {
+		return err
+	}
+	return scanLeaves(pager, leaf, fn)
+}
+
+func leftmostLeaf(pager *Pager, rootPage int) (int, error) {
+	pageNo := rootPage
+	visited := map[int]bool{}
+	for {
+		if visited[pageNo] {
+			return 0, fmt.Errorf("detected loop: page %d already visited", pageNo)
+		}
+		visited[pageNo] = true
+		raw, err := pager.ReadPage(pageNo)
+		if err != nil {
+			return 0, fmt.Errorf("read page %d: %w", pageNo, err)
+		}
+		page, err := PageFromBytes(raw)
+		if err != nil {
+			return 0, fmt.Errorf("parse page %d: %w", pageNo, err)
+		}
+		switch page.Type {
+		case PageLeaf:
+			return pageNo, nil
+		case PageInternal:
+			pageNo = int(page.LeftChild)
+		default:
+			return 0, fmt.Errorf("invalid page type: %d", page.Type)
+		}
+	}
+}
+
+func scanLeaves(pager *Pager, pageNo int, fn func(row []byte) error) error {
+	visited := map[int]bool{}
+	for pageNo != 0 {
+		if visited[pageNo] {
+			return fmt.Errorf("detected loop: page %d already visited", pageNo)
+		}
+		visited[pageNo] = true
+		raw, err := pager.ReadPage(pageNo)
+		if err != nil {
+			return fmt.Errorf("read page %d: %w", pageNo, err)
+		}
+		page, err := PageFromBytes(raw)
+		if err != nil {
+			return fmt.Errorf("parse page %d: %w", pageNo, err)
+		}
+		if page.Type != PageLeaf {
+			return fmt.Errorf("page %d in leaf chain is not a leaf", pageNo)
+		}
+		for _, cell := range page.Cells {
+			if err := fn(cell); err != nil {
+				if errors.Is(err, ErrStopScan) {
+					return nil
+				}
+				return err
+			}
+		}
+		pageNo = int(page.NextLeaf)
+	}
+	return nil
+}
+
+// SeekRows 从第一条 key >= 给定 key 的记录开始，按 key 顺序遍历之后的所有记录
+func SeekRows(pager *Pager, rootPage int, key string, fn func(row []byte) error) error {
+	leaf, err := seekLeaf(pager, rootPage, key)
+	if err != nil {
+		return err
+	}
+	started := false
+	return scanLeaves(pager, leaf, func(row []byte) error {
+		if !started {
+			cellKey, err := ExtractKey(row)
+			if err != nil {
+				return err
+			}
+			if cellKey < key {
+				return nil
+			}
+			started = true
+		}
+		return fn(row)
+	})
+}
+
+// seekLeaf 找到可能包含 key 的第一个叶子。
+// 与插入不同，遇到等于 key 的分隔键时走左子树，这样重复的 key 不会被跳过。
+func seekLeaf(pager *Pager, rootPage int, key string) (int, error) {
+	pageNo := rootPage
+	for depth := 0; ; depth++ {
+		if depth > 64 {
+			return 0, fmt.Errorf("tree too deep, possible loop at page %d", pageNo)
+		}
+		raw, err := pager.ReadPage(pageNo)
+		if err != nil {
+			return 0, fmt.Errorf("read page %d: %w", pageNo, err)
+		}
+		page, err := PageFromBytes(raw)
+		if err != nil {
+			return 0, fmt.Errorf("parse page %d: %w", pageNo, err)
+		}
+		switch page.Type {
+		case PageLeaf:
+			return pageNo, nil
+		case PageInternal:
+			child := int(page.LeftChild)
+			for _, cell := range page.Cells {
+				k, c, err := DecodeInternalCell(cell)
+				if err != nil {
+					return 0, err
+				}
+				if key <= k {
+					break
+				}
+				child = int(c)
+			}
+			pageNo = child
+		default:
+			return 0, fmt.Errorf("invalid page type: %d", page.Type)
+		}
+	}
+}
@@ -2,49 +2,28 @@ package store
 
 import "fmt"
 
+// SearchRow 返回 key 对应的第一条记录（重复的 key 按插入的先后）。
+// 重复的 key 可能跨过叶子的边界，从可能包含 key 的第一个叶子开始沿叶子链查找
 func SearchRow(pager *Pager, rootPage int, key string) ([]byte, error) {
 	if rootPage <= 0 {
 		return nil, fmt.Errorf("invalid rootPage: %d", rootPage)
 	}
-
-	raw, err := pager.ReadPage(rootPage)
-	if err != nil {
-		return nil, fmt.Errorf("read rootPage %d: %w", rootPage, err)
-	}
-	page, err := PageFromBytes(raw)
+	var found []byte
+	err := SeekRows(pager, rootPage, key, func(rec []byte) error {
+		cellKey, err := ExtractKey(rec)
+		if err != nil {
+			return err
+		}
+		if cellKey == key {
+			found = rec
+		}
+		return ErrStopScan
+	})
 	if err != nil {
-		return nil, fmt.Errorf("parse rootPage: %w", err)
+		return nil, err
 	}
-
-	switch page.Type {
-	case PageLeaf:
-		for _, cell := range page.Cells {
-			cellKey, err := ExtractKey(cell)
-			if err != nil {
-				continue
-			}
-			if cellKey == key {
-				return cell, nil
-			}
-		}
+	if found == nil {
 		return nil, fmt.Errorf("key %s not found", key)
-
-	case PageInternal:
-		// binary search 内节点
-		childPage := int(page.LeftChild)
-		for _, cell := range page.Cells {
-			k, child, err := DecodeInternalCell(cell)
-			if err != nil {
-				continue
-			}
-			if key < k {
-				break
-			}
-			childPage = int(child)
-		}
-		return SearchRow(pager, childPage, key)
-
-	default:
-		return nil, fmt.Errorf("invalid page type: %d", page.Type)
 	}
+	return found, nil
 }
@@ -0,0 +1,220 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+/*
+页校验和，新建文件时用 Options.Checksums 选择，之后不能改变：
+
+文件中每一页后面跟 4 字节的 CRC32C（Castagnoli），每页占 PageSize+4 字节，
+上层看到的页仍然是 PageSize 字节。每次从文件读页都检查校验和，不一致时返回
+*CorruptError，errors.Is(err, ErrCorrupt) 为真。加密的文件（见 crypt.go）由认证标签
+发现损坏，不另加校验和。
+
+  - 回滚日志模式下文件头（见 freelist.go）第 24 字节的 bit 0 表示启用；
+  - 影子分页模式下 meta 页第 22 字节的 bit 0 表示启用（见 shadow.go），
+    meta 页有自己的 CRC，读 meta 页时不检查页尾的校验和。
+
+修改计数在提交之后单独写入（见 lock.go），物理页 1 的校验和不包括这 4 字节，
+否则写计数时断电就会让页 1 校验失败。内容和校验和全是 0 的页只有在回滚日志模式下、
+超出已提交页数时才是分配之后还没有写过的页；已提交的页都带着校验和写过，全是 0 说明损坏。
+*/
+
+var ErrCorrupt = errors.New("database disk image is malformed")
+
+// CorruptError 是某一页的内容损坏，errors.Is(err, ErrCorrupt) 为真
+type CorruptError struct {
+	Page   int
+	Reason string
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("page %d is corrupt: %s", e.Page, e.Reason)
+}
+
+func (e *CorruptError) Unwrap() error {
+	return ErrCorrupt
+}
+
+const (
+	checksumSize    = 4
+	flagChecksums   = 1 << 0
+	fileFlagsOffset = fileHeaderOffset + 24
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Checksums 返回文件是否启用了页校验和
+func (p *Pager) Checksums() bool {
+	return p.checksums
+}
+
+// fileFlags 返回写在文件头（或 meta 页）中的标志
+func (f *pagerFile) fileFlags() byte {
+	var flags byte
+	if f.checksums {
+		flags |= flagChecksums
+	}
+	if f.cipher != nil {
+		flags |= flagEncrypted
+	}
+	if f.compress != nil {
+		flags |= flagCompressed
+	}
+	return flags
+}
+
+// pageStride 返回文件中每页占的字节数：页内容后面是校验和，或者加密的认证标签和 nonce
+func (f *pagerFile) pageStride() int64 {
+	return flagsStride(f.fileFlags())
+}
+
+func flagsStride(flags byte) int64 {
+	switch {
+	case flags&flagCompressed != 0:
+		// 压缩的文件中只有 meta 页按页排列，见 compress.go
+		return PageSize
+	case flags&flagEncrypted != 0:
+		return PageSize + cryptReserve
+	case flags&flagChecksums != 0:
+		return PageSize + checksumSize
+	}
+	return PageSize
+}
+
+func (f *pagerFile) pageOffset(pageNum int) int64 {
+	return int64(pageNum-1) * f.pageStride()
+}
+
+// pagesIn 返回 size 字节的文件有多少页，残页也算一页
+func (f *pagerFile) pagesIn(size int64) int {
+	stride := f.pageStride()
+	return int((size + stride - 1) / stride)
+}
+
+func pageChecksum(pageNum int, data []byte) uint32 {
+	if pageNum != 1 {
+		return crc32.Checksum(data, castagnoli)
+	}
+	sum := crc32.Update(0, castagnoli, data[:changeCounterOffset])
+	return crc32.Update(sum, castagnoli, data[changeCounterOffset+4:])
+}
+
+// readRaw 从文件读第 pageNum 页（影子分页模式下是物理页），启用校验和时检查，加密时解密
+func (f *pagerFile) readRaw(pageNum int) ([]byte, error) {
+	buf := make([]byte, f.pageStride())
+	if _, err := f.file.ReadAt(buf, f.pageOffset(pageNum)); err != nil {
+		return nil, err
+	}
+	if f.cipher != nil {
+		return f.unseal(pageNum, buf)
+	}
+	data := buf[:PageSize:PageSize]
+	if f.checksums {
+		sum := binary.LittleEndian.Uint32(buf[PageSize:])
+		unwritten := sum == 0 && f.shadow == nil && pageNum > f.committedPages() && isZeroPage(data)
+		if sum != pageChecksum(pageNum, data) && !unwritten {
+			return nil, &CorruptError{Page: pageNum, Reason: "checksum mismatch"}
+		}
+	}
+	return data, nil
+}
+
+// writeRaw 把一页写到文件中，启用校验和时在后面写上校验和，加密时写密文
+func (f *pagerFile) writeRaw(pageNum int, data []byte) error {
+	if f.cipher != nil {
+		data = f.seal(pageNum, data)
+	} else if f.checksums {
+		buf := make([]byte, PageSize+checksumSize)
+		copy(buf, data)
+		binary.LittleEndian.PutUint32(buf[PageSize:], pageChecksum(pageNum, data))
+		data = buf
+	}
+	_, err := f.file.WriteAt(data, f.pageOffset(pageNum))
+	return err
+}
+
+// readStored 读出文件中原样的一页（包括页尾的校验和或认证标签），文件末尾之后的部分是 0
+func (f *pagerFile) readStored(pageNum int) ([]byte, error) {
+	buf := make([]byte, f.pageStride())
+	if _, err := f.file.ReadAt(buf, f.pageOffset(pageNum)); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func isZeroPage(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// openFormat 读出文件是否启用了页校验和、是否加密，新建的文件按 opts 决定
+func (p *Pager) openFormat(opts Options) error {
+	size, err := p.file.Size()
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		if opts.Compress {
+			if !opts.Shadow {
+				return fmt.Errorf("page compression requires shadow paging")
+			}
+			p.compress = &compressState{}
+		}
+		if !opts.encrypted() {
+			p.checksums = opts.Checksums
+			return nil
+		}
+		// 认证标签已经能发现损坏，加密的文件不另加校验和
+		p.cipher, err = createCipher(opts)
+		return err
+	}
+	shadow, err := isShadowFile(p.file)
+	if err != nil {
+		return err
+	}
+	var flags byte
+	var params []byte
+	if shadow {
+		flags, params, err = shadowFlags(p.file)
+	} else {
+		flags, params, err = headerFlags(p.file)
+	}
+	if err != nil {
+		return err
+	}
+	p.checksums = flags&flagChecksums != 0
+	if opts.Checksums && !p.checksums && flags&flagEncrypted == 0 {
+		return fmt.Errorf("%s does not use page checksums", p.filename)
+	}
+	if flags&flagCompressed != 0 {
+		p.compress = &compressState{}
+	} else if opts.Compress {
+		return fmt.Errorf("%s does not use page compression", p.filename)
+	}
+	return p.openCipher(flags, params, opts)
+}
+
+// headerFlags 读回滚日志模式文件头中的标志和加密参数，文件头在页 1 中不加密
+func headerFlags(file File) (byte, []byte, error) {
+	h := make([]byte, FileHeaderSize)
+	if _, err := file.ReadAt(h, fileHeaderOffset); err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, nil, nil
+		}
+		return 0, nil, err
+	}
+	if string(h[:8]) != fileHeaderMagic {
+		return 0, nil, nil
+	}
+	return h[fileFlagsOffset-fileHeaderOffset], h[cryptParamsOffset-fileHeaderOffset:], nil
+}
@@ -0,0 +1,323 @@
+package store
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+页压缩，新建文件时用 Options.Compress 选择，之后不能改变。压缩之后每页的大小不同，
+要靠影子分页的页表（见 shadow.go）找到它们，所以只能与影子分页一起使用。
+
+压缩的文件中两个 meta 页各占 PageSize 字节，之后的空间按 512 字节的块分配。
+每个逻辑页和页表页写成一段连续的块（extent），页表和 meta 页中记录的物理位置是
+起始块号 << 4 | (块数 - 1)，一段最多 16 块。一段的内容：
+
+| 字节位置  | 内容                                              |
+| --------- | ------------------------------------------------- |
+| 0-1       | 之后内容的长度 n                                  |
+| 2..2+n    | 压缩方法(1) + 数据，加密时是它的密文、认证标签和 nonce |
+| 2+n..6+n  | 启用页校验和时，前面内容的 CRC32C                 |
+
+压缩方法 1 是 DEFLATE，压缩之后不比原来小的页用方法 0 原样保存。加密时附加数据是物理位置。
+块的分配状态只记在内存中，打开文件时根据页表重新计算。
+
+读页时解压到一个小的缓存中，缓存按物理位置索引：已提交的物理位置不会改写，
+新的内容总是写到新分配的位置，同时更新缓存；文件被其他连接修改之后清空缓存。
+压缩和解压的字节数、耗时见 CompressionStats。
+*/
+
+const (
+	flagCompressed = 1 << 2
+
+	blockSize       = 512
+	extentMaxBlocks = 16
+	extentMaxBlock  = 1 << 28
+	metaBlocks      = shadowMetaPages * PageSize / blockSize
+
+	methodStored  = 0
+	methodDeflate = 1
+
+	pageCacheSize = 256
+)
+
+// CompressionStats 是打开文件以来压缩和解压的统计
+type CompressionStats struct {
+	PagesWritten   int64 // 写入的页数
+	BytesIn        int64 // 压缩之前的字节数
+	BytesOut       int64 // 压缩之后的字节数
+	CompressTime   time.Duration
+	PagesRead      int64 // 从文件读出并解压的页数，不包括缓存命中
+	DecompressTime time.Duration
+	CacheHits      int64
+}
+
+// Ratio 返回压缩比（压缩之前 / 压缩之后），还没有写过页时为 0
+func (s CompressionStats) Ratio() float64 {
+	if s.BytesOut == 0 {
+		return 0
+	}
+	return float64(s.BytesIn) / float64(s.BytesOut)
+}
+
+type compressState struct {
+	written, bytesIn, bytesOut, compressNs atomic.Int64
+	read, decompressNs, hits               atomic.Int64
+
+	mu    sync.Mutex
+	cache map[uint32][]byte
+}
+
+var deflaters = sync.Pool{New: func() any {
+	w, _ := flate.NewWriter(nil, flate.BestSpeed)
+	return w
+}}
+
+// Compressed 返回文件是否使用页压缩
+func (p *Pager) Compressed() bool {
+	return p.compress != nil
+}
+
+// CompressionStats 返回打开文件以来的压缩统计，没有压缩的文件返回零值
+func (p *Pager) CompressionStats() CompressionStats {
+	c := p.compress
+	if c == nil {
+		return CompressionStats{}
+	}
+	return CompressionStats{
+		PagesWritten:   c.written.Load(),
+		BytesIn:        c.bytesIn.Load(),
+		BytesOut:       c.bytesOut.Load(),
+		CompressTime:   time.Duration(c.compressNs.Load()),
+		PagesRead:      c.read.Load(),
+		DecompressTime: time.Duration(c.decompressNs.Load()),
+		CacheHits:      c.hits.Load(),
+	}
+}
+
+func extentAddr(block, blocks int) uint32 {
+	return uint32(block)<<4 | uint32(blocks-1)
+}
+
+func extentBlocks(addr uint32) (block, blocks int) {
+	return int(addr >> 4), int(addr&0xf) + 1
+}
+
+// compressPage 返回压缩方法和压缩之后的数据
+func (c *compressState) compressPage(data []byte) []byte {
+	start := time.Now()
+	var buf bytes.Buffer
+	buf.WriteByte(methodDeflate)
+	w := deflaters.Get().(*flate.Writer)
+	w.Reset(&buf)
+	w.Write(data)
+	w.Close()
+	deflaters.Put(w)
+	inner := buf.Bytes()
+	if len(inner) > len(data) {
+		inner = append([]byte{methodStored}, data...)
+	}
+	c.compressNs.Add(int64(time.Since(start)))
+	c.written.Add(1)
+	c.bytesIn.Add(int64(len(data)))
+	c.bytesOut.Add(int64(len(inner)))
+	return inner
+}
+
+func (c *compressState) decompressPage(inner []byte) ([]byte, error) {
+	start := time.Now()
+	defer func() { c.decompressNs.Add(int64(time.Since(start))) }()
+	c.read.Add(1)
+	switch {
+	case len(inner) == 1+PageSize && inner[0] == methodStored:
+		return inner[1:], nil
+	case len(inner) > 0 && inner[0] == methodDeflate:
+		page := make([]byte, PageSize)
+		r := flate.NewReader(bytes.NewReader(inner[1:]))
+		defer r.Close()
+		if _, err := io.ReadFull(r, page); err != nil {
+			return nil, fmt.Errorf("inflate: %v", err)
+		}
+		// 解压之后正好是一页
+		if n, _ := r.Read(make([]byte, 1)); n != 0 {
+			return nil, fmt.Errorf("inflate: data after the end of the page")
+		}
+		return page, nil
+	}
+	return nil, fmt.Errorf("unknown compression method")
+}
+
+func (c *compressState) cached(addr uint32) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.cache[addr]
+	if !ok {
+		return nil, false
+	}
+	c.hits.Add(1)
+	return append([]byte(nil), data...), true
+}
+
+func (c *compressState) remember(addr uint32, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cache == nil {
+		c.cache = map[uint32][]byte{}
+	}
+	if _, ok := c.cache[addr]; !ok && len(c.cache) >= pageCacheSize {
+		// 缓存满时随便丢掉一页
+		for old := range c.cache {
+			delete(c.cache, old)
+			break
+		}
+	}
+	c.cache[addr] = append([]byte(nil), data...)
+}
+
+func (c *compressState) clearCache() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache = nil
+}
+
+// writeExtent 压缩一页，写到新分配的一段块中，返回它的物理位置
+func (f *pagerFile) writeExtent(data []byte) (uint32, error) {
+	inner := f.compress.compressPage(data)
+	n := len(inner)
+	if f.cipher != nil {
+		n += cryptReserve
+	}
+	size := 2 + n
+	if f.checksums {
+		size += checksumSize
+	}
+	addr, err := f.shadow.allocExtent(size)
+	if err != nil {
+		return 0, err
+	}
+	_, blocks := extentBlocks(addr)
+	buf := make([]byte, blocks*blockSize)
+	binary.LittleEndian.PutUint16(buf, uint16(n))
+	if f.cipher != nil {
+		copy(buf[2:], f.cipher.sealData(addr, inner))
+	} else {
+		copy(buf[2:], inner)
+	}
+	if f.checksums {
+		binary.LittleEndian.PutUint32(buf[2+n:], crc32.Checksum(buf[:2+n], castagnoli))
+	}
+	block, _ := extentBlocks(addr)
+	if _, err := f.file.WriteAt(buf, int64(block)*blockSize); err != nil {
+		f.shadow.release(addr)
+		return 0, err
+	}
+	f.compress.remember(addr, data)
+	return addr, nil
+}
+
+// readExtent 读出一段块并解压
+func (f *pagerFile) readExtent(addr uint32) ([]byte, error) {
+	if data, ok := f.compress.cached(addr); ok {
+		return data, nil
+	}
+	block, blocks := extentBlocks(addr)
+	buf := make([]byte, blocks*blockSize)
+	if _, err := f.file.ReadAt(buf, int64(block)*blockSize); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, &CorruptError{Page: int(addr), Reason: "extent beyond the end of the file"}
+		}
+		return nil, err
+	}
+	n := int(binary.LittleEndian.Uint16(buf))
+	end := 2 + n
+	if f.checksums {
+		end += checksumSize
+	}
+	if n == 0 || end > len(buf) {
+		return nil, &CorruptError{Page: int(addr), Reason: fmt.Sprintf("invalid extent length %d", n)}
+	}
+	if f.checksums && crc32.Checksum(buf[:2+n], castagnoli) != binary.LittleEndian.Uint32(buf[2+n:]) {
+		return nil, &CorruptError{Page: int(addr), Reason: "checksum mismatch"}
+	}
+	inner := buf[2 : 2+n]
+	if f.cipher != nil {
+		var err error
+		if inner, err = f.cipher.openData(addr, inner); err != nil {
+			return nil, &CorruptError{Page: int(addr), Reason: "authentication failed"}
+		}
+	}
+	data, err := f.compress.decompressPage(inner)
+	if err != nil {
+		return nil, &CorruptError{Page: int(addr), Reason: err.Error()}
+	}
+	f.compress.remember(addr, data)
+	return data, nil
+}
+
+// allocExtent 分配能放下 size 字节的一段连续的块：从上次分配的位置向后找第一段足够长的空闲块，
+// 找不到时从头再找一遍，还是没有就接在文件末尾
+func (s *shadowState) allocExtent(size int) (uint32, error) {
+	need := (size + blockSize - 1) / blockSize
+	if need > extentMaxBlocks {
+		return 0, fmt.Errorf("extent of %d bytes is too large", size)
+	}
+	start := -1
+	for _, r := range [][2]int{{s.cursor, len(s.blocks)}, {metaBlocks, s.cursor}} {
+		run := 0
+		for i := r[0]; i < r[1] && start < 0; i++ {
+			if s.blocks[i] {
+				run = 0
+				continue
+			}
+			if run++; run == need {
+				start = i - need + 1
+			}
+		}
+		if start >= 0 {
+			break
+		}
+	}
+	if start < 0 {
+		// 文件末尾的空闲块接上新的块
+		start = len(s.blocks)
+		for start > metaBlocks && !s.blocks[start-1] {
+			start--
+		}
+	}
+	if start+need > extentMaxBlock {
+		return 0, fmt.Errorf("database too large for page compression")
+	}
+	for len(s.blocks) < start+need {
+		s.blocks = append(s.blocks, false)
+	}
+	for i := start; i < start+need; i++ {
+		s.blocks[i] = true
+	}
+	s.cursor = start + need
+	return extentAddr(start, need), nil
+}
+
+// claimExtent 在打开文件时标记已提交版本用到的一段块，超出文件或者与已用的块重叠时返回 false
+func (s *shadowState) claimExtent(addr uint32) bool {
+	block, blocks := extentBlocks(addr)
+	if block < metaBlocks || block+blocks > len(s.blocks) {
+		return false
+	}
+	for i := block; i < block+blocks; i++ {
+		if s.blocks[i] {
+			return false
+		}
+	}
+	for i := block; i < block+blocks; i++ {
+		s.blocks[i] = true
+	}
+	return true
+}
@@ -0,0 +1,272 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+/*
+页加密，新建文件时用 Options.Passphrase 或 Options.Key 选择，之后不能改变：
+
+每页用 AES-GCM 加密，页后面跟 16 字节的认证标签和 12 字节的随机 nonce，
+每页占 PageSize+28 字节，上层看到的仍然是明文页。附加数据是页号（影子分页模式下
+是物理页号），把一页的内容复制到另一页也会认证失败。认证标签同时起校验和的作用，
+加密的文件不再另加页校验和，认证失败时返回 *CorruptError。
+全是 0 的页只有在回滚日志模式下、超出已提交页数时才当作分配之后还没有写过的页；
+已提交的页都写过密文，全是 0 说明被改过，与其他页一样认证失败。
+
+回滚日志模式下页 1 末尾的文件头不加密：锁（见 lock.go）直接读写其中的修改计数，
+打开文件时也要先读出加密参数。文件头除修改计数之外的部分作为附加数据参与认证。
+影子分页模式下 meta 页不加密，加密参数跟在页表页号后面（见 shadow.go）。
+回滚日志保存的是文件中原样的页（见 journal.go），同样是加密的。
+
+文件头第 24 字节的 bit 1（影子分页模式下 meta 页的标志）表示加密，加密参数在文件头第 25 字节开始：
+
+| 字节位置 | 内容                                                       |
+| -------- | ---------------------------------------------------------- |
+| 0        | 密钥来源：0 由应用提供，1 由口令经 PBKDF2-HMAC-SHA256 导出 |
+| 1-4      | PBKDF2 迭代次数                                            |
+| 5-20     | PBKDF2 的盐                                                |
+| 21-28    | 密钥校验值：HMAC-SHA256(密钥, "mydb key check") 的前 8 字节 |
+
+打开时先比较密钥校验值，密钥不对返回 ErrWrongKey，而不是读出一堆解密失败的页。
+*/
+
+const (
+	flagEncrypted     = 1 << 1
+	cryptParamsOffset = fileFlagsOffset + 1
+	cryptParamsSize   = 29
+	tagSize           = 16
+	nonceSize         = 12
+	cryptReserve      = tagSize + nonceSize
+)
+
+const (
+	kdfRawKey = 0
+	kdfPBKDF2 = 1
+
+	// DefaultKDFIterations 是新建数据库时 PBKDF2 的默认迭代次数
+	DefaultKDFIterations = 200000
+)
+
+var (
+	ErrKeyRequired = errors.New("database is encrypted, a passphrase or key is required")
+	ErrWrongKey    = errors.New("wrong passphrase or encryption key")
+)
+
+type cryptParams struct {
+	kdf        byte
+	iterations uint32
+	salt       [16]byte
+	check      [8]byte
+}
+
+func (c *cryptParams) encode() []byte {
+	buf := make([]byte, cryptParamsSize)
+	buf[0] = c.kdf
+	binary.LittleEndian.PutUint32(buf[1:], c.iterations)
+	copy(buf[5:], c.salt[:])
+	copy(buf[21:], c.check[:])
+	return buf
+}
+
+func decodeCryptParams(buf []byte) (cryptParams, error) {
+	var c cryptParams
+	if len(buf) < cryptParamsSize {
+		return c, fmt.Errorf("%w: truncated encryption parameters", ErrCorrupt)
+	}
+	c.kdf = buf[0]
+	c.iterations = binary.LittleEndian.Uint32(buf[1:])
+	copy(c.salt[:], buf[5:])
+	copy(c.check[:], buf[21:])
+	if c.kdf > kdfPBKDF2 || c.kdf == kdfPBKDF2 && c.iterations == 0 {
+		return c, fmt.Errorf("%w: unknown key derivation %d", ErrCorrupt, c.kdf)
+	}
+	return c, nil
+}
+
+// deriveKey 按加密参数从 opts 得到密钥，应用提供的密钥直接使用
+func (c *cryptParams) deriveKey(opts Options) ([]byte, error) {
+	if opts.Key != nil {
+		return opts.Key, nil
+	}
+	if c.kdf != kdfPBKDF2 {
+		return nil, fmt.Errorf("database was encrypted with a key supplied by the application, not a passphrase")
+	}
+	return pbkdf2.Key(sha256.New, opts.Passphrase, c.salt[:], int(c.iterations), 32)
+}
+
+func keyCheck(key []byte) [8]byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("mydb key check"))
+	var check [8]byte
+	copy(check[:], mac.Sum(nil))
+	return check
+}
+
+// pageCipher 加密和解密页。key 和 params 也用来以同样的格式新建数据库，见 FormatOptions
+type pageCipher struct {
+	aead   cipher.AEAD
+	key    []byte
+	params cryptParams
+}
+
+func newPageCipher(key []byte, params cryptParams) (*pageCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key must be 16, 24 or 32 bytes: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &pageCipher{aead: aead, key: key, params: params}, nil
+}
+
+// createCipher 为新建的文件生成加密参数：口令用随机的盐导出密钥
+func createCipher(opts Options) (*pageCipher, error) {
+	if opts.cipher != nil {
+		return opts.cipher, nil
+	}
+	params := cryptParams{kdf: kdfRawKey}
+	if opts.Key == nil {
+		params.kdf = kdfPBKDF2
+		params.iterations = DefaultKDFIterations
+		if opts.KDFIterations > 0 {
+			params.iterations = uint32(opts.KDFIterations)
+		}
+		rand.Read(params.salt[:])
+	}
+	key, err := params.deriveKey(opts)
+	if err != nil {
+		return nil, err
+	}
+	params.check = keyCheck(key)
+	return newPageCipher(key, params)
+}
+
+// openCipher 按文件中的标志和加密参数检查 opts 中的口令或密钥
+func (p *Pager) openCipher(flags byte, params []byte, opts Options) error {
+	encrypted := flags&flagEncrypted != 0
+	switch {
+	case !encrypted && opts.encrypted():
+		return fmt.Errorf("%s is not encrypted", p.filename)
+	case !encrypted:
+		return nil
+	case !opts.encrypted():
+		return fmt.Errorf("%s: %w", p.filename, ErrKeyRequired)
+	}
+	if opts.cipher != nil {
+		opts.Key = opts.cipher.key
+	}
+	c, err := decodeCryptParams(params)
+	if err != nil {
+		return err
+	}
+	key, err := c.deriveKey(opts)
+	if err != nil {
+		return err
+	}
+	if check := keyCheck(key); !hmac.Equal(check[:], c.check[:]) {
+		return fmt.Errorf("%s: %w", p.filename, ErrWrongKey)
+	}
+	p.cipher, err = newPageCipher(key, c)
+	return err
+}
+
+// encrypted 返回 opts 是否要求加密
+func (o Options) encrypted() bool {
+	return o.Passphrase != "" || o.Key != nil || o.cipher != nil
+}
+
+// Encrypted 返回文件是否加密
+func (p *Pager) Encrypted() bool {
+	return p.cipher != nil
+}
+
+// FormatOptions 返回在同一个 VFS 中以相同格式新建数据库的选项：影子分页、页校验和、压缩，
+// 加密的数据库用相同的密钥和加密参数，原来的口令也能打开新文件
+func (p *Pager) FormatOptions() Options {
+	return Options{Shadow: p.shadow != nil, Checksums: p.checksums, Compress: p.compress != nil, VFS: p.vfs, cipher: p.cipher}
+}
+
+// cryptHeader 返回写在文件头或 meta 页中的加密参数，没有加密时为 nil
+func (f *pagerFile) cryptHeader() []byte {
+	if f.cipher == nil {
+		return nil
+	}
+	return f.cipher.params.encode()
+}
+
+// pageAAD 是一页的附加数据：页号，页 1 还有不加密的文件头（修改计数除外）
+func pageAAD(pageNum int, header []byte) []byte {
+	aad := make([]byte, 4, 4+len(header))
+	binary.LittleEndian.PutUint32(aad, uint32(pageNum))
+	aad = append(aad, header...)
+	if len(header) > 0 {
+		clear(aad[4+changeCounterOffset-fileHeaderOffset:][:4])
+	}
+	return aad
+}
+
+// sealedSize 返回一页中加密的字节数，回滚日志模式下页 1 末尾的文件头不加密
+func sealedSize(pageNum int) int {
+	if pageNum == 1 {
+		// 影子分页模式下物理页 1 是 meta 页，不经过这里
+		return fileHeaderOffset
+	}
+	return PageSize
+}
+
+// seal 加密一页，返回文件中的 PageSize+28 字节
+func (f *pagerFile) seal(pageNum int, data []byte) []byte {
+	n := sealedSize(pageNum)
+	buf := make([]byte, PageSize+cryptReserve)
+	nonce := buf[PageSize+tagSize:]
+	rand.Read(nonce)
+	sealed := f.cipher.aead.Seal(nil, nonce, data[:n], pageAAD(pageNum, data[n:PageSize]))
+	copy(buf, sealed[:n])
+	copy(buf[n:], data[n:PageSize])
+	copy(buf[PageSize:], sealed[n:])
+	return buf
+}
+
+// unseal 解密从文件读出的一页并检查认证标签
+func (f *pagerFile) unseal(pageNum int, buf []byte) ([]byte, error) {
+	if isZeroPage(buf) && f.shadow == nil && pageNum > f.committedPages() {
+		// 本事务中分配、还没有写过的页
+		return make([]byte, PageSize), nil
+	}
+	n := sealedSize(pageNum)
+	sealed := make([]byte, 0, PageSize+tagSize)
+	sealed = append(append(sealed, buf[:n]...), buf[PageSize:PageSize+tagSize]...)
+	header := buf[n:PageSize]
+	data, err := f.cipher.aead.Open(sealed[:0], buf[PageSize+tagSize:], sealed, pageAAD(pageNum, header))
+	if err != nil {
+		return nil, &CorruptError{Page: pageNum, Reason: "authentication failed"}
+	}
+	return append(data, header...)[:PageSize:PageSize], nil
+}
+
+// sealData 加密任意长度的数据，返回密文、认证标签和 nonce，压缩的页用它加密（见 compress.go）
+func (c *pageCipher) sealData(addr uint32, data []byte) []byte {
+	var nonce [nonceSize]byte
+	rand.Read(nonce[:])
+	sealed := c.aead.Seal(nil, nonce[:], data, pageAAD(int(addr), nil))
+	return append(sealed, nonce[:]...)
+}
+
+func (c *pageCipher) openData(addr uint32, buf []byte) ([]byte, error) {
+	if len(buf) < cryptReserve {
+		return nil, fmt.Errorf("sealed data too short")
+	}
+	sealed, nonce := buf[:len(buf)-nonceSize], buf[len(buf)-nonceSize:]
+	return c.aead.Open(nil, nonce, sealed, pageAAD(int(addr), nil))
+}
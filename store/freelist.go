@@ -0,0 +1,187 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+/*
+页 1 末尾保留 64 字节作为文件头，页 1 中的元数据记录不能写到这里：
+
+| 字节位置 | 内容                   |
+| ---- | -------------------- |
+| 0-7  | 魔数 "mydb\x00fh1"     |
+| 8-11 | 空闲链表第一页页号（0 表示没有）   |
+| 12-15 | 空闲页数量               |
+| 16-19 | 元数据 B+ 树的根页号（0 表示旧格式，元数据是页 1 中的记录） |
+| 20-23 | 修改计数，每次释放写锁时加一，见 lock.go |
+| 24   | 标志，见 checksum.go 和 crypt.go |
+| 25-53 | 加密参数，见 crypt.go |
+| 54+  | 保留                   |
+
+旧文件这里全是 0，读出来就是空的空闲链表，第一次修改时补写魔数。
+*/
+
+const (
+	FileHeaderSize   = 64
+	fileHeaderOffset = PageSize - FileHeaderSize
+	fileHeaderMagic  = "mydb\x00fh1"
+)
+
+/*
+空闲页的格式：
+
+| 字节位置 | 内容          |
+| ---- | ----------- |
+| 0    | 类型 (0x01)   |
+| 1-4  | 下一个空闲页页号    |
+*/
+
+const PageFree = 0x01
+
+// FileHeader 是页 1 末尾的文件头
+type FileHeader struct {
+	FreeHead    uint32
+	FreeCount   uint32
+	CatalogRoot uint32
+}
+
+func (p *Pager) ReadFileHeader() (FileHeader, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.readFileHeader()
+}
+
+func (p *Pager) readFileHeader() (FileHeader, error) {
+	page, err := p.readPage(1)
+	if err != nil {
+		return FileHeader{}, err
+	}
+	h := page[fileHeaderOffset:]
+	if string(h[:8]) != fileHeaderMagic {
+		return FileHeader{}, nil
+	}
+	return FileHeader{
+		FreeHead:    binary.LittleEndian.Uint32(h[8:]),
+		FreeCount:   binary.LittleEndian.Uint32(h[12:]),
+		CatalogRoot: binary.LittleEndian.Uint32(h[16:]),
+	}, nil
+}
+
+func (p *Pager) writeFileHeader(fh FileHeader) error {
+	page, err := p.readPage(1)
+	if err != nil {
+		return err
+	}
+	h := page[fileHeaderOffset:]
+	copy(h, fileHeaderMagic)
+	binary.LittleEndian.PutUint32(h[8:], fh.FreeHead)
+	binary.LittleEndian.PutUint32(h[12:], fh.FreeCount)
+	binary.LittleEndian.PutUint32(h[16:], fh.CatalogRoot)
+	return p.writePage(1, page)
+}
+
+// SetCatalogRoot 在文件头中记录元数据 B+ 树的根页
+func (p *Pager) SetCatalogRoot(root int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fh, err := p.readFileHeader()
+	if err != nil {
+		return err
+	}
+	fh.CatalogRoot = uint32(root)
+	return p.writeFileHeader(fh)
+}
+
+// usableSize 返回页中可以存放记录的字节数，页 1 要扣掉文件头
+func usableSize(pageNum int) int {
+	if pageNum == 1 {
+		return fileHeaderOffset
+	}
+	return PageSize
+}
+
+// FreePage 把一页放到空闲链表头部，之后 AllocatePage 会优先复用
+func (p *Pager) FreePage(pageNum int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pageNum <= 1 || pageNum >= p.nextPage {
+		return fmt.Errorf("cannot free page %d", pageNum)
+	}
+	fh, err := p.readFileHeader()
+	if err != nil {
+		return err
+	}
+	page := make([]byte, PageSize)
+	page[0] = PageFree
+	binary.LittleEndian.PutUint32(page[1:], fh.FreeHead)
+	if err := p.writePage(pageNum, page); err != nil {
+		return err
+	}
+	fh.FreeHead = uint32(pageNum)
+	fh.FreeCount++
+	return p.writeFileHeader(fh)
+}
+
+// popFreePage 从空闲链表取出一页，链表为空时返回 0
+func (p *Pager) popFreePage() (int, error) {
+	fh, err := p.readFileHeader()
+	if err != nil || fh.FreeHead == 0 {
+		return 0, err
+	}
+	pageNum := int(fh.FreeHead)
+	if pageNum >= p.nextPage {
+		return 0, fmt.Errorf("freelist page %d is outside the file", pageNum)
+	}
+	page, err := p.readPage(pageNum)
+	if err != nil {
+		return 0, err
+	}
+	if page[0] != PageFree {
+		return 0, fmt.Errorf("page %d on freelist is not a free page", pageNum)
+	}
+	fh.FreeHead = binary.LittleEndian.Uint32(page[1:])
+	fh.FreeCount--
+	if err := p.writeFileHeader(fh); err != nil {
+		return 0, err
+	}
+	return pageNum, nil
+}
+
+// FreePages 返回空闲链表中的所有页号
+func (p *Pager) FreePages() ([]int, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	fh, err := p.readFileHeader()
+	if err != nil {
+		return nil, err
+	}
+	var pages []int
+	seen := map[int]bool{}
+	for next := int(fh.FreeHead); next != 0; {
+		if seen[next] {
+			return nil, fmt.Errorf("detected loop in freelist at page %d", next)
+		}
+		seen[next] = true
+		page, err := p.readPage(next)
+		if err != nil {
+			return nil, fmt.Errorf("read free page %d: %w", next, err)
+		}
+		if page[0] != PageFree {
+			return nil, fmt.Errorf("page %d on freelist is not a free page", next)
+		}
+		pages = append(pages, next)
+		next = int(binary.LittleEndian.Uint32(page[1:]))
+	}
+	return pages, nil
+}
+
+// PageCount 返回文件中已经分配出去的页数
+func (p *Pager) PageCount() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.snap != nil {
+		return p.snap.pages
+	}
+	return p.nextPage - 1
+}
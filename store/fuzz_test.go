@@ -0,0 +1,146 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// 解码器的模糊测试：任意输入都不能 panic，也不能按输入中的长度分配过多内存；
+// 解码成功的输入重新编码后应该得到相同的内容。
+//
+//	go test ./store -fuzz FuzzDecodeRow
+
+func FuzzDecodeRow(f *testing.F) {
+	for _, row := range [][]string{{}, {"key"}, {"id", "", "名字"}} {
+		rec, _ := EncodeRow(row)
+		f.Add(rec)
+	}
+	rec, _ := EncodeRowWithNulls([]string{"k", "", "v"}, []bool{false, true, false})
+	f.Add(rec)
+	f.Add([]byte{0xff, 0xff, 0xff, 0x7f, 1, 0, 0, 0})
+	f.Add([]byte{1, 0, 0, 0, 0xff, 0xff, 0xff, 0x7f})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		row, nulls, err := DecodeRowWithNulls(data)
+		if err != nil {
+			if !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("error %v does not wrap ErrCorrupt", err)
+			}
+			if checkRecord(data) == nil {
+				t.Fatalf("checkRecord accepts a record DecodeRow rejects")
+			}
+			return
+		}
+		again, _ := EncodeRowWithNulls(row, nulls)
+		if !bytes.Equal(again, data) {
+			t.Fatalf("re-encoded %x, want %x", again, data)
+		}
+	})
+}
+
+func FuzzDecodeInternalCell(f *testing.F) {
+	f.Add(EncodeInternalCell("key", 7))
+	f.Add(EncodeInternalCell("", 0))
+	f.Add([]byte("no terminator"))
+	f.Add([]byte{'k', 0, 1})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		key, child, err := DecodeInternalCell(data)
+		if err != nil {
+			if !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("error %v does not wrap ErrCorrupt", err)
+			}
+			return
+		}
+		if again := EncodeInternalCell(key, child); !bytes.Equal(again, data) {
+			t.Fatalf("re-encoded %x, want %x", again, data)
+		}
+	})
+}
+
+// fuzzPage 用 head 作为页的开头（页头和偏移表），tail 作为页的结尾（cell 内容）
+func fuzzPage(head, tail []byte) []byte {
+	data := make([]byte, PageSize)
+	copy(data, head)
+	if len(tail) > PageSize {
+		tail = tail[len(tail)-PageSize:]
+	}
+	copy(data[PageSize-len(tail):], tail)
+	return data
+}
+
+func FuzzPageFromBytes(f *testing.F) {
+	leaf := NewLeafPage()
+	for _, k := range []string{"a", "b", "c"} {
+		rec, _ := EncodeRow([]string{k, "value"})
+		leaf.Cells = append(leaf.Cells, rec)
+	}
+	internal := NewInternalPage()
+	internal.LeftChild = 2
+	internal.Cells = [][]byte{EncodeInternalCell("m", 3)}
+	for _, p := range []*Page{NewLeafPage(), leaf, internal} {
+		data := p.ToBytesMust()
+		end := pageHeaderSize + 2*len(p.Cells)
+		f.Add(data[:end], data[binary.LittleEndian.Uint16(data[3:]):])
+	}
+	f.Add([]byte{PageLeaf, 0xff, 0xff}, []byte{})
+	f.Add([]byte{PageInternal, 1, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff}, []byte{1})
+	f.Fuzz(func(t *testing.T, head, tail []byte) {
+		data := fuzzPage(head, tail)
+		page, err := PageFromBytes(data)
+		if err != nil {
+			if !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("error %v does not wrap ErrCorrupt", err)
+			}
+			return
+		}
+		// cell 连续地排在页尾，重新编码后解析出相同的 cell
+		again, err := page.ToBytes()
+		if err != nil {
+			t.Fatalf("ToBytes of a decoded page: %v", err)
+		}
+		decoded, err := PageFromBytes(again)
+		if err != nil {
+			t.Fatalf("decode re-encoded page: %v", err)
+		}
+		if !reflect.DeepEqual(decoded.Cells, page.Cells) || decoded.NextLeaf != page.NextLeaf || decoded.LeftChild != page.LeftChild {
+			t.Fatalf("re-encoded page differs")
+		}
+		for i, cell := range page.Cells {
+			if page.Type == PageLeaf {
+				DecodeRow(cell)
+			} else if _, _, err := DecodeInternalCell(cell); err != nil && !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("cell %d: %v", i, err)
+			}
+		}
+	})
+}
+
+// 页 1 中旧格式的元数据记录区，见 Pager.ReadAllRows
+func FuzzDecodeRowArea(f *testing.F) {
+	page := make([]byte, PageSize)
+	binary.LittleEndian.PutUint32(page, 2)
+	binary.LittleEndian.PutUint32(page[4:], 3)
+	copy(page[8:], "abc")
+	binary.LittleEndian.PutUint32(page[11:], 0)
+	f.Add(page[:15])
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{1, 0, 0, 0, 0xff, 0xff, 0xff, 0xff})
+	f.Fuzz(func(t *testing.T, head []byte) {
+		data := fuzzPage(head, nil)
+		rows, end, err := decodeRowArea(data, usableSize(1))
+		if err != nil {
+			if !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("error %v does not wrap ErrCorrupt", err)
+			}
+			return
+		}
+		if end > usableSize(1) {
+			t.Fatalf("row area ends at %d, beyond %d", end, usableSize(1))
+		}
+		for _, r := range rows {
+			DecodeRow(r)
+		}
+	})
+}
@@ -0,0 +1,240 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+/*
+完整性检查，逐页检查文件中的所有 B+ 树和空闲链表：
+
+  - 页的类型正确，cell 数和 cell 偏移都在页内，cell 之间不重叠；
+  - 记录和内部页 cell 能够解码；
+  - 页内的 key 有序，叶子链上前后页之间也有序；
+  - 子树中的 key 都在父页分隔 key 限定的范围内（分隔 key 等于右子树的第一个 key，
+    重复的 key 可能也出现在左边，见 seekLeaf），所有叶子深度相同；
+  - NextLeaf 链与中序遍历得到的叶子顺序相同；
+  - 没有页被引用两次（包括不同的树之间和空闲链表）；
+  - 除了页 1（文件头）之外每一页要么属于某棵树，要么在空闲链表上，空闲页数与文件头一致。
+
+发现的问题以 Problem 列表返回，校验和错误（见 checksum.go）也作为问题报告，
+只有其他读页失败时才返回 error。
+*/
+
+// Problem 是完整性检查发现的一个问题
+type Problem struct {
+	Tree string // 所在的表或索引，不属于任何树时为空
+	Page int    // 所在的页，0 表示不针对某一页
+	Msg  string
+}
+
+func (p Problem) String() string {
+	s := p.Msg
+	if p.Page != 0 {
+		s = fmt.Sprintf("page %d: %s", p.Page, s)
+	}
+	if p.Tree != "" {
+		s = fmt.Sprintf("%s: %s", p.Tree, s)
+	}
+	return s
+}
+
+// TreeRoot 是要检查的一棵树
+type TreeRoot struct {
+	Name string
+	Root int
+}
+
+const freelistOwner = "freelist"
+
+type integrityChecker struct {
+	pager    *Pager
+	pages    int
+	owner    map[int]string // 页属于哪棵树
+	problems []Problem
+}
+
+// CheckIntegrity 检查给定的树和空闲链表，以及是否有既不在树中也不空闲的页
+func CheckIntegrity(pager *Pager, trees []TreeRoot) ([]Problem, error) {
+	c := &integrityChecker{
+		pager: pager,
+		pages: pager.PageCount(),
+		owner: map[int]string{1: "file header"},
+	}
+	for _, t := range trees {
+		if err := c.checkTree(t.Name, t.Root); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.checkFreelist(); err != nil {
+		return nil, err
+	}
+	for pageNo := 2; pageNo <= c.pages; pageNo++ {
+		if _, ok := c.owner[pageNo]; !ok {
+			c.report("", pageNo, "page is neither used by a tree nor on the freelist")
+		}
+	}
+	return c.problems, nil
+}
+
+func (c *integrityChecker) report(tree string, page int, format string, args ...any) {
+	c.problems = append(c.problems, Problem{Tree: tree, Page: page, Msg: fmt.Sprintf(format, args...)})
+}
+
+// claim 记录页属于 owner，页号无效或已经被引用过时报告问题并返回 false
+func (c *integrityChecker) claim(owner string, from, pageNo int) bool {
+	if pageNo < 1 || pageNo > c.pages {
+		c.report(owner, from, "reference to page %d outside the file (%d pages)", pageNo, c.pages)
+		return false
+	}
+	if prev, ok := c.owner[pageNo]; ok {
+		c.report(owner, from, "page %d is already used by %s", pageNo, prev)
+		return false
+	}
+	c.owner[pageNo] = owner
+	return true
+}
+
+// treeWalk 是检查一棵树时的状态
+type treeWalk struct {
+	name      string
+	leaves    []int          // 中序遍历得到的叶子
+	next      map[int]uint32 // 每个叶子的 NextLeaf
+	leafDepth int
+	lastKey   string
+	hasKey    bool
+}
+
+func (c *integrityChecker) checkTree(name string, root int) error {
+	w := &treeWalk{name: name, next: map[int]uint32{}, leafDepth: -1}
+	if !c.claim(name, 0, root) {
+		return nil
+	}
+	if err := c.walk(w, root, 0, nil, nil); err != nil {
+		return err
+	}
+	for i, leaf := range w.leaves {
+		want := uint32(0)
+		if i+1 < len(w.leaves) {
+			want = uint32(w.leaves[i+1])
+		}
+		if w.next[leaf] != want {
+			c.report(name, leaf, "NextLeaf is %d, but the next leaf in key order is %d", w.next[leaf], want)
+		}
+	}
+	return nil
+}
+
+// walk 检查以 pageNo 为根的子树，其中的 key 应该在 [low, high] 内（nil 表示不限）
+func (c *integrityChecker) walk(w *treeWalk, pageNo, depth int, low, high *string) error {
+	raw, err := c.pager.ReadPage(pageNo)
+	var corrupt *CorruptError
+	if errors.As(err, &corrupt) {
+		c.report(w.name, pageNo, "%s", corrupt.Reason)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read page %d: %w", pageNo, err)
+	}
+	if msg := checkPageLayout(raw); msg != "" {
+		c.report(w.name, pageNo, "%s", msg)
+		return nil
+	}
+	page, err := PageFromBytes(raw)
+	if err != nil {
+		c.report(w.name, pageNo, "%v", err)
+		return nil
+	}
+	inRange := func(i int, key string) {
+		if low != nil && key < *low {
+			c.report(w.name, pageNo, "key %q in cell %d is less than the parent separator %q", key, i, *low)
+		}
+		if high != nil && key > *high {
+			c.report(w.name, pageNo, "key %q in cell %d is greater than the parent separator %q", key, i, *high)
+		}
+	}
+
+	if page.Type == PageLeaf {
+		if w.leafDepth < 0 {
+			w.leafDepth = depth
+		} else if depth != w.leafDepth {
+			c.report(w.name, pageNo, "leaf at depth %d, other leaves are at depth %d", depth, w.leafDepth)
+		}
+		w.leaves = append(w.leaves, pageNo)
+		w.next[pageNo] = page.NextLeaf
+		for i, cell := range page.Cells {
+			if err := checkRecord(cell); err != nil {
+				c.report(w.name, pageNo, "cell %d: %v", i, err)
+				continue
+			}
+			key, _ := ExtractKey(cell)
+			inRange(i, key)
+			if w.hasKey && key < w.lastKey {
+				c.report(w.name, pageNo, "key %q in cell %d is out of order after %q", key, i, w.lastKey)
+			}
+			w.lastKey, w.hasKey = key, true
+		}
+		return nil
+	}
+
+	// 内部页：子页 i 的 key 在分隔 key i-1 与 i 之间
+	children := []int{int(page.LeftChild)}
+	bounds := []*string{low}
+	for i, cell := range page.Cells {
+		key, child, err := DecodeInternalCell(cell)
+		if err != nil {
+			c.report(w.name, pageNo, "cell %d: %v", i, err)
+			return nil
+		}
+		inRange(i, key)
+		if prev := bounds[len(bounds)-1]; i > 0 && key < *prev {
+			c.report(w.name, pageNo, "separator %q in cell %d is out of order after %q", key, i, *prev)
+		}
+		children = append(children, int(child))
+		bounds = append(bounds, &key)
+	}
+	bounds = append(bounds, high)
+	for i, child := range children {
+		if !c.claim(w.name, pageNo, child) {
+			continue
+		}
+		if err := c.walk(w, child, depth+1, bounds[i], bounds[i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *integrityChecker) checkFreelist() error {
+	fh, err := c.pager.ReadFileHeader()
+	if err != nil {
+		return err
+	}
+	count := 0
+	from := 0
+	for next := int(fh.FreeHead); next != 0; {
+		if !c.claim(freelistOwner, from, next) {
+			break
+		}
+		count++
+		raw, err := c.pager.ReadPage(next)
+		var corrupt *CorruptError
+		if errors.As(err, &corrupt) {
+			c.report(freelistOwner, next, "%s", corrupt.Reason)
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read page %d: %w", next, err)
+		}
+		if raw[0] != PageFree {
+			c.report(freelistOwner, next, "page on the freelist has type 0x%02x", raw[0])
+			break
+		}
+		from, next = next, int(binary.LittleEndian.Uint32(raw[1:]))
+	}
+	if count != int(fh.FreeCount) {
+		c.report(freelistOwner, 0, "file header counts %d free pages, the list has %d", fh.FreeCount, count)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+)
+
+/*
+回滚日志（文件名为数据库文件名加 "-journal"）：
+
+| 字节位置 | 内容                   |
+| ---- | -------------------- |
+| 0-7  | 魔数 "mydbjrn1"        |
+| 8-11 | 事务开始时的页数           |
+| 12+  | 若干条页记录             |
+
+每条页记录为 页号(4) + 文件中原样的页 + 这一页的 CRC32(4)。启用页校验和或加密时，
+原样的页包括页尾的校验和或认证标签（见 checksum.go），加密的页在日志中也是加密的。
+事务中第一次改写某个已存在的页之前，先把原始内容追加到日志并 Sync，
+提交时删除日志文件。打开数据库时如果日志还在，说明上次事务没有提交，
+把日志中的页写回并截断文件。多个文件一起提交时日志末尾还有指向主日志的记录，见 master.go。
+*/
+
+const journalMagic = "mydbjrn1"
+
+const journalHeaderSize = 12
+
+var ErrNoTransaction = errors.New("no transaction is active")
+
+func (p *Pager) journalName() string {
+	return p.filename + "-journal"
+}
+
+// Begin 开始一个写事务，从开始到提交或回滚一直持有写锁（见 lock.go）
+func (p *Pager) Begin() error {
+	if p.snap != nil {
+		return ErrReadOnly
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.beginWrite(); err != nil {
+		return err
+	}
+	if p.inTx() {
+		p.endWrite()
+		return fmt.Errorf("cannot start a transaction within a transaction")
+	}
+	if p.shadow != nil {
+		// 影子分页模式不需要日志，提交之前的页都写在新的位置
+		p.shadow.inTx = true
+		p.txPages = p.nextPage - 1
+		return nil
+	}
+	if err := p.openJournal(); err != nil {
+		p.endWrite()
+		return err
+	}
+	return nil
+}
+
+func (p *Pager) openJournal() error {
+	f, err := p.vfs.Open(p.journalName())
+	if err != nil {
+		return err
+	}
+	header := make([]byte, journalHeaderSize)
+	copy(header, journalMagic)
+	binary.LittleEndian.PutUint32(header[8:], uint32(p.nextPage-1))
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.WriteAt(header, 0); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	p.journal, p.journalSize = f, journalHeaderSize
+	p.journaled = map[int]bool{}
+	p.txPages = p.nextPage - 1
+	return nil
+}
+
+// InTransaction 返回是否有进行中的事务
+func (p *Pager) InTransaction() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.snap == nil && p.inTx()
+}
+
+// journalPage 在页第一次被改写之前保存其原始内容
+func (p *Pager) journalPage(pageNum int) error {
+	if p.journal == nil || p.journaled[pageNum] || pageNum > p.txPages {
+		return nil
+	}
+	// 文件中还没有写过的页保存为全 0
+	orig, err := p.readStored(pageNum)
+	if err != nil {
+		return err
+	}
+	rec := make([]byte, 4+len(orig)+4)
+	binary.LittleEndian.PutUint32(rec, uint32(pageNum))
+	copy(rec[4:], orig)
+	binary.LittleEndian.PutUint32(rec[4+len(orig):], crc32.ChecksumIEEE(orig))
+	if _, err := p.journal.WriteAt(rec, p.journalSize); err != nil {
+		return err
+	}
+	p.journalSize += int64(len(rec))
+	if err := p.journal.Sync(); err != nil {
+		return err
+	}
+	p.journaled[pageNum] = true
+	return nil
+}
+
+// Commit 提交事务：先 Sync 数据页，删除日志即为提交点
+func (p *Pager) Commit() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.snap != nil {
+		return ErrReadOnly
+	}
+	if !p.inTx() {
+		return ErrNoTransaction
+	}
+	p.stmts = nil
+	if p.shadow != nil {
+		if err := p.commitShadow(); err != nil {
+			return err
+		}
+		p.shadow.inTx = false
+		p.commitVersion()
+		return p.endWrite()
+	}
+	if err := p.file.Sync(); err != nil {
+		return err
+	}
+	p.journal.Close()
+	p.journal, p.journaled = nil, nil
+	p.commitVersion()
+	err := p.vfs.Remove(p.journalName())
+	if endErr := p.endWrite(); err == nil {
+		err = endErr
+	}
+	return err
+}
+
+// Rollback 放弃事务中的所有修改
+func (p *Pager) Rollback() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.snap != nil {
+		return ErrReadOnly
+	}
+	if !p.inTx() {
+		return ErrNoTransaction
+	}
+	p.stmts = nil
+	if p.shadow != nil {
+		p.rollbackShadow()
+		return p.endWrite()
+	}
+	p.journal.Close()
+	p.journal, p.journaled = nil, nil
+	err := p.replayJournal()
+	p.dirty = true
+	if endErr := p.endWrite(); err == nil {
+		err = endErr
+	}
+	return err
+}
+
+// replayJournal 把日志中的原始页写回数据库并删除日志，日志不存在时什么也不做
+func (p *Pager) replayJournal() error {
+	data, err := readFile(p.vfs, p.journalName())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	stride := int(p.pageStride())
+	recSize := 4 + stride + 4
+	// 多文件事务的主日志已经删除说明事务已经提交，见 master.go
+	master := ""
+	if len(data) >= journalHeaderSize && string(data[:8]) == journalMagic {
+		master = journalMaster(data, recSize)
+	}
+	if master != "" {
+		if committed, err := masterCommitted(p.vfs, master); err != nil {
+			return err
+		} else if committed {
+			return p.vfs.Remove(p.journalName())
+		}
+	}
+	// 日志头不完整说明数据库还没有被修改过
+	if len(data) >= journalHeaderSize && string(data[:8]) == journalMagic {
+		origPages := int(binary.LittleEndian.Uint32(data[8:]))
+		for off := journalHeaderSize; off+recSize <= len(data); off += recSize {
+			pageNum := int(binary.LittleEndian.Uint32(data[off:]))
+			page := data[off+4 : off+4+stride]
+			// 校验失败的记录是写了一半的最后一条，对应的页还没有被改写；
+			// 事务开始之后才有的页不会写入日志，页号超出范围说明记录已经损坏
+			if crc32.ChecksumIEEE(page) != binary.LittleEndian.Uint32(data[off+4+stride:]) ||
+				pageNum < 1 || pageNum > origPages {
+				break
+			}
+			if _, err := p.file.WriteAt(page, p.pageOffset(pageNum)); err != nil {
+				return err
+			}
+		}
+		if err := p.file.Truncate(p.pageOffset(origPages + 1)); err != nil {
+			return err
+		}
+		if err := p.file.Sync(); err != nil {
+			return err
+		}
+		p.nextPage = origPages + 1
+	}
+	if err := p.vfs.Remove(p.journalName()); err != nil {
+		return err
+	}
+	if master != "" {
+		return removeMaster(p.vfs, master)
+	}
+	return nil
+}
+
+// Truncate 在事务中把数据库缩短为 pages 页，提交之后生效，回滚时恢复。
+// 截掉的页先写入日志并保存旧版本，快照仍然能读到它们；空闲链表由调用者保证不指向截掉的页。
+func (p *Pager) Truncate(pages int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.snap != nil {
+		return ErrReadOnly
+	}
+	if !p.inTx() {
+		return ErrNoTransaction
+	}
+	return p.truncate(pages)
+}
+
+func (p *Pager) truncate(pages int) error {
+	if pages < 1 {
+		return fmt.Errorf("cannot truncate database to %d pages", pages)
+	}
+	if pages >= p.nextPage-1 {
+		return nil
+	}
+	for pageNum := pages + 1; pageNum < p.nextPage; pageNum++ {
+		if err := p.saveStatementPage(pageNum); err != nil {
+			return fmt.Errorf("save page %d for statement: %w", pageNum, err)
+		}
+	}
+	if p.shadow != nil {
+		// 截掉的页在提交时从页表中去掉，见 commitShadow
+		for pageNum, phys := range p.shadow.pending {
+			if pageNum > pages {
+				p.shadow.release(phys)
+				delete(p.shadow.pending, pageNum)
+			}
+		}
+	} else {
+		for pageNum := pages + 1; pageNum < p.nextPage; pageNum++ {
+			if err := p.journalPage(pageNum); err != nil {
+				return fmt.Errorf("write journal for page %d: %w", pageNum, err)
+			}
+			if err := p.saveVersion(pageNum); err != nil {
+				return fmt.Errorf("save old version of page %d: %w", pageNum, err)
+			}
+		}
+		if err := p.file.Truncate(p.pageOffset(pages + 1)); err != nil {
+			return err
+		}
+	}
+	p.nextPage = pages + 1
+	p.dirty = true
+	return nil
+}
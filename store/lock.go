@@ -0,0 +1,349 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+/*
+文件锁（与 SQLite 的锁状态相同），多个进程可以安全地共用一个数据库文件：
+
+| 状态      | 含义                                         |
+| --------- | -------------------------------------------- |
+| NONE      | 不读也不写                                   |
+| SHARED    | 可以读，多个连接可以同时持有                 |
+| RESERVED  | 准备写，同时只有一个，已有的读者可以继续读   |
+| PENDING   | 等待读者退出，新的读者不能再加 SHARED 锁     |
+| EXCLUSIVE | 可以写，其他连接不持有任何锁                 |
+
+锁加在文件 1GB 处的一段字节上（PENDING 字节、RESERVED 字节和 510 字节的 SHARED 区），
+这些位置不存放数据。锁由 VFS 实现（见 vfs.go），Linux 上用 open file description 锁，
+同一进程里两个 Pager 打开同一个文件也会互斥，见 lock_linux.go。
+
+页是直接写入文件的，所以写者在改写任何页之前就要拿到 EXCLUSIVE 锁。
+BeginRead/EndRead、BeginWrite/EndWrite 包住一组读写操作；Begin 开始的事务持有写锁
+直到提交或回滚，快照持有读锁直到关闭。不在这些范围内的 WritePage 只为这一次写加锁，
+单独的 ReadPage 不加锁。拿不到锁时每隔一小段时间重试，超过 busy timeout 返回 ErrBusy。
+
+写锁释放时如果改过文件，就把文件头中的修改计数加一。其他连接从 NONE 加读锁时
+发现计数变了，说明文件被别人改过，重新计算页数并增加 DataVersion，
+上层据此重新加载缓存的元数据。同时检查有没有没人持有 RESERVED 锁的日志（热日志），
+有就先回滚。
+*/
+
+type LockLevel int
+
+const (
+	LockNone LockLevel = iota
+	LockShared
+	LockReserved
+	LockPending
+	LockExclusive
+)
+
+var ErrBusy = errors.New("database is locked")
+
+const DefaultBusyTimeout = 5 * time.Second
+
+const busyRetryInterval = 5 * time.Millisecond
+
+const (
+	pendingByte  = 0x40000000
+	reservedByte = pendingByte + 1
+	sharedFirst  = pendingByte + 2
+	sharedSize   = 510
+)
+
+// 修改计数在文件头中的位置，见 freelist.go
+const changeCounterOffset = fileHeaderOffset + 20
+
+// SetBusyTimeout 设置等待其他连接释放锁的最长时间，0 表示不等待
+func (p *Pager) SetBusyTimeout(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.busyTimeout = d
+}
+
+// LockLevel 返回当前持有的文件锁
+func (p *Pager) LockLevel() LockLevel {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.level
+}
+
+// DataVersion 在发现文件被其他连接修改之后增加
+func (p *Pager) DataVersion() uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.dataVersion
+}
+
+// BeginRead 加读锁，在 EndRead 之前其他连接不能写
+func (p *Pager) BeginRead() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readers++
+	if err := p.waitLock(LockShared, true); err != nil {
+		p.readers--
+		p.release()
+		return err
+	}
+	return nil
+}
+
+func (p *Pager) EndRead() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readers--
+	return p.release()
+}
+
+// BeginWrite 加写锁，在 EndWrite 之前其他连接不能读也不能写
+func (p *Pager) BeginWrite() error {
+	if p.snap != nil {
+		return ErrReadOnly
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.beginWrite()
+}
+
+func (p *Pager) beginWrite() error {
+	if p.failed != nil {
+		return p.failed
+	}
+	p.writers++
+	if err := p.waitLock(LockExclusive, true); err != nil {
+		p.writers--
+		p.release()
+		return err
+	}
+	return nil
+}
+
+func (p *Pager) EndWrite() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.endWrite()
+}
+
+func (p *Pager) endWrite() error {
+	p.writers--
+	if p.writers == 0 && p.dirty {
+		if err := p.bumpCounter(); err != nil {
+			p.release()
+			return err
+		}
+	}
+	return p.release()
+}
+
+// waitLock 把锁升级到 level，冲突时重试直到 busy timeout。
+// unlock 为 true 时等待期间释放 p.mu，让同一进程中的读者可以继续。
+func (p *Pager) waitLock(level LockLevel, unlock bool) error {
+	start := p.level
+	deadline := time.Now().Add(p.busyTimeout)
+	for {
+		err := p.lock(level)
+		if !errors.Is(err, ErrBusy) {
+			return err
+		}
+		if !time.Now().Before(deadline) {
+			p.unlockTo(start)
+			return ErrBusy
+		}
+		if unlock {
+			p.mu.Unlock()
+		}
+		time.Sleep(busyRetryInterval)
+		if unlock {
+			p.mu.Lock()
+		}
+	}
+}
+
+// release 按照还在进行的读写操作降低锁
+func (p *Pager) release() error {
+	switch {
+	case p.writers > 0:
+		return nil
+	case p.readers > 0:
+		return p.unlockTo(LockShared)
+	default:
+		return p.unlockTo(LockNone)
+	}
+}
+
+// lock 逐级升级锁，拿不到时返回 ErrBusy，已经拿到的级别保留，下次从这里继续
+func (p *Pager) lock(level LockLevel) error {
+	if p.level >= level {
+		return nil
+	}
+	if p.level == LockNone {
+		// 有写者在等待（持有 PENDING）时不能加新的读锁
+		if err := p.file.Lock(ReadLock, pendingByte, 1); err != nil {
+			return err
+		}
+		err := p.file.Lock(ReadLock, sharedFirst, sharedSize)
+		if uerr := p.file.Lock(Unlock, pendingByte, 1); err == nil {
+			err = uerr
+		}
+		if err != nil {
+			return err
+		}
+		p.level = LockShared
+		if err := p.recoverHotJournal(); err != nil {
+			p.unlockTo(LockNone)
+			return err
+		}
+		if err := p.checkChanged(); err != nil {
+			p.unlockTo(LockNone)
+			return err
+		}
+	}
+	for p.level < level {
+		var err error
+		switch p.level + 1 {
+		case LockReserved:
+			err = p.file.Lock(WriteLock, reservedByte, 1)
+		case LockPending:
+			err = p.file.Lock(WriteLock, pendingByte, 1)
+		case LockExclusive:
+			err = p.file.Lock(WriteLock, sharedFirst, sharedSize)
+		}
+		if err != nil {
+			return err
+		}
+		p.level++
+	}
+	return nil
+}
+
+// unlockTo 把锁降低到 level（LockShared 或 LockNone）
+func (p *Pager) unlockTo(level LockLevel) error {
+	if p.level <= level {
+		return nil
+	}
+	var err error
+	if level == LockShared {
+		if p.level == LockExclusive {
+			err = p.file.Lock(ReadLock, sharedFirst, sharedSize)
+		}
+		if uerr := p.file.Lock(Unlock, pendingByte, 2); err == nil {
+			err = uerr
+		}
+	} else {
+		err = p.file.Lock(Unlock, pendingByte, 2+sharedSize)
+	}
+	p.level = level
+	return err
+}
+
+// recoverHotJournal 在刚加上读锁时回滚崩溃的连接留下的日志。
+// 有人持有 RESERVED 锁说明日志属于进行中的事务，不是热日志。
+func (p *Pager) recoverHotJournal() error {
+	if p.journal != nil || p.shadow != nil {
+		return nil
+	}
+	if ok, err := fileExists(p.vfs, p.journalName()); !ok {
+		return err
+	}
+	if err := p.file.Lock(WriteLock, reservedByte, 1); err != nil {
+		if errors.Is(err, ErrBusy) {
+			return nil
+		}
+		return err
+	}
+	p.level = LockReserved
+	if err := p.lock(LockExclusive); err != nil {
+		return err
+	}
+	if err := p.replayJournal(); err != nil {
+		return err
+	}
+	if err := p.bumpCounter(); err != nil {
+		return err
+	}
+	if err := p.refresh(); err != nil {
+		return err
+	}
+	return p.unlockTo(LockShared)
+}
+
+func (p *Pager) readCounter() (uint32, error) {
+	// 影子分页模式下事务号就是修改计数
+	if p.shadow != nil {
+		_, txid, _, _, err := p.currentMeta()
+		return uint32(txid), err
+	}
+	buf := make([]byte, 4)
+	if _, err := p.file.ReadAt(buf, changeCounterOffset); err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(buf), nil
+}
+
+// bumpCounter 在文件中的修改计数上加一，持有 EXCLUSIVE 锁时调用
+func (p *Pager) bumpCounter() error {
+	if p.shadow != nil {
+		p.counter = uint32(p.shadow.txid)
+		p.dirty = false
+		return nil
+	}
+	c, err := p.readCounter()
+	if err != nil {
+		return err
+	}
+	c++
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, c)
+	if _, err := p.file.WriteAt(buf, changeCounterOffset); err != nil {
+		return err
+	}
+	p.counter = c
+	p.dirty = false
+	return nil
+}
+
+// checkChanged 比较修改计数，文件被其他连接改过时丢掉缓存的状态
+func (p *Pager) checkChanged() error {
+	c, err := p.readCounter()
+	if err != nil {
+		return err
+	}
+	if c != p.counter {
+		p.counter = c
+		return p.refresh()
+	}
+	return nil
+}
+
+func (p *Pager) refresh() error {
+	p.history = nil
+	p.dataVersion++
+	if p.shadow != nil {
+		return p.loadShadow()
+	}
+	size, err := p.file.Size()
+	if err != nil {
+		return err
+	}
+	p.nextPage = max(p.pagesIn(size), 1) + 1
+	return nil
+}
+
+// keepCounter 写页 1 时保留文件中的修改计数，它只由 bumpCounter 修改；
+// 标志和加密参数也保持不变，例如 VACUUM 从临时文件复制页 1 时
+func (p *Pager) keepCounter(data []byte) ([]byte, error) {
+	c, err := p.readCounter()
+	if err != nil {
+		return nil, err
+	}
+	data = append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(data[changeCounterOffset:], c)
+	data[fileFlagsOffset] = p.fileFlags()
+	copy(data[cryptParamsOffset:], p.cryptHeader())
+	return data, nil
+}
@@ -0,0 +1,31 @@
+//go:build linux
+
+package store
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// F_OFD_SETLK：锁属于打开的文件而不是进程，关闭同一文件的其他描述符不会释放它，
+// 同一进程中的两个 Pager 之间也会互斥
+const fOFDSetlk = 37
+
+func setLock(f *os.File, typ LockType, start, length int64) error {
+	lk := syscall.Flock_t{Whence: io.SeekStart, Start: start, Len: length}
+	switch typ {
+	case ReadLock:
+		lk.Type = syscall.F_RDLCK
+	case WriteLock:
+		lk.Type = syscall.F_WRLCK
+	default:
+		lk.Type = syscall.F_UNLCK
+	}
+	err := syscall.FcntlFlock(f.Fd(), fOFDSetlk, &lk)
+	if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EACCES) {
+		return ErrBusy
+	}
+	return err
+}
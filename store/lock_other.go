@@ -0,0 +1,10 @@
+//go:build !linux
+
+package store
+
+import "os"
+
+// 其他平台暂时不加文件锁，多个进程不能同时使用一个数据库文件
+func setLock(f *os.File, typ LockType, start, length int64) error {
+	return nil
+}
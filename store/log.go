@@ -0,0 +1,11 @@
+package store
+
+import (
+	"io"
+	"log"
+)
+
+// Logger 接收 store 和 db 包的状态信息（打开文件时的页数、建表、根页变化、备份进度等），
+// 默认丢弃，不混进调用方的输出。调试时可以 store.Logger.SetOutput(os.Stderr)。
+// 错误不经过 Logger，由函数返回。
+var Logger = log.New(io.Discard, "", 0)
@@ -0,0 +1,182 @@
+package store
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+)
+
+/*
+主日志（master journal）让一个事务对多个数据库文件的修改一起提交，与 SQLite 相同。
+CommitAll 提交多个回滚日志模式的 Pager 时：
+
+ 1. 写主日志 "<第一个文件名>-mj<随机数>"，内容为魔数 "mydbmj01" 和各个日志的文件名
+    （以 0 结尾），Sync；
+ 2. 在每个日志末尾追加指向主日志的记录，Sync 日志，再 Sync 数据库文件；
+ 3. 删除主日志，这就是整个事务的提交点；
+ 4. 像单个事务一样删除各个日志。
+
+指向主日志的记录为 0(4) + 名字长度(4) + 主日志文件名 + 文件名的 CRC32(4)，页号 0
+不会出现在页记录中。回滚日志时（见 journal.go 的 replayJournal）如果日志指向的主日志
+已经不存在，说明事务已经提交，只删除日志；否则照常回滚，最后一个回滚的日志删除主日志。
+
+影子分页模式的提交是写一个元数据页，没有日志可以挂到主日志上，:memory: 数据库崩溃之后
+本来就不存在，它们都在提交点之后单独提交，不保证与其他文件一起生效。
+*/
+
+const masterMagic = "mydbmj01"
+
+// CommitAll 提交多个 Pager 上的事务，没有在事务中的 Pager 跳过。
+// 修改了两个以上回滚日志模式的文件时通过主日志原子地提交，这些文件要在同一个 VFS 中。
+// 提交点之前出错时所有事务都已回滚。
+func CommitAll(pagers ...*Pager) error {
+	var journaled, others []*Pager
+	for _, p := range pagers {
+		if !p.InTransaction() {
+			continue
+		}
+		p.mu.RLock()
+		atomic := p.journal != nil && p.dirty && p.filename != MemoryDB
+		p.mu.RUnlock()
+		if atomic {
+			journaled = append(journaled, p)
+		} else {
+			others = append(others, p)
+		}
+	}
+	all := append(journaled, others...)
+	if len(journaled) >= 2 {
+		if master, err := commitMaster(journaled); err != nil {
+			for _, p := range all {
+				p.Rollback()
+			}
+			// 先回滚再删除主日志，否则指向它的日志会被当作已经提交
+			journaled[0].vfs.Remove(master)
+			return err
+		}
+	}
+
+	// 提交点之后：删除各个日志，其他 Pager 单独提交
+	var firstErr error
+	for _, p := range all {
+		if err := p.Commit(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// commitMaster 完成提交的前三步，返回主日志的文件名，返回的错误为 nil 时事务已经提交
+func commitMaster(pagers []*Pager) (string, error) {
+	vfs := pagers[0].vfs
+	var names bytes.Buffer
+	names.WriteString(masterMagic)
+	for _, p := range pagers {
+		if p.vfs != vfs {
+			return "", fmt.Errorf("cannot commit %s and %s atomically: different VFS", pagers[0].filename, p.filename)
+		}
+		names.WriteString(p.journalName())
+		names.WriteByte(0)
+	}
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	master := pagers[0].filename + "-mj" + hex.EncodeToString(suffix)
+
+	f, err := vfs.Open(master)
+	if err != nil {
+		return master, err
+	}
+	_, err = f.WriteAt(names.Bytes(), 0)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		for _, p := range pagers {
+			if err = p.linkMaster(master); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = vfs.Remove(master)
+	}
+	if err != nil {
+		return master, fmt.Errorf("commit master journal: %w", err)
+	}
+	return master, nil
+}
+
+// linkMaster 在日志末尾追加指向主日志的记录，日志和数据库文件都 Sync 之后返回
+func (p *Pager) linkMaster(master string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rec := make([]byte, 8+len(master)+4)
+	binary.LittleEndian.PutUint32(rec[4:], uint32(len(master)))
+	copy(rec[8:], master)
+	binary.LittleEndian.PutUint32(rec[8+len(master):], crc32.ChecksumIEEE([]byte(master)))
+	if _, err := p.journal.WriteAt(rec, p.journalSize); err != nil {
+		return err
+	}
+	p.journalSize += int64(len(rec))
+	if err := p.journal.Sync(); err != nil {
+		return err
+	}
+	return p.file.Sync()
+}
+
+// journalMaster 返回日志末尾指向的主日志，没有时返回空串
+func journalMaster(data []byte, recSize int) string {
+	off := journalHeaderSize
+	for off+recSize <= len(data) && binary.LittleEndian.Uint32(data[off:]) != 0 {
+		off += recSize
+	}
+	if off+8 > len(data) || binary.LittleEndian.Uint32(data[off:]) != 0 {
+		return ""
+	}
+	n := int(binary.LittleEndian.Uint32(data[off+4:]))
+	if n == 0 || off+8+n+4 > len(data) {
+		return ""
+	}
+	name := data[off+8 : off+8+n]
+	if crc32.ChecksumIEEE(name) != binary.LittleEndian.Uint32(data[off+8+n:]) {
+		return ""
+	}
+	return string(name)
+}
+
+// masterCommitted 返回日志所属的多文件事务是否已经提交（主日志已经删除）
+func masterCommitted(vfs VFS, master string) (bool, error) {
+	ok, err := fileExists(vfs, master)
+	return !ok && err == nil, err
+}
+
+// removeMaster 在主日志列出的日志都已经不存在时删除主日志
+func removeMaster(vfs VFS, master string) error {
+	data, err := readFile(vfs, master)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, []byte(masterMagic)) {
+		return nil
+	}
+	for _, name := range bytes.Split(data[len(masterMagic):], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		if ok, err := fileExists(vfs, string(name)); ok || err != nil {
+			return err
+		}
+	}
+	return vfs.Remove(master)
+}
@@ -4,100 +4,333 @@ package store
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"sync"
+	"time"
 )
 
 const PageSize = 4096
 
+var ErrRowNotFound = errors.New("row not found")
+
+/*
+并发模型：Pager 的每个导出方法都是原子的，内部用读写锁保护文件、nextPage 和事务状态，
+ReadPage 之间可以并发，写页、分配和释放页互斥。
+一次 B+ 树插入会连续修改多个页，多页修改之间的一致性由上层负责：
+db.Database 只允许一个写者，读者通过快照读取已提交的版本，见 snapshot.go 和 db/database.go。
+*/
+
 type Pager struct {
-	file     *os.File
+	*pagerFile
+	snap *snapshot // 非 nil 表示这是一个只读快照，见 snapshot.go
+}
+
+// pagerFile 是同一个文件的所有 Pager（包括快照）共享的状态
+type pagerFile struct {
+	mu       sync.RWMutex
+	vfs      VFS
+	file     File
 	filename string
 	nextPage int
+
+	// 事务状态，见 journal.go
+	journal     File
+	journalSize int64          // 日志文件的长度，页记录依次追加
+	journaled   map[int]bool   // 本事务中已经写入日志的页
+	txPages     int            // 事务开始时的页数，之后分配的页回滚时直接截掉
+	failed      error          // 非 nil 时拒绝所有写操作，直到重新打开，见 commitShadow
+	stmts       []*statement   // 事务中进行中的语句保存点，见 statement.go
+	shadow      *shadowState   // 影子分页模式的状态，nil 表示使用回滚日志，见 shadow.go
+	checksums   bool           // 每页带校验和，见 checksum.go
+	cipher      *pageCipher    // 非 nil 表示页是加密的，见 crypt.go
+	compress    *compressState // 非 nil 表示页是压缩的，见 compress.go
+
+	// 多版本状态，见 snapshot.go
+	version   uint64                // 最近一次提交的版本号
+	history   map[int][]pageVersion // 被覆盖的旧页，按版本号递增
+	snapshots map[*snapshot]bool    // 还没有关闭的快照
+	backups   map[*Backup]bool      // 以这个文件为源的在线备份，见 backup.go
+
+	// 文件锁状态，见 lock.go
+	level       LockLevel
+	readers     int // 进行中的读操作（包括快照）
+	writers     int // 进行中的写操作（包括事务）
+	busyTimeout time.Duration
+	counter     uint32 // 最近一次看到的修改计数
+	dataVersion uint64
+	dirty       bool // 持有写锁期间改过文件
 }
 
+// MemoryDB 作为文件名时打开一个只在内存中的新数据库，关闭之后内容丢失
+const MemoryDB = ":memory:"
+
 func OpenPager(filename string) (*Pager, error) {
-	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+	return OpenPagerWithOptions(filename, Options{})
+}
+
+func OpenPagerWithOptions(filename string, opts Options) (*Pager, error) {
+	vfs := opts.VFS
+	switch {
+	case vfs != nil:
+	case filename == MemoryDB:
+		// 每次打开都是自己的 MemVFS，其他连接看不到；快照和 VACUUM 通过 Pager.VFS() 使用同一个
+		vfs = NewMemVFS()
+	default:
+		vfs = OSVFS{}
+	}
+	file, err := vfs.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	info, err := file.Stat()
-	if err != nil {
+	p := &Pager{pagerFile: &pagerFile{vfs: vfs, file: file, filename: filename, busyTimeout: DefaultBusyTimeout}}
+	if err := p.openFormat(opts); err != nil {
+		file.Close()
 		return nil, err
 	}
+	if err := p.openShadow(opts); err != nil {
+		file.Close()
+		return nil, err
+	}
+	// 没有其他连接在用这个文件时，先回滚上次没有提交的事务；否则留到第一次加读锁时
+	if err := p.lock(LockShared); err != nil && !errors.Is(err, ErrBusy) {
+		file.Close()
+		return nil, fmt.Errorf("recover database: %w", err)
+	}
+	defer p.unlockTo(LockNone)
+	if p.shadow != nil {
+		if err := p.loadShadow(); err != nil {
+			file.Close()
+			return nil, err
+		}
+		Logger.Printf("[Pager] Database has %d pages (shadow paging)", p.nextPage-1)
+		p.counter = uint32(p.shadow.txid)
+		return p, nil
+	}
 
-	size := info.Size()
-	pageCount := int(size / PageSize)
-	if size%PageSize != 0 {
-		pageCount++ // 补上残页
+	size, err := file.Size()
+	if err != nil {
+		return nil, err
 	}
+
+	pageCount := p.pagesIn(size)
 	if pageCount == 0 {
 		pageCount = 1 // 至少一页起步
-		// 初始化页1为全0
+		// 初始化页1：没有记录，末尾写入文件头
 		empty := make([]byte, PageSize)
-		_, err := file.WriteAt(empty, 0)
-		if err != nil {
+		copy(empty[fileHeaderOffset:], fileHeaderMagic)
+		empty[fileFlagsOffset] = p.fileFlags()
+		copy(empty[cryptParamsOffset:], p.cryptHeader())
+		if err := p.writeRaw(1, empty); err != nil {
 			return nil, fmt.Errorf("failed to write initial page 1: %w", err)
 		}
 	}
 
-	fmt.Printf("[Pager] Database has %d pages\n", pageCount)
+	Logger.Printf("[Pager] Database has %d pages", pageCount)
 
-	return &Pager{
-		file:     file,
-		filename: filename,
-		nextPage: pageCount + 1, // 下一可分配页号
-	}, nil
+	p.nextPage = pageCount + 1 // 下一可分配页号
+	if p.counter, err = p.readCounter(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// openShadow 识别影子分页格式的文件，新建的文件按 opts 初始化
+func (p *Pager) openShadow(opts Options) error {
+	size, err := p.file.Size()
+	if err != nil {
+		return err
+	}
+	shadow, err := isShadowFile(p.file)
+	if err != nil {
+		return err
+	}
+	switch {
+	case size == 0 && opts.Shadow:
+		if err := p.initShadow(); err != nil {
+			return fmt.Errorf("initialize shadow paging: %w", err)
+		}
+	case opts.Shadow && !shadow:
+		return fmt.Errorf("%s is not a shadow paging database", p.filename)
+	case !shadow:
+		return nil
+	}
+	// 真正的页表在持有读锁时加载
+	p.shadow = &shadowState{}
+	return nil
+}
+
+// Filename 返回数据库文件名
+func (p *Pager) Filename() string {
+	return p.filename
 }
 
 func (p *Pager) ReadPage(pageNum int) ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.readPage(pageNum)
+}
+
+func (p *Pager) readPage(pageNum int) ([]byte, error) {
 	if pageNum < 1 {
 		return nil, fmt.Errorf("pageNum must be greater than 0")
 	}
-	offset := int64((pageNum - 1) * PageSize)
-	data := make([]byte, PageSize)
-	_, err := p.file.ReadAt(data, offset)
-	if err != nil {
-		return nil, err
+	if p.snap != nil {
+		if pageNum > p.snap.pages {
+			return nil, fmt.Errorf("page %d does not exist in snapshot", pageNum)
+		}
+		if p.shadow != nil {
+			return p.readMapped(pageNum, tableLookup(p.snap.table, pageNum))
+		}
+		if data, ok := p.readVersion(p.snap, pageNum); ok {
+			return data, nil
+		}
+	}
+	if p.shadow != nil {
+		return p.readMapped(pageNum, p.shadow.lookup(pageNum))
+	}
+	return p.readRaw(pageNum)
+}
+
+// readMapped 读影子分页模式下的物理页，还没有写过的逻辑页与文件末尾之后一样返回 io.EOF。
+// 校验和错误中的页号换成逻辑页号。
+func (p *Pager) readMapped(pageNum int, phys uint32) ([]byte, error) {
+	if phys == 0 {
+		return nil, io.EOF
 	}
-	return data, nil
+	data, err := p.readPhys(phys)
+	var corrupt *CorruptError
+	if errors.As(err, &corrupt) {
+		return nil, &CorruptError{Page: pageNum, Reason: fmt.Sprintf("%s (physical page %d)", corrupt.Reason, phys)}
+	}
+	return data, err
 }
 
 func (p *Pager) WritePage(pageNum int, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.writePage(pageNum, data)
+}
+
+func (p *Pager) writePage(pageNum int, data []byte) (err error) {
 	if len(data) != PageSize {
 		return fmt.Errorf("data length must be equal to PageSize")
 	}
-	offset := int64((pageNum - 1) * PageSize)
-	_, err := p.file.WriteAt(data, offset)
-	if err != nil {
+	if p.snap != nil {
+		return ErrReadOnly
+	}
+	if p.failed != nil {
+		return p.failed
+	}
+	// 不在 BeginWrite 或事务中的写只为这一次加写锁
+	if p.writers == 0 {
+		p.writers++
+		if err := p.waitLock(LockExclusive, false); err != nil {
+			p.writers--
+			p.release()
+			return err
+		}
+		defer func() {
+			if endErr := p.endWrite(); err == nil {
+				err = endErr
+			}
+		}()
+	}
+	if err := p.saveStatementPage(pageNum); err != nil {
+		return fmt.Errorf("save page %d for statement: %w", pageNum, err)
+	}
+	if p.shadow != nil {
+		if err := p.shadowWrite(pageNum, data); err != nil {
+			return err
+		}
+	} else {
+		if err := p.writeInPlace(pageNum, data); err != nil {
+			return err
+		}
+	}
+	p.dirty = true
+	if pageNum >= p.nextPage {
+		p.nextPage = pageNum + 1
+	}
+	for b := range p.backups {
+		b.dirty[pageNum] = true
+	}
+	// 事务之外的每次写页都是一次提交
+	if !p.inTx() {
+		if p.shadow != nil {
+			if err := p.commitShadow(); err != nil {
+				return err
+			}
+		}
+		p.commitVersion()
+	}
+	return nil
+}
+
+// writeInPlace 先保存原始内容（日志和快照用），再覆盖文件中的页
+func (p *Pager) writeInPlace(pageNum int, data []byte) (err error) {
+	if pageNum == 1 {
+		if data, err = p.keepCounter(data); err != nil {
+			return err
+		}
+	}
+	if err := p.journalPage(pageNum); err != nil {
+		return fmt.Errorf("write journal for page %d: %w", pageNum, err)
+	}
+	if err := p.saveVersion(pageNum); err != nil {
+		return fmt.Errorf("save old version of page %d: %w", pageNum, err)
+	}
+	if err := p.writeRaw(pageNum, data); err != nil {
 		return err
 	}
+	// 事务中的页在提交时统一 Sync，原始内容已经在日志里
+	if p.inTx() {
+		return nil
+	}
 	return p.file.Sync()
 }
 
+// inTx 返回是否有进行中的事务
+func (f *pagerFile) inTx() bool {
+	return f.journal != nil || (f.shadow != nil && f.shadow.inTx)
+}
+
+// Close 关闭文件，未提交的事务留下日志，下次打开时回滚。
+// 对快照调用 Close 只是释放快照，文件保持打开。
 func (p *Pager) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.snap != nil {
+		p.releaseSnapshot(p.snap)
+		p.readers--
+		return p.release()
+	}
+	if p.journal != nil {
+		p.journal.Close()
+		p.journal = nil
+	}
+	p.unlockTo(LockNone)
 	return p.file.Close()
 }
 
 func (p *Pager) AppendRow(pageNum int, row []byte) error {
-	page, err := p.ReadPage(pageNum)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	page, err := p.readPage(pageNum)
 	if err != nil || bytes.Equal(page, make([]byte, PageSize)) {
 		page = make([]byte, PageSize)
 		binary.LittleEndian.PutUint32(page, 0)
 	}
 	existing := page
-	count := int(binary.LittleEndian.Uint32(existing[0:4]))
-	offset := 4
-	for i := 0; i < count; i++ {
-		if offset+4 > PageSize {
-			return fmt.Errorf("offset overflow reading length")
-		}
-		rowLen := int(binary.LittleEndian.Uint32(existing[offset:]))
-		offset += 4 + rowLen
+	rows, offset, err := decodeRowArea(existing, usableSize(pageNum))
+	if err != nil {
+		return fmt.Errorf("page %d: %w", pageNum, err)
 	}
+	count := len(rows)
 
-	if offset+4+len(row) > PageSize {
+	if offset+4+len(row) > usableSize(pageNum) {
 		return fmt.Errorf("page full, can't append row of length %d at offset %d", len(row), offset)
 	}
 
@@ -105,64 +338,150 @@ func (p *Pager) AppendRow(pageNum int, row []byte) error {
 	copy(existing[offset+4:], row)
 	binary.LittleEndian.PutUint32(existing[0:], uint32(count+1))
 
-	return p.WritePage(pageNum, existing)
+	return p.writePage(pageNum, existing)
 }
 
 func (p *Pager) ReadAllRows(pageNum int) ([][]byte, error) {
-	page, err := p.ReadPage(pageNum)
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.readAllRows(pageNum)
+}
+
+func (p *Pager) readAllRows(pageNum int) ([][]byte, error) {
+	page, err := p.readPage(pageNum)
 	if err != nil {
 		return nil, err
 	}
-	count := int(binary.LittleEndian.Uint32(page[0:4]))
-	rows := [][]byte{}
+	rows, _, err := decodeRowArea(page, usableSize(pageNum))
+	if err != nil {
+		return nil, fmt.Errorf("page %d: %w", pageNum, err)
+	}
+	return rows, nil
+}
+
+// decodeRowArea 解析页开头的记录区：记录数(4) 加上若干条 长度(4) + 记录，
+// 只能用到前 usable 字节。返回各条记录和记录区的结束位置。
+func decodeRowArea(page []byte, usable int) ([][]byte, int, error) {
+	if len(page) < usable || usable < 4 {
+		return nil, 0, fmt.Errorf("%w: row area of %d bytes in a page of %d bytes", ErrCorrupt, usable, len(page))
+	}
+	count := binary.LittleEndian.Uint32(page)
+	// 每条记录至少占 4 字节长度
+	if int64(count) > int64(usable-4)/4 {
+		return nil, 0, fmt.Errorf("%w: invalid row count %d", ErrCorrupt, count)
+	}
+	rows := make([][]byte, 0, count)
 	offset := 4
-	for i := 0; i < count; i++ {
-		if offset+4 > PageSize {
-			break
+	for i := 0; i < int(count); i++ {
+		if offset+4 > usable {
+			return nil, 0, fmt.Errorf("%w: row %d length outside the row area", ErrCorrupt, i)
 		}
-		rowLen := int(binary.LittleEndian.Uint32(page[offset:]))
+		rowLen := int64(binary.LittleEndian.Uint32(page[offset:]))
 		offset += 4
-		if offset+rowLen > PageSize {
-			break
+		if rowLen > int64(usable-offset) {
+			return nil, 0, fmt.Errorf("%w: row %d of %d bytes exceeds the row area", ErrCorrupt, i, rowLen)
 		}
-		rows = append(rows, page[offset:offset+rowLen])
-		offset += rowLen
+		rows = append(rows, page[offset:offset+int(rowLen)])
+		offset += int(rowLen)
 	}
-	return rows, nil
+	return rows, offset, nil
 }
 
-func (p *Pager) AllocatePage() int {
+// AllocatePage 优先复用空闲链表中的页，否则在文件末尾分配新页。
+// 空闲链表损坏时返回错误，而不是当作空链表继续分配
+func (p *Pager) AllocatePage() (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.snap != nil {
+		return 0, ErrReadOnly
+	}
+	pageNum, err := p.popFreePage()
+	if err != nil {
+		return 0, fmt.Errorf("allocate page from freelist: %w", err)
+	}
+	if pageNum != 0 {
+		return pageNum, nil
+	}
 	if p.nextPage < 2 {
 		p.nextPage = 2 // 保留页 1 用于元数据表（sqlite_master）
 	}
 	page := p.nextPage
 	p.nextPage++
-	return page
+	return page, nil
 }
 
 func (p *Pager) UpdateRowInPage(pageNum int, matchName string, newRow []byte) error {
-	page, err := p.ReadPage(pageNum)
+	err := p.UpdateRowInPageFunc(pageNum, func(fields []string) bool {
+		return len(fields) > 0 && fields[0] == matchName
+	}, newRow)
+	if errors.Is(err, ErrRowNotFound) {
+		return fmt.Errorf("table metadata not found: %s", matchName)
+	}
+	return err
+}
+
+// UpdateRowInPageFunc 用 newRow 替换页中第一条满足 match 的记录。
+// 整页的记录区重新排列，所以新记录可以比旧记录长，只要页里放得下。
+func (p *Pager) UpdateRowInPageFunc(pageNum int, match func(fields []string) bool, newRow []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rows, err := p.readAllRows(pageNum)
 	if err != nil {
 		return err
 	}
-	count := int(binary.LittleEndian.Uint32(page[0:4]))
-	offset := 4
-	for i := 0; i < count; i++ {
-		rowLen := int(binary.LittleEndian.Uint32(page[offset:]))
-		offset += 4
-		rawData := page[offset : offset+rowLen]
+	for i, r := range rows {
+		fields, err := DecodeRow(r)
+		if err == nil && match(fields) {
+			rows[i] = newRow
+			return p.writeRows(pageNum, rows)
+		}
+	}
+	return ErrRowNotFound
+}
 
-		fields, err := DecodeRow(rawData)
-		if err == nil && len(fields) > 0 && fields[0] == matchName {
-			newRowLen := len(newRow)
-			if newRowLen > rowLen {
-				return fmt.Errorf("new row length %d is greater than old row length %d", newRowLen, rowLen)
-			}
-			copy(page[offset:], newRow)
-			binary.LittleEndian.PutUint32(page[offset-4:], uint32(newRowLen))
-			return p.WritePage(pageNum, page)
+// DeleteRowInPageFunc 删除页中第一条满足 match 的记录，后面的记录前移
+func (p *Pager) DeleteRowInPageFunc(pageNum int, match func(fields []string) bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rows, err := p.readAllRows(pageNum)
+	if err != nil {
+		return err
+	}
+	for i, r := range rows {
+		fields, err := DecodeRow(r)
+		if err == nil && match(fields) {
+			return p.writeRows(pageNum, append(rows[:i:i], rows[i+1:]...))
+		}
+	}
+	return ErrRowNotFound
+}
+
+// ClearRows 删除页中的所有记录
+func (p *Pager) ClearRows(pageNum int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.writeRows(pageNum, nil)
+}
+
+// writeRows 用给定记录重写整页的记录区，页 1 末尾的文件头保持不变
+func (p *Pager) writeRows(pageNum int, rows [][]byte) error {
+	page, err := p.readPage(pageNum)
+	if err != nil {
+		return err
+	}
+	limit := usableSize(pageNum)
+	for i := 0; i < limit; i++ {
+		page[i] = 0
+	}
+	binary.LittleEndian.PutUint32(page, uint32(len(rows)))
+	offset := 4
+	for _, r := range rows {
+		if offset+4+len(r) > limit {
+			return fmt.Errorf("page full, can't write row of length %d at offset %d", len(r), offset)
 		}
-		offset += rowLen
+		binary.LittleEndian.PutUint32(page[offset:], uint32(len(r)))
+		copy(page[offset+4:], r)
+		offset += 4 + len(r)
 	}
-	return fmt.Errorf("table metadata not found: %s", matchName)
+	return p.writePage(pageNum, page)
 }
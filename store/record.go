@@ -3,17 +3,31 @@ package store
 import (
 	"bytes"
 	"encoding/binary"
-	"io"
+	"fmt"
 )
 
+// 字段长度为 -1 表示 NULL
+const nullFieldSize = -1
+
 func EncodeRow(row []string) ([]byte, error) {
+	return EncodeRowWithNulls(row, nil)
+}
+
+// EncodeRowWithNulls 编码行，nulls[i] 为 true 的字段写成 NULL
+func EncodeRowWithNulls(row []string, nulls []bool) ([]byte, error) {
 	buf := new(bytes.Buffer)
 	//  写入字段数
 	err := binary.Write(buf, binary.LittleEndian, int32(len(row)))
 	if err != nil {
 		return nil, err
 	}
-	for _, field := range row {
+	for i, field := range row {
+		if i < len(nulls) && nulls[i] {
+			if err := binary.Write(buf, binary.LittleEndian, int32(nullFieldSize)); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		data := []byte(field)
 		err := binary.Write(buf, binary.LittleEndian, int32(len(data)))
 		if err != nil {
@@ -24,24 +38,76 @@ func EncodeRow(row []string) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// 解码行
+// 解码行，NULL 字段解码为空串
 func DecodeRow(data []byte) ([]string, error) {
-	buf := bytes.NewBuffer(data)
-	var count int32
-	if err := binary.Read(buf, binary.LittleEndian, &count); err != nil {
-		return nil, err
+	row, _, err := DecodeRowWithNulls(data)
+	return row, err
+}
+
+// DecodeRowWithNulls 解码行，同时返回每个字段是否为 NULL。
+// 先检查整条记录的格式再分配内存，损坏的记录返回的错误满足 errors.Is(err, ErrCorrupt)。
+func DecodeRowWithNulls(data []byte) ([]string, []bool, error) {
+	count, err := walkRecord(data, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
 	}
 	row := make([]string, count)
+	nulls := make([]bool, count)
+	walkRecord(data, func(i int, field []byte) {
+		if field == nil {
+			nulls[i] = true
+		} else {
+			row[i] = string(field)
+		}
+	})
+	return row, nulls, nil
+}
+
+// walkRecord 检查记录格式并返回字段数，fn 不为 nil 时对每个字段调用（NULL 字段为 nil）。
+// 每个字段至少占 4 字节长度，所以字段数不会超过记录长度的四分之一。
+func walkRecord(data []byte, fn func(i int, field []byte)) (int, error) {
+	if len(data) < 4 {
+		return 0, fmt.Errorf("record of %d bytes has no field count", len(data))
+	}
+	count := int32(binary.LittleEndian.Uint32(data))
+	if count < 0 || int(count) > (len(data)-4)/4 {
+		return 0, fmt.Errorf("invalid field count %d in a record of %d bytes", count, len(data))
+	}
+	pos := 4
 	for i := 0; i < int(count); i++ {
-		var size int32
-		if err := binary.Read(buf, binary.LittleEndian, &size); err != nil {
-			return nil, err
+		if pos+4 > len(data) {
+			return 0, fmt.Errorf("record truncated at field %d", i)
 		}
-		field := make([]byte, size)
-		if _, err := io.ReadFull(buf, field); err != nil {
-			return nil, err
+		size := int32(binary.LittleEndian.Uint32(data[pos:]))
+		pos += 4
+		if size == nullFieldSize {
+			if fn != nil {
+				fn(i, nil)
+			}
+			continue
 		}
-		row[i] = string(field)
+		if size < 0 || int(size) > len(data)-pos {
+			return 0, fmt.Errorf("field %d length %d exceeds the record", i, size)
+		}
+		if fn != nil {
+			fn(i, data[pos:pos+int(size):pos+int(size)])
+		}
+		pos += int(size)
+	}
+	if pos != len(data) {
+		return 0, fmt.Errorf("%d bytes after the last field", len(data)-pos)
+	}
+	return int(count), nil
+}
+
+// checkRecord 检查 B+ 树中的记录，不分配内存；树中的记录至少有一个字段（key）
+func checkRecord(data []byte) error {
+	count, err := walkRecord(data, nil)
+	if err != nil {
+		return err
+	}
+	if count < 1 {
+		return fmt.Errorf("invalid field count %d in a record of %d bytes", count, len(data))
 	}
-	return row, nil
+	return nil
 }
@@ -46,3 +46,26 @@ func TestEncodeDecodeRow(t *testing.T) {
 		})
 	}
 }
+
+func TestEncodeDecodeRowWithNulls(t *testing.T) {
+	row := []string{"1", "", "", "x"}
+	nulls := []bool{false, true, false, false}
+
+	encoded, err := EncodeRowWithNulls(row, nulls)
+	if err != nil {
+		t.Fatalf("EncodeRowWithNulls failed: %v", err)
+	}
+	decoded, decodedNulls, err := DecodeRowWithNulls(encoded)
+	if err != nil {
+		t.Fatalf("DecodeRowWithNulls failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, row) || !reflect.DeepEqual(decodedNulls, nulls) {
+		t.Errorf("decoded %v %v, want %v %v", decoded, decodedNulls, row, nulls)
+	}
+
+	// NULL 与空串编码不同
+	plain, _ := EncodeRow(row)
+	if reflect.DeepEqual(plain, encoded) {
+		t.Errorf("NULL field encoded the same as empty string")
+	}
+}
@@ -0,0 +1,506 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+/*
+影子分页模式：回滚日志之外的另一种提交方式，打开时用 Options.Shadow 选择。
+
+B+ 树等上层看到的页号（逻辑页）通过页表映射到文件中的物理页。
+改写一个逻辑页时把新内容写到一个空闲的物理页，旧的物理页保持不变；
+提交时把改过的页表页也写到新的物理页，Sync 之后再写 meta 页，
+写 meta 页就是提交点。崩溃时没写完的 meta 页校验失败，打开时用另一个。
+
+物理页 1 和 2 是两个 meta 页，轮流写入，事务号大且校验通过的是当前版本：
+
+| 字节位置  | 内容                         |
+| --------- | ---------------------------- |
+| 0-7       | 魔数 "mydbshd1"              |
+| 8-15      | 事务号                       |
+| 16-19     | 逻辑页数                     |
+| 20-21     | 页表页数 n                   |
+| 22        | 标志，见 checksum.go 和 crypt.go |
+| 23        | 保留                         |
+| 24+       | n 个页表页的物理页号         |
+| 之后 29 字节 | 加密参数，只有加密的文件才有 |
+| 最后 4 字节 | 前面内容的 CRC32            |
+
+每个页表页存放 1024 个逻辑页对应的物理页号，0 表示还没有写过。
+meta 页不加密，也不带页校验和，其他物理页与回滚日志模式下的页一样。
+压缩的文件中，页表和 meta 页中的物理页号换成一段块的位置，见 compress.go。
+
+已提交版本的页表在内存中不再修改，快照直接引用它，所以快照能一直读到旧版本。
+提交时被替换的物理页要等到所有更早的快照都关闭、并且又完成一次提交之后才放回空闲列表。
+写完 meta 页之后的 Sync 失败时不知道提交是否生效，两个版本的页都不能复用，
+这个 Pager 在重新打开之前拒绝所有写操作（ErrCommitUnknown）。
+空闲的物理页只记在内存中，打开文件时根据页表重新计算。
+*/
+
+const shadowMagic = "mydbshd1"
+
+// ErrCommitUnknown 表示提交的最后一次 Sync 失败，不知道提交是否生效，重新打开数据库之前不能再写
+var ErrCommitUnknown = errors.New("commit result unknown, reopen the database")
+
+const (
+	shadowMetaPages = 2
+	tableEntries    = PageSize / 4
+	shadowMaxTables = (PageSize - 28) / 4
+)
+
+type shadowState struct {
+	txid      uint64
+	slot      int      // 当前版本所在的 meta 页（1 或 2）
+	table     []uint32 // 已提交版本的页表，下标为逻辑页号减一，提交后不再修改
+	dir       []uint32 // 已提交页表所在的物理页
+	inTx      bool
+	pending   map[int]uint32 // 还没有提交的逻辑页 -> 新的物理页
+	free      []uint32       // 可以复用的物理页
+	physPages int            // 文件中的物理页数
+	retired   []retiredPages
+
+	// 压缩的文件中每块是否已经分配，物理位置是一段块，见 compress.go
+	blocks []bool
+	cursor int
+}
+
+// retiredPages 是事务 txid 提交时被替换掉的物理页，它们属于快照版本 version 及更早的版本
+type retiredPages struct {
+	txid    uint64
+	version uint64
+	pages   []uint32
+}
+
+// Options 是打开数据库文件的选项
+type Options struct {
+	// Shadow 让新建的数据库使用影子分页模式，已有的文件按文件格式决定
+	Shadow bool
+	// Checksums 让新建的数据库给每页加上校验和（见 checksum.go），已有的文件按文件头决定
+	Checksums bool
+	// Passphrase 或 Key 让新建的数据库加密（见 crypt.go），打开加密的数据库时必须提供其中之一。
+	// Key 是应用提供的 16、24 或 32 字节的 AES 密钥，Passphrase 经 PBKDF2 导出密钥
+	Passphrase string
+	Key        []byte
+	// KDFIterations 是新建数据库时 PBKDF2 的迭代次数，0 表示 DefaultKDFIterations
+	KDFIterations int
+	// Compress 让新建的数据库压缩每一页（见 compress.go），必须与 Shadow 一起使用
+	Compress bool
+	// VFS 是存放数据库文件和日志的存储（见 vfs.go），nil 表示操作系统的文件
+	VFS VFS
+
+	cipher *pageCipher // 用已有数据库的密钥新建文件，见 FormatOptions
+}
+
+// ShadowPaging 返回是否使用影子分页模式
+func (p *Pager) ShadowPaging() bool {
+	return p.shadow != nil
+}
+
+// isShadowFile 判断文件是否是影子分页格式
+func isShadowFile(f File) (bool, error) {
+	buf := make([]byte, len(shadowMagic))
+	if _, err := f.ReadAt(buf, 0); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	return string(buf) == shadowMagic, nil
+}
+
+type shadowMeta struct {
+	txid    uint64
+	logical int
+	dir     []uint32
+	flags   byte
+	crypt   []byte // 加密参数，见 crypt.go
+}
+
+func encodeMeta(m shadowMeta) []byte {
+	buf := make([]byte, PageSize)
+	copy(buf, shadowMagic)
+	binary.LittleEndian.PutUint64(buf[8:], m.txid)
+	binary.LittleEndian.PutUint32(buf[16:], uint32(m.logical))
+	binary.LittleEndian.PutUint16(buf[20:], uint16(len(m.dir)))
+	buf[22] = m.flags
+	for i, phys := range m.dir {
+		binary.LittleEndian.PutUint32(buf[24+4*i:], phys)
+	}
+	copy(buf[24+4*len(m.dir):], m.crypt)
+	binary.LittleEndian.PutUint32(buf[PageSize-4:], crc32.ChecksumIEEE(buf[:PageSize-4]))
+	return buf
+}
+
+func decodeMeta(buf []byte) (m shadowMeta, ok bool) {
+	if len(buf) != PageSize || string(buf[:8]) != shadowMagic {
+		return m, false
+	}
+	if crc32.ChecksumIEEE(buf[:PageSize-4]) != binary.LittleEndian.Uint32(buf[PageSize-4:]) {
+		return m, false
+	}
+	n := int(binary.LittleEndian.Uint16(buf[20:]))
+	m.flags = buf[22]
+	if n > maxTables(m.flags) {
+		return m, false
+	}
+	m.dir = make([]uint32, n)
+	for i := range m.dir {
+		m.dir[i] = binary.LittleEndian.Uint32(buf[24+4*i:])
+	}
+	if m.flags&flagEncrypted != 0 {
+		m.crypt = buf[24+4*n : 24+4*n+cryptParamsSize]
+	}
+	m.txid = binary.LittleEndian.Uint64(buf[8:])
+	m.logical = int(binary.LittleEndian.Uint32(buf[16:]))
+	return m, true
+}
+
+// maxTables 返回 meta 页中能放下的页表页数，加密参数跟在页表页号后面
+func maxTables(flags byte) int {
+	if flags&flagEncrypted != 0 {
+		return shadowMaxTables - (cryptParamsSize+3)/4
+	}
+	return shadowMaxTables
+}
+
+func (f *pagerFile) readPhys(phys uint32) ([]byte, error) {
+	if f.compress != nil {
+		return f.readExtent(phys)
+	}
+	return f.readRaw(int(phys))
+}
+
+func (f *pagerFile) writePhys(phys uint32, data []byte) error {
+	return f.writeRaw(int(phys), data)
+}
+
+// readMeta 读 meta 页，meta 页不加密，不检查页尾的校验和，meta 页的 CRC 由 decodeMeta 检查
+func (f *pagerFile) readMeta(slot int) ([]byte, error) {
+	buf := make([]byte, PageSize)
+	_, err := f.file.ReadAt(buf, f.pageOffset(slot))
+	return buf, err
+}
+
+// writeMeta 写 meta 页，页尾不写校验和
+func (f *pagerFile) writeMeta(slot int, meta []byte) error {
+	buf := make([]byte, f.pageStride())
+	copy(buf, meta)
+	_, err := f.file.WriteAt(buf, f.pageOffset(slot))
+	return err
+}
+
+// encodeMeta 生成事务 txid 的 meta 页
+func (f *pagerFile) encodeMeta(txid uint64, logical int, dir []uint32) []byte {
+	return encodeMeta(shadowMeta{txid: txid, logical: logical, dir: dir, flags: f.fileFlags(), crypt: f.cryptHeader()})
+}
+
+// shadowFlags 从 meta 页读出标志和加密参数。meta 页 1 写坏时，
+// meta 页 2 的位置取决于每页的大小，每个可能的位置都试一下，标志要与位置一致。
+func shadowFlags(file File) (byte, []byte, error) {
+	buf := make([]byte, PageSize)
+	for _, off := range []int64{0, PageSize, PageSize + checksumSize, PageSize + cryptReserve} {
+		if _, err := file.ReadAt(buf, off); err != nil && !errors.Is(err, io.EOF) {
+			return 0, nil, err
+		}
+		if m, ok := decodeMeta(buf); ok && (off == 0 || off == flagsStride(m.flags)) {
+			return m.flags, m.crypt, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("no valid meta page in shadow paging file")
+}
+
+// currentMeta 读出两个 meta 页中有效且事务号最大的一个
+func (f *pagerFile) currentMeta() (slot int, txid uint64, logical int, dir []uint32, err error) {
+	for i := 1; i <= shadowMetaPages; i++ {
+		buf, err := f.readMeta(i)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, 0, 0, nil, err
+		}
+		if m, ok := decodeMeta(buf); ok && (slot == 0 || m.txid > txid) {
+			slot, txid, logical, dir = i, m.txid, m.logical, m.dir
+		}
+	}
+	if slot == 0 {
+		return 0, 0, 0, nil, fmt.Errorf("no valid meta page in shadow paging file")
+	}
+	return slot, txid, logical, dir, nil
+}
+
+// initShadow 在空文件中建立影子分页格式：逻辑页 1 是空的页 1，版本号为 1
+func (f *pagerFile) initShadow() error {
+	f.shadow = f.newShadowState(0)
+	defer func() { f.shadow = nil }()
+	page1 := make([]byte, PageSize)
+	copy(page1[fileHeaderOffset:], fileHeaderMagic)
+	phys, err := f.writeNew(page1)
+	if err != nil {
+		return err
+	}
+	table := make([]byte, PageSize)
+	binary.LittleEndian.PutUint32(table, phys)
+	if phys, err = f.writeNew(table); err != nil {
+		return err
+	}
+	if err := f.writeMeta(2, make([]byte, PageSize)); err != nil {
+		return err
+	}
+	if err := f.file.Sync(); err != nil {
+		return err
+	}
+	if err := f.writeMeta(1, f.encodeMeta(1, 1, []uint32{phys})); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+// newShadowState 返回文件长 size 字节时的分配状态，物理页或块都还没有使用
+func (f *pagerFile) newShadowState(size int64) *shadowState {
+	if f.compress == nil {
+		return &shadowState{physPages: max(f.pagesIn(size), shadowMetaPages)}
+	}
+	blocks := make([]bool, max(int((size+blockSize-1)/blockSize), metaBlocks))
+	for i := 0; i < metaBlocks; i++ {
+		blocks[i] = true
+	}
+	return &shadowState{blocks: blocks, cursor: metaBlocks}
+}
+
+// loadShadow 从文件读出当前版本的页表，并重新计算空闲的物理页
+func (f *pagerFile) loadShadow() error {
+	slot, txid, logical, dir, err := f.currentMeta()
+	if err != nil {
+		return err
+	}
+	size, err := f.file.Size()
+	if err != nil {
+		return err
+	}
+	s := f.newShadowState(size)
+	s.txid, s.slot, s.dir = txid, slot, dir
+	if f.compress != nil {
+		f.compress.clearCache()
+	}
+	used := map[uint32]bool{}
+	for _, phys := range dir {
+		if !s.claim(phys, used) {
+			return fmt.Errorf("invalid page table page %d", phys)
+		}
+		buf, err := f.readPhys(phys)
+		if err != nil {
+			return fmt.Errorf("read page table page %d: %w", phys, err)
+		}
+		for i := 0; i < tableEntries && len(s.table) < logical; i++ {
+			s.table = append(s.table, binary.LittleEndian.Uint32(buf[4*i:]))
+		}
+	}
+	for len(s.table) < logical {
+		s.table = append(s.table, 0)
+	}
+	for lp, phys := range s.table {
+		if phys == 0 {
+			continue
+		}
+		if !s.claim(phys, used) {
+			return fmt.Errorf("page %d maps to invalid physical page %d", lp+1, phys)
+		}
+	}
+	for phys := uint32(shadowMetaPages + 1); s.blocks == nil && int(phys) <= s.physPages; phys++ {
+		if !used[phys] {
+			s.free = append(s.free, phys)
+		}
+	}
+	f.shadow = s
+	f.nextPage = max(logical, 1) + 1
+	return nil
+}
+
+// lookup 返回逻辑页当前对应的物理页，0 表示还没有写过
+func (s *shadowState) lookup(pageNum int) uint32 {
+	if phys, ok := s.pending[pageNum]; ok {
+		return phys
+	}
+	return tableLookup(s.table, pageNum)
+}
+
+func tableLookup(table []uint32, pageNum int) uint32 {
+	if pageNum > len(table) {
+		return 0
+	}
+	return table[pageNum-1]
+}
+
+// claim 在打开文件时标记已提交版本用到的物理页，物理页无效或者已经用过时返回 false
+func (s *shadowState) claim(phys uint32, used map[uint32]bool) bool {
+	if s.blocks != nil {
+		return s.claimExtent(phys)
+	}
+	if phys <= shadowMetaPages || int(phys) > s.physPages || used[phys] {
+		return false
+	}
+	used[phys] = true
+	return true
+}
+
+func (s *shadowState) allocPhys() uint32 {
+	if n := len(s.free); n > 0 {
+		phys := s.free[n-1]
+		s.free = s.free[:n-1]
+		return phys
+	}
+	s.physPages++
+	return uint32(s.physPages)
+}
+
+// release 把不再使用的物理页放回空闲列表，压缩的文件中释放对应的块
+func (s *shadowState) release(phys ...uint32) {
+	if s.blocks == nil {
+		s.free = append(s.free, phys...)
+		return
+	}
+	for _, addr := range phys {
+		block, blocks := extentBlocks(addr)
+		for i := block; i < block+blocks; i++ {
+			s.blocks[i] = false
+		}
+	}
+}
+
+// writeNew 把一页写到新分配的物理页，压缩的文件中写到新分配的一段块
+func (f *pagerFile) writeNew(data []byte) (uint32, error) {
+	if f.compress != nil {
+		return f.writeExtent(data)
+	}
+	phys := f.shadow.allocPhys()
+	if err := f.writePhys(phys, data); err != nil {
+		f.shadow.release(phys)
+		return 0, err
+	}
+	return phys, nil
+}
+
+// shadowWrite 把逻辑页写到新的物理页，提交之前已提交的版本不受影响
+func (f *pagerFile) shadowWrite(pageNum int, data []byte) error {
+	s := f.shadow
+	if s.pending == nil {
+		s.pending = map[int]uint32{}
+	}
+	// 同一事务中再次改写的页还没有提交，可以直接覆盖；压缩之后大小会变，要重新分配
+	old, ok := s.pending[pageNum]
+	if ok && f.compress == nil {
+		return f.writePhys(old, data)
+	}
+	phys, err := f.writeNew(data)
+	if err != nil {
+		return err
+	}
+	if ok {
+		s.release(old)
+	}
+	s.pending[pageNum] = phys
+	return nil
+}
+
+// commitShadow 写出改过的页表页，Sync 之后写另一个 meta 页完成提交
+func (f *pagerFile) commitShadow() error {
+	s := f.shadow
+	logical := f.nextPage - 1
+	if len(s.pending) == 0 && logical == len(s.table) {
+		return nil
+	}
+	table := make([]uint32, logical)
+	copy(table, s.table)
+	var replaced []uint32
+	// Truncate 截掉的页
+	for _, phys := range s.table[min(logical, len(s.table)):] {
+		if phys != 0 {
+			replaced = append(replaced, phys)
+		}
+	}
+	changed := map[int]bool{}
+	for pageNum, phys := range s.pending {
+		if old := table[pageNum-1]; old != 0 {
+			replaced = append(replaced, old)
+		}
+		table[pageNum-1] = phys
+		changed[(pageNum-1)/tableEntries] = true
+	}
+	dir := make([]uint32, (len(table)+tableEntries-1)/tableEntries)
+	if len(dir) > maxTables(f.fileFlags()) {
+		return fmt.Errorf("database too large for shadow paging: %d pages", len(table))
+	}
+	copy(dir, s.dir)
+	if len(s.dir) > len(dir) {
+		replaced = append(replaced, s.dir[len(dir):]...)
+	}
+	var written []uint32
+	for i := range dir {
+		if dir[i] != 0 && !changed[i] {
+			continue
+		}
+		buf := make([]byte, PageSize)
+		for j := 0; j < tableEntries && i*tableEntries+j < len(table); j++ {
+			binary.LittleEndian.PutUint32(buf[4*j:], table[i*tableEntries+j])
+		}
+		phys, err := f.writeNew(buf)
+		if err != nil {
+			s.release(written...)
+			return err
+		}
+		written = append(written, phys)
+		if dir[i] != 0 {
+			replaced = append(replaced, dir[i])
+		}
+		dir[i] = phys
+	}
+	slot := shadowMetaPages + 1 - s.slot
+	err := f.file.Sync()
+	if err == nil {
+		err = f.writeMeta(slot, f.encodeMeta(s.txid+1, len(table), dir))
+	}
+	if err != nil {
+		// meta 页可能已经写了一部分，另一个 meta 页仍然有效；新写的页表页作废
+		s.release(written...)
+		return err
+	}
+	if err := f.file.Sync(); err != nil {
+		// 新的 meta 页可能已经在磁盘上，也可能没有，它引用的页表页和数据页都不能再分配；
+		// 不知道哪个版本有效，重新打开之前不再写，见 failed
+		f.failed = fmt.Errorf("%w: %v", ErrCommitUnknown, err)
+		s.pending = nil
+		return f.failed
+	}
+	s.txid++
+	s.slot = slot
+	s.table, s.dir, s.pending = table, dir, nil
+	s.retired = append(s.retired, retiredPages{txid: s.txid, version: f.version, pages: replaced})
+	return nil
+}
+
+// rollbackShadow 丢掉还没有提交的页，它们的物理页直接复用
+func (f *pagerFile) rollbackShadow() {
+	s := f.shadow
+	for _, phys := range s.pending {
+		s.release(phys)
+	}
+	s.pending = nil
+	s.inTx = false
+	f.nextPage = f.txPages + 1
+}
+
+// reclaim 把不再需要的旧物理页放回空闲列表。除了快照不再引用之外，
+// 还要等下一次提交完成：在那之前另一个 meta 页还指向它们，新 meta 页写坏时要靠它恢复。
+func (s *shadowState) reclaim(oldest uint64, anySnapshot bool) {
+	i := 0
+	for ; i < len(s.retired); i++ {
+		r := s.retired[i]
+		if r.txid >= s.txid || anySnapshot && r.version >= oldest {
+			break
+		}
+		s.release(r.pages...)
+	}
+	s.retired = s.retired[i:]
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"errors"
+	"io"
+)
+
+/*
+快照让读者看到某个已提交版本的数据库，写者可以同时提交新的版本。
+
+每次提交（Commit，或者事务之外的一次 WritePage）把版本号加一。
+写页之前，如果有快照可能还要读这一页的旧内容（有快照打开，或者正在事务中），
+就把旧内容连同当前的已提交版本号保存到 history 中；同一页在一个版本内只保存一次。
+快照读页时，取该页第一个版本号不小于快照版本的旧内容，没有就说明
+快照之后这一页没有被改过，直接读文件。
+
+快照关闭或者提交时，丢掉所有快照都用不到的旧页。旧页只保存在内存中，
+长时间打开的快照会让内存随写入量增长。影子分页模式下旧页本来就留在文件中，
+快照只需要记住当时的页表，见 shadow.go。
+*/
+
+var ErrReadOnly = errors.New("pager is a read-only snapshot")
+
+type pageVersion struct {
+	version uint64 // 这一内容对应的已提交版本
+	data    []byte
+}
+
+type snapshot struct {
+	version uint64
+	pages   int      // 快照版本中的页数
+	table   []uint32 // 影子分页模式下快照版本的页表，见 shadow.go
+}
+
+// Snapshot 返回当前已提交版本的只读快照，它和 p 共用同一个文件。
+// 快照持有读锁，其他进程在它关闭之前不能写；同一个 Pager 仍然可以写。
+// 快照上的写操作返回 ErrReadOnly，用完之后调用 Close 释放。
+func (p *Pager) Snapshot() (*Pager, error) {
+	return p.snapshotWith(nil)
+}
+
+// snapshotWith 打开快照，fn 不为 nil 时在持有 p.mu 的同时调用，看到的状态与快照一致
+func (p *Pager) snapshotWith(fn func()) (*Pager, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readers++
+	if err := p.waitLock(LockShared, true); err != nil {
+		p.readers--
+		p.release()
+		return nil, err
+	}
+	s := &snapshot{version: p.version, pages: p.committedPages()}
+	if p.shadow != nil {
+		s.table = p.shadow.table
+	}
+	if p.snap != nil {
+		*s = *p.snap
+	}
+	if p.snapshots == nil {
+		p.snapshots = map[*snapshot]bool{}
+	}
+	p.snapshots[s] = true
+	if fn != nil {
+		fn()
+	}
+	return &Pager{pagerFile: p.pagerFile, snap: s}, nil
+}
+
+// committedPages 返回最近一次提交时的页数，事务中新分配的页不算
+func (f *pagerFile) committedPages() int {
+	if f.inTx() {
+		return f.txPages
+	}
+	return f.nextPage - 1
+}
+
+// readVersion 在 history 中查找快照能看到的旧页，没有就说明应该直接读文件
+func (f *pagerFile) readVersion(s *snapshot, pageNum int) ([]byte, bool) {
+	for _, v := range f.history[pageNum] {
+		if v.version >= s.version {
+			return append([]byte(nil), v.data...), true
+		}
+	}
+	return nil, false
+}
+
+// saveVersion 在覆盖一页之前保存它的已提交内容
+func (p *Pager) saveVersion(pageNum int) error {
+	if !p.inTx() && len(p.snapshots) == 0 {
+		return nil
+	}
+	// 新分配的页不在任何已提交版本中
+	if pageNum > p.committedPages() {
+		return nil
+	}
+	versions := p.history[pageNum]
+	if n := len(versions); n > 0 && versions[n-1].version == p.version {
+		return nil
+	}
+	data, err := p.readPage(pageNum)
+	if errors.Is(err, io.EOF) {
+		// 分配之后还没有写过的页，不在任何已提交版本中
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if p.history == nil {
+		p.history = map[int][]pageVersion{}
+	}
+	p.history[pageNum] = append(versions, pageVersion{version: p.version, data: data})
+	return nil
+}
+
+// commitVersion 在一次提交之后调用
+func (f *pagerFile) commitVersion() {
+	f.version++
+	f.pruneHistory()
+}
+
+func (f *pagerFile) releaseSnapshot(s *snapshot) {
+	delete(f.snapshots, s)
+	f.pruneHistory()
+}
+
+// pruneHistory 丢掉版本号小于最老快照的旧页；事务中保存的旧页要留到提交。
+// 影子分页模式下没有 history，把快照不再引用的物理页放回空闲列表。
+func (f *pagerFile) pruneHistory() {
+	oldest := f.version
+	for s := range f.snapshots {
+		oldest = min(oldest, s.version)
+	}
+	if f.shadow != nil {
+		f.shadow.reclaim(oldest, len(f.snapshots) > 0)
+		return
+	}
+	if f.inTx() {
+		return
+	}
+	if len(f.snapshots) == 0 {
+		f.history = nil
+		return
+	}
+	for pageNum, versions := range f.history {
+		i := 0
+		for i < len(versions) && versions[i].version < oldest {
+			i++
+		}
+		if i == len(versions) {
+			delete(f.history, pageNum)
+		} else {
+			f.history[pageNum] = versions[i:]
+		}
+	}
+}
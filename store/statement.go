@@ -0,0 +1,133 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+/*
+语句保存点让事务中的一条语句成为原子的：语句出错时只撤销这条语句的修改，
+事务中之前的修改保留。
+
+BeginStatement 记下当时的页数，之后语句中第一次改写（或截掉）一个已有的页之前，
+把它当时的内容保存在内存中。RollbackStatement 把保存的内容写回，
+再截掉语句中新分配的页；空闲链表和文件头都在页中，跟着一起恢复。
+写回也是事务中的普通写页，回滚日志和影子分页两种模式下都由事务的提交或回滚处理。
+
+保存点可以嵌套，内层语句结束时把它保存的页交给外层，外层回滚时仍然能恢复这些页。
+事务提交或回滚时丢掉所有保存点。
+*/
+
+type statement struct {
+	nextPage int            // 语句开始时的 nextPage
+	pages    map[int][]byte // 语句开始时的页内容，nil 表示那时还没有写过
+}
+
+// BeginStatement 在当前事务中开始一个语句保存点
+func (p *Pager) BeginStatement() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.snap != nil {
+		return ErrReadOnly
+	}
+	if !p.inTx() {
+		return ErrNoTransaction
+	}
+	p.stmts = append(p.stmts, &statement{nextPage: p.nextPage, pages: map[int][]byte{}})
+	return nil
+}
+
+// ReleaseStatement 结束最近的语句保存点，保留语句的修改
+func (p *Pager) ReleaseStatement() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.popStatement()
+	return err
+}
+
+// RollbackStatement 撤销最近的语句保存点之后的所有修改并结束这个保存点
+func (p *Pager) RollbackStatement() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, err := p.popStatement()
+	if err != nil {
+		return err
+	}
+	pages := make([]int, 0, len(s.pages))
+	for pageNum := range s.pages {
+		pages = append(pages, pageNum)
+	}
+	sort.Ints(pages)
+	for _, pageNum := range pages {
+		if err := p.restoreStatementPage(pageNum, s.pages[pageNum]); err != nil {
+			return fmt.Errorf("restore page %d: %w", pageNum, err)
+		}
+	}
+	if p.nextPage > s.nextPage {
+		return p.truncate(s.nextPage - 1)
+	}
+	p.nextPage = s.nextPage
+	return nil
+}
+
+// popStatement 取出最近的保存点，它保存的页交给外层保存点
+func (p *Pager) popStatement() (*statement, error) {
+	if p.snap != nil {
+		return nil, ErrReadOnly
+	}
+	n := len(p.stmts)
+	if n == 0 {
+		return nil, fmt.Errorf("no statement is active")
+	}
+	s := p.stmts[n-1]
+	p.stmts = p.stmts[:n-1]
+	if n > 1 {
+		outer := p.stmts[n-2]
+		for pageNum, data := range s.pages {
+			if _, ok := outer.pages[pageNum]; !ok && pageNum < outer.nextPage {
+				outer.pages[pageNum] = data
+			}
+		}
+	}
+	return s, nil
+}
+
+// saveStatementPage 在语句中第一次改写一个已有的页之前保存它的内容
+func (p *Pager) saveStatementPage(pageNum int) error {
+	n := len(p.stmts)
+	if n == 0 {
+		return nil
+	}
+	s := p.stmts[n-1]
+	if _, ok := s.pages[pageNum]; ok || pageNum >= s.nextPage {
+		return nil
+	}
+	data, err := p.readPage(pageNum)
+	if errors.Is(err, io.EOF) {
+		s.pages[pageNum] = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.pages[pageNum] = append([]byte(nil), data...)
+	return nil
+}
+
+// restoreStatementPage 把一页恢复成语句开始时的内容
+func (p *Pager) restoreStatementPage(pageNum int, data []byte) error {
+	if data != nil {
+		return p.writePage(pageNum, data)
+	}
+	// 分配之后还没有写过的页：影子分页模式下去掉新的映射，回滚日志模式下写成全 0
+	if p.shadow != nil {
+		if phys, ok := p.shadow.pending[pageNum]; ok {
+			p.shadow.release(phys)
+			delete(p.shadow.pending, pageNum)
+		}
+		return nil
+	}
+	return p.writeRaw(pageNum, make([]byte, PageSize))
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+)
+
+/*
+VFS 是 Pager 使用的存储，打开时用 Options.VFS 选择，默认是操作系统的文件（OSVFS）。
+数据库文件、回滚日志和 VACUUM 的临时文件都通过同一个 VFS 打开：
+
+  - OSVFS：操作系统的文件，Linux 上用 open file description 锁，见 lock_linux.go；
+  - MemVFS：全部在内存中的文件，锁也在内存中，用于测试和 :memory: 数据库，见 vfs_mem.go；
+  - FaultVFS：包装另一个 VFS，在指定的写或 Sync 时返回错误、只写一半或者模拟崩溃，
+    见 vfs_fault.go。
+
+File.Lock 给文件中的一段字节加读锁或写锁（见 lock.go 中锁的位置），
+与其他打开的 File 冲突时立即返回 ErrBusy，同一个 File 重复加锁时改变锁的类型。
+*/
+
+// VFS 打开、删除文件和查询文件大小
+type VFS interface {
+	// Open 打开文件用于读写，文件不存在时创建
+	Open(name string) (File, error)
+	// Remove 删除文件，文件不存在时返回的错误满足 errors.Is(err, fs.ErrNotExist)
+	Remove(name string) error
+	// Stat 返回文件的大小，文件不存在时返回的错误满足 errors.Is(err, fs.ErrNotExist)
+	Stat(name string) (int64, error)
+}
+
+// File 是 VFS 中打开的文件
+type File interface {
+	ReadAt(p []byte, off int64) (int, error)
+	WriteAt(p []byte, off int64) (int, error)
+	Sync() error
+	Truncate(size int64) error
+	Size() (int64, error)
+	Lock(typ LockType, start, length int64) error
+	Close() error
+}
+
+// LockType 是 File.Lock 加的锁
+type LockType int
+
+const (
+	ReadLock LockType = iota
+	WriteLock
+	Unlock
+)
+
+// OSVFS 是操作系统的文件系统
+type OSVFS struct{}
+
+func (OSVFS) Open(name string) (File, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return osFile{f}, nil
+}
+
+func (OSVFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSVFS) Stat(name string) (int64, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+type osFile struct {
+	*os.File
+}
+
+func (f osFile) Size() (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (f osFile) Lock(typ LockType, start, length int64) error {
+	return setLock(f.File, typ, start, length)
+}
+
+// fileExists 返回 VFS 中是否有这个文件
+func fileExists(vfs VFS, name string) (bool, error) {
+	_, err := vfs.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// readFile 读出整个文件
+func readFile(vfs VFS, name string) ([]byte, error) {
+	size, err := vfs.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := vfs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data := make([]byte, size)
+	n, err := f.ReadAt(data, 0)
+	if err != nil && n < len(data) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+// VFS 返回打开这个数据库的 VFS
+func (p *Pager) VFS() VFS {
+	return p.vfs
+}
@@ -0,0 +1,270 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// FaultVFS 包装另一个 VFS，在第 N 次修改文件的操作（写、截断、Sync、删除）时注入故障，
+// 用来测试出错和崩溃之后的恢复。
+//
+// 为了模拟断电，FaultVFS 记下每个文件上次 Sync 之后的写和截断：FaultCrash 之后
+// 所有操作都失败，Restart 撤销这些没有 Sync 的修改，相当于重启之后看到的磁盘内容。
+// 创建和删除文件看作立即持久。
+type FaultVFS struct {
+	base VFS
+
+	mu      sync.Mutex
+	ops     int
+	fault   Fault
+	crashed bool
+	undo    map[string][]undoRecord // 每个文件上次 Sync 之后的修改，按时间顺序
+}
+
+// FaultKind 是注入的故障
+type FaultKind int
+
+const (
+	FaultNone FaultKind = iota
+	// FaultError 让这一次操作返回错误，文件不变，之后的操作正常
+	FaultError
+	// FaultShortWrite 让这一次写只写前一半就返回错误，其他操作与 FaultError 相同
+	FaultShortWrite
+	// FaultCrash 让这一次和之后的所有操作都失败，直到 Restart
+	FaultCrash
+)
+
+// Fault 在 SetFault 之后的第 At 次修改文件的操作（从 1 开始）时注入 Kind
+type Fault struct {
+	At   int
+	Kind FaultKind
+}
+
+var ErrInjected = errors.New("injected fault")
+
+// undoRecord 撤销一次修改：把 data 写回 off，再把文件截断为 size
+type undoRecord struct {
+	size int64
+	off  int64
+	data []byte
+}
+
+func NewFaultVFS(base VFS) *FaultVFS {
+	return &FaultVFS{base: base, undo: map[string][]undoRecord{}}
+}
+
+// SetFault 设置下一个故障，并从 0 开始重新计数
+func (v *FaultVFS) SetFault(f Fault) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.fault, v.ops = f, 0
+}
+
+// Ops 返回 SetFault 以来修改文件的操作次数
+func (v *FaultVFS) Ops() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.ops
+}
+
+// Crashed 返回是否已经发生了 FaultCrash
+func (v *FaultVFS) Crashed() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.crashed
+}
+
+// Restart 模拟重启：撤销所有没有 Sync 的修改，清除故障。
+// 调用之前应该关闭所有打开的 File。
+func (v *FaultVFS) Restart() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for name, records := range v.undo {
+		if len(records) == 0 {
+			continue
+		}
+		f, err := v.base.Open(name)
+		if err != nil {
+			return err
+		}
+		for i := len(records) - 1; i >= 0; i-- {
+			r := records[i]
+			if len(r.data) > 0 {
+				if _, err := f.WriteAt(r.data, r.off); err != nil {
+					f.Close()
+					return err
+				}
+			}
+			if err := f.Truncate(r.size); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	v.undo = map[string][]undoRecord{}
+	v.fault, v.ops, v.crashed = Fault{}, 0, false
+	return nil
+}
+
+// inject 在修改文件的操作之前调用，返回这一次要注入的故障
+func (v *FaultVFS) inject() FaultKind {
+	if v.crashed {
+		return FaultCrash
+	}
+	v.ops++
+	if v.fault.Kind == FaultNone || v.ops != v.fault.At {
+		return FaultNone
+	}
+	if v.fault.Kind == FaultCrash {
+		v.crashed = true
+	}
+	return v.fault.Kind
+}
+
+func (v *FaultVFS) injected(op string, kind FaultKind) error {
+	if kind == FaultCrash {
+		return fmt.Errorf("%s: %w (crashed)", op, ErrInjected)
+	}
+	return fmt.Errorf("%s: %w", op, ErrInjected)
+}
+
+func (v *FaultVFS) Open(name string) (File, error) {
+	v.mu.Lock()
+	crashed := v.crashed
+	v.mu.Unlock()
+	if crashed {
+		return nil, v.injected("open", FaultCrash)
+	}
+	f, err := v.base.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: f, v: v, name: name}, nil
+}
+
+func (v *FaultVFS) Remove(name string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if kind := v.inject(); kind != FaultNone {
+		return v.injected("remove", kind)
+	}
+	delete(v.undo, name)
+	return v.base.Remove(name)
+}
+
+func (v *FaultVFS) Stat(name string) (int64, error) {
+	v.mu.Lock()
+	crashed := v.crashed
+	v.mu.Unlock()
+	if crashed {
+		return 0, v.injected("stat", FaultCrash)
+	}
+	return v.base.Stat(name)
+}
+
+type faultFile struct {
+	File
+	v    *FaultVFS
+	name string
+}
+
+func (f *faultFile) crashed() error {
+	if f.v.Crashed() {
+		return f.v.injected("read", FaultCrash)
+	}
+	return nil
+}
+
+func (f *faultFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.crashed(); err != nil {
+		return 0, err
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func (f *faultFile) Size() (int64, error) {
+	if err := f.crashed(); err != nil {
+		return 0, err
+	}
+	return f.File.Size()
+}
+
+func (f *faultFile) Lock(typ LockType, start, length int64) error {
+	// 崩溃之后仍然可以解锁，关闭连接时要释放锁
+	if typ != Unlock {
+		if err := f.crashed(); err != nil {
+			return err
+		}
+	}
+	return f.File.Lock(typ, start, length)
+}
+
+// remember 记下 [off, off+n) 原来的内容，Restart 时写回
+func (f *faultFile) remember(off, n int64) error {
+	size, err := f.File.Size()
+	if err != nil {
+		return err
+	}
+	r := undoRecord{size: size, off: off}
+	if off < size {
+		r.data = make([]byte, min(n, size-off))
+		if _, err := f.File.ReadAt(r.data, off); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+	}
+	f.v.undo[f.name] = append(f.v.undo[f.name], r)
+	return nil
+}
+
+func (f *faultFile) WriteAt(p []byte, off int64) (int, error) {
+	f.v.mu.Lock()
+	defer f.v.mu.Unlock()
+	kind := f.v.inject()
+	switch kind {
+	case FaultError, FaultCrash:
+		return 0, f.v.injected("write", kind)
+	}
+	if err := f.remember(off, int64(len(p))); err != nil {
+		return 0, err
+	}
+	if kind == FaultShortWrite {
+		n, _ := f.File.WriteAt(p[:len(p)/2], off)
+		return n, f.v.injected("write", kind)
+	}
+	return f.File.WriteAt(p, off)
+}
+
+func (f *faultFile) Truncate(size int64) error {
+	f.v.mu.Lock()
+	defer f.v.mu.Unlock()
+	if kind := f.v.inject(); kind != FaultNone {
+		return f.v.injected("truncate", kind)
+	}
+	old, err := f.File.Size()
+	if err != nil {
+		return err
+	}
+	if err := f.remember(size, max(old-size, 0)); err != nil {
+		return err
+	}
+	return f.File.Truncate(size)
+}
+
+// Sync 之后这个文件之前的修改不会再因为崩溃丢失
+func (f *faultFile) Sync() error {
+	f.v.mu.Lock()
+	defer f.v.mu.Unlock()
+	if kind := f.v.inject(); kind != FaultNone {
+		return f.v.injected("sync", kind)
+	}
+	if err := f.File.Sync(); err != nil {
+		return err
+	}
+	delete(f.v.undo, f.name)
+	return nil
+}
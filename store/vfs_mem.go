@@ -0,0 +1,189 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// MemVFS 把文件保存在内存中，同一个 MemVFS 中打开同一个名字得到同一个文件。
+// 锁也在内存中实现，同一个文件的多个 Pager 之间的互斥与操作系统的文件相同。
+// 删除文件之后已经打开的 File 仍然可以使用，再次打开时是一个新的空文件。
+type MemVFS struct {
+	mu    sync.Mutex
+	files map[string]*memData
+}
+
+func NewMemVFS() *MemVFS {
+	return &MemVFS{files: map[string]*memData{}}
+}
+
+type memData struct {
+	mu    sync.Mutex
+	data  []byte
+	locks map[int64]*byteLock // 加了锁的字节
+}
+
+// byteLock 是一个字节上的锁：多个读者，或者一个写者
+type byteLock struct {
+	readers map[*memFile]bool
+	writer  *memFile
+}
+
+type memFile struct {
+	d      *memData
+	closed bool
+}
+
+func (v *MemVFS) Open(name string) (File, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	d, ok := v.files[name]
+	if !ok {
+		d = &memData{locks: map[int64]*byteLock{}}
+		v.files[name] = d
+	}
+	return &memFile{d: d}, nil
+}
+
+func (v *MemVFS) Remove(name string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(v.files, name)
+	return nil
+}
+
+func (v *MemVFS) Stat(name string) (int64, error) {
+	v.mu.Lock()
+	d, ok := v.files[name]
+	v.mu.Unlock()
+	if !ok {
+		return 0, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return int64(len(d.data)), nil
+}
+
+var errClosed = fmt.Errorf("file already closed")
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.d.mu.Lock()
+	defer f.d.mu.Unlock()
+	if f.closed {
+		return 0, errClosed
+	}
+	if off >= int64(len(f.d.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.d.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.d.mu.Lock()
+	defer f.d.mu.Unlock()
+	if f.closed {
+		return 0, errClosed
+	}
+	if end := off + int64(len(p)); end > int64(len(f.d.data)) {
+		f.d.data = append(f.d.data, make([]byte, end-int64(len(f.d.data)))...)
+	}
+	return copy(f.d.data[off:], p), nil
+}
+
+func (f *memFile) Sync() error {
+	return nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.d.mu.Lock()
+	defer f.d.mu.Unlock()
+	if f.closed {
+		return errClosed
+	}
+	if size <= int64(len(f.d.data)) {
+		f.d.data = f.d.data[:size:size]
+	} else {
+		f.d.data = append(f.d.data, make([]byte, size-int64(len(f.d.data)))...)
+	}
+	return nil
+}
+
+func (f *memFile) Size() (int64, error) {
+	f.d.mu.Lock()
+	defer f.d.mu.Unlock()
+	return int64(len(f.d.data)), nil
+}
+
+// Lock 先检查整段有没有冲突，没有冲突时再逐字节加锁，所以失败时不会只加了一部分
+func (f *memFile) Lock(typ LockType, start, length int64) error {
+	f.d.mu.Lock()
+	defer f.d.mu.Unlock()
+	locks := f.d.locks
+	if typ != Unlock {
+		for i := start; i < start+length; i++ {
+			l := locks[i]
+			if l == nil {
+				continue
+			}
+			if l.writer != nil && l.writer != f {
+				return ErrBusy
+			}
+			if typ == WriteLock && (len(l.readers) > 1 || len(l.readers) == 1 && !l.readers[f]) {
+				return ErrBusy
+			}
+		}
+	}
+	for i := start; i < start+length; i++ {
+		l := locks[i]
+		if l == nil {
+			if typ == Unlock {
+				continue
+			}
+			l = &byteLock{readers: map[*memFile]bool{}}
+			locks[i] = l
+		}
+		delete(l.readers, f)
+		if l.writer == f {
+			l.writer = nil
+		}
+		switch typ {
+		case ReadLock:
+			l.readers[f] = true
+		case WriteLock:
+			l.writer = f
+		}
+		if l.writer == nil && len(l.readers) == 0 {
+			delete(locks, i)
+		}
+	}
+	return nil
+}
+
+// Close 释放这个 File 持有的所有锁
+func (f *memFile) Close() error {
+	f.d.mu.Lock()
+	defer f.d.mu.Unlock()
+	if f.closed {
+		return errClosed
+	}
+	f.closed = true
+	for i, l := range f.d.locks {
+		delete(l.readers, f)
+		if l.writer == f {
+			l.writer = nil
+		}
+		if l.writer == nil && len(l.readers) == 0 {
+			delete(f.d.locks, i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package test
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"mySQLite/db"
+)
+
+// 执行查询并把结果转成字符串，便于比较
+func queryStrings(t *testing.T, d *db.Database, sql string) [][]string {
+	t.Helper()
+	rs, err := d.Query(sql)
+	if err != nil {
+		t.Fatalf("query %q failed: %v", sql, err)
+	}
+	out := make([][]string, len(rs.Rows))
+	for i, row := range rs.Rows {
+		out[i] = make([]string, len(row))
+		for j, v := range row {
+			out[i][j] = v.String()
+		}
+	}
+	return out
+}
+
+func assertRows(t *testing.T, d *db.Database, sql string, want [][]string) {
+	t.Helper()
+	got := queryStrings(t, d, sql)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s\n got  %v\n want %v", sql, got, want)
+	}
+}
+
+func createEmployees(t *testing.T, filename string) (*db.Database, func()) {
+	d, cleanup := createTestDB(t, filename)
+	d.Exec("CREATE TABLE emp(id INT, name TEXT, dept TEXT, salary REAL, bonus INT);")
+	d.Exec("INSERT INTO emp VALUES (1, 'ann', 'eng', 100, 10), (2, 'bob', 'eng', 80, NULL), " +
+		"(3, 'cat', 'ops', 50, 5), (4, 'dan', NULL, 30, NULL), (5, 'eve', 'ops', 70, 7);")
+	return d, cleanup
+}
+
+func TestAggregateGroupByHaving(t *testing.T) {
+	d, cleanup := createEmployees(t, "test_aggregate.db")
+	defer cleanup()
+
+	assertRows(t, d, "SELECT COUNT(*), COUNT(bonus), SUM(salary), SUM(bonus), MIN(name), MAX(salary) FROM emp;",
+		[][]string{{"5", "3", "330.0", "22", "ann", "100.0"}})
+
+	assertRows(t, d, "SELECT dept, COUNT(*) AS n, AVG(salary), GROUP_CONCAT(name) FROM emp GROUP BY dept ORDER BY dept;",
+		[][]string{
+			{"NULL", "1", "30.0", "dan"},
+			{"eng", "2", "90.0", "ann,bob"},
+			{"ops", "2", "60.0", "cat,eve"},
+		})
+
+	assertRows(t, d, "SELECT dept, SUM(bonus) AS b FROM emp GROUP BY dept HAVING COUNT(*) > 1 AND b > 10 ORDER BY 2 DESC;",
+		[][]string{{"ops", "12"}})
+
+	assertRows(t, d, "SELECT GROUP_CONCAT(name, ' / ') FROM emp WHERE dept = 'eng';",
+		[][]string{{"ann / bob"}})
+
+	assertRows(t, d, "SELECT COUNT(DISTINCT dept) FROM emp;", [][]string{{"2"}})
+}
+
+func TestAggregateNullHandling(t *testing.T) {
+	d, cleanup := createEmployees(t, "test_aggregate_null.db")
+	defer cleanup()
+
+	// 全是 NULL 或没有输入行时：COUNT 为 0，其余聚合为 NULL
+	assertRows(t, d, "SELECT COUNT(*), COUNT(bonus), SUM(bonus), AVG(bonus), MIN(bonus), MAX(bonus), GROUP_CONCAT(bonus) FROM emp WHERE bonus IS NULL;",
+		[][]string{{"2", "0", "NULL", "NULL", "NULL", "NULL", "NULL"}})
+	assertRows(t, d, "SELECT COUNT(*), SUM(salary) FROM emp WHERE id > 100;",
+		[][]string{{"0", "NULL"}})
+	// 有 GROUP BY 且没有输入行时不输出任何组
+	assertRows(t, d, "SELECT dept, COUNT(*) FROM emp WHERE id > 100 GROUP BY dept;", [][]string{})
+
+	if _, err := d.Query("SELECT name FROM emp WHERE COUNT(*) > 1;"); err == nil {
+		t.Errorf("expected error for aggregate in WHERE")
+	}
+}
+
+func TestAggregateStreamingMatchesHash(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_aggregate_stream.db")
+	defer cleanup()
+
+	d.Exec("CREATE TABLE events(k TEXT, v INT);")
+	rng := rand.New(rand.NewSource(1))
+	counts := map[string]int{}
+	for _, i := range rng.Perm(1500) {
+		k := fmt.Sprintf("key%03d", i%300)
+		counts[k]++
+		d.Exec(fmt.Sprintf("INSERT INTO events VALUES ('%s', %d);", k, i))
+	}
+
+	// GROUP BY 第一列走流式聚合（输入按 key 有序），按表达式分组走哈希聚合
+	stream := queryStrings(t, d, "SELECT k, COUNT(*), SUM(v) FROM events GROUP BY k;")
+	hash := queryStrings(t, d, "SELECT k, COUNT(*), SUM(v) FROM events GROUP BY k || '' ORDER BY k;")
+	if len(stream) != len(counts) {
+		t.Fatalf("got %d groups, want %d", len(stream), len(counts))
+	}
+	if !reflect.DeepEqual(stream, hash) {
+		t.Errorf("streaming and hash aggregation differ")
+	}
+	for _, row := range stream {
+		if row[1] != fmt.Sprint(counts[row[0]]) {
+			t.Errorf("group %s: count %s, want %d", row[0], row[1], counts[row[0]])
+		}
+	}
+}
+
+func TestAggregateStreamingNullKey(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_aggregate_null_key.db")
+	defer cleanup()
+
+	// NULL 与 '' 在表中的 key 相同，流式聚合时两组的行交错出现
+	d.Exec("CREATE TABLE t(k TEXT, v INT);")
+	d.Exec("INSERT INTO t VALUES ('', 1), (NULL, 2), ('', 3), (NULL, 4), ('a', 5);")
+	want := [][]string{{"NULL", "2", "6"}, {"", "2", "4"}, {"a", "1", "5"}}
+	assertRows(t, d, "SELECT k, COUNT(*), SUM(v) FROM t GROUP BY k ORDER BY k;", want)
+	assertRows(t, d, "SELECT k, COUNT(*), SUM(v) FROM t GROUP BY k || '' ORDER BY k;", want)
+}
@@ -0,0 +1,78 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAlterTableAddColumn(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_alter_add.db")
+	defer cleanup()
+
+	// 目录 B+ 树中 first 的记录排在 second 前面，ALTER 把它改写得更长之后
+	// second 的记录必须保持完整，重新打开之后两个表的结构和数据都不变
+	d.Exec("CREATE TABLE first(id INT, name TEXT);")
+	d.Exec("CREATE TABLE second(id INT);")
+	d.Exec("INSERT INTO first VALUES (1, 'ann'), (2, 'bob');")
+	d.Exec("INSERT INTO second VALUES (42);")
+
+	d.Exec("ALTER TABLE first ADD COLUMN score INTEGER DEFAULT 5;")
+	d.Exec("ALTER TABLE first ADD note TEXT;")
+	d.Exec("ALTER TABLE first ADD COLUMN a_rather_long_column_name_to_grow_the_catalog_row REAL DEFAULT -1.5;")
+	d.Exec("INSERT INTO first VALUES (3, 'cat', 9, 'hi', 0);")
+	d.Exec("INSERT INTO first(id, name) VALUES (4, 'dan');")
+
+	want := [][]string{
+		{"1", "ann", "5", "NULL", "-1.5"},
+		{"2", "bob", "5", "NULL", "-1.5"},
+		{"3", "cat", "9", "hi", "0.0"},
+		{"4", "dan", "5", "NULL", "-1.5"},
+	}
+	assertRows(t, d, "SELECT * FROM first;", want)
+
+	d.Exec("ALTER TABLE first ADD COLUMN name TEXT;")
+	if n := len(d.Tables["first"].Columns); n != 5 {
+		t.Errorf("duplicate column was added, table has %d columns", n)
+	}
+
+	d = reopenTestDB(t, d, "test_alter_add.db")
+	assertRows(t, d, "SELECT * FROM first;", want)
+	assertRows(t, d, "SELECT * FROM second;", [][]string{{"42"}})
+}
+
+func TestAlterTableRename(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_alter_rename.db")
+	defer cleanup()
+
+	d.Exec("CREATE TABLE people(id INT, name TEXT);")
+	d.Exec("CREATE INDEX idx_people_name ON people(name);")
+	d.Exec("CREATE TABLE pets(id INT, owner TEXT);")
+	for i := 0; i < 200; i++ {
+		d.Exec(fmt.Sprintf("INSERT INTO people VALUES (%d, 'p%d');", i, i))
+	}
+	d.Exec("INSERT INTO pets VALUES (1, 'p7'), (2, 'p9');")
+
+	d.Exec("ALTER TABLE people RENAME COLUMN name TO full_name;")
+	d.Exec("ALTER TABLE people RENAME TO persons;")
+	if _, err := d.Query("SELECT * FROM people;"); err == nil {
+		t.Errorf("old table name still usable")
+	}
+	d.Exec("ALTER TABLE pets RENAME TO persons;") // 名字已被占用，不应生效
+	if _, ok := d.Tables["pets"]; !ok {
+		t.Fatalf("rename to an existing table name should fail")
+	}
+
+	sql := "SELECT pets.id, persons.id FROM pets JOIN persons ON persons.full_name = pets.owner ORDER BY 1;"
+	want := [][]string{{"1", "7"}, {"2", "9"}}
+	assertRows(t, d, sql, want)
+
+	d = reopenTestDB(t, d, "test_alter_rename.db")
+	if idx := d.Indexes["idx_people_name"]; idx == nil || idx.Table != "persons" || idx.Column != "full_name" {
+		t.Fatalf("index metadata not updated: %+v", idx)
+	}
+	if got := explain(t, d, sql); got[1] != "SEARCH persons USING INDEX idx_people_name (full_name=?)" {
+		t.Errorf("unexpected plan %v", got)
+	}
+	assertRows(t, d, sql, want)
+	assertRows(t, d, "SELECT COUNT(*) FROM persons;", [][]string{{"200"}})
+}
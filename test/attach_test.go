@@ -0,0 +1,183 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"mySQLite/db"
+	"mySQLite/store"
+)
+
+func TestAttach(t *testing.T) {
+	mem := store.NewMemVFS()
+	d, _ := openTestDB(t, "test_attach_main.db", store.Options{VFS: mem})
+	d.Exec("CREATE TABLE orders(id INT, total INT);")
+	d.Exec("INSERT INTO orders VALUES (3, 30), (4, 40);")
+
+	d.Exec("ATTACH DATABASE 'test_attach_archive.db' AS archive;")
+	d.Exec("CREATE TABLE archive.orders(id INT, total INT);")
+	d.Exec("CREATE TABLE archive.customers(id INT, name TEXT);")
+	d.Exec("CREATE INDEX archive.orders_total ON orders(total);")
+	d.Exec("INSERT INTO archive.orders VALUES (1, 10), (2, 20), (5, 50);")
+	d.Exec("INSERT INTO customers VALUES (1, 'ann');")
+	d.Exec("DELETE FROM archive.orders WHERE id = '5';")
+	d.Exec("ALTER TABLE archive.orders ADD COLUMN note TEXT;")
+
+	assertRows(t, d, "SELECT id FROM orders;", [][]string{{"3"}, {"4"}})
+	assertRows(t, d, "SELECT id, note FROM archive.orders WHERE total = 20;", [][]string{{"2", "NULL"}})
+	assertRows(t, d, "SELECT o.id, a.id FROM main.orders o JOIN archive.orders a ON a.total * 2 = o.total + 10;",
+		[][]string{{"3", "2"}})
+	assertRows(t, d, "SELECT c.name FROM customers c JOIN archive.orders ON orders.id = c.id;", [][]string{{"ann"}})
+	assertRows(t, d, "SELECT name FROM mydb_master;", [][]string{{"orders"}})
+	assertRows(t, d, "SELECT name FROM archive.mydb_master;", [][]string{{"customers"}, {"orders"}, {"orders_total"}})
+	assertRows(t, d, "PRAGMA database_list;", [][]string{{"0", "main", "test_attach_main.db"}, {"2", "archive", "test_attach_archive.db"}})
+	if _, err := d.Query("SELECT * FROM nowhere.orders;"); err == nil {
+		t.Errorf("querying an unknown database should fail")
+	}
+
+	d.Exec("DROP TABLE archive.customers;")
+	d.Exec("DETACH archive;")
+	if _, err := d.Query("SELECT * FROM archive.orders;"); err == nil {
+		t.Errorf("archive still visible after DETACH")
+	}
+
+	// 附加时写入的内容在它自己的文件中
+	a, _ := openTestDB(t, "test_attach_archive.db", store.Options{VFS: mem})
+	assertRows(t, a, "SELECT id, total FROM orders;", [][]string{{"1", "10"}, {"2", "20"}})
+	assertIntegrityOK(t, a)
+	assertIntegrityOK(t, d)
+}
+
+// openAttached 打开 main.db 并附加 archive.db，两个库中各有一张表 t
+func openAttached(t *testing.T, vfs store.VFS) *db.Database {
+	t.Helper()
+	d, _ := openTestDB(t, "main.db", store.Options{VFS: vfs})
+	t.Cleanup(func() { d.Close() })
+	d.Exec("ATTACH 'archive.db' AS archive;")
+	return d
+}
+
+func TestAttachTransaction(t *testing.T) {
+	mem := store.NewMemVFS()
+	d := openAttached(t, mem)
+	d.Exec("CREATE TABLE t(id INT);")
+	d.Exec("CREATE TABLE archive.t(id INT);")
+
+	d.Exec("BEGIN;")
+	d.Exec("INSERT INTO t VALUES (1);")
+	d.Exec("INSERT INTO archive.t VALUES (1);")
+	assertRows(t, d, "SELECT COUNT(*) FROM t JOIN archive.t a ON a.id = t.id;", [][]string{{"1"}})
+	d.Exec("ROLLBACK;")
+	assertRows(t, d, "SELECT COUNT(*) FROM t;", [][]string{{"0"}})
+	assertRows(t, d, "SELECT COUNT(*) FROM archive.t;", [][]string{{"0"}})
+
+	d.Exec("BEGIN TRANSACTION;")
+	d.Exec("INSERT INTO t VALUES (1);")
+	d.Exec("INSERT INTO archive.t VALUES (1);")
+	d.Exec("COMMIT;")
+	assertRows(t, d, "SELECT id FROM t;", [][]string{{"1"}})
+	assertRows(t, d, "SELECT id FROM archive.t;", [][]string{{"1"}})
+	d.Close()
+
+	// 每一次写、截断、Sync 或删除时崩溃：两个文件要么都有第二行，要么都没有
+	for k := 1; ; k++ {
+		fv := store.NewFaultVFS(mem)
+		d := openAttached(t, fv)
+		d.Exec("BEGIN;")
+		fv.SetFault(store.Fault{At: k, Kind: store.FaultCrash})
+		d.Exec("INSERT INTO t VALUES (2);")
+		d.Exec("INSERT INTO archive.t VALUES (2);")
+		d.Exec("COMMIT;")
+		crashed := fv.Crashed()
+		d.Close()
+		if err := fv.Restart(); err != nil {
+			t.Fatal(err)
+		}
+
+		d = openAttached(t, fv)
+		main, err1 := d.Query("SELECT COUNT(*) FROM main.t;")
+		archive, err2 := d.Query("SELECT COUNT(*) FROM archive.t;")
+		if err1 != nil || err2 != nil {
+			t.Fatalf("crash at operation %d: %v, %v", k, err1, err2)
+		}
+		m, a := main.Rows[0][0].String(), archive.Rows[0][0].String()
+		if m != a || !crashed && m != "2" {
+			t.Fatalf("crash at operation %d: main has %s rows, archive %s", k, m, a)
+		}
+		assertIntegrityOK(t, d)
+		if m == "2" {
+			// 恢复到提交之前，下一轮从同样的状态开始
+			d.Exec("DELETE FROM main.t WHERE id = '2';")
+			d.Exec("DELETE FROM archive.t WHERE id = '2';")
+		}
+		d.Close()
+		if !crashed {
+			break
+		}
+	}
+	for _, name := range []string{"main.db-journal", "archive.db-journal"} {
+		if _, err := mem.Stat(name); err == nil {
+			t.Errorf("%s left behind", name)
+		}
+	}
+}
+
+// 显式事务中出错的语句整条撤销，之前的语句保留，事务仍然可以提交
+func TestStatementRollbackInTransaction(t *testing.T) {
+	for _, shadow := range []bool{false, true} {
+		mem := store.NewMemVFS()
+		d, _ := openTestDB(t, "stmt.db", store.Options{VFS: mem, Shadow: shadow})
+		d.Exec("CREATE TABLE t(id INT, name TEXT);")
+		d.Exec("CREATE INDEX t_name ON t(name);")
+		d.Exec("INSERT INTO t VALUES (1,'a'), (2,'b');")
+
+		d.Exec("BEGIN;")
+		d.Exec("INSERT INTO t VALUES (5,'e');")
+		if err := d.Exec("INSERT INTO t VALUES (3,'a'), (4,'b','c');"); err == nil {
+			t.Fatalf("shadow=%v: a row with too many values should fail", shadow)
+		}
+		// 足够多的行让表和索引分裂、分配新页之后再出错
+		var big strings.Builder
+		big.WriteString("INSERT INTO t VALUES ")
+		for i := 100; i < 400; i++ {
+			fmt.Fprintf(&big, "(%d,'%s'), ", i, strings.Repeat("x", 50))
+		}
+		big.WriteString("(400);")
+		if err := d.Exec(big.String()); err == nil {
+			t.Fatalf("shadow=%v: a row with too few values should fail", shadow)
+		}
+		assertRows(t, d, "SELECT id FROM t ORDER BY id;", [][]string{{"1"}, {"2"}, {"5"}})
+		d.Exec("COMMIT;")
+
+		d = reopenTestDB(t, d, "stmt.db")
+		assertRows(t, d, "SELECT id FROM t ORDER BY id;", [][]string{{"1"}, {"2"}, {"5"}})
+		assertRows(t, d, "SELECT id FROM t WHERE name = 'a';", [][]string{{"1"}})
+		assertIntegrityOK(t, d)
+	}
+}
+
+func TestAttachErrors(t *testing.T) {
+	d := openAttached(t, store.NewMemVFS())
+	for _, sql := range []string{
+		"ATTACH 'other.db' AS archive;",
+		"ATTACH 'other.db' AS main;",
+		"DETACH nowhere;",
+		"COMMIT;",
+	} {
+		d.Exec(sql)
+	}
+	assertRows(t, d, "PRAGMA database_list;", [][]string{{"0", "main", "main.db"}, {"2", "archive", "archive.db"}})
+
+	d.Exec("BEGIN;")
+	if err := d.Begin(); err == nil {
+		t.Errorf("nested BEGIN should fail")
+	}
+	if err := d.Detach("archive"); err == nil {
+		t.Errorf("DETACH within a transaction should fail")
+	}
+	d.Exec("ROLLBACK;")
+	if err := d.Commit(); err == nil {
+		t.Errorf("COMMIT without a transaction should fail")
+	}
+}
@@ -0,0 +1,147 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"mySQLite/store"
+)
+
+// stepBackup 把 src 备份到 dst，每一步之间调用 between，返回完成之前的步数
+func stepBackup(t *testing.T, dst, src *store.Pager, n int, between func(step int)) (*store.Backup, int) {
+	t.Helper()
+	b, err := store.NewBackup(dst, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	for step := 1; step < 1000; step++ {
+		done, err := b.Step(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if done {
+			return b, step
+		}
+		between(step)
+	}
+	t.Fatalf("backup did not finish")
+	return nil, 0
+}
+
+func TestBackup(t *testing.T) {
+	for _, shadow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("shadow=%v", shadow), func(t *testing.T) {
+			mem := store.NewMemVFS()
+			d, src := openTestDB(t, "test_backup.db", store.Options{VFS: mem, Shadow: shadow})
+			fillVacuumDB(t, d)
+
+			// 目标原来有别的内容，格式也不同
+			old, dst := openTestDB(t, "test_backup_copy.db", store.Options{VFS: mem, Checksums: true})
+			old.Exec("CREATE TABLE stale(id INT);")
+			old.Exec("INSERT INTO stale VALUES (1);")
+
+			// 每两步之间同一个连接写一次，改过的页之后重新复制
+			b, steps := stepBackup(t, dst, src, 5, func(step int) {
+				d.Exec(fmt.Sprintf("INSERT INTO b VALUES (%d, 'step');", step+10))
+				d.Exec(fmt.Sprintf("INSERT INTO a VALUES ('%05d', %d, 'step');", step*3, step))
+				if step%3 == 0 {
+					d.Exec(fmt.Sprintf("DELETE FROM a WHERE id = '%05d';", step*7+1))
+				}
+			})
+			if steps < 3 || b.Restarts() != 0 || b.Remaining() != 0 {
+				t.Errorf("steps %d, restarts %d, remaining %d", steps, b.Restarts(), b.Remaining())
+			}
+			want := dumpString(t, d)
+			dst.Close()
+			copied, _ := openTestDB(t, "test_backup_copy.db", store.Options{VFS: mem})
+			if got := dumpString(t, copied); got != want {
+				t.Errorf("backup differs from the source:\n%s\nwant:\n%s", got, want)
+			}
+			assertIntegrityOK(t, copied)
+		})
+	}
+}
+
+func TestBackupRestart(t *testing.T) {
+	mem := store.NewMemVFS()
+	d, src := openTestDB(t, "test_backup.db", store.Options{VFS: mem})
+	fillVacuumDB(t, d)
+	other, _ := openTestDB(t, "test_backup.db", store.Options{VFS: mem})
+	_, dst := openTestDB(t, "test_backup_copy.db", store.Options{VFS: mem})
+
+	// 其他连接写过之后不知道改了哪些页，从头开始
+	b, _ := stepBackup(t, dst, src, 20, func(step int) {
+		if step == 2 {
+			other.Exec("INSERT INTO b VALUES (3, 'other');")
+		}
+	})
+	if b.Restarts() != 1 {
+		t.Errorf("restarts = %d, want 1", b.Restarts())
+	}
+	dst.Close()
+	copied, _ := openTestDB(t, "test_backup_copy.db", store.Options{VFS: mem})
+	assertRows(t, copied, "SELECT v FROM b WHERE id = 3;", [][]string{{"other"}})
+	if got, want := dumpString(t, copied), dumpString(t, d); got != want {
+		t.Errorf("backup differs from the source")
+	}
+}
+
+func TestBackupTransaction(t *testing.T) {
+	mem := store.NewMemVFS()
+	d, src := openTestDB(t, "test_backup.db", store.Options{VFS: mem})
+	d.Exec("CREATE TABLE t(id INT, v TEXT);")
+	for i := 0; i < 300; i++ {
+		d.Exec(fmt.Sprintf("INSERT INTO t VALUES (%d, 'before');", i))
+	}
+	_, dst := openTestDB(t, "test_backup_copy.db", store.Options{VFS: mem})
+
+	// 未提交的修改不进入备份；事务中改过的页在提交之后重新复制
+	d.Exec("BEGIN;")
+	d.Exec("INSERT INTO t VALUES (1000, 'in transaction');")
+	b, err := store.NewBackup(dst, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done, err := b.Step(1); done || err != nil {
+		t.Fatalf("first step: %v, %v", done, err)
+	}
+	d.Exec("COMMIT;")
+	if done, err := b.Step(0); !done || err != nil {
+		t.Fatalf("last step: %v, %v", done, err)
+	}
+	b.Close()
+	dst.Close()
+	copied, _ := openTestDB(t, "test_backup_copy.db", store.Options{VFS: mem})
+	assertRows(t, copied, "SELECT v FROM t WHERE id = 1000;", [][]string{{"in transaction"}})
+
+	// 完成之前关闭，目标保持原来的内容
+	d.Exec("DELETE FROM t WHERE id = '1000';")
+	b, err = store.NewBackup(copied.Pager, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Step(2)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	assertRows(t, copied, "SELECT COUNT(*) FROM t;", [][]string{{"301"}})
+	assertIntegrityOK(t, copied)
+
+	// 数据库级的 Backup 在事务中只复制已提交的内容
+	want := dumpString(t, d)
+	d.Exec("BEGIN;")
+	d.Exec("INSERT INTO t VALUES (2000, 'uncommitted');")
+	d.Exec("DELETE FROM t WHERE id = '5';")
+	if err := d.Backup("test_backup_db.db"); err != nil {
+		t.Fatal(err)
+	}
+	d.Exec("ROLLBACK;")
+	full, _ := openTestDB(t, "test_backup_db.db", store.Options{VFS: mem})
+	if got := dumpString(t, full); got != want {
+		t.Errorf("Database.Backup copied uncommitted changes")
+	}
+	if _, err := store.NewBackup(src, src); err == nil {
+		t.Errorf("backing up a database to itself should fail")
+	}
+}
@@ -0,0 +1,186 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"mySQLite/store"
+)
+
+func openBulkPager(t *testing.T, filename string) *store.Pager {
+	t.Helper()
+	_, pager := openTestDB(t, filename, store.Options{VFS: store.NewMemVFS()})
+	// 在一个事务中写，避免每写一页都 Sync
+	if err := pager.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	return pager
+}
+
+func bulkRecord(t *testing.T, i int) []byte {
+	t.Helper()
+	// 每 7 条有一组三条相同的 key
+	k := i - i%7%3
+	rec, err := store.EncodeRow([]string{fmt.Sprintf("k%06d", k), fmt.Sprintf("value %d", i)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// 检查批量加载的树：叶子链与中序遍历一致，内部页分隔 key 正确，返回叶子页数
+func checkBulkTree(t *testing.T, pager *store.Pager, root, n int) int {
+	t.Helper()
+	var inorder []int
+	var walk func(pageNo int, low, high string)
+	walk = func(pageNo int, low, high string) {
+		raw, err := pager.ReadPage(pageNo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := store.PageFromBytes(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Type == store.PageLeaf {
+			inorder = append(inorder, pageNo)
+			for _, cell := range page.Cells {
+				key, _ := store.ExtractKey(cell)
+				if key < low || (high != "" && key > high) {
+					t.Errorf("page %d: key %s outside separators [%s, %s]", pageNo, key, low, high)
+				}
+			}
+			return
+		}
+		children := []int{int(page.LeftChild)}
+		keys := []string{low}
+		for _, cell := range page.Cells {
+			k, child, _ := store.DecodeInternalCell(cell)
+			children = append(children, int(child))
+			keys = append(keys, k)
+		}
+		keys = append(keys, high)
+		for i, child := range children {
+			walk(child, keys[i], keys[i+1])
+		}
+	}
+	walk(root, "", "")
+
+	var chain []int
+	count := 0
+	prev := ""
+	for pageNo := inorder[0]; pageNo != 0; {
+		chain = append(chain, pageNo)
+		raw, _ := pager.ReadPage(pageNo)
+		page, _ := store.PageFromBytes(raw)
+		for _, cell := range page.Cells {
+			key, _ := store.ExtractKey(cell)
+			if key < prev {
+				t.Fatalf("key %s after %s", key, prev)
+			}
+			prev = key
+			count++
+		}
+		pageNo = int(page.NextLeaf)
+	}
+	if fmt.Sprint(chain) != fmt.Sprint(inorder) {
+		t.Errorf("NextLeaf chain %v differs from in-order leaves %v", chain, inorder)
+	}
+	if count != n {
+		t.Errorf("tree holds %d records, want %d", count, n)
+	}
+	return len(inorder)
+}
+
+func TestBulkLoad(t *testing.T) {
+	const n = 20000
+	for _, fill := range []float64{1, store.DefaultFillFactor, 0.5, 0.001} {
+		t.Run(fmt.Sprint(fill), func(t *testing.T) {
+			pager := openBulkPager(t, "bulk.db")
+			loader, err := store.NewBulkLoader(pager, fill)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < n; i++ {
+				if err := loader.Add(bulkRecord(t, i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			root, err := loader.Finish()
+			if err != nil {
+				t.Fatal(err)
+			}
+			leaves := checkBulkTree(t, pager, root, n)
+			if fill == 1 {
+				// 逐条插入时叶子分裂后只有一半满
+				inserted := openBulkPager(t, "bulk_insert.db")
+				iroot := allocTestPage(t, inserted)
+				inserted.WritePage(iroot, store.NewLeafPage().ToBytesMust())
+				for i := 0; i < n; i++ {
+					if iroot, err = store.InsertRow(inserted, iroot, bulkRecord(t, i)); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if want := checkBulkTree(t, inserted, iroot, n); leaves*3/2 > want {
+					t.Errorf("bulk load used %d leaves, inserts used %d", leaves, want)
+				}
+			}
+
+			// 重复的 key 都能找到，之后还可以正常插入
+			found := 0
+			store.SeekRows(pager, root, "k000007", func(rec []byte) error {
+				if key, _ := store.ExtractKey(rec); key != "k000007" {
+					return store.ErrStopScan
+				}
+				found++
+				return nil
+			})
+			if found != 3 {
+				t.Errorf("found %d records with a duplicated key, want 3", found)
+			}
+			if _, err := store.SearchRow(pager, root, "k019999"); err != nil {
+				t.Error(err)
+			}
+			for i := 0; i < 500; i++ {
+				rec, _ := store.EncodeRow([]string{fmt.Sprintf("k%06d-x", i*40), "late"})
+				if root, err = store.InsertRow(pager, root, rec); err != nil {
+					t.Fatal(err)
+				}
+			}
+			checkBulkTree(t, pager, root, n+500)
+		})
+	}
+}
+
+func TestBulkLoadErrors(t *testing.T) {
+	pager := openBulkPager(t, "bulk_errors.db")
+	if _, err := store.NewBulkLoader(pager, 0); err == nil {
+		t.Errorf("fill factor 0 should be rejected")
+	}
+
+	// 空的流得到一个空的叶子
+	loader, _ := store.NewBulkLoader(pager, 1)
+	root, err := loader.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBulkTree(t, pager, root, 0)
+
+	loader, _ = store.NewBulkLoader(pager, 1)
+	for i := 10; i < 2000; i++ {
+		loader.Add(bulkRecord(t, i))
+	}
+	if err := loader.Add(bulkRecord(t, 0)); !errors.Is(err, store.ErrNotSorted) {
+		t.Errorf("out of order record: got %v, want ErrNotSorted", err)
+	}
+	big, _ := store.EncodeRow([]string{"zzz", string(make([]byte, store.PageSize))})
+	if err := loader.Add(big); err == nil {
+		t.Errorf("a record larger than a page should be rejected")
+	}
+	root, err = loader.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBulkTree(t, pager, root, 1990)
+}
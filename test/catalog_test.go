@@ -0,0 +1,112 @@
+package test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"mySQLite/db"
+	"mySQLite/store"
+)
+
+// 页 1 只能放下大约一百条元数据，B+ 树中的元数据没有这个限制
+func TestCatalogManyTables(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_catalog.db")
+	defer cleanup()
+
+	root := d.Master.RootPage
+	for i := 0; i < 150; i++ {
+		d.Exec(fmt.Sprintf("CREATE TABLE table_with_a_long_name_%03d(id INT, value TEXT DEFAULT 'nothing');", i))
+		d.Exec(fmt.Sprintf("CREATE INDEX idx_%03d ON table_with_a_long_name_%03d(value);", i, i))
+	}
+	d.Exec("INSERT INTO table_with_a_long_name_149 VALUES (1, 'last');")
+	if d.Master.RootPage != root {
+		t.Fatalf("catalog root moved from %d to %d", root, d.Master.RootPage)
+	}
+
+	d = reopenTestDB(t, d, "test_catalog.db")
+	if len(d.Tables) != 150 || len(d.Indexes) != 150 {
+		t.Fatalf("recovered %d tables and %d indexes, want 150 each", len(d.Tables), len(d.Indexes))
+	}
+	assertRows(t, d, "SELECT type, COUNT(*) FROM mydb_master GROUP BY type ORDER BY 1;",
+		[][]string{{"index", "150"}, {"table", "150"}})
+	assertRows(t, d, "SELECT type, name, tbl_name, sql FROM mydb_master WHERE name = 'idx_007';",
+		[][]string{{"index", "idx_007", "table_with_a_long_name_007", "CREATE INDEX idx_007 ON table_with_a_long_name_007(value)"}})
+	assertRows(t, d, "SELECT value FROM table_with_a_long_name_149;", [][]string{{"last"}})
+
+	d.Exec("CREATE TABLE mydb_master(x);")
+	d.Exec("CREATE TABLE idx_001(x);")
+	if _, ok := d.Tables["idx_001"]; ok {
+		t.Errorf("table created with the name of an existing index")
+	}
+}
+
+// 旧版本把元数据写在页 1 的记录里，打开时迁移到 B+ 树
+func TestCatalogMigrateLegacy(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "catalog_legacy.db")
+	pager, err := store.OpenPager(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := allocTestPage(t, pager)
+	leaf := store.NewLeafPage()
+	row, _ := store.EncodeRow([]string{"1", "ann"})
+	leaf.Cells = append(leaf.Cells, row)
+	pager.WritePage(root, leaf.ToBytesMust())
+	meta, _ := store.EncodeRow([]string{"users", "id|name", fmt.Sprint(root)})
+	if err := pager.AppendRow(1, meta); err != nil {
+		t.Fatal(err)
+	}
+	pager.Close()
+
+	d := reopenTestDB(t, &db.Database{Pager: pager}, filename)
+	assertRows(t, d, "SELECT * FROM users;", [][]string{{"1", "ann"}})
+	assertRows(t, d, "SELECT name, rootpage, sql FROM mydb_master;",
+		[][]string{{"users", fmt.Sprint(root), "CREATE TABLE users(id, name)"}})
+	if rows, _ := d.Pager.ReadAllRows(1); len(rows) != 0 {
+		t.Errorf("page 1 still has %d legacy rows", len(rows))
+	}
+}
+
+// 元数据表中任意内容的记录：打开数据库、查询和完整性检查都不能 panic，
+// 无效的记录跳过或者返回错误。
+//
+//	go test ./test -run XXX -fuzz FuzzCatalogEntry
+func FuzzCatalogEntry(f *testing.F) {
+	f.Add("table", "t", "t", "3", "CREATE TABLE t(id INT, v TEXT DEFAULT 'x')")
+	f.Add("index", "t_v", "t", "3", "CREATE INDEX t_v ON t(v)")
+	f.Add("table", "t", "t", "1", "CREATE TABLE t(id)")
+	f.Add("table", "t", "t", "-7", "CREATE TABLE t(id)")
+	f.Add("table", "t", "t", "99999", "CREATE TABLE t(id)")
+	f.Add("table", "t", "t", "2", "CREATE TABLE")
+	f.Add("index", "i", "missing", "abc", "CREATE INDEX i ON missing(")
+	f.Fuzz(func(t *testing.T, typ, name, tblName, root, sql string) {
+		filename := filepath.Join(t.TempDir(), "catalog.db")
+		pager, err := store.OpenPager(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pager.Close()
+		d := db.NewDatabase(pager)
+		rec, err := store.EncodeRow([]string{name, typ, tblName, root, sql})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.InsertRowFixedRoot(pager, d.Master.RootPage, rec); err != nil {
+			t.Fatal(err)
+		}
+		pager.Close()
+
+		pager, err = store.OpenPager(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pager.Close()
+		d = db.NewDatabase(pager)
+		for name := range d.Tables {
+			d.Query(fmt.Sprintf("SELECT * FROM %s;", name))
+		}
+		d.Query("SELECT * FROM mydb_master;")
+		d.IntegrityCheck()
+	})
+}
@@ -0,0 +1,139 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mySQLite/store"
+)
+
+func TestPageChecksums(t *testing.T) {
+	for _, shadow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("shadow=%v", shadow), func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "checksum.db")
+			d, pager := openTestDB(t, filename, store.Options{Shadow: shadow, Checksums: true})
+			d.Exec("CREATE TABLE t(id TEXT, v TEXT);")
+			d.Exec("CREATE INDEX t_v ON t(v);")
+			for i := 0; i < 10; i++ {
+				var values []string
+				for j := 0; j < 50; j++ {
+					values = append(values, fmt.Sprintf("('%04d', '%s')", (i*50+j)*7%500, strings.Repeat("v", j)))
+				}
+				d.Exec("INSERT INTO t VALUES " + strings.Join(values, ", ") + ";")
+			}
+			d.Exec("DROP TABLE t;")
+			d.Exec("CREATE TABLE t(id TEXT, v TEXT);")
+			d.Exec("INSERT INTO t VALUES ('a', 'one'), ('b', 'two');")
+
+			// 回滚和崩溃恢复写回的页也带着正确的校验和
+			pager.Begin()
+			d.Pager.WritePage(d.Tables["t"].RootPage, store.NewLeafPage().ToBytesMust())
+			pager.Rollback()
+			if !shadow {
+				pager.Begin()
+				d.Pager.WritePage(d.Tables["t"].RootPage, store.NewLeafPage().ToBytesMust())
+			}
+			pager.Close()
+
+			info, _ := os.Stat(filename)
+			if info.Size()%(store.PageSize+4) != 0 {
+				t.Errorf("file size %d is not a multiple of the page size with checksum", info.Size())
+			}
+			d, pager = openTestDB(t, filename, store.Options{})
+			if !pager.Checksums() {
+				t.Fatalf("checksums should be detected when reopening")
+			}
+			assertRows(t, d, "PRAGMA checksums;", [][]string{{"1"}})
+			assertRows(t, d, "SELECT id, v FROM t;", [][]string{{"a", "one"}, {"b", "two"}})
+			assertIntegrityOK(t, d)
+
+			d.Exec("VACUUM;")
+			assertRows(t, d, "SELECT id, v FROM t;", [][]string{{"a", "one"}, {"b", "two"}})
+			assertIntegrityOK(t, d)
+			pager.Close()
+
+			// 改掉一个字节：回滚日志模式下读这一页出错，影子分页模式下页表页出错，打开就失败
+			data, _ := os.ReadFile(filename)
+			if shadow {
+				for off := 2 * (store.PageSize + 4); off < len(data); off += store.PageSize + 4 {
+					data[off+100] ^= 0xff
+				}
+				os.WriteFile(filename, data, 0644)
+				if _, err := store.OpenPager(filename); !errors.Is(err, store.ErrCorrupt) {
+					t.Errorf("opening a corrupt shadow paging file: got %v, want ErrCorrupt", err)
+				}
+				return
+			}
+			root := d.Tables["t"].RootPage
+			data[(root-1)*(store.PageSize+4)+store.PageSize-1] ^= 0xff
+			os.WriteFile(filename, data, 0644)
+			d, pager = openTestDB(t, filename, store.Options{})
+			_, err := pager.ReadPage(root)
+			var corrupt *store.CorruptError
+			if !errors.As(err, &corrupt) || corrupt.Page != root || !errors.Is(err, store.ErrCorrupt) {
+				t.Fatalf("reading a corrupt page: got %v, want CorruptError for page %d", err, root)
+			}
+			if _, err := d.Query("SELECT * FROM t;"); !errors.Is(err, store.ErrCorrupt) {
+				t.Errorf("query on a corrupt page: got %v, want ErrCorrupt", err)
+			}
+			rs, err := d.Query("PRAGMA integrity_check;")
+			if err != nil || !strings.Contains(rs.Rows[0][0].String(), fmt.Sprintf("t: page %d: checksum mismatch", root)) {
+				t.Errorf("PRAGMA integrity_check = %v, %v", rs, err)
+			}
+		})
+	}
+}
+
+func TestPageChecksumsOption(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "checksum_plain.db")
+	d, pager := openTestDB(t, filename, store.Options{})
+	d.Exec("CREATE TABLE t(id INT);")
+	assertRows(t, d, "PRAGMA checksums;", [][]string{{"0"}})
+	if _, err := d.Query("PRAGMA checksums = on;"); err == nil {
+		t.Errorf("changing checksums of an existing database should fail")
+	}
+	pager.Close()
+	if _, err := store.OpenPagerWithOptions(filename, store.Options{Checksums: true}); err == nil {
+		t.Errorf("opening a database without checksums with Checksums should fail")
+	}
+}
+
+func TestPageChecksumsZeroPage(t *testing.T) {
+	for _, shadow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("shadow=%v", shadow), func(t *testing.T) {
+			mem := store.NewMemVFS()
+			opts := store.Options{VFS: mem, Shadow: shadow, Checksums: true}
+			d, pager := openTestDB(t, "zero.db", opts)
+			d.Exec("CREATE TABLE t(id INT, v TEXT);")
+			for i := 0; i < 100; i++ {
+				d.Exec(fmt.Sprintf("INSERT INTO t VALUES (%d, 'row %d');", i, i))
+			}
+			pager.Close()
+
+			// 第 2 页之后已经提交的页连同校验和全部改成 0：不能当作没有写过的页
+			f, err := mem.Open("zero.db")
+			if err != nil {
+				t.Fatal(err)
+			}
+			size, _ := f.Size()
+			stride := int64(store.PageSize + 4)
+			for off := stride; off+stride <= size; off += stride {
+				f.WriteAt(make([]byte, stride), off)
+			}
+			f.Close()
+
+			pager, err = store.OpenPagerWithOptions("zero.db", opts)
+			if err == nil {
+				defer pager.Close()
+				_, err = pager.ReadPage(2)
+			}
+			if !errors.Is(err, store.ErrCorrupt) {
+				t.Errorf("reading zeroed pages: got %v, want ErrCorrupt", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mySQLite/db"
+	"mySQLite/store"
+)
+
+// fillTextDB 插入容易压缩的文本
+func fillTextDB(d *db.Database) {
+	d.Exec("CREATE TABLE notes(id TEXT, body TEXT);")
+	d.Exec("CREATE INDEX notes_body ON notes(body);")
+	for i := 0; i < 20; i++ {
+		var values []string
+		for j := 0; j < 50; j++ {
+			k := i*50 + j
+			values = append(values, fmt.Sprintf("('%04d', '%s %d')", k*7%1000, strings.Repeat("lorem ipsum dolor ", 5+k%7), k))
+		}
+		d.Exec("INSERT INTO notes VALUES " + strings.Join(values, ", ") + ";")
+	}
+}
+
+func TestPageCompression(t *testing.T) {
+	plain := filepath.Join(t.TempDir(), "compress_plain.db")
+	d, _ := openTestDB(t, plain, store.Options{Shadow: true})
+	fillTextDB(d)
+	want := dumpString(t, d)
+	plainInfo, _ := os.Stat(plain)
+
+	for _, opts := range []store.Options{
+		{Shadow: true, Compress: true},
+		{Shadow: true, Compress: true, Checksums: true},
+		{Shadow: true, Compress: true, Passphrase: "pw", KDFIterations: 1000},
+	} {
+		t.Run(fmt.Sprintf("checksums=%v,encrypted=%v", opts.Checksums, opts.Passphrase != ""), func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "compress.db")
+			d, pager := openTestDB(t, filename, opts)
+			fillTextDB(d)
+			if got := dumpString(t, d); got != want {
+				t.Fatalf("contents differ from the uncompressed database")
+			}
+			st := pager.CompressionStats()
+			if st.PagesWritten == 0 || st.Ratio() < 2 {
+				t.Errorf("compression stats %+v, want ratio >= 2", st)
+			}
+			rs, err := d.Query("PRAGMA compression;")
+			if err != nil || rs.Rows[0][0].String() != "1" {
+				t.Errorf("PRAGMA compression = %v, %v", rs, err)
+			}
+			if info, _ := os.Stat(filename); info.Size()*2 > plainInfo.Size() {
+				t.Errorf("compressed file has %d bytes, uncompressed %d", info.Size(), plainInfo.Size())
+			}
+
+			// 回滚丢掉的页释放它们的块，快照读到旧的内容
+			snap, err := d.Snapshot()
+			if err != nil {
+				t.Fatal(err)
+			}
+			pager.Begin()
+			d.Pager.WritePage(d.Tables["notes"].RootPage, store.NewLeafPage().ToBytesMust())
+			pager.Rollback()
+			d.Exec("DELETE FROM notes WHERE id = '0007';")
+			d.Exec("VACUUM;")
+			if rs, err := snap.Query("SELECT COUNT(*) FROM notes;"); err != nil || rs.Rows[0][0].String() != "1000" {
+				t.Errorf("snapshot count = %v, %v; want 1000", rs, err)
+			}
+			snap.Close()
+			assertIntegrityOK(t, d)
+			pager.Close()
+
+			reopen := opts
+			reopen.Shadow, reopen.Compress, reopen.Checksums = false, false, false
+			d, pager = openTestDB(t, filename, reopen)
+			if !pager.Compressed() || pager.Checksums() != opts.Checksums || pager.Encrypted() != (opts.Passphrase != "") {
+				t.Fatalf("format not detected when reopening")
+			}
+			assertRows(t, d, "SELECT COUNT(*) FROM notes;", [][]string{{"999"}})
+			assertRows(t, d, "SELECT id FROM notes WHERE body = '"+strings.Repeat("lorem ipsum dolor ", 5+7%7)+" 7';", [][]string{{"0049"}})
+			assertIntegrityOK(t, d)
+			if st := pager.CompressionStats(); st.PagesRead == 0 || st.CacheHits == 0 {
+				t.Errorf("compression stats after reading %+v", st)
+			}
+		})
+	}
+}
+
+func TestPageCompressionOption(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "compress_option.db")
+	if _, err := store.OpenPagerWithOptions(filename, store.Options{Compress: true}); err == nil {
+		t.Errorf("compression without shadow paging should fail")
+	}
+	os.Remove(filename)
+	d, pager := openTestDB(t, filename, store.Options{Shadow: true})
+	assertRows(t, d, "PRAGMA compression;", [][]string{{"0", "0", "0.0", "0", "0", "0", "0"}})
+	pager.Close()
+	if _, err := store.OpenPagerWithOptions(filename, store.Options{Compress: true}); err == nil {
+		t.Errorf("opening an uncompressed database with Compress should fail")
+	}
+
+	// 页表指向文件之外的块时打开失败
+	os.Remove(filename)
+	_, pager = openTestDB(t, filename, store.Options{Shadow: true, Compress: true})
+	pager.Close()
+	os.Truncate(filename, 2*store.PageSize+512)
+	if _, err := store.OpenPager(filename); err == nil || errors.Is(err, store.ErrWrongKey) {
+		t.Errorf("opening a truncated compressed database: got %v", err)
+	}
+}
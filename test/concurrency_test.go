@@ -0,0 +1,232 @@
+package test
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"mySQLite/store"
+)
+
+// 多个读者和写者同时使用一个 Database，用 go test -race 运行可以检查数据竞争
+func TestConcurrentReadersAndWriters(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_concurrency.db")
+	defer cleanup()
+
+	d.Exec("CREATE TABLE items(id TEXT, grp INT, n INT);")
+	d.Exec("CREATE INDEX items_grp ON items(grp);")
+
+	const writers, perWriter = 2, 60
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				d.Exec(fmt.Sprintf("INSERT INTO items VALUES ('w%d-%03d', %d, %d);", w, i, w, i))
+			}
+		}(w)
+	}
+
+	done := make(chan struct{})
+	errs := make(chan error, 4)
+	var readers sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			last := 0
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// 先通过索引计数，之后扫描得到的行数不会更少
+				byIndex, err := d.Query("SELECT COUNT(*) FROM items WHERE grp = 0;")
+				if err != nil {
+					errs <- err
+					return
+				}
+				indexed, _ := strconv.Atoi(byIndex.Rows[0][0].String())
+				rs, err := d.Query("SELECT COUNT(*), COUNT(DISTINCT id) FROM items;")
+				if err != nil {
+					errs <- err
+					return
+				}
+				count, _ := strconv.Atoi(rs.Rows[0][0].String())
+				distinct, _ := strconv.Atoi(rs.Rows[0][1].String())
+				// 读者不会看到写了一半的插入，行数也不会倒退
+				if count != distinct || count < last || count < indexed {
+					errs <- fmt.Errorf("inconsistent read: count %d, distinct %d, previous %d, indexed %d", count, distinct, last, indexed)
+					return
+				}
+				last = count
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(done)
+	readers.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	assertRows(t, d, "SELECT COUNT(*) FROM items;", [][]string{{strconv.Itoa(writers * perWriter)}})
+	for w := 0; w < writers; w++ {
+		assertRows(t, d, fmt.Sprintf("SELECT COUNT(*), MAX(n) FROM items WHERE grp = %d;", w),
+			[][]string{{strconv.Itoa(perWriter), strconv.Itoa(perWriter - 1)}})
+	}
+}
+
+// 建表和查询元数据同时进行
+func TestConcurrentSchemaChanges(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_concurrency_schema.db")
+	defer cleanup()
+
+	const tables = 20
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < tables; i++ {
+			d.Exec(fmt.Sprintf("CREATE TABLE t%02d(id INT);", i))
+			d.Exec(fmt.Sprintf("INSERT INTO t%02d VALUES (%d);", i, i))
+		}
+	}()
+	for r := 0; r < 3; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if _, err := d.Query("SELECT name, rootpage FROM mydb_master;"); err != nil {
+					t.Error(err)
+					return
+				}
+				d.Exec("SELECT * FROM t00;")
+			}
+		}()
+	}
+	wg.Wait()
+
+	assertRows(t, d, "SELECT COUNT(*) FROM mydb_master WHERE type = 'table';", [][]string{{strconv.Itoa(tables)}})
+}
+
+// Pager 的单个操作可以并发：分配页、写页、读页互不干扰
+func TestPagerConcurrentAccess(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "pager_concurrency.db")
+	pager, err := store.OpenPager(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.Close()
+
+	const workers, pages = 4, 20
+	var wg sync.WaitGroup
+	allocated := make([][]int, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < pages; i++ {
+				n, err := pager.AllocatePage()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				data := make([]byte, store.PageSize)
+				data[0] = byte(w + 1)
+				data[1] = byte(i)
+				if err := pager.WritePage(n, data); err != nil {
+					t.Error(err)
+					return
+				}
+				allocated[w] = append(allocated[w], n)
+				if _, err := pager.ReadPage(n); err != nil {
+					t.Error(err)
+					return
+				}
+				_ = pager.PageCount()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	seen := map[int]bool{}
+	for w, list := range allocated {
+		for i, n := range list {
+			if seen[n] {
+				t.Fatalf("page %d allocated twice", n)
+			}
+			seen[n] = true
+			data, err := pager.ReadPage(n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data[0] != byte(w+1) || data[1] != byte(i) {
+				t.Errorf("page %d: got (%d, %d), want (%d, %d)", n, data[0], data[1], w+1, i)
+			}
+		}
+	}
+}
+
+// 快照打开期间写者照常插入、删除和删表，快照上的查询仍然看到开始时的数据
+func TestSnapshotIsolation(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_snapshot.db")
+	defer cleanup()
+
+	d.Exec("CREATE TABLE items(id TEXT, n INT);")
+	d.Exec("CREATE TABLE old(id INT);")
+	d.Exec("INSERT INTO old VALUES (1), (2);")
+	for i := 0; i < 20; i++ {
+		d.Exec(fmt.Sprintf("INSERT INTO items VALUES ('a%03d', %d);", i, i))
+	}
+
+	s, err := d.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 快照没有持有锁，这里的写操作如果被阻塞测试会卡住
+	for i := 0; i < 200; i++ {
+		d.Exec(fmt.Sprintf("INSERT INTO items VALUES ('b%03d', %d);", i, i))
+	}
+	d.Exec("DELETE FROM items WHERE id = 'a000';")
+	d.Exec("DROP TABLE old;")
+	d.Exec("CREATE TABLE fresh(id INT);")
+	d.Exec("INSERT INTO fresh VALUES (1);")
+
+	snapshotRows := func(sql string) [][]string {
+		t.Helper()
+		rs, err := s.Query(sql)
+		if err != nil {
+			t.Fatalf("snapshot query %q: %v", sql, err)
+		}
+		var rows [][]string
+		for _, row := range rs.Rows {
+			var fields []string
+			for _, v := range row {
+				fields = append(fields, v.String())
+			}
+			rows = append(rows, fields)
+		}
+		return rows
+	}
+	want := [][]string{{"20", "0", "19"}}
+	if got := snapshotRows("SELECT COUNT(*), MIN(n), MAX(n) FROM items;"); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("snapshot items = %v, want %v", got, want)
+	}
+	if got := snapshotRows("SELECT COUNT(*) FROM old;"); fmt.Sprint(got) != "[[2]]" {
+		t.Errorf("snapshot old = %v, want [[2]]", got)
+	}
+	if _, err := s.Query("SELECT * FROM fresh;"); err == nil {
+		t.Errorf("table created after the snapshot should not be visible")
+	}
+	s.Close()
+
+	assertRows(t, d, "SELECT COUNT(*) FROM items;", [][]string{{"219"}})
+	assertRows(t, d, "SELECT COUNT(*) FROM fresh;", [][]string{{"1"}})
+}
@@ -0,0 +1,157 @@
+package test
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"mySQLite/db"
+	"mySQLite/store"
+)
+
+/*
+崩溃恢复测试：用固定的种子生成一串随机事务（插入、删除，行足够长，叶子和索引都会分裂），
+在 FaultVFS 上执行，依次在第 1、2、3……次写、截断、Sync 或删除时崩溃，
+重启之后检查数据库完整，而且内容恰好是已经提交的事务的结果：
+崩溃之前返回的事务都在，崩溃时正在执行的事务要么全部生效，要么完全没有。
+*/
+
+// crashWorkload 是一串事务和每个事务提交之后表中应有的内容
+type crashWorkload struct {
+	txns   [][]string // 每个事务的语句，多条语句时用 BEGIN ... COMMIT 包起来
+	states []string   // states[i] 是前 i 个事务提交之后 SELECT 的结果
+}
+
+func newCrashWorkload(seed int64, n int) *crashWorkload {
+	r := rand.New(rand.NewSource(seed))
+	model := map[string]string{}
+	w := &crashWorkload{states: []string{crashState(model)}}
+	nextID := 0
+	insert := func() string {
+		id := fmt.Sprintf("%05d", r.Intn(100000))
+		for model[id] != "" {
+			id = fmt.Sprintf("%05d", r.Intn(100000))
+		}
+		nextID++
+		v := fmt.Sprintf("%s-%d-%s", id, nextID, strings.Repeat(string(rune('a'+r.Intn(26))), 40+r.Intn(300)))
+		model[id] = v
+		return fmt.Sprintf("('%s', '%s')", id, v)
+	}
+	remove := func() string {
+		ids := make([]string, 0, len(model))
+		for id := range model {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		id := ids[r.Intn(len(ids))]
+		delete(model, id)
+		return fmt.Sprintf("DELETE FROM t WHERE id = '%s';", id)
+	}
+
+	for len(w.txns) < n {
+		var stmts []string
+		switch k := r.Intn(10); {
+		case k < 4 || len(model) < 10:
+			// 一条语句插入多行
+			var values []string
+			for range 1 + r.Intn(8) {
+				values = append(values, insert())
+			}
+			stmts = append(stmts, "INSERT INTO t VALUES "+strings.Join(values, ", ")+";")
+		case k < 6:
+			stmts = append(stmts, remove())
+		default:
+			// 显式事务中混合插入和删除
+			stmts = append(stmts, "BEGIN;")
+			for range 2 + r.Intn(6) {
+				if r.Intn(3) == 0 && len(model) > 0 {
+					stmts = append(stmts, remove())
+				} else {
+					stmts = append(stmts, "INSERT INTO t VALUES "+insert()+";")
+				}
+			}
+			stmts = append(stmts, "COMMIT;")
+		}
+		w.txns = append(w.txns, stmts)
+		w.states = append(w.states, crashState(model))
+	}
+	return w
+}
+
+// crashState 按 id 排序格式化模型，与 rows(SELECT ...) 的格式相同
+func crashState(model map[string]string) string {
+	var out [][]string
+	for id, v := range model {
+		out = append(out, []string{id, v})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i][0] < out[j][0] })
+	return fmt.Sprint(out)
+}
+
+func crashTableState(t *testing.T, d *db.Database) string {
+	t.Helper()
+	rs, err := d.Query("SELECT id, v FROM t ORDER BY id;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprint(rows(rs))
+}
+
+// runCrash 从空的数据库开始执行 w，在第 k 次修改文件的操作时崩溃。
+// 返回崩溃时正在执行的事务的序号（从 1 开始），没有崩溃时返回 0
+func runCrash(t *testing.T, fv *store.FaultVFS, shadow bool, w *crashWorkload, k int) int {
+	t.Helper()
+	d, pager := openTestDB(t, "crash.db", store.Options{VFS: fv, Shadow: shadow})
+	defer pager.Close()
+	d.Exec("CREATE TABLE t(id TEXT, v TEXT);")
+	d.Exec("CREATE INDEX t_v ON t(v);")
+	fv.SetFault(store.Fault{At: k, Kind: store.FaultCrash})
+	for i, stmts := range w.txns {
+		for _, sql := range stmts {
+			d.Exec(sql)
+		}
+		if fv.Crashed() {
+			return i + 1
+		}
+	}
+	// 没有崩溃时所有事务都应该成功
+	if got := crashTableState(t, d); got != w.states[len(w.txns)] {
+		t.Fatalf("workload without a crash ended with\n%s\nwant\n%s", got, w.states[len(w.txns)])
+	}
+	if root := readTestPage(t, pager, d.Tables["t"].RootPage); root.Type == store.PageLeaf {
+		t.Fatalf("workload did not split the table")
+	}
+	return 0
+}
+
+func TestCrashRecovery(t *testing.T) {
+	for _, shadow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("shadow=%v", shadow), func(t *testing.T) {
+			w := newCrashWorkload(1, 20)
+			for k := 1; ; k++ {
+				fv := store.NewFaultVFS(store.NewMemVFS())
+				crashedIn := runCrash(t, fv, shadow, w, k)
+				if crashedIn == 0 {
+					break
+				}
+				if err := fv.Restart(); err != nil {
+					t.Fatal(err)
+				}
+
+				d, _ := openTestDB(t, "crash.db", store.Options{VFS: fv})
+				problems, err := d.IntegrityCheck()
+				if err != nil || len(problems) > 0 {
+					t.Fatalf("crash at operation %d (transaction %d): %v %v", k, crashedIn, err, problems)
+				}
+				got := crashTableState(t, d)
+				if got != w.states[crashedIn-1] && got != w.states[crashedIn] {
+					t.Fatalf("crash at operation %d (transaction %d %q): recovered\n%s\nwant\n%s\nor\n%s",
+						k, crashedIn, w.txns[crashedIn-1], got, w.states[crashedIn-1], w.states[crashedIn])
+				}
+				d.Pager.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestImportCSVCreatesTable(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_csv_create.db")
+	defer cleanup()
+
+	data := `id,name,price,zip,note
+1,"Smith, John",9.5,007,"line one
+line two"
+2,O'Brien,10,12345,
+3,,,,"say ""hi"""
+`
+	n, err := d.ImportCSV(strings.NewReader(data), "people")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("imported %d rows, want 3", n)
+	}
+	assertRows(t, d, "SELECT sql FROM mydb_master WHERE name = 'people';",
+		[][]string{{"CREATE TABLE people(id INTEGER, name TEXT, price REAL, zip TEXT, note TEXT)"}})
+	assertRows(t, d, "SELECT id, name, price, zip, note FROM people ORDER BY id;", [][]string{
+		{"1", "Smith, John", "9.5", "007", "line one\nline two"},
+		{"2", "O'Brien", "10.0", "12345", ""},
+		{"3", "", "NULL", "", `say "hi"`},
+	})
+
+	var out bytes.Buffer
+	if _, err := d.ExportCSV(&out, "people"); err != nil {
+		t.Fatal(err)
+	}
+	want := `id,name,price,zip,note
+1,"Smith, John",9.5,007,"line one
+line two"
+2,O'Brien,10.0,12345,
+3,,,,"say ""hi"""
+`
+	if out.String() != want {
+		t.Errorf("export:\n%s\nwant:\n%s", out.String(), want)
+	}
+	if _, err := d.ExportCSV(&out, "missing"); err == nil {
+		t.Errorf("exporting a missing table should fail")
+	}
+}
+
+// 追加到已有的表：列按名称对应，缺少的列取默认值，索引同时更新
+func TestImportCSVAppend(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_csv_append.db")
+	defer cleanup()
+
+	d.Exec("CREATE TABLE items(id INT, name TEXT, qty INT DEFAULT 1);")
+	d.Exec("CREATE INDEX items_name ON items(name);")
+	d.Exec("INSERT INTO items VALUES (1, 'old', 5);")
+
+	if _, err := d.ImportCSV(strings.NewReader("NAME,id\nnew,2\n,3\n"), "items"); err != nil {
+		t.Fatal(err)
+	}
+	assertRows(t, d, "SELECT id, name, qty FROM items ORDER BY id;", [][]string{
+		{"1", "old", "5"}, {"2", "new", "1"}, {"3", "", "1"},
+	})
+	assertRows(t, d, "SELECT id FROM items WHERE name = 'new';", [][]string{{"2"}})
+
+	if _, err := d.ImportCSV(strings.NewReader("id,color\n4,red\n"), "items"); err == nil {
+		t.Errorf("importing an unknown column should fail")
+	}
+	if _, err := d.ImportCSV(strings.NewReader(""), "items"); err == nil {
+		t.Errorf("importing an empty file should fail")
+	}
+	assertRows(t, d, "SELECT COUNT(*) FROM items;", [][]string{{"3"}})
+}
+
+// csvRows 边生成边返回 CSV 内容，不在内存中保存整个文件
+type csvRows struct {
+	next, total int
+	bad         int // 这一行的字段数不对，0 表示没有
+	buf         bytes.Buffer
+}
+
+func (c *csvRows) Read(p []byte) (int, error) {
+	for c.buf.Len() < len(p) && c.next <= c.total {
+		switch {
+		case c.next == 0:
+			c.buf.WriteString("id,grp,score\n")
+		case c.next == c.bad:
+			c.buf.WriteString("oops\n")
+		default:
+			fmt.Fprintf(&c.buf, "k%07d,%d,%d.5\n", c.next, c.next%10, c.next)
+		}
+		c.next++
+	}
+	if c.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.buf.Read(p)
+}
+
+func TestImportCSVStreaming(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_csv_stream.db")
+	defer cleanup()
+
+	const total = 20000
+	n, err := d.ImportCSV(&csvRows{total: total}, "big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != total {
+		t.Fatalf("imported %d rows, want %d", n, total)
+	}
+	assertRows(t, d, "SELECT COUNT(*), MIN(id), MAX(id), SUM(grp) FROM big;",
+		[][]string{{"20000", "k0000001", "k0020000", "90000"}})
+	assertRows(t, d, "SELECT typeof(grp), typeof(score) FROM big WHERE id = 'k0000042';",
+		[][]string{{"integer", "real"}})
+
+	var out bytes.Buffer
+	if n, err := d.ExportCSV(&out, "big"); err != nil || n != total {
+		t.Fatalf("export: %d rows, %v", n, err)
+	}
+	if !strings.HasSuffix(out.String(), "\nk0020000,0,20000.5\n") {
+		t.Errorf("unexpected end of export: %q", out.String()[out.Len()-40:])
+	}
+
+	// 新表的有序部分批量加载，是一个事务，出错时整段回滚
+	n, err = d.ImportCSV(&csvRows{total: 2500, bad: 2100}, "partial")
+	if err == nil || n != 0 {
+		t.Fatalf("a malformed row should fail the bulk load, got %d rows, %v", n, err)
+	}
+	assertRows(t, d, "SELECT COUNT(*) FROM partial;", [][]string{{"0"}})
+
+	// 追加到已有的表时逐批插入，出错之前的整批已经提交，出错的这一批回滚
+	n, err = d.ImportCSV(&csvRows{total: 2500, bad: 2100}, "partial")
+	if err == nil {
+		t.Fatalf("a malformed row should fail the import")
+	}
+	if n != 2000 {
+		t.Errorf("imported %d rows before the error, want 2000", n)
+	}
+	assertRows(t, d, "SELECT COUNT(*) FROM partial;", [][]string{{"2000"}})
+}
+
+// 行不按 key 有序时，有序的前一段批量加载，其余的逐行插入
+func TestImportCSVUnsorted(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_csv_unsorted.db")
+	defer cleanup()
+
+	var data strings.Builder
+	data.WriteString("id,n\n")
+	for i := 0; i < 3000; i++ {
+		k := i
+		if i >= 2000 {
+			k = 4999 - i // 最后 1000 行倒序：k02999 .. k02000
+		}
+		fmt.Fprintf(&data, "k%05d,%d\n", k, i)
+	}
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&data, "k%05d,dup\n", 1500)
+	}
+	n, err := d.ImportCSV(strings.NewReader(data.String()), "mixed")
+	if err != nil || n != 3003 {
+		t.Fatalf("imported %d rows, %v", n, err)
+	}
+	assertRows(t, d, "SELECT COUNT(*), COUNT(DISTINCT id), MIN(id), MAX(id) FROM mixed;",
+		[][]string{{"3003", "3000", "k00000", "k02999"}})
+	assertRows(t, d, "SELECT COUNT(*) FROM mixed WHERE id = 'k01500';", [][]string{{"4"}})
+	assertRows(t, d, "SELECT n FROM mixed WHERE id = 'k02999';", [][]string{{"2000"}})
+}
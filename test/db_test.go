@@ -2,28 +2,44 @@ package test
 
 import (
 	"fmt"
-	"os"
+	"strings"
 	"testing"
 
 	"mySQLite/db"
 	"mySQLite/store"
 )
 
-// 创建干净数据库，返回 db 实例与清理函数
+// 在一个新的 MemVFS 中创建干净数据库，不读写磁盘，返回 db 实例与清理函数
 func createTestDB(t *testing.T, filename string) (*db.Database, func()) {
-	_ = os.Remove(filename)
-	pager, err := store.OpenPager(filename)
-	if err != nil {
-		t.Fatalf("failed to open pager: %v", err)
-	}
-	mydb := db.NewDatabase(pager)
+	t.Helper()
+	mydb, _ := openTestDB(t, filename, store.Options{VFS: store.NewMemVFS()})
 	cleanup := func() {
-		pager.Close()
-
+		mydb.Close()
 	}
 	return mydb, cleanup
 }
 
+// 关闭数据库后从同一个 VFS 重新打开同一个文件
+func reopenTestDB(t *testing.T, d *db.Database, filename string) *db.Database {
+	t.Helper()
+	vfs := d.Pager.VFS()
+	d.Pager.Close()
+	d, _ = openTestDB(t, filename, store.Options{VFS: vfs})
+	return d
+}
+
+// openTestDB 用 opts 打开 filename，测试结束时关闭。opts.VFS 为 nil 时打开的是磁盘上的文件，
+// filename 应该在 t.TempDir() 下，测试不在源码目录中留下文件
+func openTestDB(t *testing.T, filename string, opts store.Options) (*db.Database, *store.Pager) {
+	t.Helper()
+	pager, err := store.OpenPagerWithOptions(filename, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pager.Close() })
+	return db.NewDatabase(pager), pager
+}
+
 func collectRowsFromTree(pager *store.Pager, rootPage int) ([][]string, error) {
 	visited := map[int]bool{}
 	return collectRecursive(pager, rootPage, visited)
@@ -131,3 +147,46 @@ func TestDebugPrintTree(t *testing.T) {
 	//fmt.Println("\n=== B+ Tree Visual Structure ===")
 	//store.DebugPrintTree(db.Pager, db.Tables["users"].RootPage)
 }
+
+// 出错的语句整条回滚：多行 INSERT 中前面已经插入的行不会留下，根页分裂过也一样
+func TestExecErrorRollsBackStatement(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_exec_error.db")
+	defer cleanup()
+
+	if err := d.Exec("CREATE TABLE t(id INT, v TEXT);"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Exec("INSERT INTO t VALUES (1, 'a'), (2);"); err == nil {
+		t.Errorf("INSERT with a short row should fail")
+	}
+	assertRows(t, d, "SELECT COUNT(*) FROM t;", [][]string{{"0"}})
+
+	var values []string
+	for i := 0; i < 300; i++ {
+		values = append(values, fmt.Sprintf("(%d, '%s')", i, strings.Repeat("x", 100)))
+	}
+	values = append(values, "(300, no_such_column)")
+	if err := d.Exec("INSERT INTO t VALUES " + strings.Join(values, ", ") + ";"); err == nil {
+		t.Errorf("INSERT with a bad expression should fail")
+	}
+	assertRows(t, d, "SELECT COUNT(*) FROM t;", [][]string{{"0"}})
+	assertIntegrityOK(t, d)
+
+	// 内存中的表和回滚之后的文件一致，之后的语句照常执行
+	if err := d.Exec("INSERT INTO t VALUES (1, 'a');"); err != nil {
+		t.Fatal(err)
+	}
+	assertRows(t, d, "SELECT id, v FROM t;", [][]string{{"1", "a"}})
+	if err := d.Exec("CREATE TABLE t(x);"); err == nil {
+		t.Errorf("creating an existing table should fail")
+	}
+	if err := d.Exec("CREATE TABLE IF NOT EXISTS t(x);"); err != nil {
+		t.Errorf("CREATE TABLE IF NOT EXISTS: %v", err)
+	}
+	if err := d.Exec("DROP TABLE missing;"); err == nil {
+		t.Errorf("dropping a missing table should fail")
+	}
+	if err := d.Exec("UPDATE t SET v = 1;"); err == nil {
+		t.Errorf("unsupported statement should fail")
+	}
+}
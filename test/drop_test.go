@@ -0,0 +1,128 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"mySQLite/store"
+)
+
+func TestDropTable(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_drop.db")
+	defer cleanup()
+
+	d.Exec("CREATE TABLE big(id INT, name TEXT);")
+	d.Exec("CREATE TABLE keep(id INT);")
+	d.Exec("CREATE INDEX idx_big_name ON big(name);")
+	for i := 0; i < 400; i++ {
+		d.Exec(fmt.Sprintf("INSERT INTO big VALUES (%d, 'name-%d');", i, i))
+	}
+	d.Exec("INSERT INTO keep VALUES (7);")
+
+	tablePages, err := store.TreePages(d.Pager, d.Tables["big"].RootPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexPages, err := store.TreePages(d.Pager, d.Indexes["idx_big_name"].RootPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageCount := d.Pager.PageCount()
+
+	d.Exec("DROP TABLE big;")
+	if _, ok := d.Tables["big"]; ok {
+		t.Fatalf("table still present after DROP")
+	}
+	if _, ok := d.Indexes["idx_big_name"]; ok {
+		t.Fatalf("index still present after DROP")
+	}
+	free, err := d.Pager.FreePages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(free) != len(tablePages)+len(indexPages) {
+		t.Errorf("freelist has %d pages, want %d", len(free), len(tablePages)+len(indexPages))
+	}
+	if _, err := d.Query("SELECT * FROM big;"); err == nil {
+		t.Errorf("expected error selecting from dropped table")
+	}
+	d.Exec("DROP TABLE IF EXISTS big;")
+
+	// 重新打开后表不再存在，新建的表复用空闲页，文件不增长
+	d = reopenTestDB(t, d, "test_drop.db")
+	if _, ok := d.Tables["big"]; ok {
+		t.Fatalf("dropped table recovered after reopen")
+	}
+	assertRows(t, d, "SELECT * FROM keep;", [][]string{{"7"}})
+	d.Exec("CREATE TABLE again(id INT, name TEXT);")
+	for i := 0; i < 400; i++ {
+		d.Exec(fmt.Sprintf("INSERT INTO again VALUES (%d, 'name-%d');", i, i))
+	}
+	if d.Pager.PageCount() != pageCount {
+		t.Errorf("page count grew from %d to %d, freed pages not reused", pageCount, d.Pager.PageCount())
+	}
+	assertRows(t, d, "SELECT COUNT(*) FROM again;", [][]string{{"400"}})
+}
+
+// 空闲链表损坏时分配页返回错误，不会当作空链表在文件末尾继续分配
+func TestAllocateCorruptFreelist(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_drop_freelist.db")
+	defer cleanup()
+	d.Exec("CREATE TABLE t(id INT);")
+	d.Exec("DROP TABLE t;")
+	free, err := d.Pager.FreePages()
+	if err != nil || len(free) == 0 {
+		t.Fatalf("freelist %v, %v", free, err)
+	}
+	writeTestPage(t, d.Pager, free[0], store.NewLeafPage())
+
+	pageCount := d.Pager.PageCount()
+	if n, err := d.Pager.AllocatePage(); err == nil {
+		t.Errorf("allocated page %d from a corrupt freelist", n)
+	}
+	if d.Pager.PageCount() != pageCount {
+		t.Errorf("page count changed from %d to %d", pageCount, d.Pager.PageCount())
+	}
+}
+
+// DROP TABLE 的某一次写失败时整条语句回滚：表和索引都还在，释放的页没有提交
+func TestDropTableFault(t *testing.T) {
+	for _, shadow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("shadow=%v", shadow), func(t *testing.T) {
+			for k := 1; ; k++ {
+				mem := store.NewMemVFS()
+				d, pager := openTestDB(t, "test_drop_fault.db", store.Options{VFS: mem, Shadow: shadow})
+				d.Exec("CREATE TABLE big(id INT, name TEXT);")
+				d.Exec("CREATE INDEX idx_big_name ON big(name);")
+				d.Exec("CREATE TABLE keep(id INT);")
+				for i := 0; i < 200; i++ {
+					d.Exec(fmt.Sprintf("INSERT INTO big VALUES (%d, 'name-%d');", i, i))
+				}
+				pager.Close()
+
+				fv := store.NewFaultVFS(mem)
+				d, pager = openTestDB(t, "test_drop_fault.db", store.Options{VFS: fv})
+				fv.SetFault(store.Fault{At: k, Kind: store.FaultError})
+				err := d.Exec("DROP TABLE big;")
+				faulted := fv.Ops() >= k
+				pager.Close()
+
+				// 完整性检查发现元数据指向已经释放的页。语句成功时表已经删除；
+				// 提交点之后的 Sync 出错时语句返回错误但已经提交，表也可能已经删除
+				d, _ = openTestDB(t, "test_drop_fault.db", store.Options{VFS: mem})
+				assertIntegrityOK(t, d)
+				_, exists := d.Tables["big"]
+				if err == nil && exists {
+					t.Fatalf("fault at operation %d: table still present after DROP", k)
+				}
+				if exists {
+					assertRows(t, d, "SELECT COUNT(*) FROM big;", [][]string{{"200"}})
+					assertRows(t, d, "SELECT id FROM big WHERE name = 'name-7';", [][]string{{"7"}})
+				}
+				if !faulted {
+					break
+				}
+			}
+		})
+	}
+}
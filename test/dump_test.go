@@ -0,0 +1,105 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// 导出后在新数据库中重放，再次导出的结果和查询结果都应该相同
+func TestDumpRoundTrip(t *testing.T) {
+	src, cleanup := createTestDB(t, "test_dump_src.db")
+	defer cleanup()
+
+	src.Exec(`CREATE TABLE "order items"(id INT, "select" TEXT, price REAL, data BLOB, misc);`)
+	src.Exec(`INSERT INTO "order items" VALUES (1, 'it''s; here', -2.5, X'00ff0a27', NULL);`)
+	src.Exec(`INSERT INTO "order items" VALUES (2, 'two
+lines -- not a comment', 1e20, NULL, 'text');`)
+	src.Exec(`INSERT INTO "order items" VALUES (3, '中文', 0.1, X'', -7);`)
+	src.Exec(`INSERT INTO "order items" VALUES (4, X'ff00', 3, X'41', 4.5);`)
+	src.Exec(`ALTER TABLE "order items" ADD COLUMN note TEXT DEFAULT 'n/a';`)
+	src.Exec(`CREATE INDEX items_price ON "order items"(price);`)
+	src.Exec(`CREATE TABLE empty(a INT);`)
+
+	var dump bytes.Buffer
+	if err := src.Dump(&dump); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(dump.String(), "BEGIN TRANSACTION;\n") || !strings.HasSuffix(dump.String(), "\nCOMMIT;\n") {
+		t.Errorf("dump should be one transaction:\n%s", dump.String())
+	}
+	for _, want := range []string{
+		`CREATE TABLE empty(a INT);`,
+		`INSERT INTO "order items" VALUES (1, 'it''s; here', -2.5, X'00ff0a27', NULL, 'n/a');`,
+		`INSERT INTO "order items" VALUES (4, X'ff00', 3.0, X'41', 4.5, 'n/a');`,
+		`CREATE INDEX items_price ON "order items"(price);`,
+	} {
+		if !strings.Contains(dump.String(), want+"\n") {
+			t.Errorf("dump should contain %s\n%s", want, dump.String())
+		}
+	}
+
+	dst, cleanup2 := createTestDB(t, "test_dump_dst.db")
+	defer cleanup2()
+	if err := dst.ExecScript(bytes.NewReader(dump.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	var again bytes.Buffer
+	if err := dst.Dump(&again); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != dump.String() {
+		t.Errorf("dump after replay differs:\n%s\nwant:\n%s", again.String(), dump.String())
+	}
+
+	for _, sql := range []string{
+		`SELECT id, "select", price, data, misc, note FROM "order items";`,
+		`SELECT id FROM "order items" WHERE price = 0.1;`,
+		`SELECT typeof(price), typeof(data), length(data) FROM "order items";`,
+	} {
+		assertRows(t, dst, sql, queryStrings(t, src, sql))
+	}
+	if _, ok := dst.Indexes["items_price"]; !ok {
+		t.Errorf("index was not restored")
+	}
+
+	var one bytes.Buffer
+	if err := src.Dump(&one, "empty"); err != nil {
+		t.Fatal(err)
+	}
+	if one.String() != "BEGIN TRANSACTION;\nCREATE TABLE empty(a INT);\nCOMMIT;\n" {
+		t.Errorf("dump of one table = %q", one.String())
+	}
+	if err := src.Dump(&one, "missing"); err == nil {
+		t.Errorf("dumping a missing table should fail")
+	}
+}
+
+// 重放中途出错或者导出的文件不完整时整个重放回滚，不会留下导入了一半的数据库
+func TestExecScriptRollsBack(t *testing.T) {
+	src, cleanup := createTestDB(t, "test_dump_src.db")
+	defer cleanup()
+	src.Exec("CREATE TABLE a(id INT, v TEXT);")
+	src.Exec("CREATE TABLE b(id INT);")
+	for i := 0; i < 50; i++ {
+		src.Exec(fmt.Sprintf("INSERT INTO a VALUES (%d, 'row %d');", i, i))
+	}
+	src.Exec("INSERT INTO b VALUES (1);")
+	dump := dumpString(t, src)
+
+	bad := strings.Replace(dump, "INSERT INTO b VALUES (1);", "INSERT INTO b VALUES (1, 2);", 1)
+	truncated := dump[:strings.Index(dump, "CREATE TABLE b")]
+	for name, script := range map[string]string{"failing statement": bad, "truncated": truncated} {
+		dst, cleanup := createTestDB(t, "test_dump_dst.db")
+		defer cleanup()
+		if err := dst.ExecScript(strings.NewReader(script)); err == nil {
+			t.Errorf("%s: replay should fail", name)
+		}
+		assertRows(t, dst, "SELECT COUNT(*) FROM mydb_master;", [][]string{{"0"}})
+		if err := dst.Exec("BEGIN;"); err != nil {
+			t.Errorf("%s: transaction left open: %v", name, err)
+		}
+		dst.Exec("ROLLBACK;")
+	}
+}
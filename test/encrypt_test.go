@@ -0,0 +1,155 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mySQLite/store"
+)
+
+func TestEncryption(t *testing.T) {
+	for _, shadow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("shadow=%v", shadow), func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "encrypt.db")
+			opts := store.Options{Shadow: shadow, Passphrase: "correct horse", KDFIterations: 1000}
+			d, pager := openTestDB(t, filename, opts)
+			d.Exec("CREATE TABLE secrets(id TEXT, v TEXT);")
+			d.Exec("CREATE INDEX secrets_v ON secrets(v);")
+			for i := 0; i < 300; i++ {
+				d.Exec(fmt.Sprintf("INSERT INTO secrets VALUES ('%03d', 'plaintext-%d');", i, i))
+			}
+			want := dumpString(t, d)
+
+			// 回滚日志中的页也是加密的；没有提交的事务在重新打开时回滚
+			pager.Begin()
+			d.Pager.WritePage(d.Tables["secrets"].RootPage, store.NewLeafPage().ToBytesMust())
+			if !shadow {
+				journal, _ := os.ReadFile(filename + "-journal")
+				if len(journal) == 0 || bytes.Contains(journal, []byte("plaintext-")) {
+					t.Errorf("journal is missing or contains plaintext")
+				}
+			}
+			pager.Close()
+
+			data, _ := os.ReadFile(filename)
+			if bytes.Contains(data, []byte("plaintext-")) || bytes.Contains(data, []byte("secrets")) {
+				t.Fatalf("database file contains plaintext")
+			}
+			if _, err := store.OpenPager(filename); !errors.Is(err, store.ErrKeyRequired) {
+				t.Errorf("opening without a passphrase: got %v, want ErrKeyRequired", err)
+			}
+			wrong := opts
+			wrong.Passphrase = "wrong horse"
+			if _, err := store.OpenPagerWithOptions(filename, wrong); !errors.Is(err, store.ErrWrongKey) {
+				t.Errorf("opening with a wrong passphrase: got %v, want ErrWrongKey", err)
+			}
+
+			d, pager = openTestDB(t, filename, store.Options{Passphrase: "correct horse"})
+			if !pager.Encrypted() || pager.ShadowPaging() != shadow {
+				t.Fatalf("format not detected when reopening")
+			}
+			if got := dumpString(t, d); got != want {
+				t.Errorf("contents changed after reopening")
+			}
+			d.Exec("DROP INDEX secrets_v;")
+			d.Exec("VACUUM;")
+			assertIntegrityOK(t, d)
+			if _, err := os.Stat(filename + "-vacuum"); err == nil {
+				t.Errorf("VACUUM left its temporary file")
+			}
+
+			// VACUUM INTO 的副本用同一个口令打开
+			target := filepath.Join(t.TempDir(), "encrypt_copy.db")
+			d.Exec(fmt.Sprintf("VACUUM INTO '%s';", target))
+			copied, _ := os.ReadFile(target)
+			if len(copied) == 0 || bytes.Contains(copied, []byte("plaintext-")) {
+				t.Errorf("VACUUM INTO copy is missing or contains plaintext")
+			}
+			c, _ := openTestDB(t, target, store.Options{Passphrase: "correct horse"})
+			assertRows(t, c, "SELECT v FROM secrets WHERE id = '042';", [][]string{{"plaintext-42"}})
+			pager.Close()
+
+			// 改掉第 3 页之后每页的一个字节：认证失败，而不是读出错误的数据。
+			// 影子分页模式下页表页出错，打开就失败
+			data, _ = os.ReadFile(filename)
+			stride := store.PageSize + 28
+			for off := 2 * stride; off < len(data); off += stride {
+				data[off+100] ^= 0xff
+			}
+			os.WriteFile(filename, data, 0644)
+			pager, err := store.OpenPagerWithOptions(filename, store.Options{Passphrase: "correct horse"})
+			if err == nil {
+				defer pager.Close()
+				_, err = pager.ReadPage(3)
+			}
+			if !errors.Is(err, store.ErrCorrupt) {
+				t.Errorf("reading a tampered file: got %v, want ErrCorrupt", err)
+			}
+		})
+	}
+}
+
+func TestEncryptionKey(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "encrypt_key.db")
+	key := bytes.Repeat([]byte{7}, 32)
+	d, pager := openTestDB(t, filename, store.Options{Key: key})
+	d.Exec("CREATE TABLE t(id INT);")
+	d.Exec("INSERT INTO t VALUES (1), (2);")
+	pager.Close()
+
+	if _, err := store.OpenPagerWithOptions(filename, store.Options{Key: bytes.Repeat([]byte{8}, 32)}); !errors.Is(err, store.ErrWrongKey) {
+		t.Errorf("opening with a wrong key: got %v, want ErrWrongKey", err)
+	}
+	if _, err := store.OpenPagerWithOptions(filename, store.Options{Passphrase: "x"}); err == nil {
+		t.Errorf("opening a database with an application key by passphrase should fail")
+	}
+	d, _ = openTestDB(t, filename, store.Options{Key: key})
+	assertRows(t, d, "SELECT id FROM t;", [][]string{{"1"}, {"2"}})
+
+	plain := filepath.Join(t.TempDir(), "encrypt_plain.db")
+	_, pager = openTestDB(t, plain, store.Options{})
+	pager.Close()
+	if _, err := store.OpenPagerWithOptions(plain, store.Options{Key: key}); err == nil {
+		t.Errorf("opening an unencrypted database with a key should fail")
+	}
+}
+
+func TestEncryptionZeroPage(t *testing.T) {
+	for _, shadow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("shadow=%v", shadow), func(t *testing.T) {
+			mem := store.NewMemVFS()
+			opts := store.Options{VFS: mem, Shadow: shadow, Key: bytes.Repeat([]byte{7}, 32)}
+			d, pager := openTestDB(t, "zero.db", opts)
+			d.Exec("CREATE TABLE t(id INT, v TEXT);")
+			for i := 0; i < 100; i++ {
+				d.Exec(fmt.Sprintf("INSERT INTO t VALUES (%d, 'row %d');", i, i))
+			}
+			pager.Close()
+
+			// 把第 2 页之后已经提交的页全部改成 0：不能当作没有写过的页通过认证
+			f, err := mem.Open("zero.db")
+			if err != nil {
+				t.Fatal(err)
+			}
+			size, _ := f.Size()
+			stride := int64(store.PageSize + 28)
+			for off := stride; off+stride <= size; off += stride {
+				f.WriteAt(make([]byte, stride), off)
+			}
+			f.Close()
+
+			pager, err = store.OpenPagerWithOptions("zero.db", opts)
+			if err == nil {
+				defer pager.Close()
+				_, err = pager.ReadPage(2)
+			}
+			if !errors.Is(err, store.ErrCorrupt) {
+				t.Errorf("reading zeroed pages: got %v, want ErrCorrupt", err)
+			}
+		})
+	}
+}
@@ -2,18 +2,20 @@ package test
 
 import (
 	"fmt"
-	"os"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
 	"mySQLite/store"
 )
 
 func TestInsertSplitAndNewRoot(t *testing.T) {
-	os.Remove("test.db")
-	pager, _ := store.OpenPager("test.db")
+	pager, _ := store.OpenPagerWithOptions("test.db", store.Options{VFS: store.NewMemVFS()})
 	defer pager.Close()
 
-	rootPage := pager.AllocatePage()
+	rootPage, _ := pager.AllocatePage()
 
 	page := store.NewLeafPage()
 	data, _ := page.ToBytes()
@@ -73,3 +75,189 @@ func PrintChildren(pager *store.Pager, page *store.Page) {
 		fmt.Printf("  ➤ Page %d: %s (%d cells)\n", pno, typ, len(childPage.Cells))
 	}
 }
+
+// newInsertTree 在内存中的数据库上建一棵只有一个空叶子的树，返回根页号
+func newInsertTree(t *testing.T) (*store.Pager, int) {
+	t.Helper()
+	pager, err := store.OpenPagerWithOptions("test_insert.db", store.Options{VFS: store.NewMemVFS()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pager.Close() })
+	rootPage := allocTestPage(t, pager)
+	if err := pager.WritePage(rootPage, store.NewLeafPage().ToBytesMust()); err != nil {
+		t.Fatal(err)
+	}
+	return pager, rootPage
+}
+
+func insertTestRow(t *testing.T, pager *store.Pager, rootPage int, row ...string) int {
+	t.Helper()
+	encoded, err := store.EncodeRow(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootPage, err = store.InsertRow(pager, rootPage, encoded)
+	if err != nil {
+		t.Fatalf("InsertRow(%q): %v", row[0], err)
+	}
+	return rootPage
+}
+
+func TestInsertRandomOrderScanSorted(t *testing.T) {
+	pager, rootPage := newInsertTree(t)
+
+	total := 5000
+	for _, i := range rand.New(rand.NewSource(42)).Perm(total) {
+		rootPage = insertTestRow(t, pager, rootPage, fmt.Sprintf("%d", i), fmt.Sprintf("user%d", i))
+	}
+
+	// 叶子链遍历应按 key 有序且不丢行
+	var keys []string
+	err := store.ScanRows(pager, rootPage, func(row []byte) error {
+		key, err := store.ExtractKey(row)
+		keys = append(keys, key)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("ScanRows failed: %v", err)
+	}
+	if len(keys) != total {
+		t.Fatalf("scanned %d rows, want %d", len(keys), total)
+	}
+	if !sort.StringsAreSorted(keys) {
+		t.Errorf("scan is not in key order")
+	}
+	for i := 0; i < total; i += 97 {
+		if _, err := store.SearchRow(pager, rootPage, fmt.Sprintf("%d", i)); err != nil {
+			t.Errorf("SearchRow(%d): %v", i, err)
+		}
+	}
+}
+
+func TestInsertLeafSorted(t *testing.T) {
+	pager, rootPage := newInsertTree(t)
+	for _, row := range [][]string{{"c", "1"}, {"a", "2"}, {"b", "3"}, {"a", "4"}} {
+		if got := insertTestRow(t, pager, rootPage, row...); got != rootPage {
+			t.Fatalf("root changed to %d without a split", got)
+		}
+	}
+
+	// 叶子内部按 key 有序，相同的 key 排在已有记录之后
+	var got [][]string
+	for _, cell := range readTestPage(t, pager, rootPage).Cells {
+		row, err := store.DecodeRow(cell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, row)
+	}
+	want := [][]string{{"a", "2"}, {"a", "4"}, {"b", "3"}, {"c", "1"}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("leaf cells %v, want %v", got, want)
+	}
+}
+
+func TestInsertSplitKeepsLeafChain(t *testing.T) {
+	pager, rootPage := newInsertTree(t)
+	value := strings.Repeat("v", 500)
+
+	// 先按顺序插入偶数，得到若干叶子；再插入奇数，分裂中间的叶子
+	var want []string
+	for i := 0; i < 200; i += 2 {
+		rootPage = insertTestRow(t, pager, rootPage, fmt.Sprintf("%04d", i), value)
+		want = append(want, fmt.Sprintf("%04d", i))
+	}
+	for i := 101; i < 141; i += 2 {
+		rootPage = insertTestRow(t, pager, rootPage, fmt.Sprintf("%04d", i), value)
+		want = append(want, fmt.Sprintf("%04d", i))
+	}
+	sort.Strings(want)
+
+	// 从最左边的叶子沿 NextLeaf 走到链尾，中间分裂出的页都要接在链上
+	pageNo := rootPage
+	page := readTestPage(t, pager, pageNo)
+	for page.Type == store.PageInternal {
+		pageNo = int(page.LeftChild)
+		page = readTestPage(t, pager, pageNo)
+	}
+	var keys []string
+	leaves := 0
+	for {
+		leaves++
+		for _, cell := range page.Cells {
+			key, err := store.ExtractKey(cell)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys = append(keys, key)
+		}
+		if page.NextLeaf == 0 {
+			break
+		}
+		page = readTestPage(t, pager, int(page.NextLeaf))
+	}
+	if leaves < 10 {
+		t.Fatalf("only %d leaves, the test did not split enough", leaves)
+	}
+	if fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Errorf("leaf chain has keys %v, want %v", keys, want)
+	}
+}
+
+func TestInsertInternalSplit(t *testing.T) {
+	pager, rootPage := newInsertTree(t)
+
+	// 长 key 让内部页只能放十几个 cell，很快分裂到三层
+	key := func(i int) string { return fmt.Sprintf("%04d%s", i, strings.Repeat("k", 250)) }
+	order := rand.New(rand.NewSource(7)).Perm(600)
+	for _, i := range order {
+		rootPage = insertTestRow(t, pager, rootPage, key(i), "v")
+	}
+
+	depth := 1
+	for page := readTestPage(t, pager, rootPage); page.Type == store.PageInternal; depth++ {
+		page = readTestPage(t, pager, int(page.LeftChild))
+	}
+	if depth < 3 {
+		t.Fatalf("tree depth %d, want at least 3", depth)
+	}
+	// 每个子树的 key 都在父页给出的范围内
+	problems, err := store.CheckIntegrity(pager, []store.TreeRoot{{Name: "t", Root: rootPage}})
+	if err != nil || len(problems) > 0 {
+		t.Fatalf("integrity check: %v %v", err, problems)
+	}
+	for _, i := range order {
+		if _, err := store.SearchRow(pager, rootPage, key(i)); err != nil {
+			t.Errorf("SearchRow(%d): %v", i, err)
+		}
+	}
+}
+
+func TestInsertDuplicateKeys(t *testing.T) {
+	pager, rootPage := newInsertTree(t)
+
+	// 重复的 "b" 分到两个叶子，父页的分隔键是 "b"；再往左边的叶子插入一条大的 "a"，
+	// 它分裂出的右页以 "b" 开头。新页必须紧跟在左边的叶子后面，
+	// 不能按 key 放到已有的分隔键 "b" 后面
+	for i := 0; i < 5; i++ {
+		rootPage = insertTestRow(t, pager, rootPage, "b", fmt.Sprintf("b%d%s", i, strings.Repeat("v", 1000)))
+	}
+	rootPage = insertTestRow(t, pager, rootPage, "a", "a0"+strings.Repeat("v", 2500))
+	problems, err := store.CheckIntegrity(pager, []store.TreeRoot{{Name: "t", Root: rootPage}})
+	if err != nil || len(problems) > 0 {
+		t.Fatalf("integrity check: %v %v", err, problems)
+	}
+
+	// 相同 key 的记录按插入的先后排列
+	var got []string
+	store.ScanRows(pager, rootPage, func(rec []byte) error {
+		row, err := store.DecodeRow(rec)
+		got = append(got, row[1][:2])
+		return err
+	})
+	want := []string{"a0", "b0", "b1", "b2", "b3", "b4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("scan = %v, want %v", got, want)
+	}
+}
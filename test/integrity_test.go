@@ -0,0 +1,188 @@
+package test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mySQLite/db"
+	"mySQLite/store"
+)
+
+// 各种正常操作之后检查应该没有问题
+func TestIntegrityCheckHealthy(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_integrity_ok.db")
+	defer cleanup()
+
+	d.Exec("CREATE TABLE a(id TEXT, n INT, note TEXT);")
+	d.Exec("CREATE INDEX a_n ON a(n);")
+	for i := 0; i < 400; i++ {
+		d.Exec(fmt.Sprintf("INSERT INTO a VALUES ('%03d', %d, '%s');", i*7%400, i%13, strings.Repeat("x", i%50)))
+	}
+	d.Exec("DELETE FROM a WHERE n = 3;")
+	d.Exec("ALTER TABLE a ADD COLUMN extra INT DEFAULT 1;")
+	d.Exec("CREATE INDEX a_note ON a(note);")
+	d.Exec("CREATE TABLE b(id INT);")
+	d.Exec("INSERT INTO b VALUES (1), (2);")
+	d.Exec("DROP TABLE b;")
+	d.ImportCSV(strings.NewReader("k,v\na,1\nb,2\n"), "c")
+
+	problems, err := d.IntegrityCheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		t.Errorf("unexpected problem: %s", p)
+	}
+	assertRows(t, d, "PRAGMA integrity_check;", [][]string{{"ok"}})
+}
+
+// corruptTree 建一张有几层的表，返回数据库、表的根页和中序排列的叶子页
+func corruptTree(t *testing.T, filename string) (*db.Database, int, []int) {
+	d, cleanup := createTestDB(t, filename)
+	t.Cleanup(cleanup)
+	d.Exec("CREATE TABLE t(id TEXT, v TEXT);")
+	d.Exec("CREATE INDEX t_v ON t(v);")
+	for i := 0; i < 300; i++ {
+		d.Exec(fmt.Sprintf("INSERT INTO t VALUES ('%04d', '%s');", i, strings.Repeat("v", 40)))
+	}
+	root := d.Tables["t"].RootPage
+	var leaves []int
+	var walk func(pageNo int)
+	walk = func(pageNo int) {
+		page := readTestPage(t, d.Pager, pageNo)
+		if page.Type == store.PageLeaf {
+			leaves = append(leaves, pageNo)
+			return
+		}
+		walk(int(page.LeftChild))
+		for _, cell := range page.Cells {
+			_, child, _ := store.DecodeInternalCell(cell)
+			walk(int(child))
+		}
+	}
+	walk(root)
+	if len(leaves) < 3 {
+		t.Fatalf("tree has only %d leaves", len(leaves))
+	}
+	return d, root, leaves
+}
+
+func readTestPage(t *testing.T, pager *store.Pager, pageNo int) *store.Page {
+	t.Helper()
+	raw, err := pager.ReadPage(pageNo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := store.PageFromBytes(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func allocTestPage(t *testing.T, pager *store.Pager) int {
+	t.Helper()
+	n, err := pager.AllocatePage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func writeTestPage(t *testing.T, pager *store.Pager, pageNo int, page *store.Page) {
+	t.Helper()
+	data, err := page.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pager.WritePage(pageNo, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIntegrityCheckFindsCorruption(t *testing.T) {
+	cases := []struct {
+		name    string
+		corrupt func(t *testing.T, d *db.Database, root int, leaves []int)
+		want    string
+	}{
+		{"page type", func(t *testing.T, d *db.Database, root int, leaves []int) {
+			raw, _ := d.Pager.ReadPage(leaves[1])
+			raw[0] = 0x42
+			d.Pager.WritePage(leaves[1], raw)
+		}, "invalid page type 0x42"},
+		{"cell offset", func(t *testing.T, d *db.Database, root int, leaves []int) {
+			raw, _ := d.Pager.ReadPage(leaves[1])
+			binary.LittleEndian.PutUint16(raw[9:], 3)
+			d.Pager.WritePage(leaves[1], raw)
+		}, "cell 0 offset 3 out of bounds"},
+		{"bad record", func(t *testing.T, d *db.Database, root int, leaves []int) {
+			page := readTestPage(t, d.Pager, leaves[0])
+			page.Cells[2] = []byte{9, 0, 0, 0, 1, 0, 0, 0, 'x'}
+			writeTestPage(t, d.Pager, leaves[0], page)
+		}, "cell 2: invalid field count 9"},
+		{"order within page", func(t *testing.T, d *db.Database, root int, leaves []int) {
+			page := readTestPage(t, d.Pager, leaves[1])
+			page.Cells[0], page.Cells[1] = page.Cells[1], page.Cells[0]
+			writeTestPage(t, d.Pager, leaves[1], page)
+		}, "is out of order after"},
+		{"separator bound", func(t *testing.T, d *db.Database, root int, leaves []int) {
+			page := readTestPage(t, d.Pager, leaves[1])
+			rec, _ := store.EncodeRow([]string{"9999", "late"})
+			page.Cells = append(page.Cells, rec)
+			writeTestPage(t, d.Pager, leaves[1], page)
+		}, `key "9999" in cell`},
+		{"next leaf", func(t *testing.T, d *db.Database, root int, leaves []int) {
+			page := readTestPage(t, d.Pager, leaves[0])
+			page.NextLeaf = uint32(leaves[2])
+			writeTestPage(t, d.Pager, leaves[0], page)
+		}, "but the next leaf in key order is"},
+		{"double reference", func(t *testing.T, d *db.Database, root int, leaves []int) {
+			page := readTestPage(t, d.Pager, root)
+			key, _, _ := store.DecodeInternalCell(page.Cells[0])
+			page.Cells[0] = store.EncodeInternalCell(key, page.LeftChild)
+			writeTestPage(t, d.Pager, root, page)
+		}, "is already used by t"},
+		{"leaked page", func(t *testing.T, d *db.Database, root int, leaves []int) {
+			n := allocTestPage(t, d.Pager)
+			writeTestPage(t, d.Pager, n, store.NewLeafPage())
+		}, "page is neither used by a tree nor on the freelist"},
+		{"freelist count", func(t *testing.T, d *db.Database, root int, leaves []int) {
+			n := allocTestPage(t, d.Pager)
+			writeTestPage(t, d.Pager, n, store.NewLeafPage())
+			d.Pager.FreePage(n)
+			raw, _ := d.Pager.ReadPage(1)
+			binary.LittleEndian.PutUint32(raw[store.PageSize-store.FileHeaderSize+12:], 5)
+			d.Pager.WritePage(1, raw)
+		}, "file header counts 5 free pages, the list has 1"},
+		{"index entries", func(t *testing.T, d *db.Database, root int, leaves []int) {
+			idx := d.Indexes["t_v"]
+			rec, _ := store.EncodeRow([]string{"zzz\x01x", "x"})
+			newRoot, _ := store.InsertRow(d.Pager, idx.RootPage, rec)
+			idx.RootPage = newRoot
+		}, "index has 301 entries, table t has 300 rows"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d, root, leaves := corruptTree(t, "test_integrity.db")
+			c.corrupt(t, d, root, leaves)
+			problems, err := d.IntegrityCheck()
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := false
+			for _, p := range problems {
+				found = found || strings.Contains(p.String(), c.want)
+			}
+			if !found {
+				t.Errorf("problems %v should include %q", problems, c.want)
+			}
+			rs, err := d.Query("PRAGMA integrity_check(1);")
+			if err != nil || len(rs.Rows) != 1 || rs.Rows[0][0].String() == "ok" {
+				t.Errorf("PRAGMA integrity_check(1) = %v, %v", rs, err)
+			}
+		})
+	}
+}
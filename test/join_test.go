@@ -0,0 +1,164 @@
+package test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"mySQLite/db"
+	"mySQLite/store"
+)
+
+func createShop(t *testing.T, filename string) (*db.Database, func()) {
+	d, cleanup := createTestDB(t, filename)
+	d.Exec("CREATE TABLE users(id INT, name TEXT);")
+	d.Exec("CREATE TABLE orders(oid INT, user_id INT, item TEXT);")
+	d.Exec("CREATE TABLE colors(name TEXT);")
+	d.Exec("INSERT INTO users VALUES (1, 'ann'), (2, 'bob'), (3, 'cat');")
+	d.Exec("INSERT INTO orders VALUES (10, 1, 'pen'), (11, 1, 'ink'), (12, 3, 'cup'), (13, 9, 'hat');")
+	d.Exec("INSERT INTO colors VALUES ('red'), ('blue');")
+	return d, cleanup
+}
+
+func TestJoinKinds(t *testing.T) {
+	d, cleanup := createShop(t, "test_join.db")
+	defer cleanup()
+
+	want := [][]string{{"ann", "ink"}, {"ann", "pen"}, {"cat", "cup"}}
+	assertRows(t, d, "SELECT u.name, o.item FROM users u JOIN orders o ON o.user_id = u.id ORDER BY 1, 2;", want)
+	assertRows(t, d, "SELECT users.name, item FROM users INNER JOIN orders ON users.id = orders.user_id ORDER BY 1, 2;", want)
+	assertRows(t, d, "SELECT u.name, o.item FROM users u, orders o WHERE u.id = o.user_id ORDER BY 1, 2;", want)
+
+	assertRows(t, d, "SELECT u.name, o.item FROM users u LEFT JOIN orders o ON o.user_id = u.id ORDER BY 1, 2;",
+		[][]string{{"ann", "ink"}, {"ann", "pen"}, {"bob", "NULL"}, {"cat", "cup"}})
+	// WHERE 中涉及 LEFT JOIN 内表的条件在补 NULL 之后求值
+	assertRows(t, d, "SELECT u.name FROM users u LEFT OUTER JOIN orders o ON o.user_id = u.id WHERE o.oid IS NULL;",
+		[][]string{{"bob"}})
+	// ON 中的条件只决定匹配，不过滤外表
+	assertRows(t, d, "SELECT u.name, o.item FROM users u LEFT JOIN orders o ON o.user_id = u.id AND o.item = 'cup' ORDER BY 1;",
+		[][]string{{"ann", "NULL"}, {"bob", "NULL"}, {"cat", "cup"}})
+
+	assertRows(t, d, "SELECT COUNT(*) FROM users CROSS JOIN colors;", [][]string{{"6"}})
+	assertRows(t, d, "SELECT u.name, c.name FROM users u, colors c WHERE u.id = 1 ORDER BY 2;",
+		[][]string{{"ann", "blue"}, {"ann", "red"}})
+
+	assertRows(t, d, "SELECT u.name, COUNT(o.oid) FROM users u LEFT JOIN orders o ON o.user_id = u.id GROUP BY u.id;",
+		[][]string{{"ann", "2"}, {"bob", "0"}, {"cat", "1"}})
+
+	if _, err := d.Query("SELECT name FROM users JOIN colors;"); err == nil {
+		t.Errorf("expected ambiguous column error")
+	}
+}
+
+func explain(t *testing.T, d *db.Database, sql string) []string {
+	t.Helper()
+	var details []string
+	for _, row := range queryStrings(t, d, "EXPLAIN QUERY PLAN "+sql) {
+		details = append(details, row[0])
+	}
+	return details
+}
+
+func TestJoinStrategy(t *testing.T) {
+	d, cleanup := createShop(t, "test_join_plan.db")
+	defer cleanup()
+
+	cases := []struct {
+		sql  string
+		want []string
+	}{
+		{"SELECT * FROM orders o JOIN users u ON u.id = o.user_id;",
+			[]string{"SCAN orders AS o", "SEARCH users AS u USING KEY (id=?)"}},
+		{"SELECT * FROM users u JOIN orders o ON o.user_id = u.id;",
+			[]string{"SCAN users AS u", "HASH JOIN orders AS o (user_id=?)"}},
+		{"SELECT * FROM users JOIN colors ON users.name < colors.name;",
+			[]string{"SCAN users", "SCAN colors"}},
+	}
+	for _, c := range cases {
+		if got := explain(t, d, c.sql); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s\n got  %v\n want %v", c.sql, got, c.want)
+		}
+	}
+
+	d.Exec("CREATE INDEX idx_orders_user ON orders(user_id);")
+	sql := "SELECT u.name, o.item FROM users u JOIN orders o ON o.user_id = u.id ORDER BY 1, 2;"
+	want := []string{"SCAN users AS u", "SEARCH orders AS o USING INDEX idx_orders_user (user_id=?)"}
+	if got := explain(t, d, sql); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	assertRows(t, d, sql, [][]string{{"ann", "ink"}, {"ann", "pen"}, {"cat", "cup"}})
+}
+
+// 索引在插入和删除时同步维护，重新打开数据库后仍可使用
+func TestJoinIndexMaintenance(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_join_index.db")
+	defer cleanup()
+
+	d.Exec("CREATE TABLE a(id INT, grp INT);")
+	d.Exec("CREATE TABLE b(id INT, grp INT);")
+	d.Exec("CREATE INDEX idx_b_grp ON b(grp);")
+	for i := 0; i < 300; i++ {
+		d.Exec(fmt.Sprintf("INSERT INTO b VALUES (%d, %d);", i, i%10))
+	}
+	for i := 0; i < 10; i++ {
+		d.Exec(fmt.Sprintf("INSERT INTO a VALUES (%d, %d);", i, i))
+	}
+	d.Exec("DELETE FROM b WHERE key = '5'")
+	d.Exec("DELETE FROM b WHERE key = '15'")
+
+	sql := "SELECT a.grp, COUNT(*) FROM a JOIN b ON b.grp = a.grp GROUP BY a.grp;"
+	if got := explain(t, d, sql); got[1] != "SEARCH b USING INDEX idx_b_grp (grp=?)" {
+		t.Fatalf("unexpected plan %v", got)
+	}
+	// 与不用索引的嵌套循环结果一致
+	loop := queryStrings(t, d, "SELECT a.grp, COUNT(*) FROM a JOIN b ON b.grp + 0 = a.grp GROUP BY a.grp;")
+	indexed := queryStrings(t, d, sql)
+	if !reflect.DeepEqual(indexed, loop) {
+		t.Fatalf("index join %v differs from nested loop %v", indexed, loop)
+	}
+	if indexed[5][1] != "28" || indexed[0][1] != "30" {
+		t.Errorf("unexpected counts %v", indexed)
+	}
+
+	d2 := reopenTestDB(t, d, "test_join_index.db")
+	if _, ok := d2.Indexes["idx_b_grp"]; !ok {
+		t.Fatalf("index not recovered")
+	}
+	if got := queryStrings(t, d2, sql); !reflect.DeepEqual(got, indexed) {
+		t.Errorf("after reopen got %v, want %v", got, indexed)
+	}
+}
+
+// 表的第一列可以重复：DELETE 删掉所有重复的行（可能跨过叶子的边界），每删一行删一条索引记录
+func TestDeleteDuplicateKeys(t *testing.T) {
+	d, cleanup := createTestDB(t, "test_delete_dup.db")
+	defer cleanup()
+
+	d.Exec("CREATE TABLE t(id INT, c TEXT);")
+	d.Exec("CREATE INDEX i ON t(c);")
+	d.Exec("INSERT INTO t VALUES (1, 'a'), (1, 'a'), (2, 'b');")
+	if err := d.Exec("DELETE FROM t WHERE id = 1;"); err != nil {
+		t.Fatal(err)
+	}
+	assertRows(t, d, "SELECT id, c FROM t;", [][]string{{"2", "b"}})
+	assertRows(t, d, "SELECT COUNT(*) FROM t WHERE c = 'a';", [][]string{{"0"}})
+	assertIntegrityOK(t, d)
+
+	d.Exec("CREATE TABLE u(id INT, v TEXT);")
+	d.Exec("CREATE INDEX u_v ON u(v);")
+	d.Exec("CREATE TABLE w(v TEXT);")
+	d.Exec("INSERT INTO w VALUES ('x');")
+	d.Exec("INSERT INTO u VALUES (4, 'x'), (6, 'x');")
+	for i := 0; i < 400; i++ {
+		d.Exec("INSERT INTO u VALUES (5, 'x');")
+	}
+	if root := readTestPage(t, d.Pager, d.Tables["u"].RootPage); root.Type == store.PageLeaf {
+		t.Fatalf("duplicate keys did not span leaves")
+	}
+	if err := d.Exec("DELETE FROM u WHERE id = 5;"); err != nil {
+		t.Fatal(err)
+	}
+	assertRows(t, d, "SELECT COUNT(*), MIN(id), MAX(id) FROM u;", [][]string{{"2", "4", "6"}})
+	assertRows(t, d, "SELECT COUNT(*) FROM w JOIN u ON u.v = w.v;", [][]string{{"2"}})
+	assertIntegrityOK(t, d)
+}
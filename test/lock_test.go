@@ -0,0 +1,219 @@
+package test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mySQLite/db"
+	"mySQLite/store"
+)
+
+// 同一进程中打开同一文件的两个 Pager 之间的锁和两个进程之间相同
+func openPagers(t *testing.T, filename string) (*store.Pager, *store.Pager) {
+	t.Helper()
+	_, p1 := openTestDB(t, filename, store.Options{})
+	_, p2 := openTestDB(t, filename, store.Options{})
+	p1.SetBusyTimeout(20 * time.Millisecond)
+	p2.SetBusyTimeout(20 * time.Millisecond)
+	return p1, p2
+}
+
+func TestFileLockLevels(t *testing.T) {
+	p1, p2 := openPagers(t, filepath.Join(t.TempDir(), "lock.db"))
+
+	// 多个读者可以同时持有 SHARED 锁，有读者时不能写
+	if err := p1.BeginRead(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p2.BeginRead(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p2.EndRead(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p2.BeginWrite(); !errors.Is(err, store.ErrBusy) {
+		t.Fatalf("write while another connection reads: got %v, want ErrBusy", err)
+	}
+	if got := p2.LockLevel(); got != store.LockNone {
+		t.Errorf("lock level after busy = %v, want LockNone", got)
+	}
+	if err := p1.EndRead(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 写者持有 EXCLUSIVE 锁时其他连接既不能读也不能写
+	if err := p1.BeginWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if got := p1.LockLevel(); got != store.LockExclusive {
+		t.Errorf("lock level = %v, want LockExclusive", got)
+	}
+	if err := p2.BeginRead(); !errors.Is(err, store.ErrBusy) {
+		t.Errorf("read while another connection writes: got %v, want ErrBusy", err)
+	}
+	if err := p2.Begin(); !errors.Is(err, store.ErrBusy) {
+		t.Errorf("transaction while another connection writes: got %v, want ErrBusy", err)
+	}
+	if err := p1.EndWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p2.BeginWrite(); err != nil {
+		t.Fatal(err)
+	}
+	p2.EndWrite()
+}
+
+func TestFileLockBusyTimeout(t *testing.T) {
+	p1, p2 := openPagers(t, filepath.Join(t.TempDir(), "lock_timeout.db"))
+	if err := p1.BeginRead(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		p1.EndRead()
+	}()
+	// 等待读者退出之后拿到写锁
+	p2.SetBusyTimeout(5 * time.Second)
+	start := time.Now()
+	if err := p2.BeginWrite(); err != nil {
+		t.Fatalf("write after reader finished: %v", err)
+	}
+	if time.Since(start) < 40*time.Millisecond {
+		t.Errorf("BeginWrite did not wait for the reader")
+	}
+	p2.EndWrite()
+}
+
+// 写入之后，另一个连接加锁时发现文件变化，页数和元数据都会更新
+func TestFileLockSharedDatabase(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "lock_db.db")
+	p1, p2 := openPagers(t, filename)
+	d1 := db.NewDatabase(p1)
+	d2 := db.NewDatabase(p2)
+
+	d1.Exec("CREATE TABLE t(id INT, name TEXT);")
+	d1.Exec("INSERT INTO t VALUES (1, 'a'), (2, 'b');")
+	assertRows(t, d2, "SELECT COUNT(*) FROM t;", [][]string{{"2"}})
+
+	d2.Exec("CREATE INDEX t_name ON t(name);")
+	d2.Exec("INSERT INTO t VALUES (3, 'c');")
+	assertRows(t, d1, "SELECT id FROM t WHERE name = 'c';", [][]string{{"3"}})
+	// d1 重新加载了元数据，插入时维护 d2 建的索引
+	d1.Exec("INSERT INTO t VALUES (5, 'e');")
+	join := "SELECT b.id FROM t a JOIN t b ON b.name = a.name WHERE a.id = 5;"
+	if got := explain(t, d2, join); len(got) != 2 || got[1] != "SEARCH t AS b USING INDEX t_name (name=?)" {
+		t.Errorf("plan = %v, want index search", got)
+	}
+	assertRows(t, d2, join, [][]string{{"5"}})
+
+	// d1 的快照持有读锁，d2 的写入等待超时后放弃
+	s, err := d1.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2.Exec("INSERT INTO t VALUES (4, 'd');")
+	s.Close()
+	assertRows(t, d1, "SELECT COUNT(*) FROM t;", [][]string{{"4"}})
+	if _, err := d2.Query("SELECT COUNT(*) FROM t;"); err != nil {
+		t.Fatal(err)
+	}
+
+	d2.Exec("INSERT INTO t VALUES (4, 'd');")
+	assertRows(t, d1, "SELECT COUNT(*) FROM t;", [][]string{{"5"}})
+}
+
+// 一个连接的事务进行中时，另一个连接打开文件不会把它的日志当成热日志回滚
+func TestFileLockLiveJournal(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "lock_journal.db")
+	p1, _ := openPagers(t, filename)
+	n := allocTestPage(t, p1)
+	page := make([]byte, store.PageSize)
+	copy(page, "committed")
+	p1.WritePage(n, page)
+
+	if err := p1.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	copy(page, "changed!!")
+	p1.WritePage(n, page)
+
+	p3, err := store.OpenPager(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filename + "-journal"); err != nil {
+		t.Errorf("journal of a live transaction was removed: %v", err)
+	}
+	if err := p1.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p3.BeginRead(); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := p3.ReadPage(n)
+	if string(got[:9]) != "changed!!" {
+		t.Errorf("page %d = %q, want committed change", n, got[:9])
+	}
+	p3.EndRead()
+	p3.Close()
+}
+
+// 子进程持有写锁，父进程读不到；子进程退出后锁自动释放
+func TestFileLockAcrossProcesses(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "lock_process.db")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFileLockHelperProcess$")
+	cmd.Env = append(os.Environ(), "MYDB_LOCK_HELPER="+filename)
+	stdin, _ := cmd.StdinPipe()
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer stdin.Close()
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() && scanner.Text() != "locked" {
+	}
+	go io.Copy(io.Discard, stdout)
+
+	pager, err := store.OpenPager(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.Close()
+	pager.SetBusyTimeout(20 * time.Millisecond)
+	if err := pager.BeginRead(); !errors.Is(err, store.ErrBusy) {
+		t.Fatalf("read while another process writes: got %v, want ErrBusy", err)
+	}
+
+	stdin.Close()
+	pager.SetBusyTimeout(5 * time.Second)
+	if err := pager.BeginRead(); err != nil {
+		t.Fatalf("read after the other process exited: %v", err)
+	}
+	pager.EndRead()
+}
+
+func TestFileLockHelperProcess(t *testing.T) {
+	filename := os.Getenv("MYDB_LOCK_HELPER")
+	if filename == "" {
+		t.Skip("helper process for TestFileLockAcrossProcesses")
+	}
+	pager, err := store.OpenPager(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pager.BeginWrite(); err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout.WriteString("locked\n")
+	io.Copy(io.Discard, os.Stdin)
+	pager.EndWrite()
+	pager.Close()
+}
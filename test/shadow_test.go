@@ -0,0 +1,182 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mySQLite/db"
+	"mySQLite/store"
+)
+
+func TestShadowPagingDatabase(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "shadow.db")
+	d, _ := openTestDB(t, filename, store.Options{Shadow: true})
+	d.Exec("CREATE TABLE t(id TEXT, n INT);")
+	d.Exec("CREATE INDEX t_n ON t(n);")
+	for i := 0; i < 150; i++ {
+		d.Exec(fmt.Sprintf("INSERT INTO t VALUES ('k%03d', %d);", i, i%10))
+	}
+	d.Exec("CREATE TABLE gone(id INT);")
+	d.Exec("INSERT INTO gone VALUES (1);")
+	d.Exec("DROP TABLE gone;")
+
+	// 快照引用旧的页表，之后的删除不影响它
+	snap, err := d.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Exec("DELETE FROM t WHERE id = 'k000';")
+	rs, err := snap.Query("SELECT COUNT(*) FROM t;")
+	if err != nil || rs.Rows[0][0].String() != "150" {
+		t.Errorf("snapshot count = %v, %v; want 150", rs, err)
+	}
+	snap.Close()
+
+	// 不带选项打开也能识别影子分页格式
+	d.Pager.Close()
+	pager, err := store.OpenPager(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.Close()
+	if !pager.ShadowPaging() {
+		t.Fatalf("reopened file is not in shadow paging mode")
+	}
+	d = db.NewDatabase(pager)
+	assertRows(t, d, "SELECT COUNT(*), COUNT(DISTINCT id) FROM t;", [][]string{{"149", "149"}})
+	assertRows(t, d, "SELECT COUNT(*) FROM t WHERE n = 3;", [][]string{{"15"}})
+	assertRows(t, d, "SELECT name FROM mydb_master ORDER BY name;", [][]string{{"t"}, {"t_n"}})
+
+	plain := filepath.Join(dir, "shadow_plain.db")
+	_, plainPager := openTestDB(t, plain, store.Options{})
+	plainPager.Close()
+	if _, err := store.OpenPagerWithOptions(plain, store.Options{Shadow: true}); err == nil {
+		t.Errorf("opening a journal mode database in shadow paging mode should fail")
+	}
+}
+
+// newestMeta 返回事务号较大的 meta 页的物理页号
+func newestMeta(t *testing.T, filename string) int {
+	t.Helper()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx1 := binary.LittleEndian.Uint64(data[8:])
+	tx2 := binary.LittleEndian.Uint64(data[store.PageSize+8:])
+	if tx2 > tx1 {
+		return 2
+	}
+	return 1
+}
+
+func TestShadowPagingCrash(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "shadow_crash.db")
+	page := func(s string) []byte {
+		data := make([]byte, store.PageSize)
+		copy(data, s)
+		return data
+	}
+	pager, err := store.OpenPagerWithOptions(filename, store.Options{Shadow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := allocTestPage(t, pager)
+	pager.WritePage(n, page("v1"))
+	pager.WritePage(n, page("v2"))
+
+	// 没有提交的事务在崩溃之后没有任何痕迹
+	if err := pager.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	pager.WritePage(n, page("uncommitted"))
+	pager.WritePage(allocTestPage(t, pager), page("new page"))
+	pager.Close()
+
+	reopen := func() *store.Pager {
+		t.Helper()
+		p, err := store.OpenPager(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	pager = reopen()
+	got, _ := pager.ReadPage(n)
+	if !bytes.HasPrefix(got, []byte("v2")) || pager.PageCount() != n {
+		t.Fatalf("after crash: page %d = %q, %d pages; want v2, %d pages", n, got[:11], pager.PageCount(), n)
+	}
+	pager.Close()
+
+	// 写了一半的 meta 页校验失败，回到上一个版本
+	f, err := os.OpenFile(filename, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("torn"), int64(newestMeta(t, filename)-1)*store.PageSize+100)
+	f.Close()
+	pager = reopen()
+	defer pager.Close()
+	got, _ = pager.ReadPage(n)
+	if !bytes.HasPrefix(got, []byte("v1")) {
+		t.Errorf("after torn meta page: page %d = %q, want v1", n, got[:2])
+	}
+}
+
+func TestShadowPagingSnapshots(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "shadow_snapshot.db")
+	pager, err := store.OpenPagerWithOptions(filename, store.Options{Shadow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.Close()
+	page := func(i int) []byte {
+		data := make([]byte, store.PageSize)
+		data[0] = byte(i)
+		return data
+	}
+	size := func() int64 {
+		info, err := os.Stat(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+
+	n := allocTestPage(t, pager)
+	pager.WritePage(n, page(1))
+	var snaps []*store.Pager
+	for i := 2; i <= 5; i++ {
+		s, err := pager.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		snaps = append(snaps, s)
+		pager.WritePage(n, page(i))
+	}
+	// 每个快照读到的是它建立时的版本
+	for i, s := range snaps {
+		got, err := s.ReadPage(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got[0] != byte(i+1) {
+			t.Errorf("snapshot %d sees version %d", i+1, got[0])
+		}
+		s.Close()
+	}
+
+	// 快照关闭之后旧页被复用，反复改写同一页文件不再增长
+	before := size()
+	for i := 0; i < 50; i++ {
+		pager.WritePage(n, page(i))
+	}
+	if after := size(); after > before+2*store.PageSize {
+		t.Errorf("file grew from %d to %d bytes without open snapshots", before, after)
+	}
+}
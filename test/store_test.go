@@ -1,13 +1,17 @@
 package test
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"mySQLite/store"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
 func TestPager(t *testing.T) {
-	pager, _ := store.OpenPager("data")
+	pager, _ := store.OpenPager(filepath.Join(t.TempDir(), "data"))
 
 	// 写入一页
 	data := make([]byte, store.PageSize)
@@ -21,3 +25,133 @@ func TestPager(t *testing.T) {
 	pager.Close()
 
 }
+
+func TestPagerRollback(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "rollback.db")
+	pager, err := store.OpenPager(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := make([]byte, store.PageSize)
+	copy(page, "original")
+	pager.WritePage(allocTestPage(t, pager), page)
+	pages := pager.PageCount()
+
+	write := func(p *store.Pager) {
+		if err := p.Begin(); err != nil {
+			t.Fatal(err)
+		}
+		changed := make([]byte, store.PageSize)
+		copy(changed, "changed")
+		p.WritePage(2, changed)
+		p.WritePage(allocTestPage(t, p), changed)
+	}
+	check := func(p *store.Pager) {
+		got, _ := p.ReadPage(2)
+		if !bytes.HasPrefix(got, []byte("original")) {
+			t.Errorf("page 2 = %q, want original content", got[:8])
+		}
+		if p.PageCount() != pages {
+			t.Errorf("page count = %d, want %d", p.PageCount(), pages)
+		}
+	}
+
+	write(pager)
+	if err := pager.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	check(pager)
+
+	// 没有提交就关闭，重新打开时根据日志回滚
+	write(pager)
+	pager.Close()
+	pager, err = store.OpenPager(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.Close()
+	check(pager)
+	if _, err := os.Stat(filename + "-journal"); !os.IsNotExist(err) {
+		t.Errorf("journal not removed after recovery")
+	}
+}
+
+func TestPagerSnapshot(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "pager_snapshot.db")
+	pager, err := store.OpenPager(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.Close()
+
+	page := func(s string) []byte {
+		data := make([]byte, store.PageSize)
+		copy(data, s)
+		return data
+	}
+	expect := func(p *store.Pager, pageNum int, want string) {
+		t.Helper()
+		got, err := p.ReadPage(pageNum)
+		if err != nil {
+			t.Fatalf("read page %d: %v", pageNum, err)
+		}
+		if !bytes.HasPrefix(got, []byte(want)) {
+			t.Errorf("page %d = %q, want %q", pageNum, got[:len(want)], want)
+		}
+	}
+
+	n := allocTestPage(t, pager)
+	pager.WritePage(n, page("v1"))
+	s1, err := pager.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s1.Close()
+
+	// 事务之外的写和事务中的写都不影响已有快照
+	pager.WritePage(n, page("v2"))
+	s2, err := pager.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+	if err := pager.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	pager.WritePage(n, page("v3"))
+	extra := allocTestPage(t, pager)
+	pager.WritePage(extra, page("new"))
+
+	// 事务进行中建立的快照看到的是已提交的版本
+	s3, err := pager.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s3.Close()
+	expect(s3, n, "v2")
+	if _, err := s3.ReadPage(extra); err == nil {
+		t.Errorf("page allocated in an uncommitted transaction should not be visible")
+	}
+	if err := pager.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	pager.WritePage(n, page("v4"))
+
+	expect(s1, n, "v1")
+	expect(s2, n, "v2")
+	expect(s3, n, "v2")
+	expect(pager, n, "v4")
+	if s1.PageCount() != n || pager.PageCount() != extra {
+		t.Errorf("page count: snapshot %d, pager %d", s1.PageCount(), pager.PageCount())
+	}
+
+	if err := s1.WritePage(n, page("x")); !errors.Is(err, store.ErrReadOnly) {
+		t.Errorf("write to snapshot: got %v, want ErrReadOnly", err)
+	}
+	if err := s1.Begin(); !errors.Is(err, store.ErrReadOnly) {
+		t.Errorf("begin on snapshot: got %v, want ErrReadOnly", err)
+	}
+	if _, err := s1.AllocatePage(); !errors.Is(err, store.ErrReadOnly) {
+		t.Errorf("allocate on snapshot: got %v, want ErrReadOnly", err)
+	}
+}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"mySQLite/db"
+	"mySQLite/store"
+)
+
+func TestMemoryDatabase(t *testing.T) {
+	for _, shadow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("shadow=%v", shadow), func(t *testing.T) {
+			d, pager := openTestDB(t, store.MemoryDB, store.Options{Shadow: shadow})
+			d.Exec("CREATE TABLE t(id INT, v TEXT);")
+			d.Exec("CREATE INDEX t_v ON t(v);")
+			for i := 0; i < 200; i++ {
+				d.Exec(fmt.Sprintf("INSERT INTO t VALUES (%d, 'value %d');", i, i))
+			}
+			d.Exec("DELETE FROM t WHERE id = '7';")
+			pager.Begin()
+			pager.WritePage(d.Tables["t"].RootPage, store.NewLeafPage().ToBytesMust())
+			pager.Rollback()
+			d.Exec("VACUUM;")
+			assertRows(t, d, "SELECT COUNT(*) FROM t;", [][]string{{"199"}})
+			assertRows(t, d, "SELECT id FROM t WHERE v = 'value 42';", [][]string{{"42"}})
+			assertIntegrityOK(t, d)
+			if _, err := os.Stat(store.MemoryDB); err == nil {
+				t.Fatalf(":memory: created a file on disk")
+			}
+
+			// 每次打开都是新的空数据库
+			other, _ := openTestDB(t, store.MemoryDB, store.Options{})
+			if _, err := other.Query("SELECT * FROM t;"); err == nil {
+				t.Errorf("a second :memory: database sees the first one's tables")
+			}
+		})
+	}
+}
+
+func TestTempTable(t *testing.T) {
+	mem := store.NewMemVFS()
+	d, _ := openTestDB(t, "test_temp.db", store.Options{VFS: mem})
+	d.Exec("CREATE TABLE items(id INT, v TEXT);")
+	d.Exec("INSERT INTO items VALUES (1, 'one'), (2, 'two');")
+
+	d.Exec("CREATE TEMP TABLE picked(id INT, note TEXT);")
+	d.Exec("CREATE INDEX picked_note ON picked(note);")
+	d.Exec("INSERT INTO picked VALUES (2, 'keep'), (3, 'gone');")
+	d.Exec("DELETE FROM picked WHERE id = '3';")
+	assertRows(t, d, "SELECT i.v, p.note FROM items i JOIN picked p ON i.id = p.id;", [][]string{{"two", "keep"}})
+	assertRows(t, d, "SELECT id FROM picked WHERE note = 'keep';", [][]string{{"2"}})
+	assertRows(t, d, "SELECT name FROM mydb_master;", [][]string{{"items"}})
+
+	// 同名的临时表优先，删掉之后又看到普通表
+	d.Exec("CREATE TEMPORARY TABLE items(id INT, v TEXT);")
+	d.Exec("INSERT INTO items VALUES (9, 'temp');")
+	assertRows(t, d, "SELECT v FROM items;", [][]string{{"temp"}})
+	d.Exec("DROP TABLE items;")
+	assertRows(t, d, "SELECT v FROM items;", [][]string{{"one"}, {"two"}})
+
+	// 快照同样包括临时表
+	snap, err := d.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Exec("INSERT INTO picked VALUES (4, 'later');")
+	if rs, err := snap.Query("SELECT COUNT(*) FROM picked;"); err != nil || rs.Rows[0][0].String() != "1" {
+		t.Errorf("snapshot count = %v, %v; want 1", rs, err)
+	}
+	snap.Close()
+	assertRows(t, d, "SELECT COUNT(*) FROM picked;", [][]string{{"2"}})
+
+	// 其他连接看不到，关闭之后丢弃
+	other, _ := openTestDB(t, "test_temp.db", store.Options{VFS: mem})
+	if _, err := other.Query("SELECT * FROM picked;"); err == nil {
+		t.Errorf("another connection sees a temporary table")
+	}
+	assertIntegrityOK(t, d)
+	d.Close()
+	pager, err := store.OpenPagerWithOptions("test_temp.db", store.Options{VFS: mem})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.Close()
+	d = db.NewDatabase(pager)
+	if _, err := d.Query("SELECT * FROM picked;"); err == nil {
+		t.Errorf("temporary table survived closing the connection")
+	}
+	assertRows(t, d, "SELECT COUNT(*) FROM items;", [][]string{{"2"}})
+}
@@ -0,0 +1,217 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mySQLite/db"
+	"mySQLite/store"
+)
+
+// fillVacuumDB 乱序插入数据使叶子分裂后半空，再删掉一张表留下空闲页
+func fillVacuumDB(t *testing.T, d *db.Database) {
+	t.Helper()
+	d.Exec("CREATE TABLE a(id TEXT, n INT, note TEXT);")
+	d.Exec("CREATE INDEX a_n ON a(n);")
+	d.Exec("CREATE TABLE junk(id INT, v TEXT);")
+	for i := 0; i < 20; i++ {
+		var values, junk []string
+		for j := 0; j < 100; j++ {
+			k := i*100 + j
+			values = append(values, fmt.Sprintf("('%05d', %d, '%s')", k*7%2000, k%17, strings.Repeat("x", k%60)))
+			junk = append(junk, fmt.Sprintf("(%d, '%s')", k, strings.Repeat("j", 100)))
+		}
+		d.Exec("INSERT INTO a VALUES " + strings.Join(values, ", ") + ";")
+		d.Exec("INSERT INTO junk VALUES " + strings.Join(junk, ", ") + ";")
+	}
+	for i := 0; i < 2000; i += 3 {
+		d.Exec(fmt.Sprintf("DELETE FROM a WHERE id = '%05d';", i))
+	}
+	d.Exec("CREATE TABLE b(id INT, v TEXT);")
+	d.Exec("INSERT INTO b VALUES (1, 'one'), (2, NULL);")
+	d.Exec("DROP TABLE junk;")
+}
+
+func dumpString(t *testing.T, d *db.Database) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := d.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func assertIntegrityOK(t *testing.T, d *db.Database) {
+	t.Helper()
+	problems, err := d.IntegrityCheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		t.Errorf("unexpected problem: %s", p)
+	}
+}
+
+func TestVacuum(t *testing.T) {
+	for _, shadow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("shadow=%v", shadow), func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "vacuum.db")
+			pager, err := store.OpenPagerWithOptions(filename, store.Options{Shadow: shadow})
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := db.NewDatabase(pager)
+			fillVacuumDB(t, d)
+			want := dumpString(t, d)
+			before := d.Pager.PageCount()
+
+			// 整理之前打开的快照仍然看到原来的页
+			snap, err := d.Snapshot()
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.Exec("VACUUM;")
+			after := d.Pager.PageCount()
+			if after*2 > before {
+				t.Errorf("VACUUM left %d of %d pages", after, before)
+			}
+			if free, _ := d.Pager.FreePages(); len(free) != 0 {
+				t.Errorf("%d free pages after VACUUM", len(free))
+			}
+			if !shadow {
+				if info, _ := os.Stat(filename); info.Size() != int64(after)*store.PageSize {
+					t.Errorf("file has %d bytes, want %d pages", info.Size(), after)
+				}
+			}
+			if got := dumpString(t, d); got != want {
+				t.Errorf("contents changed by VACUUM")
+			}
+			assertIntegrityOK(t, d)
+			rs, err := snap.Query("SELECT COUNT(*) FROM a;")
+			if err != nil || rs.Rows[0][0].String() != "1333" {
+				t.Errorf("snapshot after VACUUM: %v, %v", rs, err)
+			}
+			snap.Close()
+
+			// 重新打开之后内容不变，还可以继续写
+			pager.Close()
+			pager, err = store.OpenPager(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pager.Close()
+			d = db.NewDatabase(pager)
+			if got := dumpString(t, d); got != want {
+				t.Errorf("contents changed after reopening")
+			}
+			d.Exec("INSERT INTO a VALUES ('99999', 1, 'new');")
+			d.Exec("CREATE TABLE c(id INT);")
+			assertRows(t, d, "SELECT id FROM a WHERE n = 1 AND note = 'new';", [][]string{{"99999"}})
+			assertIntegrityOK(t, d)
+		})
+	}
+}
+
+func TestVacuumInto(t *testing.T) {
+	// 要比较磁盘上的文件，不用 createTestDB
+	dir := t.TempDir()
+	src := filepath.Join(dir, "vacuum_src.db")
+	d, _ := openTestDB(t, src, store.Options{})
+	fillVacuumDB(t, d)
+	want := dumpString(t, d)
+	orig, _ := os.ReadFile(src)
+
+	target := filepath.Join(dir, "vacuum_copy.db")
+	d.Exec(fmt.Sprintf("VACUUM INTO '%s';", target))
+
+	if now, _ := os.ReadFile(src); !bytes.Equal(now, orig) {
+		t.Errorf("VACUUM INTO modified the original database")
+	}
+	pager, err := store.OpenPager(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.Close()
+	c := db.NewDatabase(pager)
+	if got := dumpString(t, c); got != want {
+		t.Errorf("copy differs from the original")
+	}
+	if pager.PageCount()*2 > d.Pager.PageCount() {
+		t.Errorf("copy has %d pages, original %d", pager.PageCount(), d.Pager.PageCount())
+	}
+	assertIntegrityOK(t, c)
+
+	if err := d.VacuumInto(target); err == nil {
+		t.Errorf("VACUUM INTO an existing database should fail")
+	}
+}
+
+// openHookVFS 在打开文件时调用 onOpen，用来在操作进行到一半时插入别的连接的操作
+type openHookVFS struct {
+	store.VFS
+	onOpen func(name string)
+}
+
+func (v *openHookVFS) Open(name string) (store.File, error) {
+	if v.onOpen != nil {
+		v.onOpen(name)
+	}
+	return v.VFS.Open(name)
+}
+
+// 一个连接 VACUUM 时另一个连接也开始 VACUUM：临时文件只在写锁中使用，不会删掉对方的副本
+func TestVacuumConcurrent(t *testing.T) {
+	hook := &openHookVFS{VFS: store.NewMemVFS()}
+	d1, _ := openTestDB(t, "test_vacuum_concurrent.db", store.Options{VFS: hook})
+	fillVacuumDB(t, d1)
+	want := dumpString(t, d1)
+	d2, _ := openTestDB(t, "test_vacuum_concurrent.db", store.Options{VFS: hook})
+
+	// d1 建好副本、重新打开它之前，d2 开始 VACUUM
+	done := make(chan error, 1)
+	var opens atomic.Int32
+	hook.onOpen = func(name string) {
+		if strings.HasSuffix(name, "-vacuum") && opens.Add(1) == 2 {
+			go func() { done <- d2.Vacuum() }()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	if err := d1.Vacuum(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []*db.Database{d1, d2} {
+		if got := dumpString(t, d); got != want {
+			t.Fatalf("contents changed after concurrent VACUUM:\n%s", got)
+		}
+		assertIntegrityOK(t, d)
+	}
+	if size, err := hook.Stat("test_vacuum_concurrent.db-vacuum"); err == nil {
+		t.Errorf("temporary file left behind (%d bytes)", size)
+	}
+
+	// 副本不完整时不替换原来的内容。这里在重新打开之前删掉副本，打开的是一个空文件
+	opens.Store(0)
+	hook.onOpen = func(name string) {
+		if strings.HasSuffix(name, "-vacuum") && opens.Add(1) == 2 {
+			hook.Remove(name)
+		}
+	}
+	d1.Exec("DELETE FROM a WHERE id = '00001';")
+	want = dumpString(t, d1)
+	if err := d1.Vacuum(); err == nil {
+		t.Errorf("VACUUM with an incomplete copy should fail")
+	}
+	if got := dumpString(t, d1); got != want {
+		t.Fatalf("contents changed after a failed VACUUM:\n%s", got)
+	}
+	assertIntegrityOK(t, d1)
+}
@@ -0,0 +1,163 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"mySQLite/db"
+	"mySQLite/store"
+)
+
+func TestMemVFS(t *testing.T) {
+	for _, shadow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("shadow=%v", shadow), func(t *testing.T) {
+			mem := store.NewMemVFS()
+			filename := "test_mem_vfs.db"
+			d, pager := openTestDB(t, filename, store.Options{Shadow: shadow, VFS: mem})
+			d.Exec("CREATE TABLE t(id INT, v TEXT);")
+			d.Exec("INSERT INTO t VALUES (1, 'one'), (2, 'two');")
+			if _, err := os.Stat(filename); err == nil {
+				t.Fatalf("MemVFS created a file on disk")
+			}
+
+			// 同一个 MemVFS 中的第二个连接看到同样的内容，锁同样互斥
+			other, otherPager := openTestDB(t, filename, store.Options{VFS: mem})
+			assertRows(t, other, "SELECT v FROM t;", [][]string{{"one"}, {"two"}})
+			otherPager.SetBusyTimeout(0)
+			pager.Begin()
+			if err := otherPager.BeginRead(); !errors.Is(err, store.ErrBusy) {
+				t.Errorf("reading while another connection writes: got %v, want ErrBusy", err)
+			} else if err == nil {
+				otherPager.EndRead()
+			}
+			pager.Rollback()
+			d.Exec("INSERT INTO t VALUES (3, 'three');")
+			assertRows(t, other, "SELECT COUNT(*) FROM t;", [][]string{{"3"}})
+			d.Exec("VACUUM;")
+			assertIntegrityOK(t, other)
+		})
+	}
+}
+
+// openFaultDB 在 MemVFS 中建立有一行数据的数据库，再通过 FaultVFS 打开
+func openFaultDB(t *testing.T, shadow bool) (*store.FaultVFS, *db.Database, *store.Pager) {
+	t.Helper()
+	mem := store.NewMemVFS()
+	d, pager := openTestDB(t, "fault.db", store.Options{Shadow: shadow, VFS: mem})
+	d.Exec("CREATE TABLE t(id INT, v TEXT);")
+	d.Exec("INSERT INTO t VALUES (1, 'one');")
+	pager.Close()
+	fv := store.NewFaultVFS(mem)
+	d, pager = openTestDB(t, "fault.db", store.Options{VFS: fv})
+	return fv, d, pager
+}
+
+func TestFaultVFS(t *testing.T) {
+	for _, shadow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("shadow=%v", shadow), func(t *testing.T) {
+			before := [][]string{{"1"}}
+			after := [][]string{{"1"}, {"2"}}
+
+			// 每一次写、截断、Sync 或删除时崩溃，重启之后要么是原来的内容，要么是提交之后的内容
+			for k := 1; ; k++ {
+				fv, d, pager := openFaultDB(t, shadow)
+				fv.SetFault(store.Fault{At: k, Kind: store.FaultCrash})
+				d.Exec("INSERT INTO t VALUES (2, 'two');")
+				crashed := fv.Crashed()
+				pager.Close()
+				if err := fv.Restart(); err != nil {
+					t.Fatal(err)
+				}
+				d, _ = openTestDB(t, "fault.db", store.Options{VFS: fv})
+				rs, err := d.Query("SELECT id FROM t;")
+				if err != nil {
+					t.Fatalf("crash at operation %d: %v", k, err)
+				}
+				got := rows(rs)
+				if fmt.Sprint(got) != fmt.Sprint(before) && fmt.Sprint(got) != fmt.Sprint(after) || !crashed && fmt.Sprint(got) != fmt.Sprint(after) {
+					t.Fatalf("crash at operation %d: got %v", k, got)
+				}
+				assertIntegrityOK(t, d)
+				if !crashed {
+					break
+				}
+			}
+
+			// Sync 失败和只写了一半的页：语句失败，数据库不变
+			for _, kind := range []store.FaultKind{store.FaultError, store.FaultShortWrite} {
+				for k := 1; k <= 4; k++ {
+					fv, d, _ := openFaultDB(t, shadow)
+					fv.SetFault(store.Fault{At: k, Kind: kind})
+					d.Exec("INSERT INTO t VALUES (2, 'two');")
+					rs, err := d.Query("SELECT id FROM t;")
+					if err != nil || fmt.Sprint(rows(rs)) != fmt.Sprint(before) && fmt.Sprint(rows(rs)) != fmt.Sprint(after) {
+						t.Fatalf("fault %d at operation %d: got %v, %v", kind, k, rs, err)
+					}
+					assertIntegrityOK(t, d)
+				}
+			}
+		})
+	}
+}
+
+// 影子分页模式提交时的写或 Sync 出错之后，同一个连接接着写，再在任意一次操作时崩溃：
+// 出错的提交写出的 meta 页可能已经在磁盘上，它引用的页不能被之后的写覆盖，
+// 否则重启之后用这个 meta 页时会看到之后没有提交的修改
+func TestShadowCommitError(t *testing.T) {
+	for k := 1; ; k++ {
+		faulted := false
+		for c := 1; ; c++ {
+			fv, d, pager := openFaultDB(t, true)
+			fv.SetFault(store.Fault{At: k, Kind: store.FaultError})
+			err2 := d.Exec("INSERT INTO t VALUES (2, 'two');")
+			faulted = fv.Ops() >= k
+			fv.SetFault(store.Fault{At: c, Kind: store.FaultCrash})
+			err3 := d.Exec("INSERT INTO t VALUES (3, 'three');")
+			crashed := fv.Crashed()
+			if errors.Is(err2, store.ErrCommitUnknown) && !errors.Is(err3, store.ErrCommitUnknown) {
+				t.Fatalf("error at operation %d: write after an unknown commit result should fail until reopen, got %v", k, err3)
+			}
+			pager.Close()
+			if err := fv.Restart(); err != nil {
+				t.Fatal(err)
+			}
+			pager, err := store.OpenPagerWithOptions("fault.db", store.Options{VFS: fv})
+			if err != nil {
+				t.Fatalf("error at operation %d, crash at operation %d: %v", k, c, err)
+			}
+			d = db.NewDatabase(pager)
+			rs, err := d.Query("SELECT id FROM t;")
+			if err != nil {
+				t.Fatalf("error at operation %d, crash at operation %d: %v", k, c, err)
+			}
+			// 失败的插入在重启之后都不能出现
+			for _, row := range rows(rs) {
+				if row[0] == "2" && err2 != nil || row[0] == "3" && err3 != nil {
+					t.Fatalf("error at operation %d, crash at operation %d: failed insert of %s is visible after restart", k, c, row[0])
+				}
+			}
+			assertIntegrityOK(t, d)
+			pager.Close()
+			if !crashed {
+				break
+			}
+		}
+		if !faulted {
+			break
+		}
+	}
+}
+
+func rows(rs *db.ResultSet) [][]string {
+	var out [][]string
+	for _, row := range rs.Rows {
+		var r []string
+		for _, v := range row {
+			r = append(r, v.String())
+		}
+		out = append(out, r)
+	}
+	return out
+}